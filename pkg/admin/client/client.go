@@ -6,8 +6,14 @@ import (
 	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/gossip"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type Client struct {
@@ -35,7 +41,18 @@ func Connect(addr string, opts ...Option) (*Client, error) {
 	}, nil
 }
 
-func (c *Client) Members(ctx context.Context) ([]*rpc.Member2, error) {
+// Members lists the members in the given namespace. If the namespace is empty
+// the servers default namespace is used, or '*' lists members in all
+// namespaces. If query is not empty, only members matching the query
+// expression are returned.
+func (c *Client) Members(ctx context.Context, namespace string, query string) ([]*rpc.Member2, error) {
+	if namespace != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, server.NamespaceMetadataKey, namespace)
+	}
+	if query != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, server.QueryMetadataKey, query)
+	}
+
 	resp, err := c.client.Members(ctx, &rpc.MembersRequest{})
 	if err != nil {
 		return nil, fmt.Errorf("admin client: members: %w", err)
@@ -57,6 +74,68 @@ func (c *Client) Member(ctx context.Context, id string) (*rpc.Member2, error) {
 	return resp.Member, nil
 }
 
+// Nodes returns the Fuddle nodes in the cluster along with their gossiped
+// metadata, keyed by node ID.
+func (c *Client) Nodes(ctx context.Context) (map[string]gossip.Node, error) {
+	resp := &structpb.Struct{}
+	if err := c.conn.Invoke(
+		ctx, gossip.NodesListNodesMethod, &emptypb.Empty{}, resp,
+	); err != nil {
+		return nil, fmt.Errorf("admin client: nodes: %w", err)
+	}
+	nodes, err := gossip.DecodeNodes(resp)
+	if err != nil {
+		return nil, fmt.Errorf("admin client: nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+// InstallKey installs the base64 encoded gossip encryption key on every node
+// in the cluster, so nodes accept gossip traffic encrypted with the key.
+func (c *Client) InstallKey(ctx context.Context, key string) error {
+	if err := c.conn.Invoke(
+		ctx, gossip.KeyringInstallKeyMethod, wrapperspb.String(key), &emptypb.Empty{},
+	); err != nil {
+		return fmt.Errorf("admin client: install key: %w", err)
+	}
+	return nil
+}
+
+// UseKey sets the primary gossip encryption key on every node in the cluster,
+// which is used to encrypt outgoing gossip traffic. The key must already be
+// installed.
+func (c *Client) UseKey(ctx context.Context, key string) error {
+	if err := c.conn.Invoke(
+		ctx, gossip.KeyringUseKeyMethod, wrapperspb.String(key), &emptypb.Empty{},
+	); err != nil {
+		return fmt.Errorf("admin client: use key: %w", err)
+	}
+	return nil
+}
+
+// RemoveKey removes the gossip encryption key from every node in the cluster.
+// The primary key can't be removed.
+func (c *Client) RemoveKey(ctx context.Context, key string) error {
+	if err := c.conn.Invoke(
+		ctx, gossip.KeyringRemoveKeyMethod, wrapperspb.String(key), &emptypb.Empty{},
+	); err != nil {
+		return fmt.Errorf("admin client: remove key: %w", err)
+	}
+	return nil
+}
+
+// ListKeys returns the gossip encryption keys installed on each node in the
+// cluster, keyed by node ID.
+func (c *Client) ListKeys(ctx context.Context) (map[string]gossip.NodeKeys, error) {
+	resp := &structpb.Struct{}
+	if err := c.conn.Invoke(
+		ctx, gossip.KeyringListKeysMethod, &emptypb.Empty{}, resp,
+	); err != nil {
+		return nil, fmt.Errorf("admin client: list keys: %w", err)
+	}
+	return gossip.DecodeNodeKeys(resp), nil
+}
+
 func (c *Client) Close() {
 	c.conn.Close()
 }
@@ -10,6 +10,7 @@ import (
 type options struct {
 	listener  net.Listener
 	collector *metrics.PromCollector
+	ready     func() bool
 	logger    *zap.Logger
 }
 
@@ -49,6 +50,20 @@ func WithCollector(c *metrics.PromCollector) Option {
 	return collectorOption{collector: c}
 }
 
+type readyOption struct {
+	ready func() bool
+}
+
+func (o readyOption) apply(opts *options) {
+	opts.ready = o.ready
+}
+
+// WithReady sets the check used by the /ready endpoint to return whether the
+// node is ready to accept client traffic.
+func WithReady(ready func() bool) Option {
+	return readyOption{ready: ready}
+}
+
 type loggerOption struct {
 	Log *zap.Logger
 }
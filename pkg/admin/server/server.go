@@ -38,6 +38,20 @@ func NewServer(conf *config.Config, opts ...Option) (*Server, error) {
 		)
 	}
 
+	if options.ready != nil {
+		ready := options.ready
+		// Responds with 200 once the node is ready to accept client traffic,
+		// otherwise 503, so can be used as a readiness probe.
+		mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+			if !ready() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte("not ready\n"))
+				return
+			}
+			_, _ = w.Write([]byte("ready\n"))
+		})
+	}
+
 	s := &Server{
 		logger: options.logger,
 	}
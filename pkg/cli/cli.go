@@ -4,6 +4,7 @@ import (
 	"github.com/fuddle-io/fuddle/pkg/cli/demo"
 	"github.com/fuddle-io/fuddle/pkg/cli/fcm"
 	"github.com/fuddle-io/fuddle/pkg/cli/info"
+	"github.com/fuddle-io/fuddle/pkg/cli/keys"
 	"github.com/fuddle-io/fuddle/pkg/cli/start"
 	"github.com/spf13/cobra"
 )
@@ -25,6 +26,7 @@ func init() {
 	fuddleCmd.AddCommand(
 		start.Command,
 		info.Command,
+		keys.Command,
 		demo.Command,
 		fcm.Command,
 	)
@@ -16,12 +16,13 @@ var Command = &cobra.Command{
 }
 
 func run(cmd *cobra.Command, args []string) {
+	nodeClock := client.NodeClock{Offset: clockOffset, Frozen: frozenClock}
 	client := client.NewClient(addr)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
-	nodesInfo, err := client.AddNodes(ctx, clusterID, fuddleNodes, clientNodes)
+	nodesInfo, err := client.AddNodes(ctx, clusterID, fuddleNodes, clientNodes, nodeClock)
 	if err != nil {
 		fmt.Println(err)
 		return
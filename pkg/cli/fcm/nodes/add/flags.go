@@ -1,11 +1,18 @@
 package add
 
+import (
+	"time"
+)
+
 var (
 	clusterID string
 
 	fuddleNodes int
 	clientNodes int
 
+	clockOffset time.Duration
+	frozenClock bool
+
 	addr string
 )
 
@@ -32,6 +39,19 @@ func init() {
 		"number of client nodes to add",
 	)
 
+	Command.Flags().DurationVarP(
+		&clockOffset,
+		"clock-offset", "",
+		0,
+		"offset added to the clock of the added Fuddle nodes",
+	)
+	Command.Flags().BoolVarP(
+		&frozenClock,
+		"frozen-clock", "",
+		false,
+		"whether to freeze the clock of the added Fuddle nodes",
+	)
+
 	Command.Flags().StringVarP(
 		&addr,
 		"addr", "",
@@ -7,6 +7,9 @@ import (
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	admin "github.com/fuddle-io/fuddle/pkg/admin/client"
+	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/fuddle-io/fuddle/pkg/gossip"
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
 	"github.com/rodaine/table"
 	"github.com/spf13/cobra"
 )
@@ -23,6 +26,15 @@ var clusterCommand = &cobra.Command{
 Inspect the status of the cluster.
 
 Displays an overview of the cluster status and a list of members in the cluster.
+
+Only members in the given namespace are listed, or use '*' to list members in
+all namespaces:
+
+  fuddle info cluster --namespace '*'
+
+The members can be filtered with a query, such as:
+
+  fuddle info cluster --query 'service = "clock" and liveness = up'
 `,
 	RunE: runClusterStatus,
 }
@@ -36,10 +48,23 @@ Inspect the status of a member.
 	RunE: runMemberStatus,
 }
 
+var nodesCommand = &cobra.Command{
+	Use:   "nodes",
+	Short: "inspect the Fuddle nodes in the cluster",
+	Long: `
+Inspect the Fuddle nodes in the cluster.
+
+Lists the Fuddle nodes known by the queried node, along with the metadata each
+node gossips, such as its addresses, mode and version.
+`,
+	RunE: runNodesStatus,
+}
+
 func init() {
 	Command.AddCommand(
 		clusterCommand,
 		memberCommand,
+		nodesCommand,
 	)
 }
 
@@ -48,7 +73,7 @@ func runClusterStatus(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	members, err := client.Members(context.Background())
+	members, err := client.Members(context.Background(), namespace, query)
 	if err != nil {
 		return err
 	}
@@ -75,6 +100,7 @@ func runMemberStatus(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Println("ID:", member.State.Id)
+	fmt.Println("Namespace:", registry.MemberNamespace(member.State))
 	fmt.Println("Status:", member.State.Status)
 	fmt.Println("Service:", member.State.Service)
 	fmt.Println("Locality:")
@@ -96,12 +122,62 @@ func runMemberStatus(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runNodesStatus(cmd *cobra.Command, args []string) error {
+	client, err := admin.Connect(addr)
+	if err != nil {
+		return err
+	}
+	nodes, err := client.Nodes(context.Background())
+	if err != nil {
+		return err
+	}
+
+	displayNodes(nodes)
+
+	return nil
+}
+
+func displayNodes(nodes map[string]gossip.Node) {
+	var ids []string
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tbl := table.New("ID", "Mode", "Gateway", "RPC", "Admin", "Version", "Protocol", "Locality")
+	for _, id := range ids {
+		node := nodes[id]
+		tbl.AddRow(
+			node.ID,
+			node.Mode,
+			node.Gateway,
+			node.RPCAddr,
+			node.AdminAddr,
+			node.Version,
+			node.ProtocolVersion,
+			formatLocality(node.Locality),
+		)
+	}
+
+	tbl.Print()
+}
+
+func formatLocality(locality config.Locality) string {
+	if locality.AvailabilityZone == "" {
+		return locality.Region
+	}
+	if locality.Region == "" {
+		return locality.AvailabilityZone
+	}
+	return locality.Region + "/" + locality.AvailabilityZone
+}
+
 func displayMembers(members []*rpc.Member2) {
 	sort.Slice(members, func(i, j int) bool {
 		return members[i].State.Id < members[j].State.Id
 	})
 
-	tbl := table.New("ID", "Status", "Service", "Locality", "Created", "Revision")
+	tbl := table.New("ID", "Namespace", "Status", "Service", "Locality", "Created", "Revision")
 	for _, member := range members {
 		availabilityZone := ""
 		if member.State.Locality != nil {
@@ -109,6 +185,7 @@ func displayMembers(members []*rpc.Member2) {
 		}
 		tbl.AddRow(
 			member.State.Id,
+			registry.MemberNamespace(member.State),
 			member.State.Status,
 			member.State.Service,
 			availabilityZone,
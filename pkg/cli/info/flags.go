@@ -3,6 +3,12 @@ package info
 var (
 	// addr is the Fuddle registry server to query.
 	addr string
+
+	// namespace is the namespace to list members from.
+	namespace string
+
+	// query is a member query expression to filter the listed members.
+	query string
 )
 
 func init() {
@@ -12,4 +18,17 @@ func init() {
 		"localhost:8110",
 		"address of the Fuddle server to query",
 	)
+
+	clusterCommand.Flags().StringVarP(
+		&namespace,
+		"namespace", "n",
+		"default",
+		"the namespace to list members from ('*' lists members in all namespaces)",
+	)
+	clusterCommand.Flags().StringVarP(
+		&query,
+		"query", "q",
+		"",
+		"only list members matching the query (such as 'service = \"clock\" and liveness = up')",
+	)
 }
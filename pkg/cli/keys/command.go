@@ -0,0 +1,135 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	admin "github.com/fuddle-io/fuddle/pkg/admin/client"
+	"github.com/fuddle-io/fuddle/pkg/gossip"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+)
+
+var Command = &cobra.Command{
+	Use:   "keys",
+	Short: "manage the gossip encryption keys of the cluster",
+	Long: `
+Manage the gossip encryption keys of the cluster.
+
+Changes are applied to every node in the cluster, so keys can be rotated
+without downtime by installing the new key, using the new key as the primary
+key, then removing the old key:
+
+  fuddle keys install <new-key>
+  fuddle keys use <new-key>
+  fuddle keys remove <old-key>
+
+If a change fails on any node it can be safely retried.
+`,
+}
+
+var installCommand = &cobra.Command{
+	Use:   "install [key]",
+	Short: "install a key on every node",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withClient(func(ctx context.Context, client *admin.Client) error {
+			return client.InstallKey(ctx, args[0])
+		})
+	},
+}
+
+var useCommand = &cobra.Command{
+	Use:   "use [key]",
+	Short: "use an installed key as the primary key on every node",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withClient(func(ctx context.Context, client *admin.Client) error {
+			return client.UseKey(ctx, args[0])
+		})
+	},
+}
+
+var removeCommand = &cobra.Command{
+	Use:   "remove [key]",
+	Short: "remove a key from every node",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withClient(func(ctx context.Context, client *admin.Client) error {
+			return client.RemoveKey(ctx, args[0])
+		})
+	},
+}
+
+var listCommand = &cobra.Command{
+	Use:   "list",
+	Short: "list the keys installed on each node",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withClient(func(ctx context.Context, client *admin.Client) error {
+			nodes, err := client.ListKeys(ctx)
+			if err != nil {
+				return err
+			}
+			displayKeys(nodes)
+			return nil
+		})
+	},
+}
+
+var generateCommand = &cobra.Command{
+	Use:   "generate",
+	Short: "generate a new key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := gossip.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	},
+}
+
+func init() {
+	Command.AddCommand(
+		installCommand,
+		useCommand,
+		removeCommand,
+		listCommand,
+		generateCommand,
+	)
+}
+
+func withClient(f func(ctx context.Context, client *admin.Client) error) error {
+	client, err := admin.Connect(addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	return f(ctx, client)
+}
+
+func displayKeys(nodes map[string]gossip.NodeKeys) {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tbl := table.New("Node", "Primary", "Keys")
+	for _, id := range ids {
+		tbl.AddRow(
+			id,
+			nodes[id].Primary,
+			strings.Join(nodes[id].Keys, ", "),
+		)
+	}
+
+	tbl.Print()
+}
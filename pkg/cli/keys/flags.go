@@ -0,0 +1,15 @@
+package keys
+
+var (
+	// addr is the Fuddle server to manage the keyring of.
+	addr string
+)
+
+func init() {
+	Command.PersistentFlags().StringVarP(
+		&addr,
+		"addr", "a",
+		"localhost:8110",
+		"address of the Fuddle server to manage",
+	)
+}
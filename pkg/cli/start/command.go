@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/fuddle-io/fuddle/pkg/config"
 	"github.com/fuddle-io/fuddle/pkg/logger"
@@ -23,6 +24,13 @@ var Command = &cobra.Command{
 func run(cmd *cobra.Command, args []string) {
 	conf := config.DefaultConfig()
 
+	conf.Mode = mode
+
+	if err := conf.ApplyProfile(profile); err != nil {
+		fmt.Println("failed to start node:", err)
+		os.Exit(1)
+	}
+
 	conf.Gossip.BindAddr = gossipBindAddr
 	conf.Gossip.BindPort = gossipBindPort
 	if gossipAdvAddr != "" {
@@ -39,6 +47,31 @@ func run(cmd *cobra.Command, args []string) {
 	if gossipSeeds != "" {
 		conf.Gossip.Seeds = strings.Split(gossipSeeds, ",")
 	}
+	conf.Gossip.SeedDNS = gossipSeedDNS
+	conf.Gossip.SeedSRV = gossipSeedSRV
+	conf.Gossip.SeedFile = gossipSeedFile
+	conf.Gossip.PeersFile = gossipPeersFile
+	conf.Gossip.JoinBackoff = gossipJoinBackoff
+	conf.Gossip.JoinBackoffMax = gossipJoinBackoffMax
+	conf.Gossip.RejoinInterval = gossipRejoinInterval
+	// The gossip tunables default to the profile unless their flags are set.
+	if cmd.Flags().Changed("gossip-probe-interval") {
+		conf.Gossip.ProbeInterval = gossipProbeInterval
+	}
+	if cmd.Flags().Changed("gossip-probe-timeout") {
+		conf.Gossip.ProbeTimeout = gossipProbeTimeout
+	}
+	if cmd.Flags().Changed("gossip-suspicion-mult") {
+		conf.Gossip.SuspicionMult = gossipSuspicionMult
+	}
+	if cmd.Flags().Changed("gossip-nodes") {
+		conf.Gossip.GossipNodes = gossipNodes
+	}
+	if cmd.Flags().Changed("gossip-interval") {
+		conf.Gossip.GossipInterval = gossipInterval
+	}
+	conf.Gossip.EncryptionKey = gossipEncryptionKey
+	conf.Gossip.KeyringFile = gossipKeyringFile
 
 	conf.RPC.BindAddr = rpcBindAddr
 	conf.RPC.BindPort = rpcBindPort
@@ -52,6 +85,7 @@ func run(cmd *cobra.Command, args []string) {
 	} else {
 		conf.RPC.AdvPort = rpcBindPort
 	}
+	conf.RPC.DrainWindow = drainWindow
 
 	conf.Admin.BindAddr = adminBindAddr
 	conf.Admin.BindPort = adminBindPort
@@ -66,9 +100,53 @@ func run(cmd *cobra.Command, args []string) {
 		conf.Admin.AdvPort = adminBindPort
 	}
 
+	// Only override the registry config when the flags are set, so the
+	// config defaults and profile apply otherwise.
+	if cmd.Flags().Changed("heartbeat-timeout") {
+		conf.Registry.HeartbeatTimeout = heartbeatTimeout
+	}
+	if cmd.Flags().Changed("reconnect-timeout") {
+		conf.Registry.ReconnectTimeout = reconnectTimeout
+	}
+	if cmd.Flags().Changed("tombstone-timeout") {
+		conf.Registry.TombstoneTimeout = tombstoneTimeout
+	}
+	if cmd.Flags().Changed("failure-detector-interval") {
+		conf.Registry.FailureDetectorInterval = failureDetectorInterval
+	}
+	if cmd.Flags().Changed("repair-interval") {
+		conf.Registry.RepairInterval = repairInterval
+	}
+	conf.Registry.DataDir = dataDir
+	conf.Registry.SnapshotInterval = snapshotInterval
+	conf.Registry.SubscriberQueueLimit = subscriberQueueLimit
+	conf.Registry.SubscriberOverflowPolicy = subscriberOverflowPolicy
+	conf.Registry.MaxClockDrift = maxClockDrift
+	conf.Registry.ClockDriftPolicy = clockDriftPolicy
+	conf.Registry.ChangeFeedLimit = changeFeedLimit
+	conf.Registry.MaxMemberIDLength = maxMemberIDLength
+	conf.Registry.MemberIDCharset = memberIDCharset
+	conf.Registry.MaxMemberMetadataEntries = maxMemberMetadataEntries
+	conf.Registry.MaxMemberMetadataBytes = maxMemberMetadataBytes
+	conf.Registry.RequireMemberService = requireMemberService
+	conf.Registry.BootstrapTimeout = bootstrapTimeout
+	conf.Registry.V2Enabled = registryV2
+
+	for _, s := range federatedClusters {
+		cluster, err := config.ParseFederatedCluster(s)
+		if err != nil {
+			fmt.Println("failed to start node:", err)
+			os.Exit(1)
+		}
+		conf.Federation.Clusters = append(conf.Federation.Clusters, cluster)
+	}
+
+	conf.Locality.Region = region
+	conf.Locality.AvailabilityZone = availabilityZone
+
 	// Catch signals so to gracefully shutdown the server.
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
 
 	node, err := node.NewNode(
 		conf,
@@ -76,6 +154,7 @@ func run(cmd *cobra.Command, args []string) {
 	)
 	if err != nil {
 		fmt.Println("failed to start node:", err)
+		os.Exit(1)
 	}
 	defer node.Shutdown()
 
@@ -1,27 +1,100 @@
 package start
 
+import (
+	"time"
+
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
+)
+
 var (
+	mode    string
+	profile string
+
 	gossipBindAddr string
 	gossipBindPort int
 	gossipAdvAddr  string
 	gossipAdvPort  int
 
-	gossipSeeds string
+	gossipSeeds    string
+	gossipSeedDNS  []string
+	gossipSeedSRV  []string
+	gossipSeedFile string
+
+	gossipPeersFile      string
+	gossipJoinBackoff    time.Duration
+	gossipJoinBackoffMax time.Duration
+	gossipRejoinInterval time.Duration
+
+	gossipProbeInterval time.Duration
+	gossipProbeTimeout  time.Duration
+	gossipSuspicionMult int
+	gossipNodes         int
+	gossipInterval      time.Duration
+
+	gossipEncryptionKey string
+	gossipKeyringFile   string
 
 	rpcBindAddr string
 	rpcBindPort int
 	rpcAdvAddr  string
 	rpcAdvPort  int
 
+	drainWindow time.Duration
+
 	adminBindAddr string
 	adminBindPort int
 	adminAdvAddr  string
 	adminAdvPort  int
 
+	heartbeatTimeout        time.Duration
+	reconnectTimeout        time.Duration
+	tombstoneTimeout        time.Duration
+	failureDetectorInterval time.Duration
+	repairInterval          time.Duration
+
+	dataDir          string
+	snapshotInterval time.Duration
+
+	subscriberQueueLimit     int
+	subscriberOverflowPolicy string
+
+	maxClockDrift    time.Duration
+	clockDriftPolicy string
+
+	changeFeedLimit int
+
+	maxMemberIDLength        int
+	memberIDCharset          string
+	maxMemberMetadataEntries int
+	maxMemberMetadataBytes   int
+	requireMemberService     bool
+
+	bootstrapTimeout time.Duration
+
+	registryV2 bool
+
+	federatedClusters []string
+
+	region           string
+	availabilityZone string
+
 	logLevel string
 )
 
 func init() {
+	Command.Flags().StringVarP(
+		&mode,
+		"mode", "",
+		"full",
+		"the mode to run the node in (one of 'full', 'cache')",
+	)
+	Command.Flags().StringVarP(
+		&profile,
+		"profile", "",
+		"lan",
+		"the profile to tune gossip and failure detection for (one of 'lan', 'wan', 'local'), which can be overridden by the individual flags",
+	)
+
 	Command.Flags().StringVarP(
 		&gossipBindAddr,
 		"gossip-bind-addr", "",
@@ -54,6 +127,91 @@ func init() {
 		"",
 		"gossip addresses in the target cluster to join",
 	)
+	Command.Flags().StringArrayVarP(
+		&gossipSeedDNS,
+		"join-dns", "",
+		nil,
+		"a dns name to resolve to gossip addresses to join, in the format '<name>:<port>' (may be repeated)",
+	)
+	Command.Flags().StringArrayVarP(
+		&gossipSeedSRV,
+		"join-srv", "",
+		nil,
+		"a dns srv name to resolve to gossip addresses to join (may be repeated)",
+	)
+	Command.Flags().StringVarP(
+		&gossipSeedFile,
+		"join-file", "",
+		"",
+		"a file containing gossip addresses to join, one per line, which is watched for changes",
+	)
+	Command.Flags().StringVarP(
+		&gossipPeersFile,
+		"gossip-peers-file", "",
+		"",
+		"the file to persist the known gossip peers to, which are rejoined when the node restarts",
+	)
+	Command.Flags().DurationVarP(
+		&gossipJoinBackoff,
+		"gossip-join-backoff", "",
+		time.Millisecond*500,
+		"the initial backoff when retrying to join the cluster, which doubles after each attempt",
+	)
+	Command.Flags().DurationVarP(
+		&gossipJoinBackoffMax,
+		"gossip-join-backoff-max", "",
+		time.Second*30,
+		"the maximum backoff when retrying to join the cluster",
+	)
+	Command.Flags().DurationVarP(
+		&gossipRejoinInterval,
+		"gossip-rejoin-interval", "",
+		time.Second*30,
+		"the interval to rejoin seeds and peers that aren't known members of the cluster to heal partitions (0 to disable)",
+	)
+	Command.Flags().DurationVarP(
+		&gossipProbeInterval,
+		"gossip-probe-interval", "",
+		0,
+		"the interval to probe a random node to detect failed nodes (defaults to the profile)",
+	)
+	Command.Flags().DurationVarP(
+		&gossipProbeTimeout,
+		"gossip-probe-timeout", "",
+		0,
+		"the time to wait for a probed node to respond before probing it indirectly (defaults to the profile)",
+	)
+	Command.Flags().IntVarP(
+		&gossipSuspicionMult,
+		"gossip-suspicion-mult", "",
+		0,
+		"the multiplier of the time a suspected node has to refute the suspicion before it is considered failed (defaults to the profile)",
+	)
+	Command.Flags().IntVarP(
+		&gossipNodes,
+		"gossip-nodes", "",
+		0,
+		"the number of random nodes to gossip to each gossip interval (defaults to the profile)",
+	)
+	Command.Flags().DurationVarP(
+		&gossipInterval,
+		"gossip-interval", "",
+		0,
+		"the interval to gossip to random nodes (defaults to the profile)",
+	)
+
+	Command.Flags().StringVarP(
+		&gossipEncryptionKey,
+		"gossip-encryption-key", "",
+		"",
+		"a base64 encoded 16, 24 or 32 byte key to encrypt gossip traffic (see 'fuddle keys generate')",
+	)
+	Command.Flags().StringVarP(
+		&gossipKeyringFile,
+		"gossip-keyring-file", "",
+		"",
+		"the file to persist the gossip encryption keyring to, which takes precedence over the encryption key if it exists",
+	)
 
 	Command.Flags().StringVarP(
 		&rpcBindAddr,
@@ -80,6 +238,12 @@ func init() {
 		0,
 		"the advertised port for rpc traffic (defaults to the bind addr)",
 	)
+	Command.Flags().DurationVarP(
+		&drainWindow,
+		"drain-window", "",
+		time.Second*10,
+		"the time to gradually close client connections over when shutting down",
+	)
 
 	Command.Flags().StringVarP(
 		&adminBindAddr,
@@ -107,6 +271,149 @@ func init() {
 		"the advertised port for admin traffic (defaults to the bind addr)",
 	)
 
+	Command.Flags().DurationVarP(
+		&heartbeatTimeout,
+		"heartbeat-timeout", "",
+		time.Second*20,
+		"the time a member has to send a heartbeat before it is considered down",
+	)
+	Command.Flags().DurationVarP(
+		&reconnectTimeout,
+		"reconnect-timeout", "",
+		time.Minute*5,
+		"the time a down member has to reconnect before it is removed",
+	)
+	Command.Flags().DurationVarP(
+		&tombstoneTimeout,
+		"tombstone-timeout", "",
+		time.Minute*30,
+		"the time members that have left are kept before being removed, which must be at least the heartbeat timeout plus the reconnect timeout",
+	)
+	Command.Flags().DurationVarP(
+		&failureDetectorInterval,
+		"failure-detector-interval", "",
+		0,
+		"the interval to check for members that have exceeded their timeouts (defaults to the profile)",
+	)
+	Command.Flags().DurationVarP(
+		&repairInterval,
+		"repair-interval", "",
+		0,
+		"the interval to sync the registry with a random node to repair missed updates (defaults to the profile)",
+	)
+
+	Command.Flags().StringVarP(
+		&dataDir,
+		"data-dir", "",
+		"",
+		"the directory to persist the registry state (if empty the registry is only kept in memory)",
+	)
+	Command.Flags().DurationVarP(
+		&snapshotInterval,
+		"snapshot-interval", "",
+		time.Minute*5,
+		"the interval to compact the persisted registry state by writing a snapshot",
+	)
+
+	Command.Flags().IntVarP(
+		&subscriberQueueLimit,
+		"subscriber-queue-limit", "",
+		1024,
+		"the maximum number of updates queued for each client subscriber",
+	)
+	Command.Flags().StringVarP(
+		&subscriberOverflowPolicy,
+		"subscriber-overflow-policy", "",
+		"disconnect",
+		"how to handle subscribers whose queue is full (one of 'disconnect', 'resync')",
+	)
+
+	Command.Flags().DurationVarP(
+		&maxClockDrift,
+		"max-clock-drift", "",
+		time.Minute,
+		"the maximum time a peers clock may be ahead of the local clock (0 disables the check)",
+	)
+	Command.Flags().StringVarP(
+		&clockDriftPolicy,
+		"clock-drift-policy", "",
+		"reject",
+		"how to handle updates from peers whose clock exceeds the max drift (one of 'flag', 'reject')",
+	)
+
+	Command.Flags().IntVarP(
+		&changeFeedLimit,
+		"change-feed-limit", "",
+		4096,
+		"the maximum number of updates kept for subscribers to resume from when they reconnect (0 disables resuming)",
+	)
+
+	defaultMemberLimits := registry.DefaultMemberLimits()
+	Command.Flags().IntVarP(
+		&maxMemberIDLength,
+		"max-member-id-length", "",
+		defaultMemberLimits.MaxIDLength,
+		"the maximum length of a registered member id (0 means no limit)",
+	)
+	Command.Flags().StringVarP(
+		&memberIDCharset,
+		"member-id-charset", "",
+		defaultMemberLimits.IDCharset,
+		"the characters allowed in a registered member id, as a regular expression character class (empty allows any)",
+	)
+	Command.Flags().IntVarP(
+		&maxMemberMetadataEntries,
+		"max-member-metadata-entries", "",
+		defaultMemberLimits.MaxMetadataEntries,
+		"the maximum number of metadata entries of a registered member (0 means no limit)",
+	)
+	Command.Flags().IntVarP(
+		&maxMemberMetadataBytes,
+		"max-member-metadata-bytes", "",
+		defaultMemberLimits.MaxMetadataBytes,
+		"the maximum size of the metadata of a registered member in bytes (0 means no limit)",
+	)
+	Command.Flags().BoolVarP(
+		&requireMemberService,
+		"require-member-service", "",
+		defaultMemberLimits.RequireService,
+		"whether to reject registered members without a service",
+	)
+
+	Command.Flags().DurationVarP(
+		&bootstrapTimeout,
+		"bootstrap-timeout", "",
+		time.Second*30,
+		"the maximum time to wait to sync the registry from the cluster before accepting client traffic (0 skips the sync)",
+	)
+
+	Command.Flags().BoolVarP(
+		&registryV2,
+		"registry-v2", "",
+		false,
+		"whether to run the v2 registry alongside the v1 registry",
+	)
+
+	Command.Flags().StringArrayVarP(
+		&federatedClusters,
+		"federate", "",
+		nil,
+		"a remote cluster to federate with, in the format '<name>=<addr>,<addr>' where the addresses are the rpc addresses of the remote gateway nodes (may be repeated)",
+	)
+
+	Command.Flags().StringVarP(
+		&region,
+		"region", "",
+		"",
+		"the region the node is running in, which is gossiped to the other nodes",
+	)
+	Command.Flags().StringVarP(
+		&availabilityZone,
+		"availability-zone", "",
+		"",
+		"the availability zone the node is running in, which is gossiped to the other nodes",
+	)
+
 	Command.Flags().StringVarP(
 		&logLevel,
 		"log-level", "",
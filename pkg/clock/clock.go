@@ -0,0 +1,87 @@
+// Package clock provides the time source used by Fuddle nodes.
+//
+// Components read the current time from a Clock rather than calling
+// time.Now directly, so tests can freeze, advance or skew the time seen by
+// each node.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock returns the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is a Clock using the system time.
+type RealClock struct{}
+
+func NewRealClock() *RealClock {
+	return &RealClock{}
+}
+
+func (c *RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// OffsetClock is a Clock that adds a fixed offset to another clock, which is
+// used to simulate clock skew between nodes.
+type OffsetClock struct {
+	clock  Clock
+	offset time.Duration
+}
+
+func NewOffsetClock(clock Clock, offset time.Duration) *OffsetClock {
+	return &OffsetClock{
+		clock:  clock,
+		offset: offset,
+	}
+}
+
+func (c *OffsetClock) Now() time.Time {
+	return c.clock.Now().Add(c.offset)
+}
+
+// ManualClock is a Clock whose time only changes when set or advanced. This is
+// useful for testing, or to freeze the time of a node.
+type ManualClock struct {
+	now time.Time
+
+	// mu protects the fields above.
+	mu sync.Mutex
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		now: now,
+	}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Set sets the current time.
+func (c *ManualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Advance moves the current time forward by the given duration.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+var _ Clock = &RealClock{}
+var _ Clock = &OffsetClock{}
+var _ Clock = &ManualClock{}
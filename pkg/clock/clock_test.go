@@ -0,0 +1,25 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.UnixMilli(1000)
+	c := NewManualClock(start)
+	assert.Equal(t, start, c.Now())
+
+	c.Advance(time.Second)
+	assert.Equal(t, time.UnixMilli(2000), c.Now())
+
+	c.Set(time.UnixMilli(500))
+	assert.Equal(t, time.UnixMilli(500), c.Now())
+}
+
+func TestOffsetClock(t *testing.T) {
+	c := NewOffsetClock(NewManualClock(time.UnixMilli(1000)), -time.Second)
+	assert.Equal(t, time.UnixMilli(0), c.Now())
+}
@@ -2,11 +2,14 @@ package cluster
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"sync"
 	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
+	"github.com/fuddle-io/fuddle/pkg/config"
 	registryClient "github.com/fuddle-io/fuddle/pkg/registry/client"
 	"github.com/fuddle-io/fuddle/pkg/registry/registry"
 	"go.uber.org/zap"
@@ -15,12 +18,19 @@ import (
 type Cluster struct {
 	nodes   map[string]interface{}
 	clients map[string]*registryClient.ReplicaClient
+	// addrs contains the RPC address each client is connected to.
+	addrs map[string]string
+
+	// cacheNodes contains the nodes running in cache mode, which receive
+	// updates but never own members.
+	cacheNodes map[string]interface{}
 
 	// mu is a mutex protecting the fields above.
 	mu sync.Mutex
 
 	registry *registry.Registry
 
+	clock         clock.Clock
 	logger        *zap.Logger
 	metrics       *Metrics
 	clientMetrics *registryClient.ReplicaClientMetrics
@@ -45,18 +55,24 @@ func NewCluster(reg *registry.Registry, opts ...Option) *Cluster {
 	return &Cluster{
 		nodes:         make(map[string]interface{}),
 		clients:       make(map[string]*registryClient.ReplicaClient),
+		addrs:         make(map[string]string),
+		cacheNodes:    make(map[string]interface{}),
 		registry:      reg,
+		clock:         options.clock,
 		logger:        options.logger,
 		metrics:       metrics,
 		clientMetrics: clientMetrics,
 	}
 }
 
-func (c *Cluster) OnJoin(id string, addr string) {
+// OnJoin connects to a node that has joined the cluster, where mode is the
+// mode the node runs in (see config.ModeFull and config.ModeCache).
+func (c *Cluster) OnJoin(id string, addr string, mode string) {
 	c.logger.Info(
 		"cluster on join",
 		zap.String("id", id),
 		zap.String("addr", addr),
+		zap.String("mode", mode),
 	)
 
 	client, err := registryClient.ReplicaConnect(
@@ -64,6 +80,7 @@ func (c *Cluster) OnJoin(id string, addr string) {
 		id,
 		c.registry,
 		c.clientMetrics,
+		registryClient.WithClock(c.clock),
 		registryClient.WithLogger(c.logger),
 	)
 	if err != nil {
@@ -72,8 +89,19 @@ func (c *Cluster) OnJoin(id string, addr string) {
 	}
 
 	c.mu.Lock()
+	// If the node is already known, such as if the node rejoined with a new
+	// address, replace the existing client.
+	if existing, ok := c.clients[id]; ok {
+		existing.Close()
+	}
 	c.nodes[id] = struct{}{}
 	c.clients[id] = client
+	c.addrs[id] = addr
+	if mode == config.ModeCache {
+		c.cacheNodes[id] = struct{}{}
+	} else {
+		delete(c.cacheNodes, id)
+	}
 
 	nodesCount := len(c.nodes)
 	c.mu.Unlock()
@@ -83,17 +111,47 @@ func (c *Cluster) OnJoin(id string, addr string) {
 
 	c.registry.OnNodeJoin(id)
 
-	// To bootstrap the node send the members we own.
+	// To bootstrap the node send the members we own. The client batches the
+	// updates so these are sent in as few messages as possible.
 	for _, m := range c.registry.OwnedMembers() {
 		client.Update(m)
 	}
 }
 
+// OnNodeUpdate handles a node in the cluster updating its metadata. If the node
+// has a new RPC address, such as if it restarted before this node detected it
+// left, the replica client is reconnected to the new address.
+func (c *Cluster) OnNodeUpdate(id string, addr string, mode string) {
+	c.mu.Lock()
+	existingAddr, ok := c.addrs[id]
+	if ok && existingAddr == addr {
+		if mode == config.ModeCache {
+			c.cacheNodes[id] = struct{}{}
+		} else {
+			delete(c.cacheNodes, id)
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	c.logger.Info(
+		"cluster on update; node address changed",
+		zap.String("id", id),
+		zap.String("addr", addr),
+		zap.String("existing-addr", existingAddr),
+	)
+
+	c.OnJoin(id, addr, mode)
+}
+
 func (c *Cluster) OnLeave(id string) {
 	c.logger.Info("cluster on leave", zap.String("id", id))
 
 	c.mu.Lock()
 	delete(c.nodes, id)
+	delete(c.addrs, id)
+	delete(c.cacheNodes, id)
 	if client, ok := c.clients[id]; ok {
 		client.Close()
 		delete(c.clients, id)
@@ -130,6 +188,148 @@ func (c *Cluster) ReplicaRepair() {
 	}
 }
 
+// Bootstrap synchronises the full registry state from the other nodes in the
+// cluster, so a node that has just joined has a copy of the registry before it
+// accepts client traffic.
+//
+// The node syncs with all known nodes in parallel, retrying each until it
+// succeeds, since a node may itself have missed updates. Returns once every
+// node has been synced, or when the context is cancelled if at least one node
+// has been synced. Returns immediately if there are no other nodes, or an
+// error if the context is cancelled before any sync succeeds.
+func (c *Cluster) Bootstrap(ctx context.Context) error {
+	c.mu.Lock()
+	var clients []*registryClient.ReplicaClient
+	for _, client := range c.clients {
+		clients = append(clients, client)
+	}
+	c.mu.Unlock()
+
+	if len(clients) == 0 {
+		c.logger.Info("bootstrap; no nodes to sync")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	synced := make(chan struct{}, len(clients))
+	for _, client := range clients {
+		go func(client *registryClient.ReplicaClient) {
+			if c.bootstrapClient(ctx, client) {
+				synced <- struct{}{}
+			}
+		}(client)
+	}
+
+	syncedCount := 0
+	for syncedCount != len(clients) {
+		select {
+		case <-synced:
+			syncedCount++
+		case <-ctx.Done():
+			if syncedCount == 0 {
+				return fmt.Errorf("cluster: bootstrap: %w", ctx.Err())
+			}
+			c.logger.Warn(
+				"bootstrap; registry partially synced",
+				zap.Int("synced", syncedCount),
+				zap.Int("nodes", len(clients)),
+			)
+			return nil
+		}
+	}
+
+	c.logger.Info("bootstrap; registry synced", zap.Int("nodes", len(clients)))
+	return nil
+}
+
+// bootstrapClient syncs with the client until it succeeds, returning false if
+// the context is cancelled first.
+func (c *Cluster) bootstrapClient(ctx context.Context, client *registryClient.ReplicaClient) bool {
+	for {
+		err := client.FullSync(ctx)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		c.logger.Warn("bootstrap sync failed", zap.Error(err))
+
+		select {
+		case <-time.After(time.Millisecond * 500):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Handoff hands off ownership of the members owned by this node to the other
+// nodes in the cluster, so when this node leaves the other nodes don't treat
+// its members as orphaned and mark them down.
+//
+// Members are only handed off to full nodes, since cache nodes never own
+// members, though the handoff updates are sent to every node in parallel,
+// since all nodes must learn the new owners, returning once every node has
+// acknowledged the updates or the context is cancelled. Returns an error if
+// the handoff couldn't be sent to any node, in which case the other nodes fall
+// back to taking ownership of the members once this node leaves.
+func (c *Cluster) Handoff(ctx context.Context) error {
+	c.mu.Lock()
+	clients := make(map[string]*registryClient.ReplicaClient, len(c.clients))
+	var targets []string
+	for id, client := range c.clients {
+		clients[id] = client
+		if _, ok := c.cacheNodes[id]; !ok {
+			targets = append(targets, id)
+		}
+	}
+	c.mu.Unlock()
+
+	members := c.registry.Handoff(targets)
+	if len(members) == 0 {
+		c.logger.Info("handoff; no members to hand off")
+		return nil
+	}
+
+	errs := make(chan error, len(clients))
+	for id, client := range clients {
+		go func(id string, client *registryClient.ReplicaClient) {
+			err := client.Handoff(ctx, members)
+			if err != nil {
+				c.logger.Warn(
+					"handoff failed",
+					zap.String("target", id),
+					zap.Error(err),
+				)
+			}
+			errs <- err
+		}(id, client)
+	}
+
+	var lastErr error
+	failed := 0
+	for range clients {
+		if err := <-errs; err != nil {
+			lastErr = err
+			failed++
+		}
+	}
+	if failed == len(clients) {
+		return fmt.Errorf("cluster: handoff: %w", lastErr)
+	}
+
+	c.logger.Info(
+		"handoff; members handed off",
+		zap.Int("members", len(members)),
+		zap.Int("nodes", len(clients)),
+		zap.Int("failed", failed),
+	)
+	return nil
+}
+
 func (c *Cluster) randomClient() (*registryClient.ReplicaClient, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
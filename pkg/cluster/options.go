@@ -1,18 +1,21 @@
 package cluster
 
 import (
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/metrics"
 	"go.uber.org/zap"
 )
 
 type options struct {
 	collector metrics.Collector
+	clock     clock.Clock
 	logger    *zap.Logger
 }
 
 func defaultOptions() *options {
 	return &options{
 		collector: nil,
+		clock:     clock.NewRealClock(),
 		logger:    zap.NewNop(),
 	}
 }
@@ -33,6 +36,20 @@ func WithCollector(c metrics.Collector) Option {
 	return collectorOption{collector: c}
 }
 
+type clockOption struct {
+	clock clock.Clock
+}
+
+func (o clockOption) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock used by the replica clients. Defaults to the
+// system clock.
+func WithClock(c clock.Clock) Option {
+	return clockOption{clock: c}
+}
+
 type loggerOption struct {
 	Log *zap.Logger
 }
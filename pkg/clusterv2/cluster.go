@@ -2,37 +2,182 @@ package cluster
 
 import (
 	"context"
+	"math/rand"
+	"sync"
+	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/registryv2/client"
 	"github.com/fuddle-io/fuddle/pkg/registryv2/registry"
+	"go.uber.org/zap"
 )
 
+// Cluster manages the replica clients for the other Fuddle nodes in the
+// cluster, forwarding local registry updates to each node and running replica
+// repair.
 type Cluster struct {
+	clients map[string]*client.ReplicaClient
+	// addrs contains the RPC address each client is connected to.
+	addrs map[string]string
+
+	// mu is a mutex protecting the fields above.
+	mu sync.Mutex
+
 	registry *registry.Registry
+
+	unsubscribe func()
+
+	clock clock.Clock
+
+	clientMetrics *client.Metrics
+	logger        *zap.Logger
 }
 
-func NewCluster(registry *registry.Registry) *Cluster {
+func NewCluster(reg *registry.Registry, opts ...Option) *Cluster {
+	options := defaultOptions()
+	for _, o := range opts {
+		o.apply(options)
+	}
+
+	clientMetrics := client.NewMetrics()
+	if options.collector != nil {
+		clientMetrics.Register(options.collector)
+	}
+
 	c := &Cluster{
-		registry: registry,
+		clients:       make(map[string]*client.ReplicaClient),
+		addrs:         make(map[string]string),
+		registry:      reg,
+		clock:         options.clock,
+		clientMetrics: clientMetrics,
+		logger:        options.logger,
 	}
+	c.unsubscribe = reg.SubscribeLocal(c.onUpdate)
 	return c
 }
 
 func (c *Cluster) OnJoin(id string, addr string) {
+	c.logger.Info(
+		"cluster on join",
+		zap.String("id", id),
+		zap.String("addr", addr),
+	)
+
+	conn, err := client.ConnectReplica(
+		addr,
+		id,
+		c.registry,
+		c.clientMetrics,
+		client.WithLogger(c.logger),
+	)
+	if err != nil {
+		c.logger.Error("client connect", zap.Error(err))
+		return
+	}
+
+	c.mu.Lock()
+	if existing, ok := c.clients[id]; ok {
+		existing.Close()
+	}
+	c.clients[id] = conn
+	c.addrs[id] = addr
+	c.mu.Unlock()
+
 	c.registry.OnNodeJoin(id)
 
-	conn := client.ConnectReplica(addr)
-	c.registry.SubscribeLocal(func(m *rpc.Member2) {
-		// nolint
-		conn.Update(context.Background(), m)
-	})
+	// To bootstrap the node send the members we own.
+	for _, m := range c.registry.OwnedMembers() {
+		conn.Update(m)
+	}
+}
+
+// OnNodeUpdate handles a node in the cluster updating its metadata,
+// reconnecting the replica client if the node has a new RPC address.
+func (c *Cluster) OnNodeUpdate(id string, addr string) {
+	c.mu.Lock()
+	existingAddr, ok := c.addrs[id]
+	c.mu.Unlock()
+
+	if ok && existingAddr == addr {
+		return
+	}
+
+	c.logger.Info(
+		"cluster on update; node address changed",
+		zap.String("id", id),
+		zap.String("addr", addr),
+		zap.String("existing-addr", existingAddr),
+	)
+
+	c.OnJoin(id, addr)
 }
 
 func (c *Cluster) OnLeave(id string) {
-	c.registry.OnNodeLeave(id)
+	c.logger.Info("cluster on leave", zap.String("id", id))
+
+	c.mu.Lock()
+	if conn, ok := c.clients[id]; ok {
+		conn.Close()
+		delete(c.clients, id)
+	}
+	delete(c.addrs, id)
+	c.mu.Unlock()
+
+	c.registry.OnNodeLeave(id, c.clock.Now().UnixMilli())
 }
 
+// ReplicaRepair syncs the local registry with a random node in the cluster.
 func (c *Cluster) ReplicaRepair() {
-	// Select a random node and call client.Sync().
+	conn, ok := c.randomClient()
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	if err := conn.Sync(ctx); err != nil {
+		c.logger.Warn("replica sync failed", zap.Error(err))
+	}
+}
+
+// Close stops forwarding updates and closes the replica clients.
+func (c *Cluster) Close() {
+	c.unsubscribe()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, conn := range c.clients {
+		conn.Close()
+		delete(c.clients, id)
+		delete(c.addrs, id)
+	}
+}
+
+// onUpdate forwards local updates to the other nodes. This is called with the
+// registry mutex held, though ReplicaClient.Update doesn't block.
+func (c *Cluster) onUpdate(m *rpc.Member2) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, conn := range c.clients {
+		conn.Update(m)
+	}
+}
+
+func (c *Cluster) randomClient() (*client.ReplicaClient, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.clients) == 0 {
+		return nil, false
+	}
+
+	var ids []string
+	for id := range c.clients {
+		ids = append(ids, id)
+	}
+	id := ids[rand.Int()%len(ids)]
+	return c.clients[id], true
 }
@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"github.com/fuddle-io/fuddle/pkg/clock"
+	"github.com/fuddle-io/fuddle/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+type options struct {
+	clock     clock.Clock
+	collector metrics.Collector
+	logger    *zap.Logger
+}
+
+func defaultOptions() *options {
+	return &options{
+		clock:     clock.NewRealClock(),
+		collector: nil,
+		logger:    zap.NewNop(),
+	}
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type clockOption struct {
+	clock clock.Clock
+}
+
+func (o clockOption) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock used to timestamp when nodes leave the cluster.
+// Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return clockOption{clock: c}
+}
+
+type collectorOption struct {
+	collector metrics.Collector
+}
+
+func (o collectorOption) apply(opts *options) {
+	opts.collector = o.collector
+}
+
+func WithCollector(c metrics.Collector) Option {
+	return collectorOption{collector: c}
+}
+
+type loggerOption struct {
+	Log *zap.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.logger = o.Log
+}
+
+func WithLogger(log *zap.Logger) Option {
+	return loggerOption{Log: log}
+}
@@ -1,30 +1,81 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/google/uuid"
 	"go.uber.org/zap/zapcore"
 )
 
+const (
+	// ModeFull is the default node mode, where the node accepts member
+	// registrations from clients and owns the registered members.
+	ModeFull = "full"
+	// ModeCache is a read-only node mode, where the node receives the
+	// registry from the other nodes and serves subscriptions, but never
+	// accepts registrations or owns members. Cache nodes can be used to scale
+	// the number of subscribers separately from the number of registered
+	// members.
+	ModeCache = "cache"
+)
+
+// ValidateMode returns an error if the node mode isn't supported.
+func ValidateMode(mode string) error {
+	switch mode {
+	case ModeFull, ModeCache:
+		return nil
+	default:
+		return fmt.Errorf("unknown mode: %s", mode)
+	}
+}
+
 type Config struct {
-	NodeID   string
+	NodeID string
+	// Mode is the mode the node runs in, either ModeFull or ModeCache.
+	Mode     string
 	RPC      *RPC
 	Gossip   *Gossip
 	Admin    *Admin
 	Registry *Registry
+
+	Federation *Federation
+
+	Locality *Locality
+}
+
+// Validate returns an error if the config contains invalid values or
+// combinations of values.
+func (c *Config) Validate() error {
+	if err := ValidateMode(c.Mode); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if err := c.Gossip.Validate(); err != nil {
+		return fmt.Errorf("config: gossip: %w", err)
+	}
+	if err := c.Registry.Validate(); err != nil {
+		return fmt.Errorf("config: registry: %w", err)
+	}
+	return nil
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		NodeID:   "fuddle-" + randomID(),
+		Mode:     ModeFull,
 		RPC:      DefaultRPCConfig(),
 		Gossip:   DefaultGossipConfig(),
 		Admin:    DefaultAdminConfig(),
 		Registry: DefaultRegistryConfig(),
+
+		Federation: DefaultFederationConfig(),
+
+		Locality: DefaultLocalityConfig(),
 	}
 }
 
 func (c *Config) MarshalLogObject(e zapcore.ObjectEncoder) error {
 	e.AddString("node-id", c.NodeID)
+	e.AddString("mode", c.Mode)
 	if err := e.AddObject("rpc", c.RPC); err != nil {
 		return err
 	}
@@ -37,6 +88,12 @@ func (c *Config) MarshalLogObject(e zapcore.ObjectEncoder) error {
 	if err := e.AddObject("registry", c.Registry); err != nil {
 		return err
 	}
+	if err := e.AddObject("federation", c.Federation); err != nil {
+		return err
+	}
+	if err := e.AddObject("locality", c.Locality); err != nil {
+		return err
+	}
 	return nil
 }
 
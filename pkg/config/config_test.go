@@ -0,0 +1,120 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_ValidateDefault(t *testing.T) {
+	assert.NoError(t, DefaultConfig().Validate())
+}
+
+// Tests the default config matches the LAN profile.
+func TestConfig_DefaultLANProfile(t *testing.T) {
+	conf := DefaultConfig()
+	require.NoError(t, conf.ApplyProfile(ProfileLAN))
+	assert.Equal(t, DefaultConfig().Gossip, conf.Gossip)
+	assert.Equal(t, DefaultConfig().Registry, conf.Registry)
+}
+
+func TestConfig_ApplyProfile(t *testing.T) {
+	for _, name := range []string{ProfileLAN, ProfileWAN, ProfileLocal} {
+		t.Run(name, func(t *testing.T) {
+			conf := DefaultConfig()
+			require.NoError(t, conf.ApplyProfile(name))
+			assert.NoError(t, conf.Validate())
+		})
+	}
+
+	conf := DefaultConfig()
+	require.NoError(t, conf.ApplyProfile(ProfileWAN))
+	assert.Equal(t, time.Second*5, conf.Gossip.ProbeInterval)
+	assert.Equal(t, 6, conf.Gossip.SuspicionMult)
+}
+
+func TestConfig_ApplyUnknownProfile(t *testing.T) {
+	assert.Error(t, DefaultConfig().ApplyProfile("unknown"))
+}
+
+func TestConfig_ValidateInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(conf *Config)
+	}{
+		{
+			name: "unknown mode",
+			update: func(conf *Config) {
+				conf.Mode = "unknown"
+			},
+		},
+		{
+			name: "tombstone timeout less than heartbeat and reconnect timeouts",
+			update: func(conf *Config) {
+				conf.Registry.HeartbeatTimeout = time.Minute
+				conf.Registry.ReconnectTimeout = time.Minute * 5
+				conf.Registry.TombstoneTimeout = time.Minute * 5
+			},
+		},
+		{
+			name: "zero repair interval",
+			update: func(conf *Config) {
+				conf.Registry.RepairInterval = 0
+			},
+		},
+		{
+			name: "zero failure detector interval",
+			update: func(conf *Config) {
+				conf.Registry.FailureDetectorInterval = 0
+			},
+		},
+		{
+			name: "zero snapshot interval",
+			update: func(conf *Config) {
+				conf.Registry.DataDir = "data"
+				conf.Registry.SnapshotInterval = 0
+			},
+		},
+		{
+			name: "zero subscriber queue limit",
+			update: func(conf *Config) {
+				conf.Registry.SubscriberQueueLimit = 0
+			},
+		},
+		{
+			name: "probe timeout exceeds probe interval",
+			update: func(conf *Config) {
+				conf.Gossip.ProbeInterval = time.Second
+				conf.Gossip.ProbeTimeout = time.Second * 2
+			},
+		},
+		{
+			name: "zero suspicion multiplier",
+			update: func(conf *Config) {
+				conf.Gossip.SuspicionMult = 0
+			},
+		},
+		{
+			name: "zero gossip nodes",
+			update: func(conf *Config) {
+				conf.Gossip.GossipNodes = 0
+			},
+		},
+		{
+			name: "join backoff exceeds max",
+			update: func(conf *Config) {
+				conf.Gossip.JoinBackoff = time.Minute
+				conf.Gossip.JoinBackoffMax = time.Second
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := DefaultConfig()
+			tt.update(conf)
+			assert.Error(t, conf.Validate())
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// FederatedCluster is a remote Fuddle cluster to federate with.
+type FederatedCluster struct {
+	// Name is the name of the remote cluster, which members received from
+	// the cluster are marked with.
+	Name string
+
+	// Addrs are the RPC addresses of the gateway nodes in the remote cluster.
+	Addrs []string
+}
+
+func (c FederatedCluster) MarshalLogObject(e zapcore.ObjectEncoder) error {
+	e.AddString("name", c.Name)
+	return e.AddArray("addrs", stringArray(c.Addrs))
+}
+
+// ParseFederatedCluster parses a remote cluster in the format
+// '<name>=<addr>,<addr>,...'.
+func ParseFederatedCluster(s string) (FederatedCluster, error) {
+	name, addrs, ok := strings.Cut(s, "=")
+	if !ok || name == "" || addrs == "" {
+		return FederatedCluster{}, fmt.Errorf("invalid federated cluster: %q", s)
+	}
+	return FederatedCluster{
+		Name:  name,
+		Addrs: strings.Split(addrs, ","),
+	}, nil
+}
+
+type federatedClusters []FederatedCluster
+
+func (cs federatedClusters) MarshalLogArray(arr zapcore.ArrayEncoder) error {
+	for i := range cs {
+		if err := arr.AppendObject(cs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Federation configures the remote clusters this node federates with. A node
+// with remote clusters configured is a gateway node, which streams the
+// registry of each remote cluster and replicates the members to the rest of
+// its own cluster.
+type Federation struct {
+	Clusters []FederatedCluster
+
+	// RetryInterval is the time to wait before reconnecting to a remote
+	// cluster after the connection fails.
+	RetryInterval time.Duration
+}
+
+func (c *Federation) MarshalLogObject(e zapcore.ObjectEncoder) error {
+	if err := e.AddArray("clusters", federatedClusters(c.Clusters)); err != nil {
+		return err
+	}
+	e.AddDuration("retry-interval", c.RetryInterval)
+	return nil
+}
+
+func DefaultFederationConfig() *Federation {
+	return &Federation{
+		Clusters:      nil,
+		RetryInterval: time.Second,
+	}
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"fmt"
+	"time"
+
 	"go.uber.org/zap/zapcore"
 )
 
@@ -16,6 +19,66 @@ type Gossip struct {
 	// Seeds contains a list of gossip addresses of nodes in the target cluster
 	// to join.
 	Seeds []string
+
+	// SeedDNS contains DNS names to resolve to seeds, in the format
+	// '<name>:<port>'. Each address the name resolves to is used as a seed
+	// with the given port.
+	SeedDNS []string
+
+	// SeedSRV contains DNS SRV names to resolve to seeds, such as
+	// '_gossip._tcp.fuddle.example.com'. Each target is used as a seed with
+	// the port of the record.
+	SeedSRV []string
+
+	// SeedFile is the path of a file containing seeds, with one gossip address
+	// per line. The file is watched for changes, so seeds can be updated
+	// while the node is running.
+	SeedFile string
+
+	// PeersFile is the path of a file to persist the gossip addresses of the
+	// known nodes to, which are used as seeds along with the configured seeds
+	// when the node restarts.
+	PeersFile string
+
+	// JoinBackoff is the initial time to wait before retrying to join the
+	// cluster if no seeds could be reached. The wait doubles after each
+	// attempt up to JoinBackoffMax.
+	JoinBackoff    time.Duration
+	JoinBackoffMax time.Duration
+
+	// RejoinInterval is the interval to rejoin the seeds and persisted peers
+	// that aren't known members of the cluster, which heals partitions. If
+	// zero the node never rejoins.
+	RejoinInterval time.Duration
+
+	// EncryptionKey is a base64 encoded key used to encrypt gossip traffic,
+	// which must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+	// If empty, and there is no keyring file, gossip isn't encrypted.
+	EncryptionKey string
+
+	// KeyringFile is the path of a file to persist the gossip encryption
+	// keyring to, so keys installed at runtime are kept across restarts. If
+	// the file exists it takes precedence over EncryptionKey.
+	KeyringFile string
+
+	// ProbeInterval is the interval to probe a random node to detect failed
+	// nodes.
+	ProbeInterval time.Duration
+
+	// ProbeTimeout is the time to wait for a probed node to respond before
+	// probing it indirectly through other nodes. This must be less than the
+	// ProbeInterval.
+	ProbeTimeout time.Duration
+
+	// SuspicionMult scales the time a suspected node has to refute the
+	// suspicion before it is considered failed, which is
+	// SuspicionMult * log(N+1) * ProbeInterval for a cluster of N nodes.
+	SuspicionMult int
+
+	// GossipNodes is the number of random nodes to gossip to each
+	// GossipInterval.
+	GossipNodes    int
+	GossipInterval time.Duration
 }
 
 func (c *Gossip) MarshalLogObject(e zapcore.ObjectEncoder) error {
@@ -26,6 +89,57 @@ func (c *Gossip) MarshalLogObject(e zapcore.ObjectEncoder) error {
 	if err := e.AddArray("seeds", stringArray(c.Seeds)); err != nil {
 		return err
 	}
+	if err := e.AddArray("seed-dns", stringArray(c.SeedDNS)); err != nil {
+		return err
+	}
+	if err := e.AddArray("seed-srv", stringArray(c.SeedSRV)); err != nil {
+		return err
+	}
+	e.AddString("seed-file", c.SeedFile)
+	e.AddString("peers-file", c.PeersFile)
+	e.AddDuration("join-backoff", c.JoinBackoff)
+	e.AddDuration("join-backoff-max", c.JoinBackoffMax)
+	e.AddDuration("rejoin-interval", c.RejoinInterval)
+	e.AddDuration("probe-interval", c.ProbeInterval)
+	e.AddDuration("probe-timeout", c.ProbeTimeout)
+	e.AddInt("suspicion-mult", c.SuspicionMult)
+	e.AddInt("gossip-nodes", c.GossipNodes)
+	e.AddDuration("gossip-interval", c.GossipInterval)
+	// Never log the encryption key.
+	e.AddBool("encrypted", c.EncryptionKey != "" || c.KeyringFile != "")
+	e.AddString("keyring-file", c.KeyringFile)
+	return nil
+}
+
+// Validate returns an error if the gossip tunables are invalid.
+func (c *Gossip) Validate() error {
+	if c.ProbeInterval <= 0 {
+		return fmt.Errorf("probe interval must be positive")
+	}
+	if c.ProbeTimeout <= 0 || c.ProbeTimeout >= c.ProbeInterval {
+		return fmt.Errorf(
+			"probe timeout (%s) must be positive and less than the probe interval (%s)",
+			c.ProbeTimeout, c.ProbeInterval,
+		)
+	}
+	if c.SuspicionMult < 1 {
+		return fmt.Errorf("suspicion multiplier must be at least 1")
+	}
+	if c.GossipNodes < 1 {
+		return fmt.Errorf("gossip nodes must be at least 1")
+	}
+	if c.GossipInterval <= 0 {
+		return fmt.Errorf("gossip interval must be positive")
+	}
+	if c.JoinBackoff <= 0 || c.JoinBackoffMax < c.JoinBackoff {
+		return fmt.Errorf(
+			"join backoff (%s) must be positive and at most the max join backoff (%s)",
+			c.JoinBackoff, c.JoinBackoffMax,
+		)
+	}
+	if c.RejoinInterval < 0 {
+		return fmt.Errorf("rejoin interval must not be negative")
+	}
 	return nil
 }
 
@@ -36,5 +150,15 @@ func DefaultGossipConfig() *Gossip {
 		AdvAddr:  "",
 		AdvPort:  8111,
 		Seeds:    nil,
+
+		JoinBackoff:    time.Millisecond * 500,
+		JoinBackoffMax: time.Second * 30,
+		RejoinInterval: time.Second * 30,
+
+		ProbeInterval:  time.Second,
+		ProbeTimeout:   time.Millisecond * 500,
+		SuspicionMult:  3,
+		GossipNodes:    3,
+		GossipInterval: time.Millisecond * 200,
 	}
 }
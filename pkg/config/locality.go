@@ -0,0 +1,25 @@
+package config
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+// Locality is the location of the node, which is gossiped to the other nodes
+// in the cluster.
+type Locality struct {
+	Region           string
+	AvailabilityZone string
+}
+
+func (c *Locality) MarshalLogObject(e zapcore.ObjectEncoder) error {
+	e.AddString("region", c.Region)
+	e.AddString("availability-zone", c.AvailabilityZone)
+	return nil
+}
+
+func DefaultLocalityConfig() *Locality {
+	return &Locality{
+		Region:           "",
+		AvailabilityZone: "",
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// ProfileLAN tunes gossip and failure detection for nodes in the same
+	// data center. This is the default profile.
+	ProfileLAN = "lan"
+	// ProfileWAN tunes gossip and failure detection for nodes spread across
+	// data centers, where latency is higher and packet loss more likely, so
+	// failures are detected more slowly to avoid false positives.
+	ProfileWAN = "wan"
+	// ProfileLocal tunes gossip and failure detection for nodes on the same
+	// host, such as in development, so failures are detected quickly.
+	ProfileLocal = "local"
+)
+
+// profile contains the gossip and failure detection tunables set by a
+// profile. The defaults of the gossip and registry configs match ProfileLAN.
+type profile struct {
+	probeInterval  time.Duration
+	probeTimeout   time.Duration
+	suspicionMult  int
+	gossipNodes    int
+	gossipInterval time.Duration
+
+	failureDetectorInterval time.Duration
+	repairInterval          time.Duration
+}
+
+var profiles = map[string]profile{
+	ProfileLAN: {
+		probeInterval:           time.Second,
+		probeTimeout:            time.Millisecond * 500,
+		suspicionMult:           3,
+		gossipNodes:             3,
+		gossipInterval:          time.Millisecond * 200,
+		failureDetectorInterval: time.Millisecond * 500,
+		repairInterval:          time.Millisecond * 500,
+	},
+	ProfileWAN: {
+		probeInterval:           time.Second * 5,
+		probeTimeout:            time.Second * 3,
+		suspicionMult:           6,
+		gossipNodes:             4,
+		gossipInterval:          time.Millisecond * 500,
+		failureDetectorInterval: time.Millisecond * 500,
+		// Repairing syncs the registry with another node, so is run less
+		// frequently to limit the traffic between data centers.
+		repairInterval: time.Second * 5,
+	},
+	ProfileLocal: {
+		probeInterval:           time.Second,
+		probeTimeout:            time.Millisecond * 200,
+		suspicionMult:           3,
+		gossipNodes:             3,
+		gossipInterval:          time.Millisecond * 100,
+		failureDetectorInterval: time.Millisecond * 500,
+		repairInterval:          time.Millisecond * 500,
+	},
+}
+
+// ApplyProfile sets the gossip and failure detection tunables to those of the
+// profile with the given name, either ProfileLAN, ProfileWAN or ProfileLocal.
+// Tunables can still be overridden after applying the profile.
+func (c *Config) ApplyProfile(name string) error {
+	p, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile: %s", name)
+	}
+
+	c.Gossip.ProbeInterval = p.probeInterval
+	c.Gossip.ProbeTimeout = p.probeTimeout
+	c.Gossip.SuspicionMult = p.suspicionMult
+	c.Gossip.GossipNodes = p.gossipNodes
+	c.Gossip.GossipInterval = p.gossipInterval
+
+	c.Registry.FailureDetectorInterval = p.failureDetectorInterval
+	c.Registry.RepairInterval = p.repairInterval
+
+	return nil
+}
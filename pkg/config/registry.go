@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -19,19 +21,160 @@ type Registry struct {
 	// removed. This must be at least as long has the sum of the heartbeat
 	// and reconnect timeouts.
 	TombstoneTimeout time.Duration
+
+	// FailureDetectorInterval is the interval to check for members that have
+	// exceeded the heartbeat, reconnect or tombstone timeouts.
+	FailureDetectorInterval time.Duration
+
+	// RepairInterval is the interval to sync the registry with a random node
+	// in the cluster, to repair any updates missed by replication.
+	RepairInterval time.Duration
+
+	// DataDir is the directory to persist the registry state, so a restarted
+	// node can recover its registry. If empty the registry is only kept in
+	// memory.
+	DataDir string
+
+	// SnapshotInterval is the interval to compact the persisted registry
+	// state by writing a snapshot and truncating the write-ahead log.
+	SnapshotInterval time.Duration
+
+	// SubscriberQueueLimit is the maximum number of updates queued for each
+	// client subscriber before the SubscriberOverflowPolicy is applied.
+	SubscriberQueueLimit int
+
+	// SubscriberOverflowPolicy defines how to handle client subscribers
+	// whose queue is full, either "disconnect" or "resync".
+	SubscriberOverflowPolicy string
+
+	// MaxClockDrift is the maximum time a timestamp received from another
+	// node may be ahead of the local clock before the ClockDriftPolicy is
+	// applied. Zero disables the check.
+	MaxClockDrift time.Duration
+
+	// ClockDriftPolicy defines how to handle updates whose timestamp exceeds
+	// the MaxClockDrift, either "flag" or "reject".
+	ClockDriftPolicy string
+
+	// ChangeFeedLimit is the maximum number of updates kept in the registry
+	// change feed, used by client subscribers to resume from the last update
+	// they received when they reconnect. Zero disables resuming.
+	ChangeFeedLimit int
+
+	// MaxMemberIDLength is the maximum length of a registered member ID in
+	// bytes. Zero means there is no limit.
+	MaxMemberIDLength int
+
+	// MemberIDCharset is a regular expression character class (without the
+	// brackets) of the characters allowed in a registered member ID. If empty
+	// any characters are allowed.
+	MemberIDCharset string
+
+	// MaxMemberMetadataEntries is the maximum number of metadata entries of a
+	// registered member. Zero means there is no limit.
+	MaxMemberMetadataEntries int
+
+	// MaxMemberMetadataBytes is the maximum total size of the metadata keys
+	// and values of a registered member. Zero means there is no limit.
+	MaxMemberMetadataBytes int
+
+	// RequireMemberService rejects registered members without a service.
+	RequireMemberService bool
+
+	// BootstrapTimeout is the maximum time a node waits to sync the registry
+	// from the other nodes in the cluster after joining, before it accepts
+	// client traffic. If the timeout is exceeded the node accepts client
+	// traffic anyway. Zero skips the bootstrap sync.
+	BootstrapTimeout time.Duration
+
+	// V2Enabled runs the v2 registry alongside the v1 registry, serving the
+	// v2 client protocol. The v2 registry only replicates with nodes that
+	// also have the v2 registry enabled.
+	V2Enabled bool
 }
 
 func (c *Registry) MarshalLogObject(e zapcore.ObjectEncoder) error {
 	e.AddDuration("heartbeat-timeout", c.HeartbeatTimeout)
 	e.AddDuration("reconnect-timeout", c.ReconnectTimeout)
 	e.AddDuration("tombstone-timeout", c.TombstoneTimeout)
+	e.AddDuration("failure-detector-interval", c.FailureDetectorInterval)
+	e.AddDuration("repair-interval", c.RepairInterval)
+	e.AddString("data-dir", c.DataDir)
+	e.AddDuration("snapshot-interval", c.SnapshotInterval)
+	e.AddInt("subscriber-queue-limit", c.SubscriberQueueLimit)
+	e.AddString("subscriber-overflow-policy", c.SubscriberOverflowPolicy)
+	e.AddDuration("max-clock-drift", c.MaxClockDrift)
+	e.AddString("clock-drift-policy", c.ClockDriftPolicy)
+	e.AddInt("change-feed-limit", c.ChangeFeedLimit)
+	e.AddInt("max-member-id-length", c.MaxMemberIDLength)
+	e.AddString("member-id-charset", c.MemberIDCharset)
+	e.AddInt("max-member-metadata-entries", c.MaxMemberMetadataEntries)
+	e.AddInt("max-member-metadata-bytes", c.MaxMemberMetadataBytes)
+	e.AddBool("require-member-service", c.RequireMemberService)
+	e.AddDuration("bootstrap-timeout", c.BootstrapTimeout)
+	e.AddBool("v2-enabled", c.V2Enabled)
+	return nil
+}
+
+// Validate returns an error if the registry timeouts and intervals are
+// invalid.
+func (c *Registry) Validate() error {
+	if c.HeartbeatTimeout <= 0 {
+		return fmt.Errorf("heartbeat timeout must be positive")
+	}
+	if c.ReconnectTimeout < 0 {
+		return fmt.Errorf("reconnect timeout must not be negative")
+	}
+	if c.TombstoneTimeout < c.HeartbeatTimeout+c.ReconnectTimeout {
+		return fmt.Errorf(
+			"tombstone timeout (%s) must be at least the heartbeat timeout (%s) plus the reconnect timeout (%s)",
+			c.TombstoneTimeout, c.HeartbeatTimeout, c.ReconnectTimeout,
+		)
+	}
+	if c.FailureDetectorInterval <= 0 {
+		return fmt.Errorf("failure detector interval must be positive")
+	}
+	if c.RepairInterval <= 0 {
+		return fmt.Errorf("repair interval must be positive")
+	}
+	if c.DataDir != "" && c.SnapshotInterval <= 0 {
+		return fmt.Errorf("snapshot interval must be positive")
+	}
+	if c.SubscriberQueueLimit < 1 {
+		return fmt.Errorf("subscriber queue limit must be positive")
+	}
 	return nil
 }
 
 func DefaultRegistryConfig() *Registry {
+	limits := registry.DefaultMemberLimits()
 	return &Registry{
 		HeartbeatTimeout: time.Second * 20,
 		ReconnectTimeout: time.Minute * 5,
 		TombstoneTimeout: time.Minute * 30,
+
+		FailureDetectorInterval: time.Millisecond * 500,
+		RepairInterval:          time.Millisecond * 500,
+
+		DataDir:          "",
+		SnapshotInterval: time.Minute * 5,
+
+		SubscriberQueueLimit:     1024,
+		SubscriberOverflowPolicy: "disconnect",
+
+		MaxClockDrift:    time.Minute,
+		ClockDriftPolicy: "reject",
+
+		ChangeFeedLimit: 4096,
+
+		MaxMemberIDLength:        limits.MaxIDLength,
+		MemberIDCharset:          limits.IDCharset,
+		MaxMemberMetadataEntries: limits.MaxMetadataEntries,
+		MaxMemberMetadataBytes:   limits.MaxMetadataBytes,
+		RequireMemberService:     limits.RequireService,
+
+		BootstrapTimeout: time.Second * 30,
+
+		V2Enabled: false,
 	}
 }
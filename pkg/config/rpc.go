@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"go.uber.org/zap/zapcore"
 )
@@ -14,6 +15,11 @@ type RPC struct {
 	// Address to advertise to other cluster members.
 	AdvAddr string
 	AdvPort int
+
+	// DrainWindow is the time to gradually close client streams over when
+	// the node shuts down, so clients don't all reconnect to other nodes at
+	// once.
+	DrainWindow time.Duration
 }
 
 func (c *RPC) MarshalLogObject(e zapcore.ObjectEncoder) error {
@@ -21,6 +27,7 @@ func (c *RPC) MarshalLogObject(e zapcore.ObjectEncoder) error {
 	e.AddInt("bind-port", c.BindPort)
 	e.AddString("adv-addr", c.AdvAddr)
 	e.AddInt("adv-port", c.AdvPort)
+	e.AddDuration("drain-window", c.DrainWindow)
 	return nil
 }
 
@@ -38,5 +45,7 @@ func DefaultRPCConfig() *RPC {
 		BindPort: 8110,
 		AdvAddr:  "",
 		AdvPort:  8110,
+
+		DrainWindow: time.Second * 10,
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type FuddleNodeInfo struct {
@@ -42,8 +43,19 @@ type clusterRequest struct {
 }
 
 type nodesRequest struct {
-	FuddleNodes int `json:"nodes,omitempty"`
-	ClientNodes int `json:"members,omitempty"`
+	FuddleNodes int    `json:"nodes,omitempty"`
+	ClientNodes int    `json:"members,omitempty"`
+	ClockOffset string `json:"clock_offset,omitempty"`
+	FrozenClock bool   `json:"frozen_clock,omitempty"`
+}
+
+// NodeClock configures the clock of added Fuddle nodes.
+type NodeClock struct {
+	// Offset is added to the clock of the nodes, to simulate clock skew.
+	Offset time.Duration
+
+	// Frozen freezes the clock of the nodes at the time they are added.
+	Frozen bool
 }
 
 type Client struct {
@@ -153,14 +165,19 @@ func (c *Client) ClusterHealth(ctx context.Context, id string) (bool, error) {
 	return clusterHealth.Healthy, nil
 }
 
-func (c *Client) AddNodes(ctx context.Context, clusterID string, fuddleNodes int, clientNodes int) (NodesInfo, error) {
+func (c *Client) AddNodes(ctx context.Context, clusterID string, fuddleNodes int, clientNodes int, nodeClock NodeClock) (NodesInfo, error) {
+	req := nodesRequest{
+		FuddleNodes: fuddleNodes,
+		ClientNodes: clientNodes,
+		FrozenClock: nodeClock.Frozen,
+	}
+	if nodeClock.Offset != 0 {
+		req.ClockOffset = nodeClock.Offset.String()
+	}
 	nodesInfo, err := c.updateNodes(
 		ctx,
 		"http://"+c.addr+"/cluster/"+clusterID+"/nodes/add",
-		nodesRequest{
-			FuddleNodes: fuddleNodes,
-			ClientNodes: clientNodes,
-		},
+		req,
 	)
 	if err != nil {
 		return NodesInfo{}, fmt.Errorf("fcm client: add nodes: %w", err)
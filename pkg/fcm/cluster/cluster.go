@@ -26,8 +26,10 @@ type FuddleNode struct {
 }
 
 func (n *FuddleNode) Shutdown() {
-	n.RPCProxy.Close()
+	// Shutdown the node before closing the proxy so the node can drain its
+	// client streams.
 	n.Fuddle.Shutdown()
+	n.RPCProxy.Close()
 }
 
 type Cluster struct {
@@ -36,6 +38,8 @@ type Cluster struct {
 	memberNodes map[*MemberNode]interface{}
 
 	logDir string
+
+	encryptionKey string
 }
 
 func NewCluster(opts ...Option) (*Cluster, error) {
@@ -59,9 +63,15 @@ func NewCluster(opts ...Option) (*Cluster, error) {
 		fuddleNodes: make(map[*FuddleNode]interface{}),
 		memberNodes: make(map[*MemberNode]interface{}),
 		logDir:      logDir,
+
+		encryptionKey: options.encryptionKey,
+	}
+	var nodeOpts []NodeOption
+	if options.clock != nil {
+		nodeOpts = append(nodeOpts, WithNodeClock(options.clock))
 	}
 	for i := 0; i != options.fuddleNodes; i++ {
-		_, err := c.AddFuddleNode()
+		_, err := c.AddFuddleNode(nodeOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -96,9 +106,14 @@ func (c *Cluster) MemberNodes() []*MemberNode {
 	return nodes
 }
 
+// RPCAddrs returns the RPC addresses of the full Fuddle nodes in the cluster,
+// excluding cache nodes since they don't accept member registrations.
 func (c *Cluster) RPCAddrs() []string {
 	var addrs []string
 	for n := range c.fuddleNodes {
+		if n.Fuddle.Config.Mode == config.ModeCache {
+			continue
+		}
 		addrs = append(addrs, fmt.Sprintf("127.0.0.1:%d", n.Fuddle.Config.RPC.AdvPort))
 	}
 	return addrs
@@ -112,7 +127,13 @@ func (c *Cluster) GossipAddrs() []string {
 	return addrs
 }
 
-func (c *Cluster) AddFuddleNode() (*FuddleNode, error) {
+// AddFuddleNode adds a Fuddle node to the cluster with the given options.
+func (c *Cluster) AddFuddleNode(opts ...NodeOption) (*FuddleNode, error) {
+	options := defaultNodeOptions()
+	for _, o := range opts {
+		o.applyNode(&options)
+	}
+
 	gossipTCPLn, err := tcpListen(0)
 	if err != nil {
 		return nil, fmt.Errorf("cluster: add node: %w", err)
@@ -160,10 +181,15 @@ func (c *Cluster) AddFuddleNode() (*FuddleNode, error) {
 
 	conf := config.DefaultConfig()
 
+	conf.Mode = options.mode
+	conf.Federation.Clusters = options.federatedClusters
+
 	conf.RPC.BindAddr = "0.0.0.0"
 	conf.RPC.AdvAddr = "127.0.0.1"
 	conf.RPC.BindPort = rpcPort
 	conf.RPC.AdvPort = rpcProxyPort
+	// Use a short drain window so removing nodes doesn't block for long.
+	conf.RPC.DrainWindow = time.Second
 
 	conf.Admin.BindAddr = "0.0.0.0"
 	conf.Admin.BindPort = adminPort
@@ -175,6 +201,7 @@ func (c *Cluster) AddFuddleNode() (*FuddleNode, error) {
 	conf.Gossip.BindPort = gossipPort
 	conf.Gossip.AdvPort = gossipPort
 	conf.Gossip.Seeds = c.GossipAddrs()
+	conf.Gossip.EncryptionKey = c.encryptionKey
 
 	f, err := node.NewNode(
 		conf,
@@ -183,6 +210,7 @@ func (c *Cluster) AddFuddleNode() (*FuddleNode, error) {
 		node.WithGossipTCPListener(gossipTCPLn),
 		node.WithGossipUDPListener(gossipUDPLn),
 		node.WithLogPath(c.LogPath(conf.NodeID)),
+		node.WithClock(options.clock),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("cluster: %w", err)
@@ -1,10 +1,17 @@
 package cluster
 
+import (
+	"github.com/fuddle-io/fuddle/pkg/clock"
+	"github.com/fuddle-io/fuddle/pkg/config"
+)
+
 type options struct {
 	fuddleNodes    int
 	memberNodes    int
 	defaultCluster bool
 	logDir         string
+	clock          clock.Clock
+	encryptionKey  string
 }
 
 func defaultOptions() options {
@@ -13,6 +20,7 @@ func defaultOptions() options {
 		memberNodes:    0,
 		defaultCluster: false,
 		logDir:         "",
+		clock:          nil,
 	}
 }
 
@@ -65,3 +73,93 @@ func (o logDirOption) apply(opts *options) {
 func WithLogDir(dir string) Option {
 	return logDirOption{dir: dir}
 }
+
+type clockOption struct {
+	clock clock.Clock
+}
+
+func (o clockOption) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock of the Fuddle nodes created with the cluster.
+// Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return clockOption{clock: c}
+}
+
+type gossipEncryptionKeyOption struct {
+	key string
+}
+
+func (o gossipEncryptionKeyOption) apply(opts *options) {
+	opts.encryptionKey = o.key
+}
+
+// WithGossipEncryptionKey sets the base64 encoded key used to encrypt gossip
+// traffic between the Fuddle nodes in the cluster, including nodes added
+// later. Defaults to no encryption.
+func WithGossipEncryptionKey(key string) Option {
+	return gossipEncryptionKeyOption{key: key}
+}
+
+type nodeOptions struct {
+	clock             clock.Clock
+	mode              string
+	federatedClusters []config.FederatedCluster
+}
+
+func defaultNodeOptions() nodeOptions {
+	return nodeOptions{
+		clock: clock.NewRealClock(),
+		mode:  config.ModeFull,
+	}
+}
+
+// NodeOption configures a Fuddle node added to the cluster.
+type NodeOption interface {
+	applyNode(*nodeOptions)
+}
+
+type nodeClockOption struct {
+	clock clock.Clock
+}
+
+func (o nodeClockOption) applyNode(opts *nodeOptions) {
+	opts.clock = o.clock
+}
+
+// WithNodeClock sets the clock of the added Fuddle node, such as to run the
+// node with an offset (using clock.OffsetClock) or frozen (using
+// clock.ManualClock) clock. Defaults to the system clock.
+func WithNodeClock(c clock.Clock) NodeOption {
+	return nodeClockOption{clock: c}
+}
+
+type nodeModeOption struct {
+	mode string
+}
+
+func (o nodeModeOption) applyNode(opts *nodeOptions) {
+	opts.mode = o.mode
+}
+
+// WithNodeMode sets the mode of the added Fuddle node, such as
+// config.ModeCache to add a read-only cache node. Defaults to config.ModeFull.
+func WithNodeMode(mode string) NodeOption {
+	return nodeModeOption{mode: mode}
+}
+
+type nodeFederationOption struct {
+	clusters []config.FederatedCluster
+}
+
+func (o nodeFederationOption) applyNode(opts *nodeOptions) {
+	opts.federatedClusters = o.clusters
+}
+
+// WithNodeFederation sets the remote clusters the added Fuddle node federates
+// with, making the node a federation gateway.
+func WithNodeFederation(clusters ...config.FederatedCluster) NodeOption {
+	return nodeFederationOption{clusters: clusters}
+}
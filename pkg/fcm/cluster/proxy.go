@@ -110,6 +110,10 @@ func (c *proxyConn) Close() {
 }
 
 func (c *proxyConn) forward(dst io.Writer, src io.Reader) {
+	// Close both sides of the connection when either side closes, otherwise
+	// the peer may wait on a half closed connection.
+	defer c.Close()
+
 	buf := make([]byte, 1024)
 	for {
 		n, err := src.Read(buf)
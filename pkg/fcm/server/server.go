@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/fcm/cluster"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -21,6 +22,13 @@ type clusterRequest struct {
 type nodesRequest struct {
 	Nodes   int `json:"nodes,omitempty"`
 	Members int `json:"members,omitempty"`
+
+	// ClockOffset is a duration (such as "-30s") added to the clock of the
+	// added Fuddle nodes, to simulate clock skew.
+	ClockOffset string `json:"clock_offset,omitempty"`
+	// FrozenClock freezes the clock of the added Fuddle nodes at the time
+	// they are added.
+	FrozenClock bool `json:"frozen_clock,omitempty"`
 }
 
 type nodeResponse struct {
@@ -103,10 +111,12 @@ func NewServer(addr string, port int, clusters *cluster.Manager, opts ...Option)
 	}
 
 	s.httpServer = &http.Server{
-		Handler:           r,
-		Addr:              ln.Addr().String(),
-		ReadTimeout:       1 * time.Second,
-		WriteTimeout:      1 * time.Second,
+		Handler:     r,
+		Addr:        ln.Addr().String(),
+		ReadTimeout: 1 * time.Second,
+		// Removing nodes waits for the nodes to drain their client
+		// connections, so allow time for the response.
+		WriteTimeout:      30 * time.Second,
 		IdleTimeout:       30 * time.Second,
 		ReadHeaderTimeout: 2 * time.Second,
 	}
@@ -261,9 +271,16 @@ func (s *Server) addNodes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	nodeClock, err := parseNodeClock(req.ClockOffset, req.FrozenClock)
+	if err != nil {
+		s.logger.Warn("add nodes; invalid clock", zap.Error(err))
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
 	resp := nodesResponse{}
 	for i := 0; i != req.Nodes; i++ {
-		n, err := c.AddFuddleNode()
+		n, err := c.AddFuddleNode(cluster.WithNodeClock(nodeClock))
 		if err != nil {
 			s.logger.Error("failed to add fuddle node", zap.Error(err))
 			http.Error(w, "internal server error", http.StatusInternalServerError)
@@ -374,3 +391,20 @@ func (s *Server) clusterPromTargets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// parseNodeClock returns the clock for added Fuddle nodes, with the given
+// offset (if not empty) and frozen at the current time if frozen is true.
+func parseNodeClock(offset string, frozen bool) (clock.Clock, error) {
+	var c clock.Clock = clock.NewRealClock()
+	if frozen {
+		c = clock.NewManualClock(time.Now())
+	}
+	if offset != "" {
+		d, err := time.ParseDuration(offset)
+		if err != nil {
+			return nil, fmt.Errorf("clock offset: %w", err)
+		}
+		c = clock.NewOffsetClock(c, d)
+	}
+	return c, nil
+}
@@ -0,0 +1,201 @@
+// Package federation exchanges registry state between independent Fuddle
+// clusters, such as clusters in different regions.
+//
+// Each cluster runs its own gossip and replication, and one or more gateway
+// nodes in each cluster stream the registry of the remote clusters over a WAN
+// link. Members received from a remote cluster are marked with their origin
+// cluster and replicated to the rest of the gateways cluster, though are
+// read-only outside of their origin cluster.
+package federation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Gateway streams the registry of each remote cluster into the local
+// registry.
+//
+// The gateway subscribes to a gateway node in the remote cluster using the
+// client read API, so only receives the members registered with the remote
+// cluster, not members the remote cluster federated from other clusters.
+// Therefore each cluster must federate directly with every cluster whose
+// members it needs.
+//
+// If the connection to a remote cluster fails, the gateway keeps retrying
+// each of the clusters addresses in turn until it is closed. When it
+// reconnects it sends the versions of the members it already has, so only
+// receives the updates it missed. Until then the members of the remote
+// cluster are kept as last received.
+type Gateway struct {
+	registry *registry.Registry
+
+	retryInterval time.Duration
+
+	ctx    context.Context
+	cancel func()
+
+	wg sync.WaitGroup
+
+	metrics *Metrics
+	logger  *zap.Logger
+}
+
+func NewGateway(reg *registry.Registry, clusters []config.FederatedCluster, opts ...Option) *Gateway {
+	options := defaultOptions()
+	for _, o := range opts {
+		o.apply(options)
+	}
+
+	metrics := NewMetrics()
+	if options.collector != nil {
+		metrics.Register(options.collector)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &Gateway{
+		registry:      reg,
+		retryInterval: options.retryInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+		metrics:       metrics,
+		logger:        options.logger,
+	}
+
+	for _, cluster := range clusters {
+		cluster := cluster
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			g.federate(cluster)
+		}()
+	}
+
+	return g
+}
+
+func (g *Gateway) Metrics() *Metrics {
+	return g.metrics
+}
+
+// Close stops streaming from the remote clusters and waits for the streams to
+// close.
+func (g *Gateway) Close() {
+	g.cancel()
+	g.wg.Wait()
+}
+
+// federate streams from the remote cluster until the gateway is closed,
+// retrying the clusters addresses in turn.
+func (g *Gateway) federate(cluster config.FederatedCluster) {
+	logger := g.logger.With(zap.String("cluster", cluster.Name))
+	labels := map[string]string{
+		"cluster": cluster.Name,
+	}
+
+	g.metrics.Connected.Set(0, labels)
+
+	for i := 0; ; i++ {
+		addr := cluster.Addrs[i%len(cluster.Addrs)]
+
+		err := g.stream(cluster.Name, addr, logger)
+		g.metrics.Connected.Set(0, labels)
+
+		select {
+		case <-g.ctx.Done():
+			return
+		default:
+		}
+
+		logger.Warn(
+			"remote cluster stream closed; retrying",
+			zap.String("addr", addr),
+			zap.Duration("retry-interval", g.retryInterval),
+			zap.Error(err),
+		)
+
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-time.After(g.retryInterval):
+		}
+	}
+}
+
+// stream subscribes to the registry of the remote cluster at the given
+// address, applying each received update to the local registry until the
+// stream closes.
+func (g *Gateway) stream(cluster string, addr string, logger *zap.Logger) error {
+	labels := map[string]string{
+		"cluster": cluster,
+	}
+
+	// Dial won't connect yet so should never fail.
+	conn, err := grpc.Dial(
+		addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return fmt.Errorf("gateway: %w", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(g.ctx)
+	defer cancel()
+
+	// Subscribe to members in all namespaces, though not members the remote
+	// cluster federated from other clusters.
+	ctx = metadata.AppendToOutgoingContext(
+		ctx, server.NamespaceMetadataKey, registry.AllNamespaces,
+	)
+
+	stream, err := rpc.NewClientReadRegistryClient(conn).Updates(
+		ctx, &rpc.SubscribeRequest{
+			KnownMembers: g.registry.FederatedMembers(cluster),
+		},
+	)
+	if err != nil {
+		g.metrics.ConnectAttempts.Inc(map[string]string{
+			"cluster": cluster,
+			"status":  "fail",
+		})
+		return fmt.Errorf("gateway: %w", err)
+	}
+	// The remote node sends the stream header once subscribed.
+	if _, err := stream.Header(); err != nil {
+		g.metrics.ConnectAttempts.Inc(map[string]string{
+			"cluster": cluster,
+			"status":  "fail",
+		})
+		return fmt.Errorf("gateway: %w", err)
+	}
+
+	g.metrics.ConnectAttempts.Inc(map[string]string{
+		"cluster": cluster,
+		"status":  "ok",
+	})
+	g.metrics.Connected.Set(1, labels)
+
+	logger.Info("streaming remote cluster", zap.String("addr", addr))
+
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("gateway: %w", err)
+		}
+
+		g.metrics.UpdatesInbound.Inc(labels)
+		g.registry.FederatedUpdate(cluster, update)
+	}
+}
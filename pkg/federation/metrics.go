@@ -0,0 +1,40 @@
+package federation
+
+import (
+	"github.com/fuddle-io/fuddle/pkg/metrics"
+)
+
+type Metrics struct {
+	Connected       *metrics.Gauge
+	UpdatesInbound  *metrics.Counter
+	ConnectAttempts *metrics.Counter
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Connected: metrics.NewGauge(
+			"federation",
+			"connected",
+			[]string{"cluster"},
+			"Whether the gateway is streaming the registry of a remote cluster (1 if connected, otherwise 0)",
+		),
+		UpdatesInbound: metrics.NewCounter(
+			"federation",
+			"updates.inbound",
+			[]string{"cluster"},
+			"Number of member updates received from a remote cluster",
+		),
+		ConnectAttempts: metrics.NewCounter(
+			"federation",
+			"connect.attempts",
+			[]string{"cluster", "status"},
+			"Number of attempts to stream the registry of a remote cluster",
+		),
+	}
+}
+
+func (m *Metrics) Register(collector metrics.Collector) {
+	collector.AddGauge(m.Connected)
+	collector.AddCounter(m.UpdatesInbound)
+	collector.AddCounter(m.ConnectAttempts)
+}
@@ -0,0 +1,64 @@
+package federation
+
+import (
+	"time"
+
+	"github.com/fuddle-io/fuddle/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+type options struct {
+	retryInterval time.Duration
+	collector     metrics.Collector
+	logger        *zap.Logger
+}
+
+func defaultOptions() *options {
+	return &options{
+		retryInterval: time.Second,
+		collector:     nil,
+		logger:        zap.NewNop(),
+	}
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type retryIntervalOption struct {
+	interval time.Duration
+}
+
+func (o retryIntervalOption) apply(opts *options) {
+	opts.retryInterval = o.interval
+}
+
+// WithRetryInterval sets the time to wait before reconnecting to a remote
+// cluster after the connection fails. Defaults to 1 second.
+func WithRetryInterval(interval time.Duration) Option {
+	return retryIntervalOption{interval: interval}
+}
+
+type collectorOption struct {
+	collector metrics.Collector
+}
+
+func (o collectorOption) apply(opts *options) {
+	opts.collector = o.collector
+}
+
+func WithCollector(c metrics.Collector) Option {
+	return collectorOption{collector: c}
+}
+
+type loggerOption struct {
+	Log *zap.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.logger = o.Log
+}
+
+func WithLogger(log *zap.Logger) Option {
+	return loggerOption{Log: log}
+}
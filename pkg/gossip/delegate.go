@@ -1,7 +1,7 @@
 package gossip
 
-// delegate is the memberlist delegate which simply returns the advertise RPC
-// address of this node.
+// delegate is the memberlist delegate which simply returns the metadata of
+// this node, such as its advertised RPC address.
 type delegate struct {
 	state []byte
 }
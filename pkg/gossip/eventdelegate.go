@@ -5,34 +5,35 @@ import (
 )
 
 type eventDelegate struct {
-	onJoin  func(node Node)
-	onLeave func(node Node)
+	onJoin   func(node Node)
+	onLeave  func(node Node)
+	onUpdate func(node Node)
 }
 
-func newEventDelegate(onJoin func(node Node), onLeave func(node Node)) *eventDelegate {
+func newEventDelegate(onJoin func(node Node), onLeave func(node Node), onUpdate func(node Node)) *eventDelegate {
 	return &eventDelegate{
-		onJoin:  onJoin,
-		onLeave: onLeave,
+		onJoin:   onJoin,
+		onLeave:  onLeave,
+		onUpdate: onUpdate,
 	}
 }
 
 func (d *eventDelegate) NotifyJoin(n *memberlist.Node) {
 	if d.onJoin != nil {
-		d.onJoin(Node{
-			ID:      n.Name,
-			RPCAddr: string(n.Meta),
-		})
+		d.onJoin(nodeFromMeta(n.Name, n.Meta))
 	}
 }
 
 func (d *eventDelegate) NotifyLeave(n *memberlist.Node) {
 	if d.onLeave != nil {
-		d.onLeave(Node{
-			ID:      n.Name,
-			RPCAddr: string(n.Meta),
-		})
+		d.onLeave(nodeFromMeta(n.Name, n.Meta))
 	}
 }
 
+// NotifyUpdate is called when a node updates its metadata, such as if the
+// node restarts with a new RPC address before the other nodes detect it left.
 func (d *eventDelegate) NotifyUpdate(n *memberlist.Node) {
+	if d.onUpdate != nil {
+		d.onUpdate(nodeFromMeta(n.Name, n.Meta))
+	}
 }
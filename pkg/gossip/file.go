@@ -0,0 +1,30 @@
+package gossip
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces the file at the given path with b. The file is
+// written to a temporary file that is then renamed, so a crash never leaves a
+// partially written file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -5,17 +5,37 @@ import (
 	"time"
 
 	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/fuddle-io/fuddle/pkg/version"
 	"github.com/hashicorp/memberlist"
 	"go.uber.org/zap"
 )
 
+// Node contains the metadata gossiped by a Fuddle node.
 type Node struct {
-	ID      string
-	RPCAddr string
+	ID        string
+	RPCAddr   string
+	AdminAddr string
+
+	// Mode is the mode the node runs in, either config.ModeFull or
+	// config.ModeCache.
+	Mode string
+	// Gateway is whether the node is a federation gateway.
+	Gateway bool
+
+	// Version is the build version of the node.
+	Version string
+	// ProtocolVersion is the version of the node to node protocol the node
+	// uses (see version.ProtocolVersion). This is 0 if the node doesn't
+	// gossip its protocol version.
+	ProtocolVersion int
+
+	Locality config.Locality
 }
 
 type Gossip struct {
 	memberlist *memberlist.Memberlist
+	joiner     *joiner
+	keyring    *Keyring
 	logger     *zap.Logger
 }
 
@@ -31,48 +51,86 @@ func NewGossip(conf *config.Config, opts ...Option) (*Gossip, error) {
 	memberlistConf.BindPort = conf.Gossip.BindPort
 	memberlistConf.AdvertiseAddr = conf.Gossip.AdvAddr
 	memberlistConf.AdvertisePort = conf.Gossip.AdvPort
-	memberlistConf.SuspicionMult = 3
+	memberlistConf.ProbeInterval = conf.Gossip.ProbeInterval
+	memberlistConf.ProbeTimeout = conf.Gossip.ProbeTimeout
+	memberlistConf.SuspicionMult = conf.Gossip.SuspicionMult
+	memberlistConf.GossipNodes = conf.Gossip.GossipNodes
+	memberlistConf.GossipInterval = conf.Gossip.GossipInterval
 	transport, err := newTransport(conf.Gossip, options)
 	if err != nil {
 		return nil, fmt.Errorf("gossip: transport: %w", err)
 	}
 	memberlistConf.Transport = transport
-	memberlistConf.Delegate = newDelegate([]byte(
-		fmt.Sprintf("%s:%d", conf.RPC.AdvAddr, conf.RPC.AdvPort),
-	))
+	meta := encodeNodeMeta(nodeMeta{
+		RPCAddr:          conf.RPC.JoinAdvAddr(),
+		AdminAddr:        conf.Admin.JoinAdvAddr(),
+		Mode:             conf.Mode,
+		Gateway:          len(conf.Federation.Clusters) > 0,
+		Version:          version.Version,
+		ProtocolVersion:  version.ProtocolVersion,
+		Region:           conf.Locality.Region,
+		AvailabilityZone: conf.Locality.AvailabilityZone,
+	})
+	if len(meta) > memberlist.MetaMaxSize {
+		return nil, fmt.Errorf(
+			"gossip: node metadata exceeds %d bytes", memberlist.MetaMaxSize,
+		)
+	}
+	memberlistConf.Delegate = newDelegate(meta)
 	memberlistConf.Events = newEventDelegate(
 		options.onJoin,
 		options.onLeave,
+		options.onUpdate,
 	)
 	memberlistConf.LogOutput = newLoggerWriter(options.logger)
 
-	memberlist, err := memberlist.Create(memberlistConf)
+	keyring, err := newKeyring(conf.Gossip)
 	if err != nil {
-		return nil, fmt.Errorf("gossip: memberlist: %w", err)
+		return nil, fmt.Errorf("gossip: %w", err)
+	}
+	if keyring.Enabled() {
+		memberlistConf.Keyring = keyring.keyring
 	}
 
-	if len(conf.Gossip.Seeds) != 0 {
-		if _, err = memberlist.Join(conf.Gossip.Seeds); err != nil {
-			options.logger.Error(
-				"failed to join cluster",
-				zap.Strings("seeds", conf.Gossip.Seeds),
-				zap.Error(err),
-			)
-			return nil, fmt.Errorf("gossip: memberlist: %w", err)
-		}
+	providers, err := seedProvidersFromConfig(conf.Gossip)
+	if err != nil {
+		return nil, fmt.Errorf("gossip: %w", err)
+	}
+	providers = append(providers, options.seedProviders...)
+
+	memberlist, err := memberlist.Create(memberlistConf)
+	if err != nil {
+		return nil, fmt.Errorf("gossip: memberlist: %w", err)
 	}
 
-	options.logger.Info(
-		"joined cluster",
-		zap.Strings("seeds", conf.Gossip.Seeds),
+	joiner, err := newJoiner(
+		memberlist,
+		providers,
+		conf.Gossip.PeersFile,
+		conf.Gossip.JoinBackoff,
+		conf.Gossip.JoinBackoffMax,
+		conf.Gossip.RejoinInterval,
+		options.logger,
 	)
+	if err != nil {
+		memberlist.Shutdown()
+		return nil, fmt.Errorf("gossip: %w", err)
+	}
+	joiner.Start()
 
 	return &Gossip{
 		memberlist: memberlist,
+		joiner:     joiner,
+		keyring:    keyring,
 		logger:     options.logger,
 	}, nil
 }
 
+// Keyring returns the keyring used to encrypt gossip traffic.
+func (g *Gossip) Keyring() *Keyring {
+	return g.keyring
+}
+
 func (g *Gossip) Nodes() map[string]interface{} {
 	nodes := make(map[string]interface{})
 	for _, m := range g.memberlist.Members() {
@@ -81,8 +139,19 @@ func (g *Gossip) Nodes() map[string]interface{} {
 	return nodes
 }
 
+// NodesInfo returns the gossiped metadata of each node in the cluster, keyed
+// by node ID.
+func (g *Gossip) NodesInfo() map[string]Node {
+	nodes := make(map[string]Node)
+	for _, m := range g.memberlist.Members() {
+		nodes[m.Name] = nodeFromMeta(m.Name, m.Meta)
+	}
+	return nodes
+}
+
 func (g *Gossip) Shutdown() {
 	g.logger.Info("gossip shutdown")
+	g.joiner.Close()
 	if err := g.memberlist.Leave(time.Second); err != nil {
 		g.logger.Error("failed to leave gossip", zap.Error(err))
 	}
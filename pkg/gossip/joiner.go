@@ -0,0 +1,283 @@
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"go.uber.org/zap"
+)
+
+const (
+	// seedDiscoveryTimeout is the maximum time to wait for the seed providers
+	// to discover seeds.
+	seedDiscoveryTimeout = time.Second * 10
+
+	// seedWatchInterval is the interval to check whether the seeds of watched
+	// providers have changed.
+	seedWatchInterval = time.Second
+)
+
+// joiner joins the cluster in the background.
+//
+// Until the node has joined the cluster, the joiner retries joining the seeds
+// with exponential backoff, so nodes in a new cluster can start in any order.
+// Once joined, the joiner periodically rejoins any seeds and persisted peers
+// that aren't known members of the cluster, which heals partitions where the
+// nodes on each side of the partition consider the other side failed.
+//
+// Seeds are discovered from the seed providers each time the joiner joins, so
+// seeds that change, such as DNS records, are always up to date.
+type joiner struct {
+	memberlist *memberlist.Memberlist
+	providers  []SeedProvider
+
+	// peers are the gossip addresses of the nodes known when the node last
+	// ran, which are loaded from the peers file.
+	peers     []string
+	peersFile string
+
+	backoff        time.Duration
+	backoffMax     time.Duration
+	rejoinInterval time.Duration
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+func newJoiner(
+	ml *memberlist.Memberlist,
+	providers []SeedProvider,
+	peersFile string,
+	backoff time.Duration,
+	backoffMax time.Duration,
+	rejoinInterval time.Duration,
+	logger *zap.Logger,
+) (*joiner, error) {
+	peers, err := loadPeers(peersFile)
+	if err != nil {
+		return nil, fmt.Errorf("joiner: %w", err)
+	}
+
+	return &joiner{
+		memberlist:     ml,
+		providers:      providers,
+		peers:          peers,
+		peersFile:      peersFile,
+		backoff:        backoff,
+		backoffMax:     backoffMax,
+		rejoinInterval: rejoinInterval,
+		done:           make(chan struct{}),
+		logger:         logger,
+	}, nil
+}
+
+// Start attempts to join the cluster, then continues joining in the
+// background until the joiner is closed.
+//
+// The first attempt is made before returning so the node usually knows the
+// other nodes in the cluster once started, though failing to join doesn't
+// return an error, since the seeds may not have started yet.
+func (j *joiner) Start() {
+	joined := j.join()
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.run(joined)
+	}()
+}
+
+// Close stops joining and persists the known peers.
+func (j *joiner) Close() {
+	close(j.done)
+	j.wg.Wait()
+
+	j.savePeers()
+}
+
+func (j *joiner) run(joined bool) {
+	backoff := j.backoff
+	for !joined {
+		j.logger.Info(
+			"failed to join cluster; retrying",
+			zap.Duration("backoff", backoff),
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-j.done:
+			return
+		}
+
+		// Once another node has joined this node, this node is part of the
+		// cluster even if it couldn't reach the seeds itself.
+		joined = j.join() || j.memberlist.NumMembers() > 1
+
+		backoff *= 2
+		if backoff > j.backoffMax {
+			backoff = j.backoffMax
+		}
+	}
+
+	j.savePeers()
+
+	var rejoinC <-chan time.Time
+	if j.rejoinInterval > 0 {
+		ticker := time.NewTicker(j.rejoinInterval)
+		defer ticker.Stop()
+		rejoinC = ticker.C
+	}
+
+	watchTicker := time.NewTicker(seedWatchInterval)
+	defer watchTicker.Stop()
+
+	for {
+		select {
+		case <-rejoinC:
+			j.join()
+			j.savePeers()
+		case <-watchTicker.C:
+			if j.seedsChanged() {
+				j.logger.Info("seeds changed; joining")
+				j.join()
+			}
+		case <-j.done:
+			return
+		}
+	}
+}
+
+// join joins the seeds and persisted peers that aren't already known members
+// of the cluster, returning true if at least one node was joined, or there
+// are no nodes to join.
+func (j *joiner) join() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), seedDiscoveryTimeout)
+	defer cancel()
+
+	seeds, err := discoverSeeds(ctx, j.providers)
+	if err != nil {
+		j.logger.Warn("failed to discover seeds", zap.Error(err))
+	}
+	seeds = append(seeds, j.peers...)
+
+	// Seeds may be hostnames, so resolve them to compare with the addresses
+	// of the known members.
+	addrs := j.unknownAddrs(resolveSeeds(ctx, net.DefaultResolver, seeds))
+	if len(addrs) == 0 {
+		// If every seed is already known, such as if this node is the only
+		// seed, there is nothing to join. Though if the seed providers
+		// failed, the node may be missing seeds so hasn't joined.
+		return err == nil || j.memberlist.NumMembers() > 1
+	}
+
+	n, err := j.memberlist.Join(addrs)
+	if n == 0 {
+		j.logger.Warn(
+			"failed to join cluster",
+			zap.Strings("seeds", addrs),
+			zap.Error(err),
+		)
+		return false
+	}
+
+	j.logger.Info(
+		"joined cluster",
+		zap.Strings("seeds", addrs),
+		zap.Int("joined", n),
+	)
+	return true
+}
+
+// unknownAddrs returns the addresses that don't belong to a known member of
+// the cluster, including this node. The addresses must be resolved to
+// '<ip>:<port>' to match the member addresses.
+func (j *joiner) unknownAddrs(addrs []string) []string {
+	known := make(map[string]struct{})
+	for _, m := range j.memberlist.Members() {
+		known[m.Address()] = struct{}{}
+	}
+
+	var unknown []string
+	for _, addr := range addrs {
+		if _, ok := known[addr]; ok {
+			continue
+		}
+		// Avoid joining the same address multiple times if it's returned by
+		// multiple providers.
+		known[addr] = struct{}{}
+		unknown = append(unknown, addr)
+	}
+	return unknown
+}
+
+func (j *joiner) seedsChanged() bool {
+	for _, p := range j.providers {
+		if w, ok := p.(WatchedSeedProvider); ok && w.Changed() {
+			return true
+		}
+	}
+	return false
+}
+
+// savePeers persists the gossip addresses of the other known members of the
+// cluster to the peers file.
+func (j *joiner) savePeers() {
+	if j.peersFile == "" {
+		return
+	}
+
+	local := j.memberlist.LocalNode().Name
+	var peers []string
+	for _, m := range j.memberlist.Members() {
+		if m.Name != local {
+			peers = append(peers, m.Address())
+		}
+	}
+	// If there are no other members keep the existing peers, since they may
+	// still be needed to rejoin the cluster when the node restarts.
+	if len(peers) == 0 {
+		return
+	}
+	sort.Strings(peers)
+
+	// Encoding a list of strings never fails.
+	b, _ := json.Marshal(peers)
+	if err := writeFileAtomic(j.peersFile, b); err != nil {
+		j.logger.Warn("failed to save peers", zap.Error(err))
+		return
+	}
+
+	j.peers = peers
+}
+
+// loadPeers loads the peers persisted to the peers file, returning no peers
+// if the file doesn't exist.
+func loadPeers(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load peers: %w", err)
+	}
+
+	var peers []string
+	if err := json.Unmarshal(b, &peers); err != nil {
+		return nil, fmt.Errorf("load peers: invalid peers file: %w", err)
+	}
+	return peers, nil
+}
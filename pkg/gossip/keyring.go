@@ -0,0 +1,203 @@
+package gossip
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/hashicorp/memberlist"
+)
+
+// ErrEncryptionDisabled is returned when attempting to manage the keyring of
+// a node that doesn't encrypt gossip traffic. Encryption can only be enabled
+// when the node starts.
+var ErrEncryptionDisabled = errors.New("gossip encryption not enabled")
+
+// Keyring manages the keys used to encrypt gossip traffic.
+//
+// The primary key is used to encrypt outgoing messages, though incoming
+// messages may be encrypted with any installed key. Therefore to rotate keys
+// without downtime, the new key must be installed on every node before it is
+// used as the primary key, then the old key removed once every node uses the
+// new key.
+//
+// Keys are base64 encoded. If a keyring file is configured the keyring is
+// persisted after every change, so installed keys are kept across restarts.
+type Keyring struct {
+	// keyring is the memberlist keyring, which is nil if encryption is
+	// disabled.
+	keyring *memberlist.Keyring
+	path    string
+
+	// mu serializes changes to the keyring, since memberlist.Keyring doesn't
+	// protect concurrent changes.
+	mu sync.Mutex
+}
+
+// newKeyring creates the keyring from the gossip config, loading the keyring
+// file if it exists, otherwise using the configured encryption key.
+func newKeyring(conf *config.Gossip) (*Keyring, error) {
+	k := &Keyring{
+		path: conf.KeyringFile,
+	}
+
+	var keys []string
+	if conf.KeyringFile != "" {
+		b, err := os.ReadFile(conf.KeyringFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("keyring: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(b, &keys); err != nil {
+				return nil, fmt.Errorf("keyring: invalid keyring file: %w", err)
+			}
+		}
+	}
+	if len(keys) == 0 && conf.EncryptionKey != "" {
+		keys = []string{conf.EncryptionKey}
+	}
+	if len(keys) == 0 {
+		return k, nil
+	}
+
+	var decoded [][]byte
+	for _, key := range keys {
+		b, err := DecodeKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: %w", err)
+		}
+		decoded = append(decoded, b)
+	}
+
+	keyring, err := memberlist.NewKeyring(decoded, decoded[0])
+	if err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	k.keyring = keyring
+
+	// Persist the keyring so the file exists if the node started with
+	// only an encryption key.
+	if err := k.save(); err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+
+	return k, nil
+}
+
+// Enabled returns whether gossip traffic is encrypted.
+func (k *Keyring) Enabled() bool {
+	return k.keyring != nil
+}
+
+// InstallKey adds the key to the keyring, so incoming messages encrypted with
+// the key are accepted. Installing a key that is already installed has no
+// effect.
+func (k *Keyring) InstallKey(key string) error {
+	return k.update(key, func(b []byte) error {
+		return k.keyring.AddKey(b)
+	})
+}
+
+// UseKey sets the primary key used to encrypt outgoing messages. The key must
+// already be installed.
+func (k *Keyring) UseKey(key string) error {
+	return k.update(key, func(b []byte) error {
+		return k.keyring.UseKey(b)
+	})
+}
+
+// RemoveKey removes the key from the keyring. The primary key can't be
+// removed.
+func (k *Keyring) RemoveKey(key string) error {
+	return k.update(key, func(b []byte) error {
+		return k.keyring.RemoveKey(b)
+	})
+}
+
+// ListKeys returns the installed keys and the primary key.
+func (k *Keyring) ListKeys() ([]string, string, error) {
+	if !k.Enabled() {
+		return nil, "", fmt.Errorf("keyring: %w", ErrEncryptionDisabled)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var keys []string
+	for _, b := range k.keyring.GetKeys() {
+		keys = append(keys, base64.StdEncoding.EncodeToString(b))
+	}
+	primary := base64.StdEncoding.EncodeToString(k.keyring.GetPrimaryKey())
+	return keys, primary, nil
+}
+
+func (k *Keyring) update(key string, f func(b []byte) error) error {
+	if !k.Enabled() {
+		return fmt.Errorf("keyring: %w", ErrEncryptionDisabled)
+	}
+
+	b, err := DecodeKey(key)
+	if err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := f(b); err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+	if err := k.save(); err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+	return nil
+}
+
+// save writes the keyring to the keyring file, with the primary key first.
+func (k *Keyring) save() error {
+	if k.path == "" {
+		return nil
+	}
+
+	var keys []string
+	for _, b := range k.keyring.GetKeys() {
+		keys = append(keys, base64.StdEncoding.EncodeToString(b))
+	}
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	if err := writeFileAtomic(k.path, b); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+	return nil
+}
+
+// DecodeKey decodes a base64 encoded encryption key, returning an error if
+// the key isn't a valid AES key size.
+func DecodeKey(key string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	if err := memberlist.ValidateKey(b); err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	return b, nil
+}
+
+// GenerateKey returns a random base64 encoded 32 byte key, which selects
+// AES-256.
+func GenerateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,120 @@
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tests keyring changes are persisted to the keyring file, and the file takes
+// precedence over the configured encryption key on restart.
+func TestKeyring_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	oldKey, err := GenerateKey()
+	require.NoError(t, err)
+	newKey, err := GenerateKey()
+	require.NoError(t, err)
+
+	k, err := newKeyring(&config.Gossip{
+		EncryptionKey: oldKey,
+		KeyringFile:   path,
+	})
+	require.NoError(t, err)
+	assert.True(t, k.Enabled())
+	assert.Equal(t, []string{oldKey}, readKeyringFile(t, path))
+
+	require.NoError(t, k.InstallKey(newKey))
+	require.NoError(t, k.UseKey(newKey))
+	require.NoError(t, k.RemoveKey(oldKey))
+	assert.Equal(t, []string{newKey}, readKeyringFile(t, path))
+
+	// Restarting with the old encryption key should load the persisted
+	// keyring.
+	k, err = newKeyring(&config.Gossip{
+		EncryptionKey: oldKey,
+		KeyringFile:   path,
+	})
+	require.NoError(t, err)
+
+	keys, primary, err := k.ListKeys()
+	require.NoError(t, err)
+	assert.Equal(t, newKey, primary)
+	assert.Equal(t, []string{newKey}, keys)
+}
+
+func TestKeyring_RemovePrimaryKey(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	k, err := newKeyring(&config.Gossip{
+		EncryptionKey: key,
+	})
+	require.NoError(t, err)
+
+	assert.Error(t, k.RemoveKey(key))
+}
+
+func TestKeyring_InvalidKey(t *testing.T) {
+	_, err := newKeyring(&config.Gossip{
+		EncryptionKey: "aW52YWxpZA==",
+	})
+	assert.Error(t, err)
+}
+
+func TestKeyring_Disabled(t *testing.T) {
+	k, err := newKeyring(&config.Gossip{})
+	require.NoError(t, err)
+	assert.False(t, k.Enabled())
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	assert.ErrorIs(t, k.InstallKey(key), ErrEncryptionDisabled)
+
+	_, _, err = k.ListKeys()
+	assert.ErrorIs(t, err, ErrEncryptionDisabled)
+}
+
+func readKeyringFile(t *testing.T, path string) []string {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var keys []string
+	require.NoError(t, json.Unmarshal(b, &keys))
+	return keys
+}
+
+// Tests the keyring and nodes handlers call the server interceptor, so an
+// interceptor can reject unauthorised requests.
+func TestKeyringServer_Interceptor(t *testing.T) {
+	var methods []string
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		methods = append(methods, info.FullMethod)
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	}
+	dec := func(interface{}) error { return nil }
+
+	for _, m := range keyringServiceDesc.Methods {
+		_, err := m.Handler(&KeyringServer{}, context.Background(), dec, interceptor)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+	_, err := listNodesHandler(&NodesServer{}, context.Background(), dec, interceptor)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	assert.Equal(t, []string{
+		KeyringInstallKeyMethod,
+		KeyringUseKeyMethod,
+		KeyringRemoveKeyMethod,
+		KeyringListKeysMethod,
+		NodesListNodesMethod,
+	}, methods)
+}
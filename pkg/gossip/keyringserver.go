@@ -0,0 +1,329 @@
+package gossip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The keyring service manages the gossip encryption keyring across the
+// cluster. Since the rpc package doesn't define a keyring service, it is
+// registered as its own service using the well known protobuf types:
+//
+//   - InstallKey, UseKey and RemoveKey take the base64 encoded key as a
+//     wrapperspb.StringValue.
+//   - ListKeys returns the keys installed on each node as a structpb.Struct
+//     keyed by node ID (see NodeKeys).
+//
+// The node receiving the request applies the change to its own keyring, then
+// forwards the request to every other node in the cluster with
+// KeyringLocalMetadataKey set, so the receiving nodes only apply the change
+// locally. The request fails if any node fails to apply the change, in which
+// case it can be safely retried as each change is idempotent.
+//
+// The service is served on the RPC port along with the registry and doesn't
+// authenticate callers, so any client that can reach the RPC port of a node
+// can manage the keyring of the whole cluster. The RPC port must only be
+// reachable from trusted networks, or be protected by a server interceptor,
+// which the handlers call the same as generated services.
+const (
+	KeyringServiceName      = "gossip.Keyring"
+	KeyringInstallKeyMethod = "/gossip.Keyring/InstallKey"
+	KeyringUseKeyMethod     = "/gossip.Keyring/UseKey"
+	KeyringRemoveKeyMethod  = "/gossip.Keyring/RemoveKey"
+	KeyringListKeysMethod   = "/gossip.Keyring/ListKeys"
+	KeyringLocalMetadataKey = "fuddle-keyring-local"
+)
+
+// keyringForwardingTimeout is the maximum time to wait for the other nodes to
+// apply a forwarded keyring request.
+const keyringForwardingTimeout = time.Second * 10
+
+// NodeKeys contains the gossip encryption keys installed on a node.
+type NodeKeys struct {
+	Primary string
+	Keys    []string
+}
+
+// KeyringServer serves the keyring service.
+type KeyringServer struct {
+	gossip  *Gossip
+	localID string
+	logger  *zap.Logger
+}
+
+func NewKeyringServer(g *Gossip, localID string, logger *zap.Logger) *KeyringServer {
+	return &KeyringServer{
+		gossip:  g,
+		localID: localID,
+		logger:  logger,
+	}
+}
+
+// RegisterKeyringServer registers the keyring service with the gRPC server.
+func RegisterKeyringServer(s grpc.ServiceRegistrar, srv *KeyringServer) {
+	s.RegisterService(&keyringServiceDesc, srv)
+}
+
+var keyringServiceDesc = grpc.ServiceDesc{
+	ServiceName: KeyringServiceName,
+	// The handlers are functions of KeyringServer rather than an interface.
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "InstallKey",
+			Handler: keyHandler(KeyringInstallKeyMethod, func(s *KeyringServer, key string) error {
+				return s.gossip.Keyring().InstallKey(key)
+			}),
+		},
+		{
+			MethodName: "UseKey",
+			Handler: keyHandler(KeyringUseKeyMethod, func(s *KeyringServer, key string) error {
+				return s.gossip.Keyring().UseKey(key)
+			}),
+		},
+		{
+			MethodName: "RemoveKey",
+			Handler: keyHandler(KeyringRemoveKeyMethod, func(s *KeyringServer, key string) error {
+				return s.gossip.Keyring().RemoveKey(key)
+			}),
+		},
+		{
+			MethodName: "ListKeys",
+			Handler:    listKeysHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// keyHandler returns a handler that applies the key change to the local
+// keyring, then forwards the request to the other nodes unless the request
+// was forwarded.
+func keyHandler(method string, apply func(s *KeyringServer, key string) error) func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := &wrapperspb.StringValue{}
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+
+		s := srv.(*KeyringServer)
+		return intercept(srv, ctx, req, method, interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return s.updateKey(ctx, method, apply, req.(*wrapperspb.StringValue))
+		})
+	}
+}
+
+func (s *KeyringServer) updateKey(ctx context.Context, method string, apply func(s *KeyringServer, key string) error, req *wrapperspb.StringValue) (*emptypb.Empty, error) {
+	logger := s.logger.With(zap.String("rpc", method))
+
+	if err := apply(s, req.Value); err != nil {
+		logger.Warn("keyring update failed", zap.Error(err))
+		return nil, keyringStatusError(err)
+	}
+
+	logger.Info("keyring updated")
+
+	if !forwardedFromContext(ctx) {
+		if err := s.forward(ctx, method, req, logger); err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func listKeysHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &emptypb.Empty{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	s := srv.(*KeyringServer)
+	return intercept(srv, ctx, req, KeyringListKeysMethod, interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.listKeys(ctx, req.(*emptypb.Empty))
+	})
+}
+
+func (s *KeyringServer) listKeys(ctx context.Context, req *emptypb.Empty) (*structpb.Struct, error) {
+	keys, primary, err := s.gossip.Keyring().ListKeys()
+	if err != nil {
+		return nil, keyringStatusError(err)
+	}
+	nodes := map[string]NodeKeys{
+		s.localID: {Primary: primary, Keys: keys},
+	}
+
+	if !forwardedFromContext(ctx) {
+		var mu sync.Mutex
+		err := s.forEachNode(ctx, func(ctx context.Context, id string, conn *grpc.ClientConn) error {
+			resp := &structpb.Struct{}
+			if err := conn.Invoke(ctx, KeyringListKeysMethod, req, resp); err != nil {
+				return err
+			}
+			remote := DecodeNodeKeys(resp)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for id, k := range remote {
+				nodes[id] = k
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+	}
+
+	return EncodeNodeKeys(nodes), nil
+}
+
+// forward sends the request to every other node in the cluster to apply
+// locally.
+func (s *KeyringServer) forward(ctx context.Context, method string, req *wrapperspb.StringValue, logger *zap.Logger) error {
+	return s.forEachNode(ctx, func(ctx context.Context, id string, conn *grpc.ClientConn) error {
+		if err := conn.Invoke(ctx, method, req, &emptypb.Empty{}); err != nil {
+			logger.Warn(
+				"failed to forward keyring update",
+				zap.String("node", id),
+				zap.Error(err),
+			)
+			return err
+		}
+		return nil
+	})
+}
+
+// forEachNode calls f with a connection to each other node in the cluster in
+// parallel, returning an error listing the nodes that failed.
+func (s *KeyringServer) forEachNode(ctx context.Context, f func(ctx context.Context, id string, conn *grpc.ClientConn) error) error {
+	ctx, cancel := context.WithTimeout(ctx, keyringForwardingTimeout)
+	defer cancel()
+
+	ctx = metadata.AppendToOutgoingContext(ctx, KeyringLocalMetadataKey, "true")
+
+	var mu sync.Mutex
+	var failed []string
+
+	var wg sync.WaitGroup
+	for id, node := range s.gossip.NodesInfo() {
+		if id == s.localID {
+			continue
+		}
+
+		id := id
+		addr := node.RPCAddr
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := invokeNode(addr, func(conn *grpc.ClientConn) error {
+				return f(ctx, id, conn)
+			})
+			if err != nil {
+				mu.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %s", id, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("keyring: failed nodes: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// intercept calls the handler through the server interceptor if there is one,
+// the same as generated service handlers.
+func intercept(srv interface{}, ctx context.Context, req interface{}, method string, interceptor grpc.UnaryServerInterceptor, handler grpc.UnaryHandler) (interface{}, error) {
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: method,
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func invokeNode(addr string, f func(conn *grpc.ClientConn) error) error {
+	// Dial won't connect yet so should never fail.
+	conn, err := grpc.Dial(
+		addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return f(conn)
+}
+
+func forwardedFromContext(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(KeyringLocalMetadataKey)
+	return len(values) > 0 && values[0] == "true"
+}
+
+func keyringStatusError(err error) error {
+	if errors.Is(err, ErrEncryptionDisabled) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// EncodeNodeKeys encodes the keys installed on each node, keyed by node ID.
+func EncodeNodeKeys(nodes map[string]NodeKeys) *structpb.Struct {
+	encoded := &structpb.Struct{
+		Fields: make(map[string]*structpb.Value),
+	}
+	for id, k := range nodes {
+		var keys []*structpb.Value
+		for _, key := range k.Keys {
+			keys = append(keys, structpb.NewStringValue(key))
+		}
+		encoded.Fields[id] = structpb.NewStructValue(&structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				"primary": structpb.NewStringValue(k.Primary),
+				"keys":    structpb.NewListValue(&structpb.ListValue{Values: keys}),
+			},
+		})
+	}
+	return encoded
+}
+
+// DecodeNodeKeys decodes the keys installed on each node encoded with
+// EncodeNodeKeys.
+func DecodeNodeKeys(s *structpb.Struct) map[string]NodeKeys {
+	nodes := make(map[string]NodeKeys)
+	for id, v := range s.GetFields() {
+		fields := v.GetStructValue().GetFields()
+		k := NodeKeys{
+			Primary: fields["primary"].GetStringValue(),
+		}
+		for _, key := range fields["keys"].GetListValue().GetValues() {
+			k.Keys = append(k.Keys, key.GetStringValue())
+		}
+		nodes[id] = k
+	}
+	return nodes
+}
@@ -0,0 +1,68 @@
+package gossip
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/fuddle-io/fuddle/pkg/config"
+)
+
+// nodeMeta is the metadata each node gossips to the other nodes in the
+// cluster.
+//
+// Since memberlist limits the metadata to memberlist.MetaMaxSize bytes, the
+// fields are kept short and empty fields are omitted.
+type nodeMeta struct {
+	RPCAddr   string `json:"rpc_addr"`
+	AdminAddr string `json:"admin_addr,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	Gateway   bool   `json:"gateway,omitempty"`
+
+	Version         string `json:"version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+
+	Region           string `json:"region,omitempty"`
+	AvailabilityZone string `json:"az,omitempty"`
+}
+
+func encodeNodeMeta(meta nodeMeta) []byte {
+	// Encoding a struct of strings never fails.
+	b, _ := json.Marshal(meta)
+	return b
+}
+
+// decodeNodeMeta decodes the metadata gossiped by a node.
+//
+// Nodes from before the metadata was encoded only gossip their RPC address,
+// so if the metadata isn't encoded it is used as the RPC address of a full
+// node. Fields added since the node started are left empty.
+func decodeNodeMeta(b []byte) nodeMeta {
+	var meta nodeMeta
+	if !strings.HasPrefix(string(b), "{") || json.Unmarshal(b, &meta) != nil {
+		return nodeMeta{
+			RPCAddr: string(b),
+			Mode:    config.ModeFull,
+		}
+	}
+	if meta.Mode == "" {
+		meta.Mode = config.ModeFull
+	}
+	return meta
+}
+
+func nodeFromMeta(id string, b []byte) Node {
+	meta := decodeNodeMeta(b)
+	return Node{
+		ID:              id,
+		RPCAddr:         meta.RPCAddr,
+		AdminAddr:       meta.AdminAddr,
+		Mode:            meta.Mode,
+		Gateway:         meta.Gateway,
+		Version:         meta.Version,
+		ProtocolVersion: meta.ProtocolVersion,
+		Locality: config.Locality{
+			Region:           meta.Region,
+			AvailabilityZone: meta.AvailabilityZone,
+		},
+	}
+}
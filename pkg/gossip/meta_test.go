@@ -0,0 +1,73 @@
+package gossip
+
+import (
+	"testing"
+
+	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeMeta_EncodeDecode(t *testing.T) {
+	meta := nodeMeta{
+		RPCAddr:          "10.26.104.52:8110",
+		AdminAddr:        "10.26.104.52:8112",
+		Mode:             config.ModeCache,
+		Gateway:          true,
+		Version:          "v0.1.0",
+		ProtocolVersion:  1,
+		Region:           "us-east-1",
+		AvailabilityZone: "us-east-1-c",
+	}
+
+	assert.Equal(t, Node{
+		ID:              "fuddle-123",
+		RPCAddr:         "10.26.104.52:8110",
+		AdminAddr:       "10.26.104.52:8112",
+		Mode:            config.ModeCache,
+		Gateway:         true,
+		Version:         "v0.1.0",
+		ProtocolVersion: 1,
+		Locality: config.Locality{
+			Region:           "us-east-1",
+			AvailabilityZone: "us-east-1-c",
+		},
+	}, nodeFromMeta("fuddle-123", encodeNodeMeta(meta)))
+}
+
+// Tests decoding metadata from nodes that only gossip their RPC address.
+func TestNodeMeta_DecodeLegacy(t *testing.T) {
+	assert.Equal(t, Node{
+		ID:      "fuddle-123",
+		RPCAddr: "10.26.104.52:8110",
+		Mode:    config.ModeFull,
+	}, nodeFromMeta("fuddle-123", []byte("10.26.104.52:8110")))
+}
+
+func TestNodes_EncodeDecode(t *testing.T) {
+	nodes := map[string]Node{
+		"fuddle-123": {
+			ID:              "fuddle-123",
+			RPCAddr:         "10.26.104.52:8110",
+			AdminAddr:       "10.26.104.52:8112",
+			Mode:            config.ModeFull,
+			Version:         "v0.1.0",
+			ProtocolVersion: 1,
+			Locality: config.Locality{
+				Region:           "us-east-1",
+				AvailabilityZone: "us-east-1-c",
+			},
+		},
+		"fuddle-456": {
+			ID:      "fuddle-456",
+			RPCAddr: "10.26.104.53:8110",
+			Mode:    config.ModeCache,
+			Gateway: true,
+		},
+	}
+
+	encoded, err := EncodeNodes(nodes)
+	assert.NoError(t, err)
+	decoded, err := DecodeNodes(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, nodes, decoded)
+}
@@ -0,0 +1,99 @@
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// The nodes service lists the Fuddle nodes in the cluster along with their
+// gossiped metadata. As with the keyring service, it is registered as its own
+// service using the well known protobuf types, where ListNodes returns the
+// nodes as a structpb.Struct keyed by node ID (see EncodeNodes).
+const (
+	NodesServiceName     = "gossip.Nodes"
+	NodesListNodesMethod = "/gossip.Nodes/ListNodes"
+)
+
+// NodesServer serves the nodes service.
+type NodesServer struct {
+	gossip *Gossip
+}
+
+func NewNodesServer(g *Gossip) *NodesServer {
+	return &NodesServer{
+		gossip: g,
+	}
+}
+
+// RegisterNodesServer registers the nodes service with the gRPC server.
+func RegisterNodesServer(s grpc.ServiceRegistrar, srv *NodesServer) {
+	s.RegisterService(&nodesServiceDesc, srv)
+}
+
+var nodesServiceDesc = grpc.ServiceDesc{
+	ServiceName: NodesServiceName,
+	// The handlers are functions of NodesServer rather than an interface.
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListNodes",
+			Handler:    listNodesHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func listNodesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &emptypb.Empty{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	s := srv.(*NodesServer)
+	return intercept(srv, ctx, req, NodesListNodesMethod, interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.listNodes(ctx, req.(*emptypb.Empty))
+	})
+}
+
+func (s *NodesServer) listNodes(ctx context.Context, req *emptypb.Empty) (*structpb.Struct, error) {
+	nodes, err := EncodeNodes(s.gossip.NodesInfo())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return nodes, nil
+}
+
+// EncodeNodes encodes the gossiped metadata of each node, keyed by node ID.
+func EncodeNodes(nodes map[string]Node) (*structpb.Struct, error) {
+	// Convert the nodes to generic JSON values so they can be encoded as a
+	// struct.
+	b, err := json.Marshal(nodes)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(values)
+}
+
+// DecodeNodes decodes the nodes encoded with EncodeNodes.
+func DecodeNodes(s *structpb.Struct) (map[string]Node, error) {
+	b, err := protojson.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var nodes map[string]Node
+	if err := json.Unmarshal(b, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
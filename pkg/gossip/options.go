@@ -7,11 +7,13 @@ import (
 )
 
 type options struct {
-	onJoin      func(node Node)
-	onLeave     func(node Node)
-	tcpListener *net.TCPListener
-	udpListener *net.UDPConn
-	logger      *zap.Logger
+	onJoin        func(node Node)
+	onLeave       func(node Node)
+	onUpdate      func(node Node)
+	seedProviders []SeedProvider
+	tcpListener   *net.TCPListener
+	udpListener   *net.UDPConn
+	logger        *zap.Logger
 }
 
 func defaultOptions() options {
@@ -48,6 +50,34 @@ func WithOnLeave(cb func(node Node)) Option {
 	return onLeaveOption{cb: cb}
 }
 
+type onUpdateOption struct {
+	cb func(node Node)
+}
+
+func (o onUpdateOption) apply(opts *options) {
+	opts.onUpdate = o.cb
+}
+
+// WithOnUpdate sets a callback called when a node in the cluster updates its
+// gossiped metadata.
+func WithOnUpdate(cb func(node Node)) Option {
+	return onUpdateOption{cb: cb}
+}
+
+type seedProvidersOption struct {
+	providers []SeedProvider
+}
+
+func (o seedProvidersOption) apply(opts *options) {
+	opts.seedProviders = append(opts.seedProviders, o.providers...)
+}
+
+// WithSeedProviders adds seed providers to discover nodes to join, in
+// addition to the seed providers in the gossip config.
+func WithSeedProviders(providers ...SeedProvider) Option {
+	return seedProvidersOption{providers: providers}
+}
+
 type tcpListenerOption struct {
 	ln *net.TCPListener
 }
@@ -0,0 +1,254 @@
+package gossip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fuddle-io/fuddle/pkg/config"
+)
+
+// SeedProvider discovers the gossip addresses of nodes in the cluster to
+// join.
+type SeedProvider interface {
+	Seeds(ctx context.Context) ([]string, error)
+}
+
+// WatchedSeedProvider is a SeedProvider whose seeds may change while the node
+// is running, such as seeds read from a file. When the seeds change the node
+// joins the new seeds immediately rather than waiting to rejoin.
+type WatchedSeedProvider interface {
+	SeedProvider
+
+	// Changed returns whether the seeds may have changed since they were
+	// last returned by Seeds.
+	Changed() bool
+}
+
+// StaticSeedProvider provides a fixed list of seeds.
+type StaticSeedProvider struct {
+	seeds []string
+}
+
+func NewStaticSeedProvider(seeds []string) *StaticSeedProvider {
+	return &StaticSeedProvider{
+		seeds: seeds,
+	}
+}
+
+func (p *StaticSeedProvider) Seeds(ctx context.Context) ([]string, error) {
+	return p.seeds, nil
+}
+
+// DNSSeedProvider resolves a DNS name to seeds, using each address the name
+// resolves to with a fixed port.
+type DNSSeedProvider struct {
+	host string
+	port string
+
+	resolver *net.Resolver
+}
+
+// NewDNSSeedProvider returns a provider resolving the given address in the
+// format '<name>:<port>'.
+func NewDNSSeedProvider(addr string) (*DNSSeedProvider, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("dns seed provider: %w", err)
+	}
+	return &DNSSeedProvider{
+		host:     host,
+		port:     port,
+		resolver: net.DefaultResolver,
+	}, nil
+}
+
+func (p *DNSSeedProvider) Seeds(ctx context.Context) ([]string, error) {
+	addrs, err := p.resolver.LookupHost(ctx, p.host)
+	if err != nil {
+		return nil, fmt.Errorf("dns seed provider: %w", err)
+	}
+
+	var seeds []string
+	for _, addr := range addrs {
+		seeds = append(seeds, net.JoinHostPort(addr, p.port))
+	}
+	return seeds, nil
+}
+
+// SRVSeedProvider resolves a DNS SRV name to seeds, using the target and port
+// of each record.
+type SRVSeedProvider struct {
+	name string
+
+	resolver *net.Resolver
+}
+
+func NewSRVSeedProvider(name string) *SRVSeedProvider {
+	return &SRVSeedProvider{
+		name:     name,
+		resolver: net.DefaultResolver,
+	}
+}
+
+func (p *SRVSeedProvider) Seeds(ctx context.Context) ([]string, error) {
+	// With an empty service and protocol the name is looked up directly.
+	_, records, err := p.resolver.LookupSRV(ctx, "", "", p.name)
+	if err != nil {
+		return nil, fmt.Errorf("srv seed provider: %w", err)
+	}
+
+	var seeds []string
+	for _, record := range records {
+		seeds = append(seeds, net.JoinHostPort(
+			strings.TrimSuffix(record.Target, "."),
+			strconv.Itoa(int(record.Port)),
+		))
+	}
+	return seeds, nil
+}
+
+// FileSeedProvider reads seeds from a file, with one gossip address per line.
+// Empty lines and lines starting with '#' are ignored.
+//
+// The file is watched for changes by checking its modification time and size,
+// so it may be updated while the node is running, such as by a configuration
+// management tool.
+type FileSeedProvider struct {
+	path string
+
+	// modTime and size of the file when it was last read.
+	modTime time.Time
+	size    int64
+
+	// mu is a mutex protecting the fields above.
+	mu sync.Mutex
+}
+
+func NewFileSeedProvider(path string) *FileSeedProvider {
+	return &FileSeedProvider{
+		path: path,
+	}
+}
+
+func (p *FileSeedProvider) Seeds(ctx context.Context) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("file seed provider: %w", err)
+	}
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("file seed provider: %w", err)
+	}
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+
+	var seeds []string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("file seed provider: %w", err)
+	}
+	return seeds, nil
+}
+
+func (p *FileSeedProvider) Changed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		// If the file doesn't exist there are no new seeds.
+		return false
+	}
+	return !info.ModTime().Equal(p.modTime) || info.Size() != p.size
+}
+
+// seedProvidersFromConfig returns the seed providers configured in the gossip
+// config.
+func seedProvidersFromConfig(conf *config.Gossip) ([]SeedProvider, error) {
+	var providers []SeedProvider
+	if len(conf.Seeds) != 0 {
+		providers = append(providers, NewStaticSeedProvider(conf.Seeds))
+	}
+	for _, addr := range conf.SeedDNS {
+		p, err := NewDNSSeedProvider(addr)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	for _, name := range conf.SeedSRV {
+		providers = append(providers, NewSRVSeedProvider(name))
+	}
+	if conf.SeedFile != "" {
+		providers = append(providers, NewFileSeedProvider(conf.SeedFile))
+	}
+	return providers, nil
+}
+
+// discoverSeeds returns the seeds from all providers. If a provider fails the
+// seeds of the other providers are still returned, along with an error
+// describing the failed providers, so one unavailable provider doesn't
+// prevent joining the cluster.
+func discoverSeeds(ctx context.Context, providers []SeedProvider) ([]string, error) {
+	var seeds []string
+	var errs []error
+	for _, p := range providers {
+		s, err := p.Seeds(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		seeds = append(seeds, s...)
+	}
+	return seeds, errors.Join(errs...)
+}
+
+// resolveSeeds resolves seeds containing a hostname to the '<ip>:<port>'
+// address of each IP the hostname resolves to, which is the format of the
+// member addresses, so seeds can be compared with the known members.
+//
+// Seeds that can't be resolved, or don't have a port, are returned unchanged
+// so joining them reports the error.
+func resolveSeeds(ctx context.Context, resolver *net.Resolver, seeds []string) []string {
+	var resolved []string
+	for _, seed := range seeds {
+		host, port, err := net.SplitHostPort(seed)
+		if err != nil {
+			resolved = append(resolved, seed)
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			resolved = append(resolved, net.JoinHostPort(ip.String(), port))
+			continue
+		}
+
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			resolved = append(resolved, seed)
+			continue
+		}
+		for _, addr := range addrs {
+			resolved = append(resolved, net.JoinHostPort(addr, port))
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,83 @@
+package gossip
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSSeedProvider(t *testing.T) {
+	p, err := NewDNSSeedProvider("localhost:8111")
+	require.NoError(t, err)
+
+	seeds, err := p.Seeds(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, seeds, "127.0.0.1:8111")
+}
+
+func TestDNSSeedProvider_MissingPort(t *testing.T) {
+	_, err := NewDNSSeedProvider("localhost")
+	assert.Error(t, err)
+}
+
+func TestResolveSeeds(t *testing.T) {
+	resolved := resolveSeeds(context.Background(), net.DefaultResolver, []string{
+		"localhost:8111",
+		"10.26.104.52:8111",
+		"[::1]:8111",
+		"missing-port",
+	})
+	assert.Contains(t, resolved, "127.0.0.1:8111")
+	assert.Contains(t, resolved, "10.26.104.52:8111")
+	assert.Contains(t, resolved, "[::1]:8111")
+	assert.Contains(t, resolved, "missing-port")
+	assert.NotContains(t, resolved, "localhost:8111")
+}
+
+func TestFileSeedProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeds")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# Comments and empty lines are ignored.
+10.26.104.52:8111
+
+10.26.104.53:8111
+`), 0o644))
+
+	p := NewFileSeedProvider(path)
+	assert.True(t, p.Changed())
+
+	seeds, err := p.Seeds(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.26.104.52:8111", "10.26.104.53:8111"}, seeds)
+	assert.False(t, p.Changed())
+
+	require.NoError(t, os.WriteFile(path, []byte("10.26.104.54:8111\n"), 0o644))
+	// Ensure the modification time changes even on file systems with a
+	// coarse timestamp resolution.
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+	assert.True(t, p.Changed())
+
+	seeds, err = p.Seeds(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.26.104.54:8111"}, seeds)
+	assert.False(t, p.Changed())
+}
+
+// Tests a failed provider doesn't prevent discovering the seeds of the other
+// providers.
+func TestDiscoverSeeds_ProviderFails(t *testing.T) {
+	seeds, err := discoverSeeds(context.Background(), []SeedProvider{
+		NewStaticSeedProvider([]string{"10.26.104.52:8111"}),
+		NewFileSeedProvider(filepath.Join(t.TempDir(), "missing")),
+		NewStaticSeedProvider([]string{"10.26.104.53:8111"}),
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"10.26.104.52:8111", "10.26.104.53:8111"}, seeds)
+}
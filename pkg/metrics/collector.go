@@ -3,4 +3,5 @@ package metrics
 type Collector interface {
 	AddGauge(g *Gauge)
 	AddCounter(c *Counter)
+	AddHistogram(h *Histogram)
 }
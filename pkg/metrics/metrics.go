@@ -62,6 +62,9 @@ func (c *Counter) Add(n int, labels map[string]string) {
 }
 
 func (c *Counter) Value(labels map[string]string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	return c.values[labelsToString(labels)]
 }
 
@@ -124,6 +127,9 @@ func (g *Gauge) Set(v float64, labels map[string]string) {
 }
 
 func (g *Gauge) Value(labels map[string]string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	return g.values[labelsToString(labels)]
 }
 
@@ -131,6 +137,71 @@ func (g *Gauge) ToProm() *prometheus.GaugeVec {
 	return g.promGauge
 }
 
+type histogramValue struct {
+	count uint64
+	sum   float64
+}
+
+// Histogram samples observations into the given buckets, such as to measure
+// latencies.
+type Histogram struct {
+	values map[string]histogramValue
+
+	// mu is a mutex protecting the fields above.
+	mu sync.Mutex
+
+	promHistogram *prometheus.HistogramVec
+}
+
+func NewHistogram(subsystem string, name string, labels []string, buckets []float64, help string) *Histogram {
+	return &Histogram{
+		values: make(map[string]histogramValue),
+		promHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:      strings.ReplaceAll(name, ".", "_"),
+				Subsystem: subsystem,
+				Namespace: "fuddle",
+				Help:      help,
+				Buckets:   buckets,
+			},
+			labels,
+		),
+	}
+}
+
+func (h *Histogram) Observe(v float64, labels map[string]string) {
+	labelsToLowercase(labels)
+
+	h.mu.Lock()
+	value := h.values[labelsToString(labels)]
+	value.count++
+	value.sum += v
+	h.values[labelsToString(labels)] = value
+	h.mu.Unlock()
+
+	h.promHistogram.With(prometheus.Labels(labels)).Observe(v)
+}
+
+// Count returns the number of observations with the given labels.
+func (h *Histogram) Count(labels map[string]string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.values[labelsToString(labels)].count
+}
+
+// Sum returns the sum of the observations with the given labels.
+func (h *Histogram) Sum(labels map[string]string) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.values[labelsToString(labels)].sum
+}
+
+func (h *Histogram) ToProm() *prometheus.HistogramVec {
+	return h.promHistogram
+}
+
 func labelsToString(labels map[string]string) string {
 	var labelledValues []labelledValue
 	for l, v := range labels {
@@ -82,3 +82,30 @@ func TestGauge(t *testing.T) {
 		"c": "3",
 	}))
 }
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram("foo", "bar", []string{"a"}, []float64{1, 5, 10}, "")
+
+	histogram.Observe(2.0, map[string]string{
+		"a": "x",
+	})
+	histogram.Observe(8.0, map[string]string{
+		"a": "x",
+	})
+	histogram.Observe(3.0, map[string]string{
+		"a": "y",
+	})
+
+	assert.Equal(t, uint64(2), histogram.Count(map[string]string{
+		"a": "x",
+	}))
+	assert.Equal(t, 10.0, histogram.Sum(map[string]string{
+		"a": "x",
+	}))
+	assert.Equal(t, uint64(1), histogram.Count(map[string]string{
+		"a": "y",
+	}))
+	assert.Equal(t, uint64(0), histogram.Count(map[string]string{
+		"a": "z",
+	}))
+}
@@ -25,6 +25,10 @@ func (c *PromCollector) AddCounter(counter *Counter) {
 	c.reg.MustRegister(counter.ToProm())
 }
 
+func (c *PromCollector) AddHistogram(h *Histogram) {
+	c.reg.MustRegister(h.ToProm())
+}
+
 func (c *PromCollector) Registry() *prometheus.Registry {
 	return c.reg
 }
@@ -1,32 +1,58 @@
 package node
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
 	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	adminServer "github.com/fuddle-io/fuddle/pkg/admin/server"
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/cluster"
+	clusterv2 "github.com/fuddle-io/fuddle/pkg/clusterv2"
 	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/fuddle-io/fuddle/pkg/federation"
 	"github.com/fuddle-io/fuddle/pkg/gossip"
 	"github.com/fuddle-io/fuddle/pkg/logger"
 	"github.com/fuddle-io/fuddle/pkg/metrics"
 	"github.com/fuddle-io/fuddle/pkg/registry/registry"
 	registryServer "github.com/fuddle-io/fuddle/pkg/registry/server"
+	"github.com/fuddle-io/fuddle/pkg/registry/storage"
+	registryv2 "github.com/fuddle-io/fuddle/pkg/registryv2/registry"
+	registryv2Server "github.com/fuddle-io/fuddle/pkg/registryv2/server"
 	rpcServer "github.com/fuddle-io/fuddle/pkg/server"
 	"go.uber.org/zap"
 )
 
+// handoffTimeout is the maximum time to wait for the other nodes to accept
+// the handoff of this nodes members when shutting down.
+const handoffTimeout = time.Second * 5
+
 // Node sets up and manages a Fuddle node.
 type Node struct {
 	Config *config.Config
 
 	gossip      *gossip.Gossip
 	registry    *registry.Registry
+	storage     *storage.Storage
 	cluster     *cluster.Cluster
 	rpcServer   *rpcServer.Server
+	drainer     *registryServer.Drainer
 	adminServer *adminServer.Server
 
+	// gateway streams the registry of remote clusters, which is only set if
+	// the node is a federation gateway.
+	gateway *federation.Gateway
+
+	// registryV2, clusterV2 and failureDetectorV2 are only set if the v2
+	// registry is enabled.
+	registryV2        *registryv2.Registry
+	clusterV2         *clusterv2.Cluster
+	failureDetectorV2 *registryv2.FailureDetector
+
+	clock clock.Clock
+
 	done chan interface{}
 
 	logger *zap.Logger
@@ -52,37 +78,109 @@ func NewNode(conf *config.Config, opts ...Option) (*Node, error) {
 
 	logger.Logger("fuddle").Info("starting fuddle", zap.Object("conf", conf))
 
-	r := registry.NewRegistry(
-		conf.NodeID,
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("fuddle: %w", err)
+	}
+	cacheMode := conf.Mode == config.ModeCache
+	if cacheMode && conf.Registry.V2Enabled {
+		return nil, fmt.Errorf("fuddle: cache mode doesn't support the v2 registry")
+	}
+
+	var registryOpts []registry.Option
+	var store *storage.Storage
+	if conf.Registry.DataDir != "" {
+		store, err = storage.Open(
+			conf.Registry.DataDir,
+			storage.WithLogger(logger.Logger("storage")),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("fuddle: %w", err)
+		}
+		registryOpts = append(registryOpts, registry.WithStorage(store))
+	}
+	if cacheMode {
+		registryOpts = append(registryOpts, registry.WithReadOnly())
+	}
+	clockDriftPolicy, err := registry.ParseClockDriftPolicy(conf.Registry.ClockDriftPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("fuddle: %w", err)
+	}
+	registryOpts = append(
+		registryOpts,
 		registry.WithLocalMember(&rpc.MemberState{
 			Id:       conf.NodeID,
-			Status:   "active",
+			Status:   registry.StatusActive,
 			Service:  "fuddle",
-			Started:  time.Now().UnixMilli(),
+			Started:  options.clock.Now().UnixMilli(),
 			Revision: "unknown",
 		}),
 		registry.WithHeartbeatTimeout(conf.Registry.HeartbeatTimeout.Milliseconds()),
 		registry.WithReconnectTimeout(conf.Registry.ReconnectTimeout.Milliseconds()),
 		registry.WithTombstoneTimeout(conf.Registry.TombstoneTimeout.Milliseconds()),
+		registry.WithMaxClockDrift(conf.Registry.MaxClockDrift.Milliseconds()),
+		registry.WithClockDriftPolicy(clockDriftPolicy),
+		registry.WithFeedLimit(conf.Registry.ChangeFeedLimit),
+		registry.WithClock(options.clock),
 		registry.WithCollector(collector),
 		registry.WithLogger(logger.Logger("registry")),
 	)
+	r := registry.NewRegistry(conf.NodeID, registryOpts...)
+
+	// Recover any persisted registry state before serving clients.
+	if err := r.Recover(); err != nil {
+		return nil, fmt.Errorf("fuddle: %w", err)
+	}
 
 	c := cluster.NewCluster(
 		r,
 		cluster.WithLogger(logger.Logger("cluster")),
 		cluster.WithCollector(collector),
+		cluster.WithClock(options.clock),
 	)
 
 	r.SubscribeLocal(func(update *rpc.Member2) {
 		c.OnUpdate(update)
 	})
 
+	var r2 *registryv2.Registry
+	var c2 *clusterv2.Cluster
+	if conf.Registry.V2Enabled {
+		r2 = registryv2.NewRegistry(
+			conf.NodeID,
+			options.clock.Now().UnixMilli(),
+			registryv2.WithLocalMember(&rpc.MemberState{
+				Id:       conf.NodeID,
+				Status:   registry.StatusActive,
+				Service:  "fuddle",
+				Started:  options.clock.Now().UnixMilli(),
+				Revision: "unknown",
+			}),
+			registryv2.WithHeartbeatTimeout(conf.Registry.HeartbeatTimeout.Milliseconds()),
+			registryv2.WithReconnectTimeout(conf.Registry.ReconnectTimeout.Milliseconds()),
+			registryv2.WithTombstoneTimeout(conf.Registry.TombstoneTimeout.Milliseconds()),
+			registryv2.WithCollector(collector),
+		)
+		c2 = clusterv2.NewCluster(
+			r2,
+			clusterv2.WithClock(options.clock),
+			clusterv2.WithLogger(logger.Logger("clusterv2")),
+			clusterv2.WithCollector(collector),
+		)
+	}
+
+	var rpcServerOpts []rpcServer.Option
+	if options.rpcListener != nil {
+		rpcServerOpts = append(rpcServerOpts, rpcServer.WithListener(options.rpcListener))
+	}
+	rpcServerOpts = append(rpcServerOpts, rpcServer.WithLogger(logger.Logger("server")))
+	s := rpcServer.NewServer(conf, rpcServerOpts...)
+
 	var adminServerOpts []adminServer.Option
 	if options.adminListener != nil {
 		adminServerOpts = append(adminServerOpts, adminServer.WithListener(options.adminListener))
 	}
 	adminServerOpts = append(adminServerOpts, adminServer.WithCollector(collector))
+	adminServerOpts = append(adminServerOpts, adminServer.WithReady(s.Ready))
 	adminServerOpts = append(adminServerOpts, adminServer.WithLogger(logger.Logger("admin")))
 	adminServer, err := adminServer.NewServer(conf, adminServerOpts...)
 	if err != nil {
@@ -102,12 +200,26 @@ func NewNode(conf *config.Config, opts ...Option) (*Node, error) {
 	}
 	gossipOpts = append(gossipOpts, gossip.WithOnJoin(func(node gossip.Node) {
 		if node.ID != conf.NodeID {
-			c.OnJoin(node.ID, node.RPCAddr)
+			c.OnJoin(node.ID, node.RPCAddr, node.Mode)
+			if c2 != nil {
+				c2.OnJoin(node.ID, node.RPCAddr)
+			}
 		}
 	}))
 	gossipOpts = append(gossipOpts, gossip.WithOnLeave(func(node gossip.Node) {
 		if node.ID != conf.NodeID {
 			c.OnLeave(node.ID)
+			if c2 != nil {
+				c2.OnLeave(node.ID)
+			}
+		}
+	}))
+	gossipOpts = append(gossipOpts, gossip.WithOnUpdate(func(node gossip.Node) {
+		if node.ID != conf.NodeID {
+			c.OnNodeUpdate(node.ID, node.RPCAddr, node.Mode)
+			if c2 != nil {
+				c2.OnNodeUpdate(node.ID, node.RPCAddr)
+			}
 		}
 	}))
 	gossipOpts = append(gossipOpts, gossip.WithLogger(logger.Logger("gossip")))
@@ -117,20 +229,33 @@ func NewNode(conf *config.Config, opts ...Option) (*Node, error) {
 		return nil, fmt.Errorf("fuddle: %w", err)
 	}
 
-	var rpcServerOpts []rpcServer.Option
-	if options.rpcListener != nil {
-		rpcServerOpts = append(rpcServerOpts, rpcServer.WithListener(options.rpcListener))
+	overflowPolicy, err := registry.ParseOverflowPolicy(conf.Registry.SubscriberOverflowPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("fuddle: %w", err)
 	}
-	rpcServerOpts = append(rpcServerOpts, rpcServer.WithLogger(logger.Logger("server")))
-	s := rpcServer.NewServer(conf, rpcServerOpts...)
-
+	drainer := registryServer.NewDrainer()
 	clientReadServer := registryServer.NewClientReadServer(
 		r,
+		registryServer.WithDrainer(drainer),
+		registryServer.WithSubscriberQueueLimit(conf.Registry.SubscriberQueueLimit),
+		registryServer.WithOverflowPolicy(overflowPolicy),
 		registryServer.WithLogger(logger.Logger("registry")),
 		registryServer.WithCollector(collector),
 	)
+	memberValidator, err := registry.NewMemberValidator(&registry.MemberLimits{
+		MaxIDLength:        conf.Registry.MaxMemberIDLength,
+		IDCharset:          conf.Registry.MemberIDCharset,
+		MaxMetadataEntries: conf.Registry.MaxMemberMetadataEntries,
+		MaxMetadataBytes:   conf.Registry.MaxMemberMetadataBytes,
+		RequireService:     conf.Registry.RequireMemberService,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fuddle: %w", err)
+	}
 	clientWriteServer := registryServer.NewClientWriteServer(
 		r,
+		registryServer.WithDrainer(drainer),
+		registryServer.WithMemberValidator(memberValidator),
 		registryServer.WithLogger(logger.Logger("registry")),
 		registryServer.WithCollector(collector),
 	)
@@ -139,9 +264,48 @@ func NewNode(conf *config.Config, opts ...Option) (*Node, error) {
 		registryServer.WithLogger(logger.Logger("registry")),
 		registryServer.WithCollector(collector),
 	)
-	rpc.RegisterClientReadRegistryServer(s.GRPCServer(), clientReadServer)
-	rpc.RegisterClientWriteRegistryServer(s.GRPCServer(), clientWriteServer)
+	// Client services only accept RPCs once the registry has been
+	// bootstrapped, whereas replica services are needed to bootstrap so
+	// accept RPCs immediately.
+	//
+	// Cache nodes never accept registrations, so only serve the read
+	// service. Clients attempting to register with a cache node receive an
+	// Unimplemented status.
+	rpc.RegisterClientReadRegistryServer(s.ReadyRegistrar(), clientReadServer)
+	if !cacheMode {
+		rpc.RegisterClientWriteRegistryServer(s.ReadyRegistrar(), clientWriteServer)
+	}
 	rpc.RegisterReplicaRegistry2Server(s.GRPCServer(), replicaReadServer)
+	registryServer.RegisterReplicaStreamServer(s.GRPCServer(), replicaReadServer)
+	gossip.RegisterKeyringServer(s.GRPCServer(), gossip.NewKeyringServer(
+		g, conf.NodeID, logger.Logger("gossip"),
+	))
+	gossip.RegisterNodesServer(s.GRPCServer(), gossip.NewNodesServer(g))
+
+	if r2 != nil {
+		// The v2 registry serves the v2 client protocol on the same server
+		// as the v1 registry.
+		serverV2Metrics := registryv2Server.NewMetrics()
+		serverV2Metrics.Register(collector)
+
+		rpc.RegisterClientReadRegistry2Server(s.ReadyRegistrar(), registryv2Server.NewClientReadServer(
+			r2,
+			serverV2Metrics,
+			registryv2Server.WithSubscriberQueueLimit(conf.Registry.SubscriberQueueLimit),
+			registryv2Server.WithLogger(logger.Logger("registryv2")),
+		))
+		rpc.RegisterClientWriteRegistry2Server(s.ReadyRegistrar(), registryv2Server.NewClientWriteServer(
+			r2,
+			serverV2Metrics,
+			registryv2Server.WithClock(options.clock),
+			registryv2Server.WithLogger(logger.Logger("registryv2")),
+		))
+		registryv2Server.RegisterReplicaServer(s.GRPCServer(), registryv2Server.NewReplicaServer(
+			r2,
+			serverV2Metrics,
+			registryv2Server.WithLogger(logger.Logger("registryv2")),
+		))
+	}
 
 	if err := s.Serve(); err != nil {
 		return nil, fmt.Errorf("fuddle: %w", err)
@@ -150,16 +314,41 @@ func NewNode(conf *config.Config, opts ...Option) (*Node, error) {
 	n := &Node{
 		Config:      conf,
 		registry:    r,
+		storage:     store,
 		cluster:     c,
 		gossip:      g,
 		rpcServer:   s,
+		drainer:     drainer,
 		adminServer: adminServer,
+		registryV2:  r2,
+		clusterV2:   c2,
+		clock:       options.clock,
 		logger:      logger.Logger("fuddle"),
 		done:        make(chan interface{}),
 	}
+	if r2 != nil {
+		n.failureDetectorV2 = registryv2.NewFailureDetector(r2)
+	}
 
 	go n.failureDetector()
 	go n.replicaRepair()
+	if store != nil {
+		go n.snapshot()
+	}
+
+	n.bootstrap()
+
+	// Only start streaming remote clusters once bootstrapped, so the
+	// federated members are forwarded to the other nodes.
+	if len(conf.Federation.Clusters) > 0 {
+		n.gateway = federation.NewGateway(
+			r,
+			conf.Federation.Clusters,
+			federation.WithRetryInterval(conf.Federation.RetryInterval),
+			federation.WithCollector(collector),
+			federation.WithLogger(logger.Logger("federation")),
+		)
+	}
 
 	return n, nil
 }
@@ -168,22 +357,134 @@ func (n *Node) Registry() *registry.Registry {
 	return n.registry
 }
 
+// RegistryV2 returns the v2 registry, or nil if the v2 registry isn't
+// enabled.
+func (n *Node) RegistryV2() *registryv2.Registry {
+	return n.registryV2
+}
+
 func (n *Node) Nodes() map[string]interface{} {
 	return n.gossip.Nodes()
 }
 
+// Shutdown gracefully shuts down the node.
+//
+// The node first stops accepting new client streams, then closes the existing
+// client streams gradually over the drain window, so clients reconnect to
+// the other nodes without them all reconnecting at once. Once drained, the
+// node hands off ownership of any members it still owns to the other nodes
+// before leaving the cluster.
 func (n *Node) Shutdown() {
 	n.logger.Info("shutting down fuddle")
 
+	n.drain()
+	n.handoff()
+
+	if n.gateway != nil {
+		n.gateway.Close()
+	}
+
+	n.gossip.Shutdown()
+
 	close(n.done)
 
 	n.rpcServer.Shutdown()
-	n.gossip.Shutdown()
 	n.adminServer.Shutdown()
+
+	if n.clusterV2 != nil {
+		n.clusterV2.Close()
+	}
+
+	if n.storage != nil {
+		if err := n.storage.Close(); err != nil {
+			n.logger.Error("failed to close storage", zap.Error(err))
+		}
+	}
+}
+
+// bootstrap syncs the registry from the other nodes in the cluster, then
+// starts accepting client traffic.
+func (n *Node) bootstrap() {
+	if n.Config.Registry.BootstrapTimeout > 0 {
+		ctx, cancel := context.WithTimeout(
+			context.Background(), n.Config.Registry.BootstrapTimeout,
+		)
+		defer cancel()
+
+		if err := n.cluster.Bootstrap(ctx); err != nil {
+			n.logger.Warn(
+				"failed to bootstrap registry; accepting client traffic anyway",
+				zap.Error(err),
+			)
+		}
+	}
+
+	n.rpcServer.SetReady(true)
+	n.logger.Info("fuddle ready")
+}
+
+func (n *Node) drain() {
+	n.logger.Info(
+		"draining client streams",
+		zap.Duration("window", n.Config.RPC.DrainWindow),
+	)
+
+	n.rpcServer.SetReady(false)
+
+	// Allow extra time beyond the window for the streams to close.
+	ctx, cancel := context.WithTimeout(
+		context.Background(), n.Config.RPC.DrainWindow+time.Second*5,
+	)
+	defer cancel()
+	n.drainer.Drain(ctx, n.Config.RPC.DrainWindow, n.reconnectAddr)
+}
+
+// handoff hands off ownership of the members this node still owns to the
+// other nodes in the cluster, so the members aren't marked down once this
+// node leaves.
+func (n *Node) handoff() {
+	ctx, cancel := context.WithTimeout(context.Background(), handoffTimeout)
+	defer cancel()
+
+	if err := n.cluster.Handoff(ctx); err != nil {
+		n.logger.Warn("failed to hand off members", zap.Error(err))
+	}
+}
+
+// reconnectAddr returns the RPC address of a random other node in the
+// cluster for clients to reconnect to, or an empty string if there are no
+// other nodes.
+//
+// Clients are reconnected to a node with the same mode as this node, so
+// subscribers to a cache node move to another cache node, falling back to a
+// full node. Clients of a full node are only reconnected to full nodes, since
+// cache nodes don't accept registrations.
+func (n *Node) reconnectAddr() string {
+	var sameMode, full []string
+	for id, node := range n.gossip.NodesInfo() {
+		if id == n.Config.NodeID {
+			continue
+		}
+		if node.Mode == n.Config.Mode {
+			sameMode = append(sameMode, node.RPCAddr)
+		}
+		if node.Mode == config.ModeFull {
+			full = append(full, node.RPCAddr)
+		}
+	}
+
+	addrs := sameMode
+	if len(addrs) == 0 {
+		addrs = full
+	}
+	if len(addrs) == 0 {
+		return ""
+	}
+	return addrs[rand.Intn(len(addrs))]
 }
 
 func (n *Node) failureDetector() {
-	ticker := time.NewTicker(time.Millisecond * 500)
+	ticker := time.NewTicker(n.Config.Registry.FailureDetectorInterval)
 	defer ticker.Stop()
 
 	for {
@@ -191,13 +492,17 @@ func (n *Node) failureDetector() {
 		case <-n.done:
 			return
 		case <-ticker.C:
-			n.registry.UpdateLiveness(time.Now().UnixMilli())
+			now := n.clock.Now().UnixMilli()
+			n.registry.UpdateLiveness(now)
+			if n.failureDetectorV2 != nil {
+				n.failureDetectorV2.Check(now)
+			}
 		}
 	}
 }
 
 func (n *Node) replicaRepair() {
-	ticker := time.NewTicker(time.Millisecond * 500)
+	ticker := time.NewTicker(n.Config.Registry.RepairInterval)
 	defer ticker.Stop()
 
 	for {
@@ -206,6 +511,25 @@ func (n *Node) replicaRepair() {
 			return
 		case <-ticker.C:
 			n.cluster.ReplicaRepair()
+			if n.clusterV2 != nil {
+				n.clusterV2.ReplicaRepair()
+			}
+		}
+	}
+}
+
+func (n *Node) snapshot() {
+	ticker := time.NewTicker(n.Config.Registry.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+			if err := n.registry.Snapshot(); err != nil {
+				n.logger.Error("failed to snapshot registry", zap.Error(err))
+			}
 		}
 	}
 }
@@ -3,6 +3,7 @@ package node
 import (
 	"net"
 
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -13,12 +14,14 @@ type options struct {
 	adminListener     *net.TCPListener
 	logLevel          zapcore.Level
 	logPath           string
+	clock             clock.Clock
 }
 
 func defaultOptions() options {
 	return options{
 		logLevel: zapcore.InfoLevel,
 		logPath:  "",
+		clock:    clock.NewRealClock(),
 	}
 }
 
@@ -106,3 +109,18 @@ func (o logPathOption) apply(opts *options) {
 func WithLogPath(path string) Option {
 	return logPathOption{path: path}
 }
+
+type clockOption struct {
+	clock clock.Clock
+}
+
+func (o clockOption) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock the node reads the time from, such as to run a
+// node with a skewed or frozen clock in tests. If unset defaults to the system
+// clock.
+func WithClock(c clock.Clock) Option {
+	return clockOption{clock: c}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Handoff sends the updates handing off ownership of this nodes members (see
+// registry.Handoff) to the replica, returning once the replica has
+// acknowledged every update.
+//
+// Unlike Update, the updates are sent synchronously on their own replica
+// stream, so the caller knows the replica has the updates before this node
+// leaves the cluster.
+func (c *ReplicaClient) Handoff(ctx context.Context, members []*rpc.Member2) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ctx = metadata.AppendToOutgoingContext(
+		ctx,
+		server.ReplicaSourceMetadataKey, c.registry.LocalID(),
+		server.ReplicaHandoffMetadataKey, "true",
+	)
+
+	stream, err := c.conn.NewStream(
+		ctx,
+		&server.ReplicaStreamDesc,
+		server.ReplicaStreamMethod,
+		grpc.WaitForReady(true),
+	)
+	if err != nil {
+		return fmt.Errorf("replica client: handoff: %w", err)
+	}
+
+	batches := splitBatches(members, c.batchMaxBytes)
+	for _, b := range batches {
+		msg := &rpc.ReplicaSyncResponse{
+			Members: b,
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The stream was closed by the replica, so get the status
+				// when receiving the acks below.
+				break
+			}
+			return fmt.Errorf("replica client: handoff: %w", err)
+		}
+
+		c.metrics.ReplicaBytesOutbound.Add(proto.Size(msg), map[string]string{
+			"target": c.targetID,
+		})
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("replica client: handoff: %w", err)
+	}
+
+	var acked uint64
+	for acked < uint64(len(batches)) {
+		ack := &rpc.ClientAck{}
+		if err := stream.RecvMsg(ack); err != nil {
+			c.metrics.ReplicaBatchesOutbound.Add(len(batches)-int(acked), map[string]string{
+				"target": c.targetID,
+				"status": "fail",
+			})
+			return fmt.Errorf("replica client: handoff: %w", err)
+		}
+
+		seq := ack.SeqId
+		if seq > uint64(len(batches)) {
+			seq = uint64(len(batches))
+		}
+		for _, b := range batches[acked:seq] {
+			c.metrics.ReplicaBatchesOutbound.Inc(map[string]string{
+				"target": c.targetID,
+				"status": "ok",
+			})
+			c.metrics.ReplicaUpdatesOutbound.Add(len(b), map[string]string{
+				"target": c.targetID,
+				"status": "ok",
+			})
+		}
+		acked = seq
+	}
+
+	return nil
+}
+
+// splitBatches splits the members into batches of up to maxBytes. A member
+// larger than maxBytes is sent in its own batch.
+func splitBatches(members []*rpc.Member2, maxBytes int) [][]*rpc.Member2 {
+	var batches [][]*rpc.Member2
+	var batch []*rpc.Member2
+	bytes := 0
+	for _, m := range members {
+		size := proto.Size(m)
+		if len(batch) > 0 && bytes+size > maxBytes {
+			batches = append(batches, batch)
+			batch = nil
+			bytes = 0
+		}
+		batch = append(batch, m)
+		bytes += size
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"time"
 
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"go.uber.org/zap"
 )
 
@@ -10,13 +11,23 @@ type options struct {
 	pendingUpdatesLimit int
 	updateTimeout       time.Duration
 	digestLimit         int
+	repairBucketLimit   int
+	batchMaxBytes       int
+	batchWindow         time.Duration
+	maxInflightBatches  int
+	clock               clock.Clock
 	logger              *zap.Logger
 }
 
 func defaultOptions() *options {
 	return &options{
-		pendingUpdatesLimit: 128,
+		pendingUpdatesLimit: 0,
 		updateTimeout:       time.Second * 20,
+		repairBucketLimit:   256,
+		batchMaxBytes:       64 * 1024,
+		batchWindow:         time.Millisecond * 10,
+		maxInflightBatches:  8,
+		clock:               clock.NewRealClock(),
 		logger:              zap.NewNop(),
 	}
 }
@@ -33,6 +44,9 @@ func (o pendingUpdatesLimitOption) apply(opts *options) {
 	opts.pendingUpdatesLimit = o.limit
 }
 
+// WithPendingUpdatesLimit sets the maximum number of members with updates
+// waiting to be sent to the replica. If zero or less there is no limit, which
+// is the default since all owned members are pushed when a replica joins.
 func WithPendingUpdatesLimit(limit int) Option {
 	return pendingUpdatesLimitOption{limit: limit}
 }
@@ -61,6 +75,78 @@ func WithDigestLimit(limit int) Option {
 	return digestLimitOption{limit: limit}
 }
 
+type repairBucketLimitOption struct {
+	limit int
+}
+
+func (o repairBucketLimitOption) apply(opts *options) {
+	opts.repairBucketLimit = o.limit
+}
+
+// WithRepairBucketLimit sets the maximum number of mismatched Merkle tree
+// buckets to repair in each sync, which bounds the size of the sync response.
+func WithRepairBucketLimit(limit int) Option {
+	return repairBucketLimitOption{limit: limit}
+}
+
+type batchMaxBytesOption struct {
+	bytes int
+}
+
+func (o batchMaxBytesOption) apply(opts *options) {
+	opts.batchMaxBytes = o.bytes
+}
+
+// WithBatchMaxBytes sets the maximum size of a batch of updates sent on the
+// replica stream. An update larger than the limit is sent in its own batch.
+func WithBatchMaxBytes(bytes int) Option {
+	return batchMaxBytesOption{bytes: bytes}
+}
+
+type batchWindowOption struct {
+	window time.Duration
+}
+
+func (o batchWindowOption) apply(opts *options) {
+	opts.batchWindow = o.window
+}
+
+// WithBatchWindow sets how long to wait for more updates to fill a batch
+// before sending it on the replica stream.
+func WithBatchWindow(window time.Duration) Option {
+	return batchWindowOption{window: window}
+}
+
+type maxInflightBatchesOption struct {
+	limit int
+}
+
+func (o maxInflightBatchesOption) apply(opts *options) {
+	opts.maxInflightBatches = o.limit
+}
+
+// WithMaxInflightBatches sets the maximum number of batches sent on the
+// replica stream that haven't yet been acknowledged by the replica. Once the
+// limit is reached, the client waits for an acknowledgement before sending
+// another batch.
+func WithMaxInflightBatches(limit int) Option {
+	return maxInflightBatchesOption{limit: limit}
+}
+
+type clockOption struct {
+	clock clock.Clock
+}
+
+func (o clockOption) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock used to record the time of the last sync with the
+// replica. Defaults to the system clock.
+func WithClock(c clock.Clock) Option {
+	return clockOption{clock: c}
+}
+
 type loggerOption struct {
 	log *zap.Logger
 }
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
+	"google.golang.org/protobuf/proto"
+)
+
+// pendingUpdates is a queue of updates waiting to be sent to a replica.
+//
+// Only the latest update for each member is kept, so if a member is updated
+// while it already has a pending update, the updates are coalesced. The
+// coalesced update keeps the position of the original update, so a member that
+// is updated frequently can't delay updates to other members. Therefore the
+// number of pending updates is bounded by the number of distinct members
+// rather than the rate of updates.
+type pendingUpdates struct {
+	// limit is the maximum number of members with pending updates. Once
+	// exceeded the oldest updates are dropped. If zero or less there is no
+	// limit.
+	limit int
+
+	// order contains the IDs of members with pending updates, in the order
+	// they were queued.
+	order []string
+	// pending contains the latest pending update for each member.
+	pending map[string]*rpc.Member2
+	// bytes is the encoded size of the pending updates.
+	bytes  int
+	closed bool
+
+	cv *sync.Cond
+
+	// mu protects the fields above.
+	mu *sync.Mutex
+}
+
+func newPendingUpdates(limit int) *pendingUpdates {
+	mu := &sync.Mutex{}
+	return &pendingUpdates{
+		limit:   limit,
+		pending: make(map[string]*rpc.Member2),
+		cv:      sync.NewCond(mu),
+		closed:  false,
+		mu:      mu,
+	}
+}
+
+// Push queues the given update. Returns whether the update was coalesced with
+// an existing pending update for the member, and whether an older update was
+// dropped since the number of pending updates exceeded the limit.
+//
+// If the member has a newer pending update, such as when an update is
+// requeued, the given update is discarded, which isn't counted as coalesced.
+func (p *pendingUpdates) Push(u *rpc.Member2) (coalesced bool, dropped bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false, false
+	}
+
+	id := u.State.Id
+	if existing, ok := p.pending[id]; ok {
+		// Requeued updates may be older than the pending update, in which
+		// case the pending update is kept.
+		if registry.CompareVersions(existing.Version, u.Version) <= 0 {
+			return false, false
+		}
+		p.bytes += proto.Size(u) - proto.Size(existing)
+		p.pending[id] = u
+		return true, false
+	}
+
+	// If the number of pending members exceeds the limit, drop the oldest
+	// update. The dropped updates will be repaired by replica repair.
+	if p.limit > 0 && len(p.order) >= p.limit {
+		p.bytes -= proto.Size(p.pending[p.order[0]])
+		delete(p.pending, p.order[0])
+		p.order = p.order[1:]
+		dropped = true
+	}
+
+	p.order = append(p.order, id)
+	p.pending[id] = u
+	p.bytes += proto.Size(u)
+	p.cv.Signal()
+
+	return false, dropped
+}
+
+// Take returns the next pending update and removes it, or false if the client
+// is closed.
+func (p *pendingUpdates) Take() (*rpc.Member2, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Since we can miss signals, only block if empty.
+	for len(p.order) == 0 && !p.closed {
+		p.cv.Wait()
+	}
+
+	if p.closed {
+		return nil, false
+	}
+
+	return p.popLocked(), true
+}
+
+// TakeBatch removes and returns a batch of pending updates, or false if the
+// client is closed.
+//
+// It blocks until there is a pending update, then waits up to window for more
+// updates until the pending updates exceed maxBytes. The batch contains at
+// least one update, and otherwise is limited to maxBytes.
+func (p *pendingUpdates) TakeBatch(maxBytes int, window time.Duration) ([]*rpc.Member2, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Since we can miss signals, only block if empty.
+	for len(p.order) == 0 && !p.closed {
+		p.cv.Wait()
+	}
+
+	if window > 0 && p.bytes < maxBytes && !p.closed {
+		deadline := time.Now().Add(window)
+		timer := time.AfterFunc(window, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+
+			p.cv.Broadcast()
+		})
+		for p.bytes < maxBytes && !p.closed && time.Now().Before(deadline) {
+			p.cv.Wait()
+		}
+		timer.Stop()
+	}
+
+	if p.closed {
+		return nil, false
+	}
+
+	var batch []*rpc.Member2
+	size := 0
+	for len(p.order) > 0 {
+		s := proto.Size(p.pending[p.order[0]])
+		if len(batch) > 0 && size+s > maxBytes {
+			break
+		}
+		size += s
+		batch = append(batch, p.popLocked())
+	}
+	return batch, true
+}
+
+// Len returns the number of members with pending updates.
+func (p *pendingUpdates) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.order)
+}
+
+func (p *pendingUpdates) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	// Signal the write loop so it closes.
+	p.cv.Broadcast()
+}
+
+// popLocked removes and returns the oldest pending update. The queue must not
+// be empty.
+func (p *pendingUpdates) popLocked() *rpc.Member2 {
+	id := p.order[0]
+	p.order = p.order[1:]
+
+	u := p.pending[id]
+	delete(p.pending, id)
+	p.bytes -= proto.Size(u)
+	return u
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingUpdates_CoalesceUpdates(t *testing.T) {
+	pending := newPendingUpdates(128)
+
+	coalesced, dropped := pending.Push(testMember("member-1", 1))
+	assert.False(t, coalesced)
+	assert.False(t, dropped)
+	pending.Push(testMember("member-2", 2))
+
+	// Updating member-1 should replace its pending update and keep its
+	// position.
+	for i := 3; i != 500; i++ {
+		coalesced, dropped = pending.Push(testMember("member-1", int64(i)))
+		assert.True(t, coalesced)
+		assert.False(t, dropped)
+	}
+
+	m, ok := pending.Take()
+	assert.True(t, ok)
+	assert.Equal(t, "member-1", m.State.Id)
+	assert.Equal(t, int64(499), m.Version.Timestamp.Timestamp)
+
+	m, ok = pending.Take()
+	assert.True(t, ok)
+	assert.Equal(t, "member-2", m.State.Id)
+}
+
+// Tests pushing an older update for a member with a pending update, such as
+// a requeued update, keeps the newer pending update and isn't counted as
+// coalesced.
+func TestPendingUpdates_CoalesceKeepsLatest(t *testing.T) {
+	pending := newPendingUpdates(128)
+
+	pending.Push(testMember("member-1", 10))
+	coalesced, dropped := pending.Push(testMember("member-1", 5))
+	assert.False(t, coalesced)
+	assert.False(t, dropped)
+
+	m, ok := pending.Take()
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), m.Version.Timestamp.Timestamp)
+}
+
+func TestPendingUpdates_Unbounded(t *testing.T) {
+	pending := newPendingUpdates(0)
+
+	for i := 0; i != 10; i++ {
+		_, dropped := pending.Push(testMember(fmt.Sprintf("member-%d", i), int64(i)))
+		assert.False(t, dropped)
+	}
+	assert.Equal(t, 10, pending.Len())
+}
+
+// Tests the default limit doesn't drop updates when pushing more members
+// than the previous limit of 128, such as when a replica joins and all owned
+// members are pushed.
+func TestPendingUpdates_DefaultLimitKeepsAllMembers(t *testing.T) {
+	pending := newPendingUpdates(defaultOptions().pendingUpdatesLimit)
+
+	for i := 0; i != 500; i++ {
+		_, dropped := pending.Push(testMember(fmt.Sprintf("member-%d", i), int64(i)))
+		assert.False(t, dropped)
+	}
+
+	for i := 0; i != 500; i++ {
+		m, ok := pending.Take()
+		assert.True(t, ok)
+		assert.Equal(t, fmt.Sprintf("member-%d", i), m.State.Id)
+	}
+	assert.Equal(t, 0, pending.Len())
+}
+
+func TestPendingUpdates_DropOldest(t *testing.T) {
+	pending := newPendingUpdates(2)
+
+	pending.Push(testMember("member-1", 1))
+	pending.Push(testMember("member-2", 2))
+	coalesced, dropped := pending.Push(testMember("member-3", 3))
+	assert.False(t, coalesced)
+	assert.True(t, dropped)
+
+	batch, ok := pending.TakeBatch(1024*1024, 0)
+	assert.True(t, ok)
+	var ids []string
+	for _, m := range batch {
+		ids = append(ids, m.State.Id)
+	}
+	assert.Equal(t, []string{"member-2", "member-3"}, ids)
+}
+
+func TestPendingUpdates_TakeBatchMaxBytes(t *testing.T) {
+	pending := newPendingUpdates(128)
+
+	for i := 0; i != 10; i++ {
+		pending.Push(testMember(fmt.Sprintf("member-%d", i), int64(i)))
+	}
+
+	batch, ok := pending.TakeBatch(1, time.Millisecond)
+	assert.True(t, ok)
+	// The batch always contains at least one update.
+	assert.Equal(t, 1, len(batch))
+
+	batch, ok = pending.TakeBatch(1024*1024, time.Millisecond)
+	assert.True(t, ok)
+	assert.Equal(t, 9, len(batch))
+}
+
+func TestPendingUpdates_Close(t *testing.T) {
+	pending := newPendingUpdates(128)
+	pending.Close()
+
+	pending.Push(testMember("member-1", 1))
+	_, ok := pending.Take()
+	assert.False(t, ok)
+}
+
+func testMember(id string, timestamp int64) *rpc.Member2 {
+	return &rpc.Member2{
+		State:    testutils.RandomMemberState(id, ""),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "local",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: timestamp,
+			},
+		},
+	}
+}
@@ -3,20 +3,40 @@ package client
 import (
 	"context"
 	"fmt"
+	"math/rand"
+	"strconv"
 	"sync"
 	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/metrics"
 	"github.com/fuddle-io/fuddle/pkg/registry/registry"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 )
 
 type ReplicaClientMetrics struct {
 	ReplicaUpdatesOutbound *metrics.Counter
 	RepairUpdatesInbound   *metrics.Counter
+
+	ReplicaBatchesOutbound *metrics.Counter
+	ReplicaBytesOutbound   *metrics.Counter
+	ReplicaInflightBatches *metrics.Gauge
+
+	PendingUpdates          *metrics.Gauge
+	PendingUpdatesCoalesced *metrics.Counter
+	PendingUpdatesDropped   *metrics.Counter
+
+	RepairBytesSent     *metrics.Counter
+	RepairBytesReceived *metrics.Counter
+	RepairSyncBytes     *metrics.Gauge
+	RepairRoundTrips    *metrics.Counter
+	RepairLastSync      *metrics.Gauge
 }
 
 func NewReplicaClientMetrics() *ReplicaClientMetrics {
@@ -34,12 +54,92 @@ func NewReplicaClientMetrics() *ReplicaClientMetrics {
 			[]string{"source", "status"},
 			"Number of inbound updates from replica repair",
 		),
+
+		ReplicaBatchesOutbound: metrics.NewCounter(
+			"registry",
+			"replica.batches.outbound",
+			[]string{"target", "status"},
+			"Number of outbound batches of updates sent on replica streams",
+		),
+		ReplicaBytesOutbound: metrics.NewCounter(
+			"registry",
+			"replica.bytes.outbound",
+			[]string{"target"},
+			"Number of bytes of updates sent on replica streams",
+		),
+		ReplicaInflightBatches: metrics.NewGauge(
+			"registry",
+			"replica.batches.inflight",
+			[]string{"target"},
+			"Number of batches sent on replica streams waiting to be acknowledged",
+		),
+
+		PendingUpdates: metrics.NewGauge(
+			"registry",
+			"replica.pending",
+			[]string{"target"},
+			"Number of members with updates waiting to be sent to a replica",
+		),
+		PendingUpdatesCoalesced: metrics.NewCounter(
+			"registry",
+			"replica.pending.coalesced",
+			[]string{"target"},
+			"Number of updates to replicas coalesced with a pending update for the same member",
+		),
+		PendingUpdatesDropped: metrics.NewCounter(
+			"registry",
+			"replica.pending.dropped",
+			[]string{"target"},
+			"Number of updates to replicas dropped as the pending updates limit was exceeded",
+		),
+
+		RepairBytesSent: metrics.NewCounter(
+			"registry",
+			"repair.sync.bytes.sent",
+			[]string{"target"},
+			"Number of bytes sent to replicas in replica repair",
+		),
+		RepairBytesReceived: metrics.NewCounter(
+			"registry",
+			"repair.sync.bytes.received",
+			[]string{"target"},
+			"Number of bytes received from replicas in replica repair",
+		),
+		RepairSyncBytes: metrics.NewGauge(
+			"registry",
+			"repair.sync.bytes",
+			[]string{"target"},
+			"Number of bytes exchanged in the last replica repair sync",
+		),
+		RepairRoundTrips: metrics.NewCounter(
+			"registry",
+			"repair.sync.round_trips",
+			[]string{"target"},
+			"Number of round trips to replicas in replica repair",
+		),
+		RepairLastSync: metrics.NewGauge(
+			"registry",
+			"repair.sync.last_success",
+			[]string{"target"},
+			"Unix time in seconds of the last successful replica repair sync",
+		),
 	}
 }
 
 func (m *ReplicaClientMetrics) Register(collector metrics.Collector) {
 	collector.AddCounter(m.ReplicaUpdatesOutbound)
 	collector.AddCounter(m.RepairUpdatesInbound)
+	collector.AddCounter(m.ReplicaBatchesOutbound)
+	collector.AddCounter(m.ReplicaBytesOutbound)
+	collector.AddGauge(m.ReplicaInflightBatches)
+	collector.AddGauge(m.PendingUpdates)
+	collector.AddCounter(m.PendingUpdatesCoalesced)
+	collector.AddCounter(m.PendingUpdatesDropped)
+	collector.AddCounter(m.RepairBytesSent)
+	collector.AddCounter(m.RepairBytesReceived)
+	collector.AddGauge(m.RepairSyncBytes)
+	collector.AddCounter(m.RepairRoundTrips)
+	collector.AddGauge(m.RepairLastSync)
 }
 
 // ReplicaClient is used to make RPCs to other Fuddle nodes in the cluster.
@@ -50,12 +150,17 @@ type ReplicaClient struct {
 	targetID string
 	registry *registry.Registry
 
-	digestLimit int
+	digestLimit       int
+	repairBucketLimit int
 
 	pending *pendingUpdates
 
 	updateTimeout time.Duration
 
+	batchMaxBytes      int
+	batchWindow        time.Duration
+	maxInflightBatches int
+
 	conn   *grpc.ClientConn
 	client rpc.ReplicaRegistry2Client
 
@@ -64,6 +169,7 @@ type ReplicaClient struct {
 
 	wg sync.WaitGroup
 
+	clock   clock.Clock
 	metrics *ReplicaClientMetrics
 	logger  *zap.Logger
 }
@@ -100,17 +206,22 @@ func ReplicaConnect(addr string, targetID string, registry *registry.Registry, m
 
 	ctx, cancel := context.WithCancel(context.Background())
 	c := &ReplicaClient{
-		targetID:      targetID,
-		registry:      registry,
-		digestLimit:   options.digestLimit,
-		pending:       newPendingUpdates(options.pendingUpdatesLimit),
-		updateTimeout: options.updateTimeout,
-		conn:          conn,
-		client:        rpc.NewReplicaRegistry2Client(conn),
-		ctx:           ctx,
-		cancel:        cancel,
-		metrics:       metrics,
-		logger:        options.logger,
+		targetID:           targetID,
+		registry:           registry,
+		digestLimit:        options.digestLimit,
+		repairBucketLimit:  options.repairBucketLimit,
+		pending:            newPendingUpdates(options.pendingUpdatesLimit),
+		updateTimeout:      options.updateTimeout,
+		batchMaxBytes:      options.batchMaxBytes,
+		batchWindow:        options.batchWindow,
+		maxInflightBatches: options.maxInflightBatches,
+		conn:               conn,
+		client:             rpc.NewReplicaRegistry2Client(conn),
+		ctx:                ctx,
+		cancel:             cancel,
+		clock:              options.clock,
+		metrics:            metrics,
+		logger:             options.logger,
 	}
 
 	c.wg.Add(1)
@@ -124,18 +235,44 @@ func ReplicaConnect(addr string, targetID string, registry *registry.Registry, m
 
 // Update forwards the given member update to the connected replica.
 //
-// This sends the update in the background to avoid blocking. If the number of
+// This sends the update in the background to avoid blocking, batching the
+// update with any other pending updates. If the member already has a pending
+// update, only the latest update is sent. If the number of members with
 // pending updates exceeds pendingUpdatesLimit, the older updates are dropped.
-// Therefore if the client cannot connector for a long time, updates may be
+// Therefore if the client cannot connect for a long time, updates may be
 // dropped and have to be repaired by replica repair.
 func (c *ReplicaClient) Update(u *rpc.Member2) {
-	c.pending.Push(u)
+	c.push(u)
 }
 
+// Sync repairs the local registry with the replica.
+//
+// It first compares Merkle trees with the replica to find the buckets of
+// members that differ, then requests the members in those buckets that are
+// missing or out of date. If the replica doesn't support tree repair, it falls
+// back to sending a digest of up to digestLimit members.
 func (c *ReplicaClient) Sync(ctx context.Context) error {
-	resp, err := c.client.Sync(ctx, &rpc.ReplicaSyncRequest{
-		Digest: c.registry.Digest(c.digestLimit),
-	})
+	return c.repair(ctx, false)
+}
+
+// FullSync repairs the local registry with the replica, like Sync, but
+// repairs every mismatched bucket rather than limiting the number of buckets
+// repaired. To bound the size of each sync response, the buckets are
+// requested in pages of up to repairBucketLimit buckets. This is used to
+// bootstrap the registry when the node joins the cluster.
+func (c *ReplicaClient) FullSync(ctx context.Context) error {
+	return c.repair(ctx, true)
+}
+
+func (c *ReplicaClient) repair(ctx context.Context, full bool) error {
+	var bytes int
+	defer func() {
+		c.metrics.RepairSyncBytes.Set(float64(bytes), map[string]string{
+			"target": c.targetID,
+		})
+	}()
+
+	buckets, ok, err := c.mismatchedBuckets(ctx, &bytes)
 	if err != nil {
 		c.metrics.RepairUpdatesInbound.Inc(map[string]string{
 			"source": c.targetID,
@@ -145,12 +282,81 @@ func (c *ReplicaClient) Sync(ctx context.Context) error {
 		return fmt.Errorf("replica client: client: sync: %w", err)
 	}
 
+	var received int
+	if ok {
+		if len(buckets) == 0 {
+			c.logger.Debug(
+				"replica sync; trees match",
+				zap.String("target", c.targetID),
+			)
+			c.setLastSyncMetric()
+			return nil
+		}
+
+		pageSize := c.repairBucketLimit
+		if full && pageSize <= 0 {
+			pageSize = len(buckets)
+		}
+		if !full && len(buckets) > pageSize {
+			rand.Shuffle(len(buckets), func(i, j int) {
+				buckets[i], buckets[j] = buckets[j], buckets[i]
+			})
+			buckets = buckets[:pageSize]
+		}
+
+		for start := 0; start < len(buckets); start += pageSize {
+			end := start + pageSize
+			if end > len(buckets) {
+				end = len(buckets)
+			}
+			page := buckets[start:end]
+
+			md := metadata.Pairs(
+				server.RepairBucketsMetadataKey, server.EncodeTreeIndexes(page),
+			)
+			n, err := c.syncDigest(ctx, md, c.registry.BucketDigest(page), &bytes)
+			if err != nil {
+				return err
+			}
+			received += n
+		}
+	} else {
+		received, err = c.syncDigest(ctx, nil, c.registry.Digest(c.digestLimit), &bytes)
+		if err != nil {
+			return err
+		}
+	}
+
 	c.logger.Info(
 		"replica sync",
 		zap.String("target", c.targetID),
-		zap.Int("digest-len", len(resp.Members)),
+		zap.Bool("tree", ok),
+		zap.Int("buckets", len(buckets)),
+		zap.Int("digest-len", received),
+		zap.Int("bytes", bytes),
 	)
 
+	c.setLastSyncMetric()
+	return nil
+}
+
+// syncDigest sends the digest to the replica and applies the members the
+// replica returns, which are the members that are missing or out of date in
+// the digest. Returns the number of members received.
+func (c *ReplicaClient) syncDigest(ctx context.Context, md metadata.MD, digest map[string]*rpc.MonotonicTimestamp, bytes *int) (int, error) {
+	resp, _, err := c.sync(ctx, md, &rpc.ReplicaSyncRequest{
+		Digest:       digest,
+		SourceNodeId: c.registry.LocalID(),
+	}, bytes)
+	if err != nil {
+		c.metrics.RepairUpdatesInbound.Inc(map[string]string{
+			"source": c.targetID,
+			"status": "fail",
+		})
+
+		return 0, fmt.Errorf("replica client: client: sync: %w", err)
+	}
+
 	c.metrics.RepairUpdatesInbound.Add(len(resp.Members), map[string]string{
 		"source": c.targetID,
 		"status": "ok",
@@ -160,117 +366,107 @@ func (c *ReplicaClient) Sync(ctx context.Context) error {
 		c.registry.RemoteUpdate(m)
 	}
 
-	return nil
+	return len(resp.Members), nil
 }
 
-func (c *ReplicaClient) Close() {
-	c.cancel()
-	c.pending.Close()
-	c.wg.Wait()
-}
-
-func (c *ReplicaClient) sendLoop() {
-	for {
-		m, ok := c.pending.Take()
-		if !ok {
-			// Client closed.
-			return
+// mismatchedBuckets compares the local Merkle tree with the replicas tree,
+// level by level, and returns the buckets whose hashes don't match. Returns
+// false if the replica doesn't support tree repair.
+func (c *ReplicaClient) mismatchedBuckets(ctx context.Context, bytes *int) ([]int, bool, error) {
+	var parents []int
+	for level := 0; level != registry.TreeLevels; level++ {
+		md := metadata.Pairs(server.RepairLevelMetadataKey, strconv.Itoa(level))
+		if level > 0 {
+			md.Set(server.RepairParentsMetadataKey, server.EncodeTreeIndexes(parents))
 		}
 
-		// Update will keep retrying for until cancelled. If it still does not
-		// succeed, the update will be dropped and the replica will get the
-		// update via read repair when it comes back.
-		ctx, cancel := context.WithTimeout(c.ctx, c.updateTimeout)
-		defer cancel()
-		if _, err := c.client.Update(ctx, &rpc.UpdateRequest{
-			Member:       m,
+		_, header, err := c.sync(ctx, md, &rpc.ReplicaSyncRequest{
 			SourceNodeId: c.registry.LocalID(),
-		}); err != nil {
-			c.logger.Warn(
-				"failed to forward update",
-				zap.String("member-id", m.State.Id),
-				zap.String("target", c.targetID),
-				zap.Error(err),
-			)
-
-			c.metrics.ReplicaUpdatesOutbound.Inc(map[string]string{
-				"target": c.targetID,
-				"status": "fail",
-			})
-		} else {
-			c.metrics.ReplicaUpdatesOutbound.Inc(map[string]string{
-				"target": c.targetID,
-				"status": "ok",
-			})
+		}, bytes)
+		if err != nil {
+			return nil, false, err
 		}
-	}
-}
-
-type pendingUpdates struct {
-	limit int
-
-	pending []*rpc.Member2
-	closed  bool
 
-	cv *sync.Cond
+		values := header.Get(server.RepairHashesMetadataKey)
+		if len(values) == 0 {
+			return nil, false, nil
+		}
+		hashes, err := server.DecodeTreeHashes(values[0])
+		if err != nil {
+			return nil, false, err
+		}
 
-	// mu protects the fields above.
-	mu *sync.Mutex
+		parents = c.registry.TreeMismatches(level, parents, hashes)
+		if len(parents) == 0 {
+			return nil, true, nil
+		}
+	}
+	return parents, true, nil
 }
 
-func newPendingUpdates(limit int) *pendingUpdates {
-	mu := &sync.Mutex{}
-	return &pendingUpdates{
-		limit:  limit,
-		cv:     sync.NewCond(mu),
-		closed: false,
-		mu:     mu,
+// sync sends a sync request to the replica with the given metadata, and
+// returns the response and response header.
+func (c *ReplicaClient) sync(ctx context.Context, md metadata.MD, req *rpc.ReplicaSyncRequest, bytes *int) (*rpc.ReplicaSyncResponse, metadata.MD, error) {
+	if md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, md)
 	}
-}
 
-func (p *pendingUpdates) Push(u *rpc.Member2) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	sent := proto.Size(req) + server.MetadataSize(md)
+	*bytes += sent
+	c.metrics.RepairBytesSent.Add(sent, map[string]string{
+		"target": c.targetID,
+	})
+	c.metrics.RepairRoundTrips.Inc(map[string]string{
+		"target": c.targetID,
+	})
 
-	// If the number of pending items exceeds the limit, drop the older updates.
-	// These updates will dropped updates be repaired by replica repair.
-	if len(p.pending) > p.limit {
-		p.pending = p.pending[1:]
+	var header metadata.MD
+	resp, err := c.client.Sync(ctx, req, grpc.Header(&header))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if p.closed {
-		return
-	}
+	received := proto.Size(resp) + server.MetadataSize(header)
+	*bytes += received
+	c.metrics.RepairBytesReceived.Add(received, map[string]string{
+		"target": c.targetID,
+	})
 
-	p.pending = append(p.pending, u)
-	p.cv.Signal()
+	return resp, header, nil
 }
 
-// Take returns the next pending update and removes it, or false if the client
-// is closed.
-func (p *pendingUpdates) Take() (*rpc.Member2, bool) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	// Since we can miss signals, only block if empty.
-	for len(p.pending) == 0 && !p.closed {
-		p.cv.Wait()
+func (c *ReplicaClient) push(u *rpc.Member2) {
+	coalesced, dropped := c.pending.Push(u)
+	c.setPendingMetric()
+	if coalesced {
+		c.metrics.PendingUpdatesCoalesced.Inc(map[string]string{
+			"target": c.targetID,
+		})
 	}
-
-	if p.closed {
-		return nil, false
+	if dropped {
+		c.metrics.PendingUpdatesDropped.Inc(map[string]string{
+			"target": c.targetID,
+		})
 	}
+}
 
-	u := p.pending[0]
-	p.pending = p.pending[1:]
-	return u, true
+func (c *ReplicaClient) setPendingMetric() {
+	c.metrics.PendingUpdates.Set(float64(c.pending.Len()), map[string]string{
+		"target": c.targetID,
+	})
 }
 
-func (p *pendingUpdates) Close() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+func (c *ReplicaClient) setLastSyncMetric() {
+	c.metrics.RepairLastSync.Set(
+		float64(c.clock.Now().UnixMilli())/1000,
+		map[string]string{
+			"target": c.targetID,
+		},
+	)
+}
 
-	p.closed = true
-	// Signal the write loop so it closes.
-	p.cv.Signal()
+func (c *ReplicaClient) Close() {
+	c.cancel()
+	c.pending.Close()
+	c.wg.Wait()
 }
@@ -10,8 +10,10 @@ import (
 	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/registry/client"
 	"github.com/fuddle-io/fuddle/pkg/registry/registry"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
 	"github.com/fuddle-io/fuddle/pkg/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -135,6 +137,246 @@ func TestClient_ForwardUpdateRetryUnavailable(t *testing.T) {
 	assert.True(t, proto.Equal(member, update))
 }
 
+// Tests the replica client batches updates on the replica stream.
+func TestClient_ForwardUpdateBatched(t *testing.T) {
+	serverRegistry := registry.NewRegistry("server")
+	replicaServer := server.NewReplicaServer(serverRegistry)
+	grpcServer, addr, err := serveReplicaServer(replicaServer)
+	require.NoError(t, err)
+	defer grpcServer.Stop()
+
+	metrics := client.NewReplicaClientMetrics()
+	c, err := client.ReplicaConnect(
+		addr,
+		"target",
+		registry.NewRegistry("local"),
+		metrics,
+		client.WithBatchWindow(time.Millisecond*50),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	var members []*rpc.Member2
+	for i := 0; i != 100; i++ {
+		member := &rpc.Member2{
+			State:    testutils.RandomMemberState(fmt.Sprintf("member-%d", i), ""),
+			Liveness: rpc.Liveness_UP,
+			Version: &rpc.Version2{
+				OwnerId: "foo-123",
+				Timestamp: &rpc.MonotonicTimestamp{
+					Timestamp: time.Now().UnixMilli() + 10000,
+				},
+			},
+		}
+		members = append(members, member)
+		c.Update(member)
+	}
+
+	labels := map[string]string{
+		"target": "target",
+		"status": "ok",
+	}
+	assert.Eventually(t, func() bool {
+		return metrics.ReplicaUpdatesOutbound.Value(labels) == 100.0
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, 0.0, metrics.PendingUpdates.Value(map[string]string{
+		"target": "target",
+	}))
+
+	for _, member := range members {
+		m, ok := serverRegistry.MemberState(member.State.Id)
+		assert.True(t, ok)
+		assert.True(t, proto.Equal(member.State, m))
+	}
+
+	// The updates should be sent in fewer batches than updates.
+	batches := metrics.ReplicaBatchesOutbound.Value(labels)
+	assert.Less(t, 0.0, batches)
+	assert.Less(t, batches, 100.0)
+	assert.Equal(t, batches, replicaServer.Metrics().ReplicaBatchesInbound.Value(map[string]string{
+		"source": "local",
+	}))
+}
+
+// Tests the replica client falls back to the unary Update RPC if the replica
+// doesn't support the replica stream.
+func TestClient_ForwardUpdateUnaryFallback(t *testing.T) {
+	// The fake server only registers the unary replica service.
+	server := newFakeReplicaServer(0)
+	grpcServer, addr, err := server.Serve()
+	require.NoError(t, err)
+	defer grpcServer.Stop()
+
+	client, err := client.ReplicaConnect(
+		addr,
+		"target",
+		registry.NewRegistry("local"),
+		client.NewReplicaClientMetrics(),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	for i := 0; i != 3; i++ {
+		member := &rpc.Member2{
+			State:    testutils.RandomMemberState(fmt.Sprintf("member-%d", i), ""),
+			Liveness: rpc.Liveness_UP,
+			Version: &rpc.Version2{
+				OwnerId: "foo-123",
+				Timestamp: &rpc.MonotonicTimestamp{
+					Timestamp: time.Now().UnixMilli() + 10000,
+				},
+			},
+		}
+		client.Update(member)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		update, ok := waitWithContext(ctx, server.Ch)
+		cancel()
+		assert.True(t, ok, "timeout")
+		assert.True(t, proto.Equal(member, update))
+	}
+}
+
+// Tests replica repair compares Merkle trees to find and repair the members
+// that differ.
+func TestClient_SyncTree(t *testing.T) {
+	serverRegistry := registry.NewRegistry("server")
+	clientRegistry := registry.NewRegistry("local")
+	for i := 0; i != 1000; i++ {
+		m := &rpc.Member2{
+			State:    testutils.RandomMemberState(fmt.Sprintf("member-%d", i), ""),
+			Liveness: rpc.Liveness_UP,
+			Version: &rpc.Version2{
+				OwnerId: "remote",
+				Timestamp: &rpc.MonotonicTimestamp{
+					Timestamp: time.Now().UnixMilli(),
+				},
+			},
+		}
+		serverRegistry.RemoteUpdate(m)
+		// Only the server has the first 10 members.
+		if i >= 10 {
+			clientRegistry.RemoteUpdate(m)
+		}
+	}
+
+	grpcServer, addr, err := serveReplicaServer(server.NewReplicaServer(serverRegistry))
+	require.NoError(t, err)
+	defer grpcServer.Stop()
+
+	metrics := client.NewReplicaClientMetrics()
+	c, err := client.ReplicaConnect(
+		addr,
+		"target",
+		clientRegistry,
+		metrics,
+		client.WithClock(clock.NewManualClock(time.Unix(1000, 0))),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, c.Sync(ctx))
+
+	for i := 0; i != 10; i++ {
+		_, ok := clientRegistry.Member(fmt.Sprintf("member-%d", i))
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 10.0, metrics.RepairUpdatesInbound.Value(map[string]string{
+		"source": "target",
+		"status": "ok",
+	}))
+	// The tree exchange plus the bucket sync.
+	assert.Equal(t, float64(registry.TreeLevels+1), metrics.RepairRoundTrips.Value(map[string]string{
+		"target": "target",
+	}))
+	assert.Less(t, 0.0, metrics.RepairSyncBytes.Value(map[string]string{
+		"target": "target",
+	}))
+	assert.Equal(t, 1000.0, metrics.RepairLastSync.Value(map[string]string{
+		"target": "target",
+	}))
+
+	// Once repaired, the trees should match so no further updates are
+	// requested.
+	require.NoError(t, c.Sync(ctx))
+	assert.Equal(t, float64(registry.TreeLevels+2), metrics.RepairRoundTrips.Value(map[string]string{
+		"target": "target",
+	}))
+}
+
+// Tests a full sync repairs every mismatched bucket, requesting the buckets
+// in pages of up to the repair bucket limit.
+func TestClient_FullSyncPagesBuckets(t *testing.T) {
+	serverRegistry := registry.NewRegistry("server")
+	clientRegistry := registry.NewRegistry("local")
+	for i := 0; i != 1000; i++ {
+		serverRegistry.RemoteUpdate(&rpc.Member2{
+			State:    testutils.RandomMemberState(fmt.Sprintf("member-%d", i), ""),
+			Liveness: rpc.Liveness_UP,
+			Version: &rpc.Version2{
+				OwnerId: "remote",
+				Timestamp: &rpc.MonotonicTimestamp{
+					Timestamp: time.Now().UnixMilli(),
+				},
+			},
+		})
+	}
+
+	grpcServer, addr, err := serveReplicaServer(server.NewReplicaServer(serverRegistry))
+	require.NoError(t, err)
+	defer grpcServer.Stop()
+
+	metrics := client.NewReplicaClientMetrics()
+	c, err := client.ReplicaConnect(
+		addr,
+		"target",
+		clientRegistry,
+		metrics,
+		client.WithRepairBucketLimit(100),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, c.FullSync(ctx))
+
+	for i := 0; i != 1000; i++ {
+		_, ok := clientRegistry.Member(fmt.Sprintf("member-%d", i))
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 1000.0, metrics.RepairUpdatesInbound.Value(map[string]string{
+		"source": "target",
+		"status": "ok",
+	}))
+	// The 1000 members span more than 100 buckets, so must be requested
+	// in multiple pages.
+	assert.Less(t, float64(registry.TreeLevels+1), metrics.RepairRoundTrips.Value(map[string]string{
+		"target": "target",
+	}))
+}
+
+func serveReplicaServer(s *server.ReplicaServer) (*grpc.Server, string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", fmt.Errorf("replica server: listen: %w", err)
+	}
+
+	grpcServer := grpc.NewServer()
+	rpc.RegisterReplicaRegistry2Server(grpcServer, s)
+	server.RegisterReplicaStreamServer(grpcServer, s)
+
+	go func() {
+		if err := grpcServer.Serve(ln); err != nil {
+			panic(err)
+		}
+	}()
+
+	return grpcServer, ln.Addr().String(), nil
+}
+
 func waitWithContext(ctx context.Context, ch chan *rpc.Member2) (*rpc.Member2, bool) {
 	select {
 	case m := <-ch:
@@ -0,0 +1,330 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	streamBackoffMin = time.Millisecond * 100
+	streamBackoffMax = time.Second * 10
+)
+
+// sendLoop forwards pending updates to the replica.
+//
+// Updates are sent in batches on the replica stream (see
+// server.ReplicaStreamServiceName). If the stream fails, the unacknowledged
+// updates are requeued and the stream is reopened with backoff. If the replica
+// doesn't support the stream, the client falls back to sending each update
+// with the unary Update RPC.
+func (c *ReplicaClient) sendLoop() {
+	backoff := streamBackoffMin
+	for {
+		start := time.Now()
+		err := c.replicate()
+		if c.ctx.Err() != nil {
+			// Client closed.
+			return
+		}
+
+		if status.Code(err) == codes.Unimplemented {
+			c.logger.Info(
+				"replica doesn't support replica stream; falling back to unary updates",
+				zap.String("target", c.targetID),
+			)
+			c.sendUnaryLoop()
+			return
+		}
+
+		c.logger.Warn(
+			"replica stream failed",
+			zap.String("target", c.targetID),
+			zap.Error(err),
+		)
+
+		// Only backoff if the stream fails repeatedly.
+		if time.Since(start) > streamBackoffMax {
+			backoff = streamBackoffMin
+		}
+		select {
+		case <-time.After(backoff):
+		case <-c.ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > streamBackoffMax {
+			backoff = streamBackoffMax
+		}
+	}
+}
+
+// replicate opens a replica stream and sends batches of pending updates until
+// the stream fails or the client is closed.
+func (c *ReplicaClient) replicate() error {
+	ctx, cancel := context.WithCancel(c.ctx)
+	ctx = metadata.AppendToOutgoingContext(
+		ctx, server.ReplicaSourceMetadataKey, c.registry.LocalID(),
+	)
+
+	inflight := newInflightBatches(c.maxInflightBatches)
+	recvErr := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+
+		// Requeue any updates the replica hasn't acknowledged. Since updates
+		// are versioned, resending an update that was applied is harmless.
+		// Note the receiver normally requeues the updates when the stream
+		// fails, so this only applies if the stream was never opened.
+		for _, b := range inflight.Close() {
+			c.requeue(b)
+		}
+		c.setInflightMetric(0)
+	}()
+
+	stream, err := c.conn.NewStream(
+		ctx,
+		&server.ReplicaStreamDesc,
+		server.ReplicaStreamMethod,
+		grpc.WaitForReady(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			ack := &rpc.ClientAck{}
+			if err := stream.RecvMsg(ack); err != nil {
+				// Requeue the unacknowledged updates now rather than waiting
+				// for the sender, which may be blocked waiting for updates.
+				for _, b := range inflight.Close() {
+					c.requeue(b)
+				}
+				c.setInflightMetric(0)
+
+				recvErr <- err
+				return
+			}
+
+			for _, b := range inflight.Ack(ack.SeqId) {
+				c.metrics.ReplicaBatchesOutbound.Inc(map[string]string{
+					"target": c.targetID,
+					"status": "ok",
+				})
+				c.metrics.ReplicaUpdatesOutbound.Add(len(b.Members), map[string]string{
+					"target": c.targetID,
+					"status": "ok",
+				})
+			}
+			c.setInflightMetric(inflight.Len())
+		}
+	}()
+
+	var seq uint64
+	for {
+		members, ok := c.pending.TakeBatch(c.batchMaxBytes, c.batchWindow)
+		if !ok {
+			// Client closed.
+			return nil
+		}
+		c.setPendingMetric()
+
+		seq++
+		batch := inflightBatch{
+			Seq:     seq,
+			Members: members,
+		}
+		if !inflight.Add(batch) {
+			// The stream has failed.
+			c.requeue(batch)
+			return <-recvErr
+		}
+		c.setInflightMetric(inflight.Len())
+
+		msg := &rpc.ReplicaSyncResponse{
+			Members: members,
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				// The stream was closed by the replica, so get the status
+				// from the receiver.
+				return <-recvErr
+			}
+			return err
+		}
+
+		c.metrics.ReplicaBytesOutbound.Add(proto.Size(msg), map[string]string{
+			"target": c.targetID,
+		})
+	}
+}
+
+// sendUnaryLoop forwards each pending update using the unary Update RPC, for
+// replicas that don't support the replica stream.
+func (c *ReplicaClient) sendUnaryLoop() {
+	for {
+		m, ok := c.pending.Take()
+		if !ok {
+			// Client closed.
+			return
+		}
+		c.setPendingMetric()
+
+		c.sendUnary(m)
+	}
+}
+
+func (c *ReplicaClient) sendUnary(m *rpc.Member2) {
+	// Update will keep retrying for until cancelled. If it still does not
+	// succeed, the update will be dropped and the replica will get the
+	// update via read repair when it comes back.
+	ctx, cancel := context.WithTimeout(c.ctx, c.updateTimeout)
+	defer cancel()
+
+	if _, err := c.client.Update(ctx, &rpc.UpdateRequest{
+		Member:       m,
+		SourceNodeId: c.registry.LocalID(),
+	}); err != nil {
+		c.logger.Warn(
+			"failed to forward update",
+			zap.String("member-id", m.State.Id),
+			zap.String("target", c.targetID),
+			zap.Error(err),
+		)
+
+		c.metrics.ReplicaUpdatesOutbound.Inc(map[string]string{
+			"target": c.targetID,
+			"status": "fail",
+		})
+	} else {
+		c.metrics.ReplicaUpdatesOutbound.Inc(map[string]string{
+			"target": c.targetID,
+			"status": "ok",
+		})
+	}
+}
+
+// requeue adds the updates in a batch that wasn't acknowledged back to the
+// pending updates.
+func (c *ReplicaClient) requeue(b inflightBatch) {
+	c.metrics.ReplicaBatchesOutbound.Inc(map[string]string{
+		"target": c.targetID,
+		"status": "fail",
+	})
+	c.metrics.ReplicaUpdatesOutbound.Add(len(b.Members), map[string]string{
+		"target": c.targetID,
+		"status": "fail",
+	})
+
+	for _, m := range b.Members {
+		c.push(m)
+	}
+}
+
+func (c *ReplicaClient) setInflightMetric(n int) {
+	c.metrics.ReplicaInflightBatches.Set(float64(n), map[string]string{
+		"target": c.targetID,
+	})
+}
+
+type inflightBatch struct {
+	Seq     uint64
+	Members []*rpc.Member2
+}
+
+// inflightBatches tracks the batches sent on a replica stream that haven't
+// been acknowledged.
+type inflightBatches struct {
+	limit int
+
+	batches []inflightBatch
+	closed  bool
+
+	cv *sync.Cond
+
+	// mu protects the fields above.
+	mu *sync.Mutex
+}
+
+func newInflightBatches(limit int) *inflightBatches {
+	mu := &sync.Mutex{}
+	return &inflightBatches{
+		limit: limit,
+		cv:    sync.NewCond(mu),
+		mu:    mu,
+	}
+}
+
+// Add adds a sent batch, blocking while the number of unacknowledged batches
+// is at the limit. Returns false if closed.
+func (f *inflightBatches) Add(b inflightBatch) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.batches) >= f.limit && !f.closed {
+		f.cv.Wait()
+	}
+
+	if f.closed {
+		return false
+	}
+
+	f.batches = append(f.batches, b)
+	return true
+}
+
+// Ack removes and returns the batches acknowledged by seq. Since the stream is
+// ordered, this includes all batches up to seq.
+func (f *inflightBatches) Ack(seq uint64) []inflightBatch {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for n < len(f.batches) && f.batches[n].Seq <= seq {
+		n++
+	}
+	acked := f.batches[:n:n]
+	f.batches = f.batches[n:]
+
+	f.cv.Broadcast()
+	return acked
+}
+
+func (f *inflightBatches) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.batches)
+}
+
+// Close unblocks any waiting Add calls and returns the unacknowledged batches.
+// Subsequent calls return nil.
+func (f *inflightBatches) Close() []inflightBatch {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	f.cv.Broadcast()
+
+	unacked := f.batches
+	f.batches = nil
+	return unacked
+}
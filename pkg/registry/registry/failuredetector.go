@@ -106,6 +106,18 @@ func (r *Registry) updateRemoteMemberLivenessLocked(id string, timestamp int64)
 		return
 	}
 
+	// A read-only registry never takes ownership of members, so leaves the
+	// other nodes to take ownership.
+	if r.readOnly {
+		return
+	}
+
+	// Federated members are owned by nodes in their origin cluster, so are
+	// never taken by this cluster.
+	if IsFederated(member.State) {
+		return
+	}
+
 	// If the owner of the node is still in the cluster, do nothing.
 	ownerLastContact, ok := r.leftNodes[member.Version.OwnerId]
 	if !ok {
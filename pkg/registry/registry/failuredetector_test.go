@@ -27,6 +27,37 @@ func TestFailureDetector_UnreachableMemberMarkedAsDown(t *testing.T) {
 	assert.Equal(t, int64(6000), m.Expiry)
 }
 
+// Tests an owned member is marked down after the heartbeat timeout of the
+// local clock, even if the registry clock was advanced by a remote node whose
+// clock is ahead.
+func TestFailureDetector_LastSeenUsesLocalClock(t *testing.T) {
+	registry := NewRegistry(
+		"local",
+		WithHeartbeatTimeout(500),
+		WithReconnectTimeout(5000),
+		WithClockDriftPolicy(ClockDriftPolicyFlag),
+	)
+
+	registry.RemoteUpdate(&rpc.Member2{
+		State: randomMember("remote-member"),
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 1000000,
+			},
+		},
+	}, WithNowTime(100))
+
+	addedMember := testutils.RandomMemberState("my-member", "")
+	registry.AddMember(addedMember, WithNowTime(100))
+
+	registry.UpdateLiveness(1000)
+
+	m, ok := registry.Member("my-member")
+	assert.True(t, ok)
+	assert.Equal(t, rpc.Liveness_DOWN, m.Liveness)
+}
+
 // Tests an owned member that hasn't recovered in the reconnect timeout is
 // marked as left.
 func TestFailureDetector_ExpiredDownMemberMarkedAsLeft(t *testing.T) {
@@ -175,6 +206,40 @@ func TestFailureDetector_DownNodesMembersTaken(t *testing.T) {
 	assert.Equal(t, int64(15000), m.Expiry)
 }
 
+// Tests a read-only registry never takes ownership of members whose owner is
+// down.
+func TestFailureDetector_ReadOnlyDownNodesMembersNotTaken(t *testing.T) {
+	registry := NewRegistry(
+		"local",
+		WithHeartbeatTimeout(500),
+		WithReconnectTimeout(5000),
+		WithReadOnly(),
+	)
+
+	addedMember := testutils.RandomMemberState("my-member", "")
+	registry.RemoteUpdate(&rpc.Member2{
+		State:    addedMember,
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 100,
+			},
+		},
+	})
+
+	// Mark the owner node down.
+	registry.OnNodeLeave("remote", WithNowTime(1000))
+
+	registry.UpdateLiveness(2000)
+
+	m, ok := registry.Member("my-member")
+	assert.True(t, ok)
+	assert.Equal(t, "remote", m.Version.OwnerId)
+	assert.Equal(t, rpc.Liveness_UP, m.Liveness)
+	assert.Equal(t, 0, len(registry.OwnedMembers()))
+}
+
 func TestFailureDetector_LocalNodeIgnored(t *testing.T) {
 	localMember := randomMember("local")
 	registry := NewRegistry(
@@ -0,0 +1,141 @@
+package registry
+
+import (
+	"errors"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"go.uber.org/zap"
+)
+
+// ClusterMetadataKey is the member metadata key containing the name of the
+// cluster a federated member originates from.
+//
+// Members registered with this cluster don't have an origin cluster, so only
+// members received from a remote cluster with FederatedUpdate are marked with
+// their origin. As with the namespace, the origin is stored in the member
+// metadata so it is replicated between nodes along with the rest of the
+// member state.
+const ClusterMetadataKey = "fuddle.cluster"
+
+// ErrFederatedMember is returned when attempting to register a member that
+// originates from a remote cluster. Federated members are read-only outside
+// of their origin cluster.
+var ErrFederatedMember = errors.New("member owned by remote cluster")
+
+// MemberCluster returns the name of the remote cluster the member originates
+// from, or an empty string if the member was registered with this cluster.
+func MemberCluster(m *rpc.MemberState) string {
+	return m.Metadata[ClusterMetadataKey]
+}
+
+// IsFederated returns whether the member originates from a remote cluster.
+func IsFederated(m *rpc.MemberState) bool {
+	return MemberCluster(m) != ""
+}
+
+// WithMemberCluster returns a copy of the member state marked as originating
+// from the given remote cluster.
+func WithMemberCluster(m *rpc.MemberState, cluster string) *rpc.MemberState {
+	m = copyMemberState(m)
+	m.Metadata[ClusterMetadataKey] = cluster
+	return m
+}
+
+// FederatedUpdate applies an update to a member received from the remote
+// cluster with the given name, such as by a gateway node streaming the
+// remote clusters registry.
+//
+// The member is marked with its origin cluster and keeps the version from
+// the remote cluster, so updates received by multiple gateways are applied
+// once. Federated members are never owned by this cluster, so are read-only,
+// and only change when updated by their origin cluster.
+//
+// Unlike RemoteUpdate, the update is forwarded to owner only subscribers so
+// the gateway replicates the update to the other nodes in this cluster.
+func (r *Registry) FederatedUpdate(cluster string, update *rpc.Member2, opts ...Option) {
+	options := r.options(opts)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	update = &rpc.Member2{
+		State:    WithMemberCluster(update.State, cluster),
+		Liveness: update.Liveness,
+		Version:  update.Version,
+		Expiry:   update.Expiry,
+	}
+
+	if update.State.Id == r.localID || update.Version.OwnerId == r.localID {
+		r.logger.Error(
+			"federated update: discarding update; conflicts with local node",
+			zap.String("cluster", cluster),
+			zap.Object("update", newMemberLogger(update)),
+		)
+		return
+	}
+
+	if !r.observeLocked(
+		update.Version.Timestamp, options.now, zap.String("owner", update.Version.OwnerId),
+	) {
+		r.logger.Error(
+			"discarding federated update; clock drift exceeded",
+			zap.String("cluster", cluster),
+			zap.Object("update", newMemberLogger(update)),
+			zap.Object("update-version", newVersionLogger(update.Version)),
+		)
+		return
+	}
+
+	existing, ok := r.members[update.State.Id]
+	if ok {
+		// Members registered with this cluster take precedence over members
+		// with the same ID in a remote cluster.
+		if MemberCluster(existing.State) != cluster {
+			r.logger.Warn(
+				"discarding federated update; member id conflicts with another cluster",
+				zap.String("cluster", cluster),
+				zap.String("existing-cluster", MemberCluster(existing.State)),
+				zap.Object("update", newMemberLogger(update)),
+			)
+			return
+		}
+
+		if compareVersions(existing.Version, update.Version) <= 0 {
+			r.logger.Debug(
+				"discarding federated update; outdated version",
+				zap.String("cluster", cluster),
+				zap.Object("update", newMemberLogger(update)),
+				zap.Object("update-version", newVersionLogger(update.Version)),
+				zap.Object("existing-version", newVersionLogger(existing.Version)),
+			)
+			return
+		}
+	}
+
+	r.setMemberLocked(update, options.now)
+
+	r.logger.Info(
+		"updated member; federated",
+		zap.String("cluster", cluster),
+		zap.Object("update", newMemberLogger(update)),
+	)
+
+	r.notifySubscribersLocked(update, existing, true)
+}
+
+// FederatedMembers returns the versions of the members originating from the
+// remote cluster with the given name, keyed by member ID. This can be used as
+// the known members when subscribing to the remote cluster, so only missed
+// updates are received.
+func (r *Registry) FederatedMembers(cluster string) map[string]*rpc.Version2 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := make(map[string]*rpc.Version2)
+	for id, m := range r.members {
+		if MemberCluster(m.State) == cluster {
+			versions[id] = copyVersion(m.Version)
+		}
+	}
+	return versions
+}
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_FederatedUpdate(t *testing.T) {
+	remote := NewRegistry(
+		"remote-node",
+		WithLogger(testutils.Logger()),
+	)
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	var ownerUpdates []*rpc.Member2
+	reg.SubscribeLocal(func(update *rpc.Member2) {
+		ownerUpdates = append(ownerUpdates, update)
+	})
+
+	remote.AddMember(randomMember("member-1"), WithNowTime(100))
+	m, _ := remote.Member("member-1")
+	reg.FederatedUpdate("us-east", m, WithNowTime(100))
+
+	federated, ok := reg.Member("member-1")
+	require.True(t, ok)
+	assert.Equal(t, "us-east", MemberCluster(federated.State))
+	assert.Equal(t, "remote-node", federated.Version.OwnerId)
+	assert.Equal(t, 0, len(reg.OwnedMembers()))
+
+	// The update should be forwarded to the other nodes in the cluster.
+	require.Equal(t, 1, len(ownerUpdates))
+	assert.Equal(t, "member-1", ownerUpdates[0].State.Id)
+
+	// Applying the same update again, such as from another gateway, should
+	// be ignored.
+	reg.FederatedUpdate("us-east", m, WithNowTime(100))
+	assert.Equal(t, 1, len(ownerUpdates))
+
+	assert.Equal(t, map[string]*rpc.Version2{
+		"member-1": federated.Version,
+	}, reg.FederatedMembers("us-east"))
+	assert.Equal(t, 0, len(reg.FederatedMembers("eu-west")))
+}
+
+// Tests federated members are read-only outside their origin cluster.
+func TestRegistry_FederatedMemberReadOnly(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithHeartbeatTimeout(500),
+		WithReconnectTimeout(5000),
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.FederatedUpdate("us-east", &rpc.Member2{
+		State:    randomMember("member-1"),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote-node",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 100,
+			},
+		},
+	}, WithNowTime(100))
+
+	err := reg.AddMember(randomMember("member-1"), WithNowTime(200))
+	assert.ErrorIs(t, err, ErrFederatedMember)
+
+	reg.RemoveMember("member-1", WithNowTime(200))
+
+	// Even if the owner is treated as having left the cluster, such as after
+	// a restart, the member should never be taken.
+	reg.OnNodeLeave("remote-node", WithNowTime(1000))
+	reg.UpdateLiveness(10000)
+
+	m, ok := reg.Member("member-1")
+	require.True(t, ok)
+	assert.Equal(t, rpc.Liveness_UP, m.Liveness)
+	assert.Equal(t, "remote-node", m.Version.OwnerId)
+}
+
+// Tests members registered with the local cluster take precedence over
+// federated members with the same ID.
+func TestRegistry_FederatedUpdateConflictsWithLocalMember(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	registered := randomMember("member-1")
+	reg.AddMember(registered, WithNowTime(100))
+
+	reg.FederatedUpdate("us-east", &rpc.Member2{
+		State:    randomMember("member-1"),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote-node",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 200,
+			},
+		},
+	}, WithNowTime(200))
+
+	m, ok := reg.Member("member-1")
+	require.True(t, ok)
+	assert.Equal(t, "local", m.Version.OwnerId)
+	assert.False(t, IsFederated(m.State))
+}
+
+func TestFilter_ExcludesFederatedMembers(t *testing.T) {
+	local := &rpc.Member2{
+		State: randomMember("local-member"),
+	}
+	federated := &rpc.Member2{
+		State: WithMemberCluster(randomMember("remote-member"), "us-east"),
+	}
+
+	f := &Filter{}
+	assert.True(t, f.Match(local))
+	assert.False(t, f.Match(federated))
+
+	f = &Filter{IncludeRemote: true}
+	assert.True(t, f.Match(local))
+	assert.True(t, f.Match(federated))
+
+	// A nil filter should match all members.
+	f = nil
+	assert.True(t, f.Match(federated))
+}
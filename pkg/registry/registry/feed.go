@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
+// FeedPosition identifies a position in a registry's change feed.
+type FeedPosition struct {
+	// Epoch identifies the change feed. Each registry is assigned a random
+	// epoch when created, so positions from another node, or from before
+	// the node restarted, are never resumed.
+	Epoch uint64
+	// Seq is the sequence number of the last update received.
+	Seq uint64
+}
+
+// ParseFeedPosition parses a position encoded with FeedPosition.String.
+func ParseFeedPosition(s string) (FeedPosition, error) {
+	epoch, seq, ok := strings.Cut(s, ":")
+	if !ok {
+		return FeedPosition{}, fmt.Errorf("parse feed position: invalid position: %s", s)
+	}
+	var pos FeedPosition
+	var err error
+	if pos.Epoch, err = strconv.ParseUint(epoch, 10, 64); err != nil {
+		return FeedPosition{}, fmt.Errorf("parse feed position: %w", err)
+	}
+	if pos.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+		return FeedPosition{}, fmt.Errorf("parse feed position: %w", err)
+	}
+	return pos, nil
+}
+
+// String encodes the position as '<epoch>:<seq>'.
+func (p FeedPosition) String() string {
+	return strconv.FormatUint(p.Epoch, 10) + ":" + strconv.FormatUint(p.Seq, 10)
+}
+
+type feedEntry struct {
+	seq      uint64
+	update   *rpc.Member2
+	previous *rpc.Member2
+	// owner is true if the update is to a member owned by this node, or this
+	// node lost ownership of the member.
+	owner bool
+}
+
+// changeFeed is a bounded in-memory log of the updates applied to the
+// registry, where each update is assigned a monotonically increasing sequence
+// number.
+//
+// Subscribers that reconnect with the sequence number of the last update they
+// received can be sent only the updates they missed from the feed, rather than
+// diffing their known members with the whole registry. Once the feed exceeds
+// its limit the oldest updates are discarded, so subscribers that are too far
+// behind must fall back to a full diff.
+type changeFeed struct {
+	epoch uint64
+	// seq is the sequence number of the last update.
+	seq uint64
+
+	// entries is a ring buffer containing the last updates, where start is
+	// the index of the oldest entry and len is the number of entries.
+	entries []feedEntry
+	start   int
+	len     int
+}
+
+func newChangeFeed(limit int) *changeFeed {
+	return &changeFeed{
+		epoch:   rand.Uint64(),
+		entries: make([]feedEntry, limit),
+	}
+}
+
+// Append adds the update to the feed and returns its sequence number.
+func (f *changeFeed) Append(update *rpc.Member2, previous *rpc.Member2, owner bool) uint64 {
+	f.seq++
+
+	if len(f.entries) == 0 {
+		return f.seq
+	}
+
+	entry := feedEntry{
+		seq:      f.seq,
+		update:   update,
+		previous: previous,
+		owner:    owner,
+	}
+	if f.len < len(f.entries) {
+		f.entries[(f.start+f.len)%len(f.entries)] = entry
+		f.len++
+	} else {
+		// Overwrite the oldest entry.
+		f.entries[f.start] = entry
+		f.start = (f.start + 1) % len(f.entries)
+	}
+	return f.seq
+}
+
+// Head returns the position of the last update in the feed.
+func (f *changeFeed) Head() FeedPosition {
+	return FeedPosition{
+		Epoch: f.epoch,
+		Seq:   f.seq,
+	}
+}
+
+// Since returns the updates after the given position, or false if the position
+// isn't in the feed, either because it is from another feed or the updates
+// after the position have been discarded.
+func (f *changeFeed) Since(pos FeedPosition) ([]feedEntry, bool) {
+	if pos.Epoch != f.epoch || pos.Seq > f.seq {
+		return nil, false
+	}
+	if pos.Seq == f.seq {
+		return nil, true
+	}
+
+	missed := int(f.seq - pos.Seq)
+	if missed > f.len {
+		return nil, false
+	}
+
+	entries := make([]feedEntry, 0, missed)
+	for i := f.len - missed; i != f.len; i++ {
+		entries = append(entries, f.entries[(f.start+i)%len(f.entries)])
+	}
+	return entries, true
+}
@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFeed_Since(t *testing.T) {
+	feed := newChangeFeed(10)
+	for i := 0; i != 5; i++ {
+		feed.Append(remoteMember(fmt.Sprintf("member-%d", i), 0), nil, false)
+	}
+
+	entries, ok := feed.Since(FeedPosition{Epoch: feed.epoch, Seq: 2})
+	require.True(t, ok)
+	require.Equal(t, 3, len(entries))
+	for i, e := range entries {
+		assert.Equal(t, uint64(3+i), e.seq)
+		assert.Equal(t, fmt.Sprintf("member-%d", 2+i), e.update.State.Id)
+	}
+
+	entries, ok = feed.Since(feed.Head())
+	assert.True(t, ok)
+	assert.Empty(t, entries)
+}
+
+// Tests positions whose updates have been discarded from the feed can't be
+// resumed.
+func TestChangeFeed_SinceTruncated(t *testing.T) {
+	feed := newChangeFeed(10)
+	for i := 0; i != 25; i++ {
+		feed.Append(remoteMember(fmt.Sprintf("member-%d", i), 0), nil, false)
+	}
+
+	_, ok := feed.Since(FeedPosition{Epoch: feed.epoch, Seq: 14})
+	assert.False(t, ok)
+
+	entries, ok := feed.Since(FeedPosition{Epoch: feed.epoch, Seq: 15})
+	require.True(t, ok)
+	require.Equal(t, 10, len(entries))
+	assert.Equal(t, uint64(16), entries[0].seq)
+	assert.Equal(t, "member-24", entries[9].update.State.Id)
+}
+
+func TestChangeFeed_SinceUnknownPosition(t *testing.T) {
+	feed := newChangeFeed(10)
+	feed.Append(remoteMember("member-1", 0), nil, false)
+
+	// Position from another feed.
+	_, ok := feed.Since(FeedPosition{Epoch: feed.epoch + 1, Seq: 0})
+	assert.False(t, ok)
+	// Position ahead of the feed.
+	_, ok = feed.Since(FeedPosition{Epoch: feed.epoch, Seq: 5})
+	assert.False(t, ok)
+}
+
+func TestFeedPosition_Parse(t *testing.T) {
+	pos := FeedPosition{Epoch: 1234, Seq: 5678}
+	parsed, err := ParseFeedPosition(pos.String())
+	require.NoError(t, err)
+	assert.Equal(t, pos, parsed)
+
+	_, err = ParseFeedPosition("1234")
+	assert.Error(t, err)
+	_, err = ParseFeedPosition("abc:1")
+	assert.Error(t, err)
+}
+
+// Tests a subscriber resuming from a position in the feed only receives the
+// updates it missed.
+func TestRegistry_SubscribeFeedResume(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	var pos FeedPosition
+	unsubscribe := reg.SubscribeFeed(nil, nil, func(u *rpc.Member2, seq uint64) {
+		if seq != 0 {
+			pos.Seq = seq
+		}
+	}, WithOnSubscribed(func(head FeedPosition, resumed bool) {
+		pos = head
+		assert.False(t, resumed)
+	}))
+	reg.AddMember(randomMember("member-1"))
+	unsubscribe()
+
+	// Updates while disconnected.
+	reg.AddMember(randomMember("member-2"))
+	reg.AddMember(randomMember("member-3"))
+
+	var updates []*rpc.Member2
+	var resumed bool
+	unsubscribe = reg.SubscribeFeed(nil, &pos, func(u *rpc.Member2, seq uint64) {
+		updates = append(updates, u)
+		pos.Seq = seq
+	}, WithOnSubscribed(func(head FeedPosition, r bool) {
+		resumed = r
+	}))
+	defer unsubscribe()
+
+	assert.True(t, resumed)
+	require.Equal(t, 2, len(updates))
+	assert.Equal(t, "member-2", updates[0].State.Id)
+	assert.Equal(t, "member-3", updates[1].State.Id)
+	assert.Equal(t, reg.FeedHead(), pos)
+
+	assert.Equal(t, 1.0, reg.Metrics().FeedSubscriptions.Value(map[string]string{
+		"result": "resumed",
+	}))
+}
+
+// Tests a subscriber whose position has been discarded from the feed falls
+// back to receiving the updates it's missing given its known members.
+func TestRegistry_SubscribeFeedFallback(t *testing.T) {
+	reg := NewRegistry("local", WithFeedLimit(2), WithLogger(testutils.Logger()))
+
+	pos := reg.FeedHead()
+	for i := 0; i != 5; i++ {
+		reg.AddMember(randomMember(fmt.Sprintf("member-%d", i)))
+	}
+
+	var updates []*rpc.Member2
+	var seqs []uint64
+	var resumed bool
+	unsubscribe := reg.SubscribeFeed(nil, &pos, func(u *rpc.Member2, seq uint64) {
+		updates = append(updates, u)
+		seqs = append(seqs, seq)
+	}, WithOnSubscribed(func(head FeedPosition, r bool) {
+		resumed = r
+	}))
+	defer unsubscribe()
+
+	assert.False(t, resumed)
+	require.Equal(t, 5, len(updates))
+	// Only the last update has a sequence number.
+	for _, seq := range seqs[:len(seqs)-1] {
+		assert.Equal(t, uint64(0), seq)
+	}
+	assert.Equal(t, reg.FeedHead().Seq, seqs[len(seqs)-1])
+
+	assert.Equal(t, 1.0, reg.Metrics().FeedSubscriptions.Value(map[string]string{
+		"result": "fallback",
+	}))
+}
+
+// Tests a subscriber resuming from the feed only receives the missed updates
+// that match its filter.
+func TestRegistry_SubscribeFeedResumeWithFilter(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	pos := reg.FeedHead()
+
+	m := randomMember("member-1")
+	m.Service = "foo"
+	reg.AddMember(m)
+	m = randomMember("member-2")
+	m.Service = "bar"
+	reg.AddMember(m)
+
+	var updates []*rpc.Member2
+	unsubscribe := reg.SubscribeFeed(nil, &pos, func(u *rpc.Member2, seq uint64) {
+		updates = append(updates, u)
+	}, WithFilter(&Filter{Service: []string{"foo"}}))
+	defer unsubscribe()
+
+	require.Equal(t, 1, len(updates))
+	assert.Equal(t, "member-1", updates[0].State.Id)
+}
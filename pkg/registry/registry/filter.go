@@ -0,0 +1,241 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
+// LocalityFilter matches members in the given region and availability zone.
+// An empty region or availability zone matches any value.
+type LocalityFilter struct {
+	Region           string `json:"region,omitempty"`
+	AvailabilityZone string `json:"availability_zone,omitempty"`
+}
+
+// Filter selects the members a subscriber is interested in.
+//
+// Each field is optional, where an empty field matches all members. A member
+// matches the filter if it matches every non-empty field.
+type Filter struct {
+	// Namespace matches members in the given namespace.
+	Namespace string
+
+	// Service matches members whose service is any of the listed services.
+	Service []string
+
+	// Locality matches members in any of the listed localities.
+	Locality []LocalityFilter
+
+	// Liveness matches members with any of the listed liveness statuses.
+	Liveness []rpc.Liveness
+
+	// Metadata matches members whose metadata contains all of the listed
+	// key-value pairs.
+	Metadata map[string]string
+
+	// Query matches members that match the query expression.
+	Query *Query
+
+	// ExcludeDraining excludes members that are draining or terminating, so
+	// clients stop sending them new traffic.
+	ExcludeDraining bool
+
+	// IncludeRemote includes members federated from remote clusters (see
+	// FederatedUpdate). By default a filter only matches members registered
+	// with this cluster.
+	IncludeRemote bool
+}
+
+// filterJSON is the JSON encoding of Filter, which encodes the liveness
+// statuses as strings.
+type filterJSON struct {
+	Namespace string            `json:"namespace,omitempty"`
+	Service   []string          `json:"service,omitempty"`
+	Locality  []LocalityFilter  `json:"locality,omitempty"`
+	Liveness  []string          `json:"liveness,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Query     string            `json:"query,omitempty"`
+
+	ExcludeDraining bool `json:"exclude_draining,omitempty"`
+	IncludeRemote   bool `json:"include_remote,omitempty"`
+}
+
+// ParseFilter decodes a JSON encoded filter.
+func ParseFilter(b []byte) (*Filter, error) {
+	var encoded filterJSON
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return nil, fmt.Errorf("parse filter: %w", err)
+	}
+
+	f := &Filter{
+		Namespace: encoded.Namespace,
+		Service:   encoded.Service,
+		Locality:  encoded.Locality,
+		Metadata:  encoded.Metadata,
+
+		ExcludeDraining: encoded.ExcludeDraining,
+		IncludeRemote:   encoded.IncludeRemote,
+	}
+	for _, s := range encoded.Liveness {
+		liveness, ok := rpc.Liveness_value[strings.ToUpper(s)]
+		if !ok {
+			return nil, fmt.Errorf("parse filter: unknown liveness: %s", s)
+		}
+		f.Liveness = append(f.Liveness, rpc.Liveness(liveness))
+	}
+	if encoded.Query != "" {
+		q, err := ParseQuery(encoded.Query)
+		if err != nil {
+			return nil, fmt.Errorf("parse filter: %w", err)
+		}
+		f.Query = q
+	}
+	return f, nil
+}
+
+// Encode returns the JSON encoding of the filter.
+func (f *Filter) Encode() ([]byte, error) {
+	encoded := filterJSON{
+		Namespace: f.Namespace,
+		Service:   f.Service,
+		Locality:  f.Locality,
+		Metadata:  f.Metadata,
+
+		ExcludeDraining: f.ExcludeDraining,
+		IncludeRemote:   f.IncludeRemote,
+	}
+	for _, l := range f.Liveness {
+		encoded.Liveness = append(encoded.Liveness, strings.ToLower(l.String()))
+	}
+	if f.Query != nil {
+		encoded.Query = f.Query.String()
+	}
+	return json.Marshal(encoded)
+}
+
+// Match returns whether the member matches the filter. A nil filter matches
+// all members, including members federated from remote clusters.
+func (f *Filter) Match(m *rpc.Member2) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.Namespace != "" && f.Namespace != MemberNamespace(m.State) {
+		return false
+	}
+
+	if f.ExcludeDraining && isDrainingStatus(m.State.Status) {
+		return false
+	}
+
+	if !f.IncludeRemote && IsFederated(m.State) {
+		return false
+	}
+
+	if len(f.Service) > 0 && !containsString(f.Service, m.State.Service) {
+		return false
+	}
+
+	if len(f.Locality) > 0 {
+		matched := false
+		for _, l := range f.Locality {
+			if l.match(m.State.Locality) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(f.Liveness) > 0 {
+		matched := false
+		for _, l := range f.Liveness {
+			if l == m.Liveness {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for k, v := range f.Metadata {
+		if memberValue, ok := m.State.Metadata[k]; !ok || memberValue != v {
+			return false
+		}
+	}
+
+	return f.Query.Match(m)
+}
+
+// withNamespace returns a copy of the filter that only matches members in the
+// given namespace. The filter may be nil.
+func (f *Filter) withNamespace(namespace string) *Filter {
+	scoped := &Filter{}
+	if f != nil {
+		*scoped = *f
+	}
+	scoped.Namespace = namespace
+	return scoped
+}
+
+func (l LocalityFilter) match(locality *rpc.Locality) bool {
+	region := ""
+	az := ""
+	if locality != nil {
+		region = locality.Region
+		az = locality.AvailabilityZone
+	}
+
+	if l.Region != "" && l.Region != region {
+		return false
+	}
+	if l.AvailabilityZone != "" && l.AvailabilityZone != az {
+		return false
+	}
+	return true
+}
+
+// filterUpdate returns the update to send to a subscriber with the given
+// filter, or false if the update should not be sent.
+//
+// If the member matches the filter the update is sent unchanged. If the member
+// no longer matches the filter, but previously did, the subscriber is sent the
+// update with a liveness of left so it removes the member. Otherwise the update
+// is discarded.
+func filterUpdate(f *Filter, update *rpc.Member2, previous *rpc.Member2) (*rpc.Member2, bool) {
+	if f.Match(update) {
+		return update, true
+	}
+	if previous != nil && f.Match(previous) {
+		return filteredOutUpdate(update), true
+	}
+	return nil, false
+}
+
+// filteredOutUpdate returns an update that removes the member from a
+// subscribers view of the registry when the member moves out of the
+// subscribers filter.
+func filteredOutUpdate(m *rpc.Member2) *rpc.Member2 {
+	return &rpc.Member2{
+		State:    m.State,
+		Liveness: rpc.Liveness_LEFT,
+		Version:  m.Version,
+		Expiry:   m.Expiry,
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package registry
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFilter_Match(t *testing.T) {
+	member := &rpc.Member2{
+		State: &rpc.MemberState{
+			Id:      "my-member",
+			Service: "foo",
+			Locality: &rpc.Locality{
+				Region:           "eu-west-1",
+				AvailabilityZone: "eu-west-1a",
+			},
+			Metadata: map[string]string{
+				"protocol": "grpc",
+				"version":  "3",
+			},
+		},
+		Liveness: rpc.Liveness_UP,
+	}
+
+	tests := []struct {
+		name   string
+		filter *Filter
+		match  bool
+	}{
+		{"nil", nil, true},
+		{"empty", &Filter{}, true},
+		{"service", &Filter{Service: []string{"bar", "foo"}}, true},
+		{"service mismatch", &Filter{Service: []string{"bar"}}, false},
+		{"region", &Filter{Locality: []LocalityFilter{{Region: "eu-west-1"}}}, true},
+		{"az", &Filter{Locality: []LocalityFilter{{Region: "eu-west-1", AvailabilityZone: "eu-west-1a"}}}, true},
+		{"az mismatch", &Filter{Locality: []LocalityFilter{{AvailabilityZone: "eu-west-1b"}}}, false},
+		{"liveness", &Filter{Liveness: []rpc.Liveness{rpc.Liveness_UP}}, true},
+		{"liveness mismatch", &Filter{Liveness: []rpc.Liveness{rpc.Liveness_DOWN}}, false},
+		{"metadata", &Filter{Metadata: map[string]string{"protocol": "grpc", "version": "3"}}, true},
+		{"metadata mismatch", &Filter{Metadata: map[string]string{"protocol": "http"}}, false},
+		{"metadata missing", &Filter{Metadata: map[string]string{"weight": "1"}}, false},
+		{
+			"all",
+			&Filter{
+				Service:  []string{"foo"},
+				Locality: []LocalityFilter{{Region: "eu-west-1"}},
+				Liveness: []rpc.Liveness{rpc.Liveness_UP},
+				Metadata: map[string]string{"protocol": "grpc"},
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, tt.filter.Match(member))
+		})
+	}
+}
+
+func TestFilter_EncodeThenParse(t *testing.T) {
+	filter := &Filter{
+		Namespace: "staging",
+		Service:   []string{"foo"},
+		Locality:  []LocalityFilter{{Region: "eu-west-1"}},
+		Liveness:  []rpc.Liveness{rpc.Liveness_UP, rpc.Liveness_DOWN},
+		Metadata:  map[string]string{"protocol": "grpc"},
+
+		ExcludeDraining: true,
+	}
+	b, err := filter.Encode()
+	require.NoError(t, err)
+
+	parsed, err := ParseFilter(b)
+	require.NoError(t, err)
+	assert.Equal(t, filter, parsed)
+}
+
+func TestFilter_ParseUnknownLiveness(t *testing.T) {
+	_, err := ParseFilter([]byte(`{"liveness": ["unknown"]}`))
+	assert.Error(t, err)
+}
+
+func TestRegistry_SubscribeWithFilter(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	var updates []*rpc.Member2
+	reg.Subscribe(nil, func(u *rpc.Member2) {
+		updates = append(updates, u)
+	}, WithFilter(&Filter{
+		Service: []string{"foo"},
+	}))
+
+	// Members outside the filter are ignored.
+	reg.AddMember(testutils.RandomMemberState("member-1", "bar"), WithNowTime(100))
+	assert.Equal(t, 0, len(updates))
+
+	// Members in the filter are sent.
+	reg.AddMember(testutils.RandomMemberState("member-2", "foo"), WithNowTime(200))
+	assert.Equal(t, 1, len(updates))
+	assert.Equal(t, "member-2", updates[0].State.Id)
+	assert.Equal(t, rpc.Liveness_UP, updates[0].Liveness)
+
+	// Members that move into the filter are sent.
+	reg.AddMember(testutils.RandomMemberState("member-1", "foo"), WithNowTime(300))
+	assert.Equal(t, 2, len(updates))
+	assert.Equal(t, "member-1", updates[1].State.Id)
+	assert.Equal(t, rpc.Liveness_UP, updates[1].Liveness)
+
+	// Members that move out of the filter are sent as left.
+	reg.AddMember(testutils.RandomMemberState("member-2", "bar"), WithNowTime(400))
+	assert.Equal(t, 3, len(updates))
+	assert.Equal(t, "member-2", updates[2].State.Id)
+	assert.Equal(t, rpc.Liveness_LEFT, updates[2].Liveness)
+	assert.Equal(t, int64(400), updates[2].Version.Timestamp.Timestamp)
+
+	// Further updates outside the filter are ignored.
+	reg.AddMember(testutils.RandomMemberState("member-2", "bar"), WithNowTime(500))
+	assert.Equal(t, 3, len(updates))
+}
+
+func TestRegistry_SubscribeWithLivenessFilter(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithHeartbeatTimeout(500),
+		WithReconnectTimeout(5000),
+		WithLogger(testutils.Logger()),
+	)
+
+	var updates []*rpc.Member2
+	reg.Subscribe(nil, func(u *rpc.Member2) {
+		updates = append(updates, u)
+	}, WithFilter(&Filter{
+		Liveness: []rpc.Liveness{rpc.Liveness_UP},
+	}))
+
+	reg.AddMember(testutils.RandomMemberState("my-member", ""), WithNowTime(100))
+	assert.Equal(t, 1, len(updates))
+
+	// Marks the member down, which moves it out of the filter.
+	reg.UpdateLiveness(1000)
+	assert.Equal(t, 2, len(updates))
+	assert.Equal(t, rpc.Liveness_LEFT, updates[1].Liveness)
+}
+
+func TestRegistry_UpdatesWithFilter(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	fooMember := testutils.RandomMemberState("foo-member", "foo")
+	reg.AddMember(fooMember, WithNowTime(100))
+	reg.AddMember(testutils.RandomMemberState("bar-member", "bar"), WithNowTime(200))
+	reg.AddMember(testutils.RandomMemberState("known-bar-member", "bar"), WithNowTime(300))
+
+	updates := reg.Updates(&rpc.SubscribeRequest{
+		KnownMembers: map[string]*rpc.Version2{
+			// The subscriber knows the latest version of a member that doesn't
+			// match the filter.
+			"known-bar-member": {
+				OwnerId: "local",
+				Timestamp: &rpc.MonotonicTimestamp{
+					Timestamp: 300,
+				},
+			},
+		},
+	}, WithFilter(&Filter{
+		Service: []string{"foo"},
+	}))
+	assert.Equal(t, 2, len(updates))
+
+	for _, u := range updates {
+		switch u.State.Id {
+		case "foo-member":
+			assert.True(t, proto.Equal(fooMember, u.State))
+			assert.Equal(t, rpc.Liveness_UP, u.Liveness)
+		case "known-bar-member":
+			assert.Equal(t, rpc.Liveness_LEFT, u.Liveness)
+			assert.Equal(t, int64(300), u.Version.Timestamp.Timestamp)
+			assert.Equal(t, uint64(1), u.Version.Timestamp.Counter)
+		default:
+			t.Errorf("unexpected update: %s", u.State.Id)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"sort"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"go.uber.org/zap"
+)
+
+// Handoff transfers ownership of the members owned by this node to the given
+// target nodes, such as when this node is shutting down gracefully.
+//
+// Without a handoff, once this node leaves the cluster the other nodes treat
+// its members as orphaned and mark them down after the heartbeat timeout,
+// even though the members clients will reconnect to another node. Instead each
+// member is given a new version owned by one of the targets, keeping the
+// members liveness, so subscribers don't see a liveness change.
+//
+// The members are spread evenly across the targets. The handoff updates are
+// applied to the local registry and returned so the caller can send them to
+// the other nodes, which must apply them with AcceptHandoff. Returns nil if
+// there are no targets.
+func (r *Registry) Handoff(targets []string, opts ...Option) []*rpc.Member2 {
+	options := r.options(opts)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	targets = append([]string(nil), targets...)
+	sort.Strings(targets)
+
+	var ids []string
+	for id := range r.indexes.owner[r.localID] {
+		// The local member is never handed off.
+		if id != r.localID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var updates []*rpc.Member2
+	for i, id := range ids {
+		existing := r.members[id]
+
+		version := r.nextVersionLocked(options.now)
+		version.OwnerId = targets[i%len(targets)]
+
+		update := &rpc.Member2{
+			State:    copyMemberState(existing.State),
+			Liveness: existing.Liveness,
+			Version:  version,
+			Expiry:   existing.Expiry,
+		}
+		r.setMemberLocked(update, options.now)
+
+		r.logger.Info(
+			"handed off member",
+			zap.Object("update", newMemberLogger(update)),
+		)
+
+		// The handoff is sent to the other nodes by the caller so isn't
+		// forwarded to owner only subscribers.
+		r.notifySubscribersLocked(update, existing, false)
+
+		updates = append(updates, copyMember(update))
+	}
+
+	r.metrics.MembersHandedOff.Add(len(updates), map[string]string{
+		"direction": "outbound",
+	})
+
+	return updates
+}
+
+// AcceptHandoff applies an update received from a node handing off ownership
+// of its members (see Handoff).
+//
+// If the update transfers ownership to this node, this node takes ownership
+// of the member as if the member was last seen now, so the members client has
+// the heartbeat timeout to reconnect before the member is marked down. If this
+// node already owns the member, such as if the client has already reconnected
+// to this node, the handoff is ignored.
+//
+// Updates that transfer ownership to another node are applied as with
+// RemoteUpdate.
+func (r *Registry) AcceptHandoff(update *rpc.Member2, opts ...Option) {
+	options := r.options(opts)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if update.Version.OwnerId != r.localID {
+		r.remoteUpdateLocked(update, options)
+		return
+	}
+
+	if update.State.Id == r.localID {
+		r.logger.Error(
+			"accept handoff: discarding update; attempted to update local member",
+			zap.Object("member", newMemberLogger(update)),
+		)
+		return
+	}
+
+	if r.readOnly {
+		r.logger.Error(
+			"accept handoff: discarding update; registry is read-only",
+			zap.Object("member", newMemberLogger(update)),
+		)
+		return
+	}
+
+	if !r.observeLocked(
+		update.Version.Timestamp, options.now, zap.String("owner", update.Version.OwnerId),
+	) {
+		r.logger.Error(
+			"discarding handoff; clock drift exceeded",
+			zap.Object("update", newMemberLogger(update)),
+			zap.Object("update-version", newVersionLogger(update.Version)),
+		)
+		return
+	}
+
+	existing, ok := r.members[update.State.Id]
+	if ok {
+		if existing.Version.OwnerId == r.localID {
+			r.logger.Info(
+				"discarding handoff; member already owned",
+				zap.Object("update", newMemberLogger(update)),
+			)
+			return
+		}
+
+		if compareVersions(existing.Version, update.Version) <= 0 {
+			r.logger.Error(
+				"discarding handoff; outdated version",
+				zap.Object("update", newMemberLogger(update)),
+				zap.Object("update-version", newVersionLogger(update.Version)),
+				zap.Object("existing-version", newVersionLogger(existing.Version)),
+			)
+			return
+		}
+	}
+
+	r.setMemberLocked(update, options.now)
+
+	r.metrics.MembersHandedOff.Inc(map[string]string{
+		"direction": "inbound",
+	})
+
+	r.logger.Info(
+		"took ownership of member; handoff",
+		zap.Object("update", newMemberLogger(update)),
+	)
+
+	r.notifySubscribersLocked(update, existing, true)
+}
@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Handoff(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLocalMember(randomMember("local")),
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.AddMember(randomMember("member-1"), WithNowTime(100))
+	reg.AddMember(randomMember("member-2"), WithNowTime(100))
+	reg.AddMember(randomMember("member-3"), WithNowTime(100))
+	reg.RemoveMember("member-3", WithNowTime(200))
+
+	updates := reg.Handoff([]string{"node-2", "node-1"}, WithNowTime(300))
+	require.Equal(t, 3, len(updates))
+
+	owners := make(map[string]int)
+	for _, u := range updates {
+		owners[u.Version.OwnerId]++
+
+		// The members liveness should be unchanged.
+		m, ok := reg.Member(u.State.Id)
+		assert.True(t, ok)
+		assert.Equal(t, u.Version.OwnerId, m.Version.OwnerId)
+		if u.State.Id == "member-3" {
+			assert.Equal(t, rpc.Liveness_LEFT, m.Liveness)
+		} else {
+			assert.Equal(t, rpc.Liveness_UP, m.Liveness)
+		}
+	}
+	// The members should be spread across the targets.
+	assert.Equal(t, map[string]int{"node-1": 2, "node-2": 1}, owners)
+
+	// The local member should not be handed off.
+	assert.Equal(t, 1, len(reg.OwnedMembers()))
+
+	assert.Equal(t, 3.0, reg.Metrics().MembersHandedOff.Value(map[string]string{
+		"direction": "outbound",
+	}))
+}
+
+func TestRegistry_HandoffNoTargets(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.AddMember(randomMember("member-1"), WithNowTime(100))
+
+	assert.Nil(t, reg.Handoff(nil))
+
+	m, ok := reg.Member("member-1")
+	assert.True(t, ok)
+	assert.Equal(t, "local", m.Version.OwnerId)
+}
+
+func TestRegistry_AcceptHandoff(t *testing.T) {
+	source := NewRegistry(
+		"source",
+		WithLogger(testutils.Logger()),
+	)
+	target := NewRegistry(
+		"target",
+		WithHeartbeatTimeout(500),
+		WithLogger(testutils.Logger()),
+	)
+
+	source.AddMember(randomMember("member-1"), WithNowTime(100))
+	m, _ := source.Member("member-1")
+	target.RemoteUpdate(m, WithNowTime(100))
+
+	// The source node leaves the cluster, so would normally be treated as
+	// orphaned.
+	target.OnNodeLeave("source", WithNowTime(1000))
+
+	for _, u := range source.Handoff([]string{"target"}, WithNowTime(1000)) {
+		target.AcceptHandoff(u, WithNowTime(1000))
+	}
+
+	m, ok := target.Member("member-1")
+	assert.True(t, ok)
+	assert.Equal(t, "target", m.Version.OwnerId)
+	assert.Equal(t, rpc.Liveness_UP, m.Liveness)
+
+	// The member should be treated as last seen when handed off.
+	target.UpdateLiveness(1400)
+	m, _ = target.Member("member-1")
+	assert.Equal(t, rpc.Liveness_UP, m.Liveness)
+
+	target.UpdateLiveness(1600)
+	m, _ = target.Member("member-1")
+	assert.Equal(t, rpc.Liveness_DOWN, m.Liveness)
+
+	assert.Equal(t, 1.0, target.Metrics().MembersHandedOff.Value(map[string]string{
+		"direction": "inbound",
+	}))
+}
+
+func TestRegistry_AcceptHandoffToOtherNode(t *testing.T) {
+	source := NewRegistry(
+		"source",
+		WithLogger(testutils.Logger()),
+	)
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	source.AddMember(randomMember("member-1"), WithNowTime(100))
+	for _, u := range source.Handoff([]string{"remote"}, WithNowTime(200)) {
+		reg.AcceptHandoff(u, WithNowTime(200))
+	}
+
+	m, ok := reg.Member("member-1")
+	assert.True(t, ok)
+	assert.Equal(t, "remote", m.Version.OwnerId)
+	assert.Equal(t, 0, len(reg.OwnedMembers()))
+}
+
+func TestRegistry_AcceptHandoffAlreadyOwnedIgnored(t *testing.T) {
+	source := NewRegistry(
+		"source",
+		WithLogger(testutils.Logger()),
+	)
+	target := NewRegistry(
+		"target",
+		WithLogger(testutils.Logger()),
+	)
+
+	source.AddMember(randomMember("member-1"), WithNowTime(100))
+
+	// The members client has already reconnected to the target.
+	reconnected := randomMember("member-1")
+	target.AddMember(reconnected, WithNowTime(200))
+
+	for _, u := range source.Handoff([]string{"target"}, WithNowTime(300)) {
+		target.AcceptHandoff(u, WithNowTime(300))
+	}
+
+	m, ok := target.MemberState("member-1")
+	assert.True(t, ok)
+	assert.Equal(t, reconnected.Metadata, m.Metadata)
+}
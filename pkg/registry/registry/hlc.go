@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
+// hybridClock is a hybrid logical clock (HLC) used to assign versions to
+// member updates.
+//
+// Each timestamp contains the physical time in UNIX milliseconds and a logical
+// counter. The clock follows the local wall clock, but never goes backwards and
+// advances past any timestamp observed from other nodes. Therefore an update
+// generated after observing another nodes update always has a greater version,
+// even if the local wall clock is behind the other nodes clock.
+type hybridClock struct {
+	timestamp int64
+	counter   uint64
+}
+
+// Now returns the next timestamp given the local wall clock time.
+//
+// If the wall clock is ahead of the last timestamp it is used with a counter of
+// 0, otherwise the last timestamp is reused with the counter incremented.
+func (c *hybridClock) Now(now int64) *rpc.MonotonicTimestamp {
+	if now > c.timestamp {
+		c.timestamp = now
+		c.counter = 0
+	} else {
+		c.counter++
+	}
+	return &rpc.MonotonicTimestamp{
+		Timestamp: c.timestamp,
+		Counter:   c.counter,
+	}
+}
+
+// Observe advances the clock past the given timestamp received from another
+// node, so any later local timestamp will be greater.
+func (c *hybridClock) Observe(ts *rpc.MonotonicTimestamp) {
+	if ts.Timestamp > c.timestamp {
+		c.timestamp = ts.Timestamp
+		c.counter = ts.Counter
+	} else if ts.Timestamp == c.timestamp && ts.Counter > c.counter {
+		c.counter = ts.Counter
+	}
+}
+
+// ClockDriftPolicy defines how to handle updates from nodes whose clock is
+// ahead of the local clock by more than the maximum drift.
+type ClockDriftPolicy int
+
+const (
+	// ClockDriftPolicyFlag applies the update but logs a warning and records
+	// the drift in the registry metrics.
+	ClockDriftPolicyFlag ClockDriftPolicy = iota
+	// ClockDriftPolicyReject discards the update so the local clock isn't
+	// advanced past the drifted timestamp.
+	ClockDriftPolicyReject
+)
+
+func (p ClockDriftPolicy) String() string {
+	switch p {
+	case ClockDriftPolicyFlag:
+		return "flag"
+	case ClockDriftPolicyReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseClockDriftPolicy returns the clock drift policy with the given name.
+func ParseClockDriftPolicy(s string) (ClockDriftPolicy, error) {
+	switch strings.ToLower(s) {
+	case "flag":
+		return ClockDriftPolicyFlag, nil
+	case "reject":
+		return ClockDriftPolicyReject, nil
+	default:
+		return 0, fmt.Errorf("unknown clock drift policy: %s", s)
+	}
+}
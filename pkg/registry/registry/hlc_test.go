@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHybridClock_FollowsWallClock(t *testing.T) {
+	var clock hybridClock
+
+	ts := clock.Now(100)
+	assert.Equal(t, int64(100), ts.Timestamp)
+	assert.Equal(t, uint64(0), ts.Counter)
+
+	ts = clock.Now(100)
+	assert.Equal(t, int64(100), ts.Timestamp)
+	assert.Equal(t, uint64(1), ts.Counter)
+
+	ts = clock.Now(200)
+	assert.Equal(t, int64(200), ts.Timestamp)
+	assert.Equal(t, uint64(0), ts.Counter)
+}
+
+func TestHybridClock_NeverGoesBackwards(t *testing.T) {
+	var clock hybridClock
+
+	clock.Now(200)
+
+	ts := clock.Now(100)
+	assert.Equal(t, int64(200), ts.Timestamp)
+	assert.Equal(t, uint64(1), ts.Counter)
+}
+
+func TestHybridClock_ObserveRemoteTimestamp(t *testing.T) {
+	var clock hybridClock
+
+	clock.Now(100)
+	clock.Observe(&rpc.MonotonicTimestamp{Timestamp: 500, Counter: 3})
+
+	ts := clock.Now(200)
+	assert.Equal(t, int64(500), ts.Timestamp)
+	assert.Equal(t, uint64(4), ts.Counter)
+
+	// Observing an older timestamp has no effect.
+	clock.Observe(&rpc.MonotonicTimestamp{Timestamp: 300, Counter: 10})
+
+	ts = clock.Now(200)
+	assert.Equal(t, int64(500), ts.Timestamp)
+	assert.Equal(t, uint64(5), ts.Counter)
+}
+
+// Tests after receiving a remote update from a node whose clock is ahead,
+// local updates still supersede the remote update.
+func TestRegistry_RemoteUpdateAdvancesClock(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.RemoteUpdate(&rpc.Member2{
+		State: randomMember("my-member"),
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 500,
+			},
+		},
+	}, WithNowTime(100))
+
+	addedMember := randomMember("my-member")
+	reg.AddMember(addedMember, WithNowTime(200))
+
+	m, ok := reg.Member("my-member")
+	assert.True(t, ok)
+	assert.Equal(t, "local", m.Version.OwnerId)
+	assert.Equal(t, int64(500), m.Version.Timestamp.Timestamp)
+	assert.Equal(t, uint64(1), m.Version.Timestamp.Counter)
+}
+
+func TestRegistry_RemoteUpdateClockDriftRejected(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithMaxClockDrift(1000),
+		WithClockDriftPolicy(ClockDriftPolicyReject),
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.RemoteUpdate(&rpc.Member2{
+		State: randomMember("my-member"),
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 5000,
+			},
+		},
+	}, WithNowTime(100))
+
+	_, ok := reg.Member("my-member")
+	assert.False(t, ok)
+
+	assert.Equal(t, 1.0, reg.Metrics().ClockDriftExceeded.Value(map[string]string{
+		"policy": "reject",
+	}))
+
+	// The clock should not have advanced.
+	reg.AddMember(randomMember("my-member"), WithNowTime(200))
+	m, ok := reg.Member("my-member")
+	assert.True(t, ok)
+	assert.Equal(t, int64(200), m.Version.Timestamp.Timestamp)
+}
+
+func TestRegistry_RemoteUpdateClockDriftFlagged(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithMaxClockDrift(1000),
+		WithClockDriftPolicy(ClockDriftPolicyFlag),
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.RemoteUpdate(&rpc.Member2{
+		State: randomMember("my-member"),
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 5000,
+			},
+		},
+	}, WithNowTime(100))
+
+	m, ok := reg.Member("my-member")
+	assert.True(t, ok)
+	assert.Equal(t, "remote", m.Version.OwnerId)
+
+	assert.Equal(t, 1.0, reg.Metrics().ClockDriftExceeded.Value(map[string]string{
+		"policy": "flag",
+	}))
+}
+
+func TestRegistry_DeltaAdvancesClock(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.Delta(map[string]*rpc.MonotonicTimestamp{
+		"my-member": {Timestamp: 500, Counter: 2},
+	}, WithNowTime(100))
+
+	reg.AddMember(randomMember("my-member"), WithNowTime(200))
+
+	m, ok := reg.Member("my-member")
+	assert.True(t, ok)
+	assert.Equal(t, int64(500), m.Version.Timestamp.Timestamp)
+	assert.Equal(t, uint64(3), m.Version.Timestamp.Counter)
+}
@@ -0,0 +1,161 @@
+package registry
+
+import (
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
+// memberIndex is a secondary index mapping a key (such as a service name) to
+// the IDs of the members with that key.
+type memberIndex map[string]map[string]interface{}
+
+func (i memberIndex) add(key string, id string) {
+	ids, ok := i[key]
+	if !ok {
+		ids = make(map[string]interface{})
+		i[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (i memberIndex) remove(key string, id string) {
+	ids, ok := i[key]
+	if !ok {
+		return
+	}
+	delete(ids, id)
+	// Remove empty keys so the index doesn't grow with every key ever seen.
+	if len(ids) == 0 {
+		delete(i, key)
+	}
+}
+
+// memberIndexes contains the registry secondary indexes, which are updated
+// whenever a member is set or deleted so lookups don't have to scan every
+// member.
+type memberIndexes struct {
+	namespace memberIndex
+	service   memberIndex
+	region    memberIndex
+	locality  memberIndex
+	owner     memberIndex
+	liveness  memberIndex
+}
+
+func newMemberIndexes() *memberIndexes {
+	return &memberIndexes{
+		namespace: make(memberIndex),
+		service:   make(memberIndex),
+		region:    make(memberIndex),
+		locality:  make(memberIndex),
+		owner:     make(memberIndex),
+		liveness:  make(memberIndex),
+	}
+}
+
+func (i *memberIndexes) add(m *rpc.Member2) {
+	id := m.State.Id
+	region, zone := memberLocality(m)
+
+	i.namespace.add(MemberNamespace(m.State), id)
+	i.service.add(m.State.Service, id)
+	i.region.add(region, id)
+	i.locality.add(localityKey(region, zone), id)
+	i.owner.add(m.Version.OwnerId, id)
+	i.liveness.add(m.Liveness.String(), id)
+}
+
+func (i *memberIndexes) remove(m *rpc.Member2) {
+	id := m.State.Id
+	region, zone := memberLocality(m)
+
+	i.namespace.remove(MemberNamespace(m.State), id)
+	i.service.remove(m.State.Service, id)
+	i.region.remove(region, id)
+	i.locality.remove(localityKey(region, zone), id)
+	i.owner.remove(m.Version.OwnerId, id)
+	i.liveness.remove(m.Liveness.String(), id)
+}
+
+// MembersByService returns the members with the given service.
+func (r *Registry) MembersByService(service string) []*rpc.Member2 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.indexedMembersLocked(r.indexes.service[service])
+}
+
+// MembersByOwner returns the members owned by the node with the given ID.
+func (r *Registry) MembersByOwner(owner string) []*rpc.Member2 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.indexedMembersLocked(r.indexes.owner[owner])
+}
+
+// MembersByLocality returns the members in the given region and availability
+// zone. If the availability zone is empty, all members in the region are
+// returned.
+func (r *Registry) MembersByLocality(region string, zone string) []*rpc.Member2 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if zone == "" {
+		return r.indexedMembersLocked(r.indexes.region[region])
+	}
+	return r.indexedMembersLocked(r.indexes.locality[localityKey(region, zone)])
+}
+
+// MembersByLiveness returns the members with the given liveness.
+func (r *Registry) MembersByLiveness(liveness rpc.Liveness) []*rpc.Member2 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.indexedMembersLocked(r.indexes.liveness[liveness.String()])
+}
+
+func (r *Registry) indexedMembersLocked(ids map[string]interface{}) []*rpc.Member2 {
+	members := make([]*rpc.Member2, 0, len(ids))
+	for id := range ids {
+		members = append(members, r.members[id])
+	}
+	return members
+}
+
+// filterCandidatesLocked returns the IDs of the members that may match the
+// filter using the service or namespace index, or false if the filter can't
+// be narrowed using an index so every member must be checked.
+func (r *Registry) filterCandidatesLocked(filter *Filter) (map[string]interface{}, bool) {
+	if filter == nil {
+		return nil, false
+	}
+	if len(filter.Service) == 0 {
+		if filter.Namespace != "" {
+			return r.indexes.namespace[filter.Namespace], true
+		}
+		return nil, false
+	}
+
+	if len(filter.Service) == 1 {
+		return r.indexes.service[filter.Service[0]], true
+	}
+
+	candidates := make(map[string]interface{})
+	for _, service := range filter.Service {
+		for id := range r.indexes.service[service] {
+			candidates[id] = struct{}{}
+		}
+	}
+	return candidates, true
+}
+
+func memberLocality(m *rpc.Member2) (string, string) {
+	if m.State.Locality == nil {
+		return "", ""
+	}
+	return m.State.Locality.Region, m.State.Locality.AvailabilityZone
+}
+
+func localityKey(region string, zone string) string {
+	// Use a separator that can't be in a region name.
+	return region + "\x00" + zone
+}
@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex_MembersByService(t *testing.T) {
+	reg := NewRegistry("local")
+
+	m := remoteMember("member-1", 100)
+	m.State.Service = "foo"
+	reg.RemoteUpdate(m)
+
+	assert.Equal(t, []string{"member-1"}, memberIDs(reg.MembersByService("foo")))
+
+	// Updating the service should move the member in the index.
+	m = remoteMember("member-1", 200)
+	m.State.Service = "bar"
+	reg.RemoteUpdate(m)
+
+	assert.Empty(t, reg.MembersByService("foo"))
+	assert.Equal(t, []string{"member-1"}, memberIDs(reg.MembersByService("bar")))
+}
+
+func TestIndex_MembersByOwner(t *testing.T) {
+	reg := NewRegistry("local")
+
+	reg.AddMember(randomMember("member-1"))
+	reg.RemoteUpdate(remoteMember("member-2", 100))
+
+	assert.Equal(t, []string{"member-1"}, memberIDs(reg.MembersByOwner("local")))
+	assert.Equal(t, []string{"member-2"}, memberIDs(reg.MembersByOwner("remote")))
+	assert.Equal(t, []string{"member-1"}, memberIDs(reg.OwnedMembers()))
+}
+
+func TestIndex_MembersByLocality(t *testing.T) {
+	reg := NewRegistry("local")
+
+	for i, zone := range []string{"eu-west-1a", "eu-west-1b"} {
+		m := remoteMember(fmt.Sprintf("member-%d", i), 100)
+		m.State.Locality = &rpc.Locality{
+			Region:           "eu-west-1",
+			AvailabilityZone: zone,
+		}
+		reg.RemoteUpdate(m)
+	}
+
+	assert.ElementsMatch(t, []string{"member-0", "member-1"}, memberIDs(reg.MembersByLocality("eu-west-1", "")))
+	assert.Equal(t, []string{"member-1"}, memberIDs(reg.MembersByLocality("eu-west-1", "eu-west-1b")))
+	assert.Empty(t, reg.MembersByLocality("us-east-1", ""))
+}
+
+func TestIndex_MembersByLiveness(t *testing.T) {
+	reg := NewRegistry("local")
+
+	reg.AddMember(randomMember("member-1"), WithNowTime(100))
+	reg.AddMember(randomMember("member-2"), WithNowTime(100))
+
+	assert.ElementsMatch(t, []string{"member-1", "member-2"}, memberIDs(reg.UpMembers()))
+
+	reg.RemoveMember("member-1", WithNowTime(200))
+
+	assert.Equal(t, []string{"member-2"}, memberIDs(reg.MembersByLiveness(rpc.Liveness_UP)))
+	assert.Equal(t, []string{"member-1"}, memberIDs(reg.MembersByLiveness(rpc.Liveness_LEFT)))
+
+	// Once removed the member should be removed from the index.
+	reg.UpdateLiveness(200 + reg.tombstoneTimeout + 1)
+	assert.Empty(t, reg.MembersByLiveness(rpc.Liveness_LEFT))
+}
+
+// Tests subscribing with a service filter only sends members in that service.
+func TestIndex_UpdatesWithServiceFilter(t *testing.T) {
+	reg := NewRegistry("local")
+
+	for i := 0; i != 10; i++ {
+		m := remoteMember(fmt.Sprintf("member-%d", i), 100)
+		m.State.Service = fmt.Sprintf("service-%d", i%2)
+		reg.RemoteUpdate(m)
+	}
+
+	updates := reg.Updates(&rpc.SubscribeRequest{
+		KnownMembers: map[string]*rpc.Version2{
+			// Known member that doesn't match the filter should be removed.
+			"member-1": {
+				OwnerId:   "remote",
+				Timestamp: &rpc.MonotonicTimestamp{Timestamp: 100},
+			},
+		},
+	}, WithFilter(&Filter{Service: []string{"service-0"}}))
+
+	var left []string
+	var up []string
+	for _, u := range updates {
+		if u.Liveness == rpc.Liveness_LEFT {
+			left = append(left, u.State.Id)
+		} else {
+			up = append(up, u.State.Id)
+		}
+	}
+	assert.ElementsMatch(t, []string{"member-0", "member-2", "member-4", "member-6", "member-8"}, up)
+	assert.Equal(t, []string{"member-1"}, left)
+}
+
+func BenchmarkRegistry_MembersByService(b *testing.B) {
+	for _, n := range []int{100, 10000, 50000} {
+		reg := benchmarkRegistry(n)
+		b.Run(fmt.Sprintf("indexed-%d", n), func(b *testing.B) {
+			for i := 0; i != b.N; i++ {
+				reg.MembersByService("service-0")
+			}
+		})
+		b.Run(fmt.Sprintf("scan-%d", n), func(b *testing.B) {
+			for i := 0; i != b.N; i++ {
+				var members []*rpc.Member2
+				for _, m := range reg.Members() {
+					if m.State.Service == "service-0" {
+						members = append(members, m)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRegistry_MembersByOwner(b *testing.B) {
+	for _, n := range []int{100, 10000, 50000} {
+		reg := benchmarkRegistry(n)
+		b.Run(fmt.Sprintf("indexed-%d", n), func(b *testing.B) {
+			for i := 0; i != b.N; i++ {
+				reg.MembersByOwner("owner-0")
+			}
+		})
+		b.Run(fmt.Sprintf("scan-%d", n), func(b *testing.B) {
+			for i := 0; i != b.N; i++ {
+				var members []*rpc.Member2
+				for _, m := range reg.Members() {
+					if m.Version.OwnerId == "owner-0" {
+						members = append(members, m)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRegistry_UpdatesWithServiceFilter(b *testing.B) {
+	for _, n := range []int{100, 10000, 50000} {
+		reg := benchmarkRegistry(n)
+		b.Run(fmt.Sprintf("members-%d", n), func(b *testing.B) {
+			for i := 0; i != b.N; i++ {
+				reg.Updates(
+					&rpc.SubscribeRequest{},
+					WithFilter(&Filter{Service: []string{"service-0"}}),
+				)
+			}
+		})
+	}
+}
+
+// benchmarkRegistry returns a registry with n members, spread across 100
+// services and 10 owners.
+func benchmarkRegistry(n int) *Registry {
+	reg := NewRegistry("local")
+	for i := 0; i != n; i++ {
+		m := remoteMember(fmt.Sprintf("member-%d", i), 100)
+		m.State.Service = fmt.Sprintf("service-%d", i%100)
+		m.Version.OwnerId = fmt.Sprintf("owner-%d", i%10)
+		reg.RemoteUpdate(m)
+	}
+	return reg
+}
+
+func memberIDs(members []*rpc.Member2) []string {
+	var ids []string
+	for _, m := range members {
+		ids = append(ids, m.State.Id)
+	}
+	return ids
+}
@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
+// Lifecycle statuses of a member, stored in the member state status.
+//
+// A member normally registers as either starting (registered but not yet
+// ready to receive traffic) or active. Before shutting down, a member moves to
+// draining, so clients stop sending it new traffic while in-flight requests
+// complete, then terminating once it is about to exit.
+//
+// Members may use other statuses, in which case their transitions aren't
+// validated, though once a member uses a lifecycle status it can't move to a
+// status outside the lifecycle.
+const (
+	StatusStarting    = "starting"
+	StatusActive      = "active"
+	StatusDraining    = "draining"
+	StatusTerminating = "terminating"
+)
+
+// ErrInvalidTransition is returned when a member update doesn't follow the
+// member lifecycle.
+var ErrInvalidTransition = errors.New("invalid lifecycle transition")
+
+// lifecycleTransitions contains the statuses each lifecycle status may move
+// to.
+var lifecycleTransitions = map[string][]string{
+	StatusStarting:    {StatusStarting, StatusActive, StatusDraining, StatusTerminating},
+	StatusActive:      {StatusActive, StatusDraining, StatusTerminating},
+	StatusDraining:    {StatusDraining, StatusActive, StatusTerminating},
+	StatusTerminating: {StatusTerminating},
+}
+
+// IsLifecycleStatus returns whether the status is one of the member lifecycle
+// statuses.
+func IsLifecycleStatus(status string) bool {
+	switch status {
+	case StatusStarting, StatusActive, StatusDraining, StatusTerminating:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidateTransition returns an error wrapping ErrInvalidTransition if a
+// member can't move from status 'from' to status 'to'.
+//
+// An empty 'from' status is a new member, which may register with any status,
+// since a member may reconnect in any state, such as a draining member whose
+// Fuddle node failed.
+func ValidateTransition(from string, to string) error {
+	if !IsLifecycleStatus(from) {
+		// New members and members using statuses outside the lifecycle
+		// aren't validated.
+		return nil
+	}
+
+	for _, s := range lifecycleTransitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+}
+
+// lifecycleLabel returns the lifecycle metric label for the status.
+func lifecycleLabel(status string) string {
+	if IsLifecycleStatus(status) {
+		return status
+	}
+	return "other"
+}
+
+// incLifecycleCount adds the member to the lifecycle metrics. Members that
+// have left aren't counted.
+func (r *Registry) incLifecycleCount(m *rpc.Member2) {
+	if m.Liveness == rpc.Liveness_LEFT {
+		return
+	}
+	r.metrics.MembersLifecycle.Inc(map[string]string{
+		"namespace": MemberNamespace(m.State),
+		"state":     lifecycleLabel(m.State.Status),
+	})
+}
+
+// decLifecycleCount removes the member from the lifecycle metrics.
+func (r *Registry) decLifecycleCount(m *rpc.Member2) {
+	if m.Liveness == rpc.Liveness_LEFT {
+		return
+	}
+	r.metrics.MembersLifecycle.Dec(map[string]string{
+		"namespace": MemberNamespace(m.State),
+		"state":     lifecycleLabel(m.State.Status),
+	})
+}
+
+// isDrainingStatus returns whether clients should stop sending new traffic
+// to members with the given status.
+func isDrainingStatus(status string) bool {
+	return status == StatusDraining || status == StatusTerminating
+}
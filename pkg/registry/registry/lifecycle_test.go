@@ -0,0 +1,181 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		from  string
+		to    string
+		valid bool
+	}{
+		{"", StatusStarting, true},
+		{"", StatusDraining, true},
+		{"", "custom", true},
+		{StatusStarting, StatusActive, true},
+		{StatusActive, StatusDraining, true},
+		{StatusActive, StatusStarting, false},
+		{StatusDraining, StatusActive, true},
+		{StatusDraining, StatusTerminating, true},
+		{StatusTerminating, StatusActive, false},
+		{StatusTerminating, StatusTerminating, true},
+		{StatusActive, "custom", false},
+		{"custom", StatusActive, true},
+		{"custom", "other", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			err := ValidateTransition(tt.from, tt.to)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, ErrInvalidTransition))
+			}
+		})
+	}
+}
+
+func TestRegistry_AddMemberInvalidTransition(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	member := randomMember("member-1")
+	member.Status = StatusTerminating
+	require.NoError(t, reg.AddMember(member))
+
+	member = copyMemberState(member)
+	member.Status = StatusActive
+	err := reg.AddMember(member)
+	assert.True(t, errors.Is(err, ErrInvalidTransition))
+
+	m, ok := reg.MemberState("member-1")
+	require.True(t, ok)
+	assert.Equal(t, StatusTerminating, m.Status)
+
+	assert.Equal(t, 1.0, reg.Metrics().LifecycleTransitionsRejected.Value(map[string]string{
+		"from": "terminating",
+		"to":   "active",
+	}))
+}
+
+// Tests a member that is down may re-register with any status, such as if it
+// restarted with the same ID.
+func TestRegistry_AddMemberDownTreatedAsNew(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithHeartbeatTimeout(500),
+		WithLogger(testutils.Logger()),
+	)
+
+	member := randomMember("member-1")
+	member.Status = StatusTerminating
+	require.NoError(t, reg.AddMember(member, WithNowTime(100)))
+
+	reg.UpdateLiveness(1000)
+	m, ok := reg.Member("member-1")
+	require.True(t, ok)
+	require.Equal(t, rpc.Liveness_DOWN, m.Liveness)
+
+	member = copyMemberState(member)
+	member.Status = StatusStarting
+	assert.NoError(t, reg.AddMember(member))
+}
+
+// Tests a new registration may use any status while the previous
+// registration is still UP, such as if the member restarted with the same ID.
+func TestRegistry_AddMemberNewRegistration(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	member := randomMember("member-1")
+	member.Status = StatusTerminating
+	require.NoError(t, reg.AddMember(member))
+
+	member = copyMemberState(member)
+	member.Status = StatusStarting
+	require.NoError(t, reg.AddMember(member, WithNewRegistration()))
+
+	m, ok := reg.MemberState("member-1")
+	require.True(t, ok)
+	assert.Equal(t, StatusStarting, m.Status)
+}
+
+func TestRegistry_LifecycleMetrics(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	member := randomMember("member-1")
+	member.Status = StatusActive
+	require.NoError(t, reg.AddMember(member))
+	member = copyMemberState(member)
+	member.Status = StatusDraining
+	require.NoError(t, reg.AddMember(member))
+
+	custom := randomMember("member-2")
+	require.NoError(t, reg.AddMember(custom))
+
+	assert.Equal(t, 0.0, reg.Metrics().MembersLifecycle.Value(map[string]string{
+		"namespace": "default",
+		"state":     "active",
+	}))
+	assert.Equal(t, 1.0, reg.Metrics().MembersLifecycle.Value(map[string]string{
+		"namespace": "default",
+		"state":     "draining",
+	}))
+	assert.Equal(t, 1.0, reg.Metrics().MembersLifecycle.Value(map[string]string{
+		"namespace": "default",
+		"state":     "other",
+	}))
+
+	reg.RemoveMember("member-1")
+	assert.Equal(t, 0.0, reg.Metrics().MembersLifecycle.Value(map[string]string{
+		"namespace": "default",
+		"state":     "draining",
+	}))
+}
+
+// Tests a subscriber excluding draining members is sent the member as left
+// once it starts draining.
+func TestRegistry_SubscribeExcludeDraining(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	var updates []*rpc.Member2
+	unsubscribe := reg.Subscribe(nil, func(u *rpc.Member2) {
+		updates = append(updates, u)
+	}, WithFilter(&Filter{ExcludeDraining: true}))
+	defer unsubscribe()
+
+	member := randomMember("member-1")
+	member.Status = StatusActive
+	require.NoError(t, reg.AddMember(member))
+	member = copyMemberState(member)
+	member.Status = StatusDraining
+	require.NoError(t, reg.AddMember(member))
+
+	require.Equal(t, 2, len(updates))
+	assert.Equal(t, rpc.Liveness_UP, updates[0].Liveness)
+	assert.Equal(t, rpc.Liveness_LEFT, updates[1].Liveness)
+}
+
+func TestRegistry_MembersExcludeDraining(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	for id, status := range map[string]string{
+		"member-1": StatusStarting,
+		"member-2": StatusActive,
+		"member-3": StatusDraining,
+		"member-4": StatusTerminating,
+	} {
+		member := randomMember(id)
+		member.Status = status
+		require.NoError(t, reg.AddMember(member))
+	}
+
+	q, err := ParseQuery("draining = false")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"member-1", "member-2"}, memberIDs(reg.Members(WithQuery(q))))
+}
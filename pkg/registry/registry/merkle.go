@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"go.uber.org/zap"
+)
+
+const (
+	// TreeFanout is the number of children of each node in the Merkle tree.
+	TreeFanout = 64
+	// TreeLevels is the number of levels in the Merkle tree below the root,
+	// where the last level contains the buckets.
+	TreeLevels = 2
+	// TreeBuckets is the number of leaf buckets in the Merkle tree.
+	TreeBuckets = TreeFanout * TreeFanout
+)
+
+// merkleTree summarises the registry state for replica repair.
+//
+// Each member is hashed into a bucket based on its ID, where the hash of a
+// bucket is the XOR of the hashes of the members versions in that bucket. The
+// hash of an inner node is the XOR of all member hashes below it. Using XOR
+// means the tree can be updated incrementally in constant time as members are
+// updated, without having to recompute the hashes of other members.
+//
+// Nodes can compare their trees level by level, only drilling down into the
+// nodes whose hashes don't match, to find the buckets that differ in a few
+// round trips regardless of the registry size.
+type merkleTree struct {
+	// levels contains the node hashes at each level, where levels[0] contains
+	// the children of the root and levels[TreeLevels-1] contains the buckets.
+	levels [TreeLevels][]uint64
+
+	// buckets contains the IDs of the members in each bucket, so the members
+	// in the mismatched buckets can be found without scanning every member.
+	buckets []map[string]struct{}
+}
+
+func newMerkleTree() *merkleTree {
+	t := &merkleTree{
+		buckets: make([]map[string]struct{}, TreeBuckets),
+	}
+	size := 1
+	for level := 0; level != TreeLevels; level++ {
+		size *= TreeFanout
+		t.levels[level] = make([]uint64, size)
+	}
+	return t
+}
+
+// Add adds the members version to the tree.
+func (t *merkleTree) Add(m *rpc.Member2) {
+	bucket := treeBucket(m.State.Id)
+	t.xor(bucket, memberHash(m.State.Id, m.Version.Timestamp))
+
+	if t.buckets[bucket] == nil {
+		t.buckets[bucket] = make(map[string]struct{})
+	}
+	t.buckets[bucket][m.State.Id] = struct{}{}
+}
+
+// Remove removes the members version from the tree.
+func (t *merkleTree) Remove(m *rpc.Member2) {
+	bucket := treeBucket(m.State.Id)
+	// Since XOR is its own inverse, removing the hash is the same as adding.
+	t.xor(bucket, memberHash(m.State.Id, m.Version.Timestamp))
+
+	delete(t.buckets[bucket], m.State.Id)
+}
+
+// Bucket returns the IDs of the members in the given bucket.
+func (t *merkleTree) Bucket(bucket int) map[string]struct{} {
+	if bucket < 0 || bucket >= len(t.buckets) {
+		return nil
+	}
+	return t.buckets[bucket]
+}
+
+// Hashes returns the hashes of the children of the given parent nodes at the
+// given level, in the order of the parents. Level 0 has a single parent (the
+// root), so parents is ignored.
+func (t *merkleTree) Hashes(level int, parents []int) []uint64 {
+	if level < 0 || level >= TreeLevels {
+		return nil
+	}
+	if level == 0 {
+		hashes := make([]uint64, TreeFanout)
+		copy(hashes, t.levels[0])
+		return hashes
+	}
+
+	hashes := make([]uint64, 0, len(parents)*TreeFanout)
+	for _, parent := range parents {
+		if parent < 0 || parent >= len(t.levels[level-1]) {
+			continue
+		}
+		start := parent * TreeFanout
+		hashes = append(hashes, t.levels[level][start:start+TreeFanout]...)
+	}
+	return hashes
+}
+
+func (t *merkleTree) xor(bucket int, h uint64) {
+	index := bucket
+	for level := TreeLevels - 1; level >= 0; level-- {
+		t.levels[level][index] ^= h
+		index /= TreeFanout
+	}
+}
+
+// TreeHashes returns the hashes of the Merkle tree nodes at the given level
+// that are children of the given parents. See merkleTree.Hashes.
+func (r *Registry) TreeHashes(level int, parents []int) []uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.tree.Hashes(level, parents)
+}
+
+// TreeMismatches compares the given remote hashes of the children of parents
+// at the given level with the local tree, and returns the indexes of the nodes
+// whose hashes don't match.
+//
+// If the number of remote hashes doesn't match the number of children, all
+// children are considered mismatched.
+func (r *Registry) TreeMismatches(level int, parents []int, remote []uint64) []int {
+	local := r.TreeHashes(level, parents)
+
+	if level == 0 {
+		parents = []int{0}
+	}
+
+	var mismatched []int
+	for i, parent := range parents {
+		for child := 0; child != TreeFanout; child++ {
+			index := i*TreeFanout + child
+			if index < len(local) && index < len(remote) && local[index] == remote[index] {
+				continue
+			}
+			mismatched = append(mismatched, parent*TreeFanout+child)
+		}
+	}
+	return mismatched
+}
+
+// BucketDigest returns the timestamps of the known members in the given
+// buckets.
+func (r *Registry) BucketDigest(buckets []int) map[string]*rpc.MonotonicTimestamp {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	digest := make(map[string]*rpc.MonotonicTimestamp)
+	for bucket := range bucketSet(buckets) {
+		for id := range r.tree.Bucket(bucket) {
+			m := r.members[id]
+			digest[id] = &rpc.MonotonicTimestamp{
+				Timestamp: m.Version.Timestamp.Timestamp,
+				Counter:   m.Version.Timestamp.Counter,
+			}
+		}
+	}
+	return digest
+}
+
+// BucketDelta returns the members in the given buckets that are either more
+// up to date than those in the digest, or are missing from the digest.
+//
+// Unlike Delta, members the sender is more up to date about are not added to
+// the next digest, as the sender will be found to differ when this node next
+// compares trees.
+func (r *Registry) BucketDelta(buckets []int, digest map[string]*rpc.MonotonicTimestamp, opts ...Option) []*rpc.Member2 {
+	options := r.options(opts)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, timestamp := range digest {
+		r.observeLocked(timestamp, options.now, zap.String("member-id", id))
+	}
+
+	var members []*rpc.Member2
+	for bucket := range bucketSet(buckets) {
+		for id := range r.tree.Bucket(bucket) {
+			m := r.members[id]
+			timestamp, ok := digest[id]
+			if !ok || compareTimestamps(timestamp, m.Version.Timestamp) > 0 {
+				members = append(members, copyMember(m))
+			}
+		}
+	}
+	return members
+}
+
+func bucketSet(buckets []int) map[int]interface{} {
+	set := make(map[int]interface{}, len(buckets))
+	for _, b := range buckets {
+		set[b] = struct{}{}
+	}
+	return set
+}
+
+// treeBucket returns the bucket the member with the given ID is assigned to.
+func treeBucket(id string) int {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return int(h.Sum64() % TreeBuckets)
+}
+
+// memberHash returns the hash of the members version.
+//
+// The owner isn't included, as when multiple nodes take ownership of a member
+// with the same timestamp, it doesn't matter which owner wins (the same as
+// Delta).
+func memberHash(id string, ts *rpc.MonotonicTimestamp) uint64 {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[0:8], uint64(ts.Timestamp))
+	binary.BigEndian.PutUint64(b[8:16], ts.Counter)
+
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	h.Write(b)
+	return h.Sum64()
+}
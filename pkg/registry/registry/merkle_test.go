@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree_MatchingRegistries(t *testing.T) {
+	lhs := NewRegistry("lhs")
+	rhs := NewRegistry("rhs")
+
+	for i := 0; i != 1000; i++ {
+		m := remoteMember(fmt.Sprintf("member-%d", i), int64(100+i))
+		lhs.RemoteUpdate(m)
+		rhs.RemoteUpdate(m)
+	}
+
+	assert.Equal(t, lhs.TreeHashes(0, nil), rhs.TreeHashes(0, nil))
+	assert.Empty(t, lhs.TreeMismatches(0, nil, rhs.TreeHashes(0, nil)))
+}
+
+// Tests comparing trees level by level finds the bucket of the member that
+// differs.
+func TestTree_FindMismatchedBucket(t *testing.T) {
+	lhs := NewRegistry("lhs")
+	rhs := NewRegistry("rhs")
+
+	for i := 0; i != 1000; i++ {
+		m := remoteMember(fmt.Sprintf("member-%d", i), int64(100+i))
+		lhs.RemoteUpdate(m)
+		rhs.RemoteUpdate(m)
+	}
+
+	// Update a member on only one registry.
+	lhs.RemoteUpdate(remoteMember("member-10", 5000))
+
+	var parents []int
+	for level := 0; level != TreeLevels; level++ {
+		parents = lhs.TreeMismatches(level, parents, rhs.TreeHashes(level, parents))
+		assert.Equal(t, 1, len(parents))
+	}
+	assert.Equal(t, []int{treeBucket("member-10")}, parents)
+
+	// Once both registries have the update the trees should match.
+	rhs.RemoteUpdate(remoteMember("member-10", 5000))
+	assert.Empty(t, lhs.TreeMismatches(0, nil, rhs.TreeHashes(0, nil)))
+}
+
+func TestTree_MismatchedHashesLength(t *testing.T) {
+	reg := NewRegistry("local")
+	assert.Equal(t, TreeFanout, len(reg.TreeMismatches(0, nil, nil)))
+}
+
+func TestRegistry_BucketDelta(t *testing.T) {
+	reg := NewRegistry("local")
+
+	reg.RemoteUpdate(remoteMember("member-1", 100))
+	reg.RemoteUpdate(remoteMember("member-2", 200))
+	reg.RemoteUpdate(remoteMember("member-3", 300))
+
+	buckets := []int{
+		treeBucket("member-1"),
+		treeBucket("member-2"),
+		treeBucket("member-3"),
+	}
+
+	digest := reg.BucketDigest(buckets)
+	assert.Equal(t, 3, len(digest))
+	assert.Empty(t, reg.BucketDelta(buckets, digest))
+
+	// Includes members missing from the digest or out of date.
+	delta := reg.BucketDelta(buckets, map[string]*rpc.MonotonicTimestamp{
+		"member-1": {Timestamp: 50},
+		"member-2": {Timestamp: 200},
+	})
+	var ids []string
+	for _, m := range delta {
+		ids = append(ids, m.State.Id)
+	}
+	assert.ElementsMatch(t, []string{"member-1", "member-3"}, ids)
+
+	// Updated members are kept in their bucket.
+	reg.RemoteUpdate(remoteMember("member-1", 400))
+	digest = reg.BucketDigest([]int{treeBucket("member-1")})
+	assert.Equal(t, int64(400), digest["member-1"].Timestamp)
+
+	// Buckets outside the tree are ignored.
+	assert.Empty(t, reg.BucketDigest([]int{-1, TreeBuckets}))
+}
+
+func remoteMember(id string, timestamp int64) *rpc.Member2 {
+	return &rpc.Member2{
+		State:    randomMember(id),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: timestamp,
+			},
+		},
+	}
+}
@@ -7,6 +7,21 @@ import (
 type Metrics struct {
 	MembersCount *metrics.Gauge
 	MembersOwned *metrics.Gauge
+
+	MembersLifecycle             *metrics.Gauge
+	LifecycleTransitionsRejected *metrics.Counter
+
+	SubscriberUpdatesDropped *metrics.Counter
+	SubscriberOverflows      *metrics.Counter
+	SubscribersLagging       *metrics.Gauge
+
+	ClockDriftExceeded *metrics.Counter
+
+	FeedSubscriptions *metrics.Counter
+
+	MembersHandedOff *metrics.Counter
+
+	ReplicationLag *metrics.Histogram
 }
 
 func NewMetrics() *Metrics {
@@ -14,19 +29,83 @@ func NewMetrics() *Metrics {
 		MembersCount: metrics.NewGauge(
 			"registry",
 			"members.count",
-			[]string{"status", "owner"},
+			[]string{"namespace", "status", "owner"},
 			"Number of registered members in the cluster",
 		),
 		MembersOwned: metrics.NewGauge(
 			"registry",
 			"members.owned",
-			[]string{"status"},
+			[]string{"namespace", "status"},
 			"Number of members owned by this node",
 		),
+		MembersLifecycle: metrics.NewGauge(
+			"registry",
+			"members.lifecycle",
+			[]string{"namespace", "state"},
+			"Number of members that haven't left the cluster in each lifecycle state",
+		),
+		LifecycleTransitionsRejected: metrics.NewCounter(
+			"registry",
+			"lifecycle.transitions.rejected",
+			[]string{"from", "to"},
+			"Number of member updates rejected due to an invalid lifecycle transition",
+		),
+		SubscriberUpdatesDropped: metrics.NewCounter(
+			"registry",
+			"subscriber.updates.dropped",
+			[]string{"policy"},
+			"Number of updates dropped due to a full subscriber queue",
+		),
+		SubscriberOverflows: metrics.NewCounter(
+			"registry",
+			"subscriber.overflows",
+			[]string{"policy"},
+			"Number of times a subscriber queue overflowed",
+		),
+		SubscribersLagging: metrics.NewGauge(
+			"registry",
+			"subscribers.lagging",
+			[]string{},
+			"Number of subscribers whose queue is at least half full",
+		),
+		ClockDriftExceeded: metrics.NewCounter(
+			"registry",
+			"clock.drift.exceeded",
+			[]string{"policy"},
+			"Number of remote timestamps ahead of the local clock by more than the max drift",
+		),
+		FeedSubscriptions: metrics.NewCounter(
+			"registry",
+			"feed.subscriptions",
+			[]string{"result"},
+			"Number of subscribers resuming from the change feed, by whether they resumed or fell back to a full diff",
+		),
+		MembersHandedOff: metrics.NewCounter(
+			"registry",
+			"members.handoff",
+			[]string{"direction"},
+			"Number of members whose ownership was handed off to or from this node",
+		),
+		ReplicationLag: metrics.NewHistogram(
+			"registry",
+			"replication.lag.seconds",
+			[]string{"owner"},
+			[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+			"Time between a member update being versioned by its owner and applied by this node",
+		),
 	}
 }
 
 func (m *Metrics) Register(collector metrics.Collector) {
 	collector.AddGauge(m.MembersCount)
 	collector.AddGauge(m.MembersOwned)
+	collector.AddGauge(m.MembersLifecycle)
+	collector.AddCounter(m.LifecycleTransitionsRejected)
+	collector.AddCounter(m.SubscriberUpdatesDropped)
+	collector.AddCounter(m.SubscriberOverflows)
+	collector.AddGauge(m.SubscribersLagging)
+	collector.AddCounter(m.ClockDriftExceeded)
+	collector.AddCounter(m.FeedSubscriptions)
+	collector.AddCounter(m.MembersHandedOff)
+	collector.AddHistogram(m.ReplicationLag)
 }
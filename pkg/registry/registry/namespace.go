@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
+const (
+	// DefaultNamespace is the namespace of members that don't specify a
+	// namespace.
+	DefaultNamespace = "default"
+
+	// AllNamespaces selects members in any namespace.
+	AllNamespaces = "*"
+
+	// NamespaceMetadataKey is the member metadata key containing the members
+	// namespace.
+	//
+	// Since the member state doesn't have a namespace field, the namespace is
+	// stored in the member metadata, so it is replicated between nodes along
+	// with the rest of the member state.
+	NamespaceMetadataKey = "fuddle.namespace"
+)
+
+var namespacePattern = regexp.MustCompile("^[a-zA-Z0-9._-]{1,63}$")
+
+// MemberNamespace returns the namespace of the member.
+func MemberNamespace(m *rpc.MemberState) string {
+	if ns, ok := m.Metadata[NamespaceMetadataKey]; ok && ns != "" {
+		return ns
+	}
+	return DefaultNamespace
+}
+
+// WithMemberNamespace returns a copy of the member state in the given
+// namespace.
+func WithMemberNamespace(m *rpc.MemberState, namespace string) *rpc.MemberState {
+	m = copyMemberState(m)
+	m.Metadata[NamespaceMetadataKey] = namespace
+	return m
+}
+
+// ValidateNamespace returns an error if the namespace is not a valid name.
+//
+// A namespace must be between 1 and 63 characters, containing only
+// alphanumeric characters, '.', '_' and '-'.
+func ValidateNamespace(namespace string) error {
+	if !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace: %q", namespace)
+	}
+	return nil
+}
+
+// scopedNamespace returns whether the namespace selects a single namespace,
+// rather than all namespaces.
+func scopedNamespace(namespace string) bool {
+	return namespace != "" && namespace != AllNamespaces
+}
+
+// MembersByNamespace returns the members in the given namespace.
+func (r *Registry) MembersByNamespace(namespace string) []*rpc.Member2 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.indexedMembersLocked(r.indexes.namespace[namespace])
+}
@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_MembersWithNamespace(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	reg.AddMember(randomMember("member-1"))
+	reg.AddMember(WithMemberNamespace(randomMember("member-2"), "staging"))
+	reg.AddMember(WithMemberNamespace(randomMember("member-3"), "staging"))
+
+	assert.ElementsMatch(t, []string{"member-1"}, memberIDs(reg.Members(WithNamespace(DefaultNamespace))))
+	assert.ElementsMatch(t, []string{"member-2", "member-3"}, memberIDs(reg.Members(WithNamespace("staging"))))
+	assert.ElementsMatch(t, []string{"member-2", "member-3"}, memberIDs(reg.MembersByNamespace("staging")))
+	assert.Equal(t, 3, len(reg.Members(WithNamespace(AllNamespaces))))
+	assert.Equal(t, 3, len(reg.Members()))
+
+	q, err := ParseQuery(`namespace = "staging"`)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(reg.Members(WithQuery(q))))
+
+	assert.Equal(t, 2.0, reg.Metrics().MembersCount.Value(map[string]string{
+		"namespace": "staging",
+		"status":    "up",
+		"owner":     "local",
+	}))
+}
+
+// Tests a subscriber scoped to a namespace only receives updates to members
+// in that namespace.
+func TestRegistry_SubscribeWithNamespace(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	reg.AddMember(WithMemberNamespace(randomMember("member-1"), "staging"))
+	reg.AddMember(randomMember("member-2"))
+
+	var updates []string
+	unsubscribe := reg.Subscribe(nil, func(u *rpc.Member2) {
+		updates = append(updates, u.State.Id)
+	}, WithNamespace("staging"))
+	defer unsubscribe()
+
+	reg.AddMember(WithMemberNamespace(randomMember("member-3"), "staging"))
+	reg.AddMember(randomMember("member-4"))
+
+	assert.Equal(t, []string{"member-1", "member-3"}, updates)
+}
+
+// Tests members in all namespaces are replicated.
+func TestRegistry_RemoteUpdateWithNamespace(t *testing.T) {
+	reg := NewRegistry("local", WithLogger(testutils.Logger()))
+
+	m := remoteMember("member-1", 100)
+	m.State = WithMemberNamespace(m.State, "staging")
+	reg.RemoteUpdate(m)
+
+	assert.ElementsMatch(t, []string{"member-1"}, memberIDs(reg.Members(WithNamespace("staging"))))
+	assert.Empty(t, reg.Members(WithNamespace(DefaultNamespace)))
+}
+
+func TestValidateNamespace(t *testing.T) {
+	assert.NoError(t, ValidateNamespace("staging"))
+	assert.NoError(t, ValidateNamespace("team-a.prod_1"))
+	assert.Error(t, ValidateNamespace(""))
+	assert.Error(t, ValidateNamespace(AllNamespaces))
+	assert.Error(t, ValidateNamespace("foo/bar"))
+}
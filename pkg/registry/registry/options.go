@@ -1,10 +1,10 @@
 package registry
 
 import (
-	"time"
-
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/metrics"
+	"github.com/fuddle-io/fuddle/pkg/registry/storage"
 	"go.uber.org/zap"
 )
 
@@ -13,9 +13,26 @@ type options struct {
 	heartbeatTimeout int64
 	reconnectTimeout int64
 	tombstoneTimeout int64
+	maxClockDrift    int64
+	clockDriftPolicy ClockDriftPolicy
 	now              int64
-	collector        metrics.Collector
-	logger           *zap.Logger
+	nowSet           bool
+	clock            clock.Clock
+	storage          *storage.Storage
+	readOnly         bool
+	filter           *Filter
+	query            *Query
+
+	subscriberQueueLimit int
+	overflowPolicy       OverflowPolicy
+	onDisconnect         func()
+	onSubscribed         func(head FeedPosition, resumed bool)
+	namespace            string
+	feedLimit            int
+	newRegistration      bool
+
+	collector metrics.Collector
+	logger    *zap.Logger
 }
 
 func defaultOptions() *options {
@@ -23,7 +40,10 @@ func defaultOptions() *options {
 		heartbeatTimeout: 20 * 1000,
 		reconnectTimeout: 5 * 60 * 1000,
 		tombstoneTimeout: 30 * 60 * 1000,
-		now:              time.Now().UnixMilli(),
+		feedLimit:        4096,
+		maxClockDrift:    60 * 1000,
+		clockDriftPolicy: ClockDriftPolicyReject,
+		clock:            clock.NewRealClock(),
 		collector:        nil,
 		logger:           zap.NewNop(),
 	}
@@ -45,6 +65,19 @@ func WithLocalMember(m *rpc.MemberState) Option {
 	return localMemberOption{member: m}
 }
 
+type readOnlyOption struct{}
+
+func (o readOnlyOption) apply(opts *options) {
+	opts.readOnly = true
+}
+
+// WithReadOnly configures the registry to never own members, such as on
+// cache nodes. The registry only applies updates from other nodes, and never
+// takes ownership of members whose owner has left the cluster.
+func WithReadOnly() Option {
+	return readOnlyOption{}
+}
+
 type heartbeatTimeoutOption struct {
 	timeout int64
 }
@@ -81,20 +114,205 @@ func WithTombstoneTimeout(timeout int64) Option {
 	return tombstoneTimeoutOption{timeout: timeout}
 }
 
+type maxClockDriftOption struct {
+	drift int64
+}
+
+func (o maxClockDriftOption) apply(opts *options) {
+	opts.maxClockDrift = o.drift
+}
+
+// WithMaxClockDrift sets the maximum time in milliseconds a remote timestamp
+// may be ahead of the local clock before the clock drift policy is applied.
+// Zero disables the check.
+func WithMaxClockDrift(drift int64) Option {
+	return maxClockDriftOption{drift: drift}
+}
+
+type clockDriftPolicyOption struct {
+	policy ClockDriftPolicy
+}
+
+func (o clockDriftPolicyOption) apply(opts *options) {
+	opts.clockDriftPolicy = o.policy
+}
+
+// WithClockDriftPolicy sets how to handle remote timestamps that exceed the
+// max clock drift. Defaults to ClockDriftPolicyReject.
+func WithClockDriftPolicy(policy ClockDriftPolicy) Option {
+	return clockDriftPolicyOption{policy: policy}
+}
+
 type nowTimeOption struct {
 	now int64
 }
 
 func (o nowTimeOption) apply(opts *options) {
 	opts.now = o.now
+	opts.nowSet = true
 }
 
-// WithNowTime sets the time 'now' to the given timestamp. This can be
-// useful for testing.
+// WithNowTime sets the time 'now' to the given timestamp, instead of reading
+// the time from the registry clock. This can be useful for testing.
 func WithNowTime(now int64) Option {
 	return nowTimeOption{now: now}
 }
 
+type clockOption struct {
+	clock clock.Clock
+}
+
+func (o clockOption) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock the registry reads the time 'now' from. Defaults to
+// the system clock.
+func WithClock(c clock.Clock) Option {
+	return clockOption{clock: c}
+}
+
+type storageOption struct {
+	storage *storage.Storage
+}
+
+func (o storageOption) apply(opts *options) {
+	opts.storage = o.storage
+}
+
+// WithStorage persists registry updates to the given storage. Any state
+// already in the storage is loaded when the registry is created.
+func WithStorage(s *storage.Storage) Option {
+	return storageOption{storage: s}
+}
+
+type filterOption struct {
+	filter *Filter
+}
+
+func (o filterOption) apply(opts *options) {
+	opts.filter = o.filter
+}
+
+// WithFilter filters the members a subscriber receives updates for.
+func WithFilter(f *Filter) Option {
+	return filterOption{filter: f}
+}
+
+type queryOption struct {
+	query *Query
+}
+
+func (o queryOption) apply(opts *options) {
+	opts.query = o.query
+}
+
+// WithQuery only includes members matching the query.
+func WithQuery(q *Query) Option {
+	return queryOption{query: q}
+}
+
+type subscriberQueueLimitOption struct {
+	limit int
+}
+
+func (o subscriberQueueLimitOption) apply(opts *options) {
+	opts.subscriberQueueLimit = o.limit
+}
+
+// WithSubscriberQueueLimit delivers updates to the subscriber from a queue
+// with the given limit, instead of delivering updates synchronously.
+func WithSubscriberQueueLimit(limit int) Option {
+	return subscriberQueueLimitOption{limit: limit}
+}
+
+type overflowPolicyOption struct {
+	policy OverflowPolicy
+}
+
+func (o overflowPolicyOption) apply(opts *options) {
+	opts.overflowPolicy = o.policy
+}
+
+// WithOverflowPolicy sets how to handle subscribers whose queue is full.
+// Defaults to OverflowPolicyDisconnect.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return overflowPolicyOption{policy: policy}
+}
+
+type onDisconnectOption struct {
+	cb func()
+}
+
+func (o onDisconnectOption) apply(opts *options) {
+	opts.onDisconnect = o.cb
+}
+
+// WithOnDisconnect sets a callback that is called if the subscriber is
+// disconnected due to its queue overflowing. The callback must not block.
+func WithOnDisconnect(cb func()) Option {
+	return onDisconnectOption{cb: cb}
+}
+
+type onSubscribedOption struct {
+	cb func(head FeedPosition, resumed bool)
+}
+
+func (o onSubscribedOption) apply(opts *options) {
+	opts.onSubscribed = o.cb
+}
+
+// WithOnSubscribed sets a callback that is called with the subscribers change
+// feed position once subscribed, before any updates are delivered. If updates
+// are delivered synchronously (see WithSubscriberQueueLimit) the callback is
+// called while holding the registry mutex so must not block.
+func WithOnSubscribed(cb func(head FeedPosition, resumed bool)) Option {
+	return onSubscribedOption{cb: cb}
+}
+
+type namespaceOption struct {
+	namespace string
+}
+
+func (o namespaceOption) apply(opts *options) {
+	opts.namespace = o.namespace
+}
+
+// WithNamespace scopes a subscription or members lookup to the members in the
+// given namespace. If the namespace is empty or AllNamespaces, members in any
+// namespace are included.
+func WithNamespace(namespace string) Option {
+	return namespaceOption{namespace: namespace}
+}
+
+type feedLimitOption struct {
+	limit int
+}
+
+func (o feedLimitOption) apply(opts *options) {
+	opts.feedLimit = o.limit
+}
+
+// WithFeedLimit sets the maximum number of updates kept in the change feed
+// to resume subscriptions. Zero disables resuming subscriptions.
+func WithFeedLimit(limit int) Option {
+	return feedLimitOption{limit: limit}
+}
+
+type newRegistrationOption struct{}
+
+func (o newRegistrationOption) apply(opts *options) {
+	opts.newRegistration = true
+}
+
+// WithNewRegistration marks an added member as a new registration, such as
+// the first registration on a client stream. New registrations may use any
+// status, since the member may have restarted with the same ID before its
+// previous registration was removed.
+func WithNewRegistration() Option {
+	return newRegistrationOption{}
+}
+
 type collectorOption struct {
 	collector metrics.Collector
 }
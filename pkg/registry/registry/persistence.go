@@ -0,0 +1,144 @@
+package registry
+
+import (
+	"fmt"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"go.uber.org/zap"
+)
+
+// Recover loads the registry state persisted in the registry storage. This
+// must be called before the registry is used.
+//
+// Since the members owners may no longer be in the cluster (including this
+// node if it restarted with a new ID), each remote owner is treated as a left
+// node until it rejoins, so if it doesn't rejoin within the heartbeat timeout
+// we take ownership of its members. Members owned by this node are given the
+// heartbeat timeout to reconnect before they are marked down.
+func (r *Registry) Recover(opts ...Option) error {
+	options := r.options(opts)
+
+	if r.storage == nil {
+		return nil
+	}
+
+	members, err := r.storage.Load()
+	if err != nil {
+		return fmt.Errorf("registry: recover: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Detach the storage while recovering to avoid writing the recovered
+	// members back to the write-ahead log.
+	storage := r.storage
+	r.storage = nil
+	defer func() {
+		r.storage = storage
+	}()
+
+	recovered := 0
+	for _, m := range members {
+		// The local member is always owned by this process so is never
+		// recovered.
+		if m.State.Id == r.localID {
+			continue
+		}
+
+		if existing, ok := r.members[m.State.Id]; ok {
+			if compareVersions(existing.Version, m.Version) <= 0 {
+				continue
+			}
+		}
+
+		// Advance the clock past the recovered versions in case the wall
+		// clock went backwards while the node was down.
+		r.clock.Observe(m.Version.Timestamp)
+
+		r.setMemberLocked(m, options.now)
+		recovered++
+
+		// Members owned by this node are last seen now, so have the heartbeat
+		// timeout to reconnect.
+		owner := m.Version.OwnerId
+		if _, ok := r.leftNodes[owner]; !ok && owner != r.localID {
+			r.leftNodes[owner] = options.now
+		}
+	}
+
+	r.logger.Info(
+		"recovered registry",
+		zap.Int("members", recovered),
+		zap.Int("owners", len(r.leftNodes)),
+	)
+
+	return nil
+}
+
+// Snapshot compacts the registry storage by writing a snapshot of the current
+// registry state and discarding the write-ahead log.
+func (r *Registry) Snapshot() error {
+	if r.storage == nil {
+		return nil
+	}
+
+	// Rotate the WAL and copy the members while holding the lock so the
+	// snapshot contains every update written to the rotated WAL, then write
+	// the snapshot without blocking updates.
+	r.mu.Lock()
+	if err := r.storage.RotateWAL(); err != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("registry: snapshot: %w", err)
+	}
+	members := make([]*rpc.Member2, 0, len(r.members))
+	for _, m := range r.members {
+		members = append(members, copyMember(m))
+	}
+	r.mu.Unlock()
+
+	if err := r.storage.Snapshot(members); err != nil {
+		return fmt.Errorf("registry: snapshot: %w", err)
+	}
+	return nil
+}
+
+// StorageEntries returns the number of updates written to storage since the
+// last snapshot.
+func (r *Registry) StorageEntries() int {
+	if r.storage == nil {
+		return 0
+	}
+	return r.storage.WALEntries()
+}
+
+func (r *Registry) persistUpsertLocked(m *rpc.Member2) {
+	if r.storage == nil {
+		return
+	}
+
+	// If we fail to persist the update, the in-memory registry is still
+	// correct, though if the node restarts it may recover an out of date
+	// state, which will be repaired by replica repair.
+	if err := r.storage.Upsert(m); err != nil {
+		r.logger.Error(
+			"failed to persist member update",
+			zap.String("id", m.State.Id),
+			zap.Error(err),
+		)
+	}
+}
+
+func (r *Registry) persistDeleteLocked(id string) {
+	if r.storage == nil {
+		return
+	}
+
+	if err := r.storage.Delete(id); err != nil {
+		r.logger.Error(
+			"failed to persist member delete",
+			zap.String("id", id),
+			zap.Error(err),
+		)
+	}
+}
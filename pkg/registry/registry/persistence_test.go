@@ -0,0 +1,184 @@
+package registry
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/registry/storage"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// Tests a registry recovers the members persisted by a previous registry
+// using the same data directory.
+func TestPersistence_Recover(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := storage.Open(dir)
+	require.NoError(t, err)
+
+	reg := NewRegistry(
+		"local",
+		WithLocalMember(randomMember("local")),
+		WithStorage(s),
+		WithLogger(testutils.Logger()),
+	)
+	require.NoError(t, reg.Recover())
+
+	ownedMember := randomMember("owned-member")
+	reg.AddMember(ownedMember, WithNowTime(100))
+	remoteMember := &rpc.Member2{
+		State:    randomMember("remote-member"),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 200,
+			},
+		},
+	}
+	reg.RemoteUpdate(remoteMember)
+	require.NoError(t, reg.Snapshot())
+
+	removedMember := randomMember("removed-member")
+	reg.AddMember(removedMember, WithNowTime(300))
+	reg.RemoveMember("removed-member", WithNowTime(400))
+
+	require.NoError(t, s.Close())
+
+	s, err = storage.Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	localMember := randomMember("local")
+	reg = NewRegistry(
+		"local",
+		WithLocalMember(localMember),
+		WithStorage(s),
+		WithLogger(testutils.Logger()),
+	)
+	require.NoError(t, reg.Recover(WithNowTime(1000)))
+
+	// The local member is not recovered from storage.
+	m, ok := reg.MemberState("local")
+	assert.True(t, ok)
+	assert.True(t, proto.Equal(localMember, m))
+
+	m, ok = reg.MemberState("owned-member")
+	assert.True(t, ok)
+	assert.True(t, proto.Equal(ownedMember, m))
+
+	recovered, ok := reg.Member("remote-member")
+	assert.True(t, ok)
+	assert.True(t, proto.Equal(remoteMember, recovered))
+
+	recovered, ok = reg.Member("removed-member")
+	assert.True(t, ok)
+	assert.Equal(t, rpc.Liveness_LEFT, recovered.Liveness)
+}
+
+// Tests members owned by a node that has not rejoined the cluster since the
+// registry was recovered are taken over after the heartbeat timeout.
+func TestPersistence_RecoverTakesOwnershipFromMissingNodes(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := storage.Open(dir)
+	require.NoError(t, err)
+
+	reg := NewRegistry("local", WithStorage(s))
+	reg.RemoteUpdate(&rpc.Member2{
+		State:    randomMember("my-member"),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 100,
+			},
+		},
+	})
+	require.NoError(t, s.Close())
+
+	s, err = storage.Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	reg = NewRegistry(
+		"local",
+		WithStorage(s),
+		WithHeartbeatTimeout(500),
+		WithReconnectTimeout(5000),
+	)
+	require.NoError(t, reg.Recover(WithNowTime(1000)))
+
+	reg.UpdateLiveness(2000)
+
+	m, ok := reg.Member("my-member")
+	assert.True(t, ok)
+	assert.Equal(t, "local", m.Version.OwnerId)
+	assert.Equal(t, rpc.Liveness_DOWN, m.Liveness)
+}
+
+// Tests the expiry of down and left members is kept in the snapshot, so the
+// members still have their reconnect and tombstone timeouts once recovered.
+func TestPersistence_SnapshotKeepsExpiry(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := storage.Open(dir)
+	require.NoError(t, err)
+
+	reg := NewRegistry(
+		"local",
+		WithStorage(s),
+		WithHeartbeatTimeout(500),
+		WithReconnectTimeout(5000),
+		WithTombstoneTimeout(50000),
+		WithLogger(testutils.Logger()),
+	)
+	require.NoError(t, reg.Recover())
+
+	reg.AddMember(randomMember("down-member"), WithNowTime(100))
+	reg.UpdateLiveness(1000)
+	reg.AddMember(randomMember("left-member"), WithNowTime(1000))
+	reg.RemoveMember("left-member", WithNowTime(1000))
+
+	down, ok := reg.Member("down-member")
+	require.True(t, ok)
+	require.Equal(t, rpc.Liveness_DOWN, down.Liveness)
+	left, ok := reg.Member("left-member")
+	require.True(t, ok)
+	require.Equal(t, rpc.Liveness_LEFT, left.Liveness)
+
+	require.NoError(t, reg.Snapshot())
+	require.NoError(t, s.Close())
+
+	s, err = storage.Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	reg = NewRegistry(
+		"local",
+		WithStorage(s),
+		WithHeartbeatTimeout(500),
+		WithReconnectTimeout(5000),
+		WithTombstoneTimeout(50000),
+		WithLogger(testutils.Logger()),
+	)
+	require.NoError(t, reg.Recover(WithNowTime(2000)))
+
+	recovered, ok := reg.Member("down-member")
+	require.True(t, ok)
+	assert.Equal(t, down.Expiry, recovered.Expiry)
+	recovered, ok = reg.Member("left-member")
+	require.True(t, ok)
+	assert.Equal(t, left.Expiry, recovered.Expiry)
+
+	// The members are still within their timeouts so aren't expired.
+	reg.UpdateLiveness(2000)
+	recovered, ok = reg.Member("down-member")
+	require.True(t, ok)
+	assert.Equal(t, rpc.Liveness_DOWN, recovered.Liveness)
+	_, ok = reg.Member("left-member")
+	assert.True(t, ok)
+}
@@ -0,0 +1,448 @@
+package registry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
+// Query is a parsed member query expression, used to select members in
+// lookups and subscriptions.
+//
+// A query contains comparisons of member fields to values, combined with
+// 'and', 'or', 'not' and parentheses. Such as:
+//
+//	service = "clock" and locality.region = "eu-west-1" and metadata.version >= 3 and liveness = up
+//
+// The supported fields are 'id', 'namespace', 'status', 'service', 'revision',
+// 'started', 'owner', 'liveness', 'locality.region',
+// 'locality.availability_zone' and 'metadata.<key>'. The 'draining' field is
+// 'true' if the member is draining or terminating, so 'draining = false'
+// excludes members that shouldn't receive new traffic.
+//
+// The supported operators are '=', '!=', '<', '<=', '>' and '>='.
+//
+// Values may be quoted strings, numbers or unquoted words (such as 'up').
+// When the value is a number, the field is compared numerically, and the
+// comparison is false if the field isn't a number. Otherwise fields are
+// compared as strings, where liveness is compared case insensitive. A
+// comparison with a metadata key the member doesn't have is always false.
+type Query struct {
+	source string
+	expr   queryExpr
+}
+
+// ParseQuery parses the given query expression.
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse query: %w", err)
+	}
+
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("parse query: %w", err)
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("parse query: unexpected %s at offset %d", t, t.offset)
+	}
+
+	return &Query{
+		source: s,
+		expr:   expr,
+	}, nil
+}
+
+// Match returns whether the member matches the query. A nil query matches all
+// members.
+func (q *Query) Match(m *rpc.Member2) bool {
+	if q == nil {
+		return true
+	}
+	return q.expr.eval(m)
+}
+
+// String returns the query source.
+func (q *Query) String() string {
+	return q.source
+}
+
+type queryExpr interface {
+	eval(m *rpc.Member2) bool
+}
+
+type andExpr struct {
+	lhs queryExpr
+	rhs queryExpr
+}
+
+func (e *andExpr) eval(m *rpc.Member2) bool {
+	return e.lhs.eval(m) && e.rhs.eval(m)
+}
+
+type orExpr struct {
+	lhs queryExpr
+	rhs queryExpr
+}
+
+func (e *orExpr) eval(m *rpc.Member2) bool {
+	return e.lhs.eval(m) || e.rhs.eval(m)
+}
+
+type notExpr struct {
+	expr queryExpr
+}
+
+func (e *notExpr) eval(m *rpc.Member2) bool {
+	return !e.expr.eval(m)
+}
+
+type compareExpr struct {
+	field string
+	op    string
+	value string
+	// number is set if the value is numeric, in which case the field is
+	// compared numerically.
+	number   bool
+	numValue float64
+}
+
+func (e *compareExpr) eval(m *rpc.Member2) bool {
+	fieldValue, ok := queryFieldValue(m, e.field)
+	if !ok {
+		return false
+	}
+
+	if e.number {
+		n, err := strconv.ParseFloat(fieldValue, 64)
+		if err != nil {
+			return false
+		}
+		return compareOp(e.op, compareFloats(n, e.numValue))
+	}
+
+	value := e.value
+	if e.field == "liveness" {
+		fieldValue = strings.ToLower(fieldValue)
+		value = strings.ToLower(value)
+	}
+	return compareOp(e.op, strings.Compare(fieldValue, value))
+}
+
+// queryFieldValue returns the value of the given field, or false if the
+// member doesn't have the field.
+func queryFieldValue(m *rpc.Member2, field string) (string, bool) {
+	if strings.HasPrefix(field, "metadata.") {
+		v, ok := m.State.Metadata[strings.TrimPrefix(field, "metadata.")]
+		return v, ok
+	}
+
+	switch field {
+	case "id":
+		return m.State.Id, true
+	case "namespace":
+		return MemberNamespace(m.State), true
+	case "status":
+		return m.State.Status, true
+	case "draining":
+		return strconv.FormatBool(isDrainingStatus(m.State.Status)), true
+	case "service":
+		return m.State.Service, true
+	case "revision":
+		return m.State.Revision, true
+	case "started":
+		return strconv.FormatInt(m.State.Started, 10), true
+	case "owner":
+		if m.Version == nil {
+			return "", false
+		}
+		return m.Version.OwnerId, true
+	case "liveness":
+		return m.Liveness.String(), true
+	case "locality.region":
+		if m.State.Locality == nil {
+			return "", true
+		}
+		return m.State.Locality.Region, true
+	case "locality.availability_zone":
+		if m.State.Locality == nil {
+			return "", true
+		}
+		return m.State.Locality.AvailabilityZone, true
+	default:
+		return "", false
+	}
+}
+
+func isQueryField(field string) bool {
+	if strings.HasPrefix(field, "metadata.") {
+		return len(field) > len("metadata.")
+	}
+	switch field {
+	case "id", "namespace", "status", "draining", "service", "revision", "started", "owner",
+		"liveness", "locality.region", "locality.availability_zone":
+		return true
+	default:
+		return false
+	}
+}
+
+func compareFloats(lhs float64, rhs float64) int {
+	if lhs < rhs {
+		return -1
+	}
+	if lhs > rhs {
+		return 1
+	}
+	return 0
+}
+
+// compareOp returns whether the comparison result c satisfies the operator.
+func compareOp(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind   tokenKind
+	value  string
+	offset int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.value)
+	default:
+		return "'" + t.value + "'"
+	}
+}
+
+func lexQuery(s string) ([]token, error) {
+	var tokens []token
+	runes := []rune(s)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", offset: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", offset: i})
+			i++
+		case r == '=':
+			tokens = append(tokens, token{kind: tokenOp, value: "=", offset: i})
+			i++
+		case r == '!' || r == '<' || r == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, token{kind: tokenOp, value: string(r) + "=", offset: i})
+				i += 2
+			} else if r == '!' {
+				return nil, fmt.Errorf("unexpected '!' at offset %d", i)
+			} else {
+				tokens = append(tokens, token{kind: tokenOp, value: string(r), offset: i})
+				i++
+			}
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, value: sb.String(), offset: start})
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			value := string(runes[start:i])
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", value, start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: value, offset: start})
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && (isWordRune(runes[i]) || runes[i] == '.' || runes[i] == '-' || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: string(runes[start:i]), offset: start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", r, i)
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, offset: len(runes)})
+	return tokens, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+// queryParser is a recursive descent parser for the query grammar:
+//
+//	or         = and { "or" and }
+//	and        = not { "and" not }
+//	not        = "not" not | primary
+//	primary    = "(" or ")" | comparison
+//	comparison = field op value
+type queryParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && strings.EqualFold(t.value, keyword)
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	lhs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.next()
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &orExpr{lhs: lhs, rhs: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	lhs, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.next()
+		rhs, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &andExpr{lhs: lhs, rhs: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *queryParser) parseNot() (queryExpr, error) {
+	if p.peekKeyword("not") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryExpr, error) {
+	if p.peek().kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ')' at offset %d, got %s", t.offset, t)
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryExpr, error) {
+	field := p.next()
+	if field.kind != tokenWord {
+		return nil, fmt.Errorf("expected field at offset %d, got %s", field.offset, field)
+	}
+	if !isQueryField(field.value) {
+		return nil, fmt.Errorf("unknown field '%s' at offset %d", field.value, field.offset)
+	}
+
+	op := p.next()
+	if op.kind != tokenOp {
+		return nil, fmt.Errorf("expected operator at offset %d, got %s", op.offset, op)
+	}
+
+	value := p.next()
+	switch value.kind {
+	case tokenString, tokenWord:
+		return &compareExpr{
+			field: field.value,
+			op:    op.value,
+			value: value.value,
+		}, nil
+	case tokenNumber:
+		n, _ := strconv.ParseFloat(value.value, 64)
+		return &compareExpr{
+			field:    field.value,
+			op:       op.value,
+			value:    value.value,
+			number:   true,
+			numValue: n,
+		}, nil
+	default:
+		return nil, fmt.Errorf("expected value at offset %d, got %s", value.offset, value)
+	}
+}
@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_Match(t *testing.T) {
+	member := &rpc.Member2{
+		State: &rpc.MemberState{
+			Id:      "clock-1",
+			Status:  "active",
+			Service: "clock",
+			Locality: &rpc.Locality{
+				Region:           "eu-west-1",
+				AvailabilityZone: "eu-west-1a",
+			},
+			Started:  1000,
+			Revision: "v1",
+			Metadata: map[string]string{
+				"version":  "3",
+				"rpc-addr": "10.0.0.1:8000",
+			},
+		},
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "node-1",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 100,
+			},
+		},
+	}
+
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{`service = "clock"`, true},
+		{`service = 'clock'`, true},
+		{`service = clock`, true},
+		{`service != "clock"`, false},
+		{`service = "foo"`, false},
+		{`locality.region = "eu-west-1"`, true},
+		{`locality.availability_zone = "eu-west-1b"`, false},
+		{`metadata.version >= 3`, true},
+		{`metadata.version > 3`, false},
+		{`metadata.version < 10`, true},
+		{`metadata.rpc-addr = "10.0.0.1:8000"`, true},
+		{`metadata.missing = "foo"`, false},
+		{`metadata.missing != "foo"`, false},
+		{`metadata.rpc-addr > 1`, false},
+		{`liveness = up`, true},
+		{`liveness = UP`, true},
+		{`liveness = down`, false},
+		{`owner = "node-1"`, true},
+		{`started >= 1000`, true},
+		{`started > -5`, true},
+		{`id = "clock-1" and status = "active" and revision = "v1"`, true},
+		{`service = "clock" and locality.region = "eu-west-1" and metadata.version >= 3 and liveness = up`, true},
+		{`service = "foo" or service = "clock"`, true},
+		{`service = "foo" or service = "bar"`, false},
+		{`not service = "foo"`, true},
+		{`NOT (service = "clock" AND liveness = up)`, false},
+		{`service = "foo" and service = "bar" or service = "clock"`, true},
+		{`service = "foo" and (service = "bar" or service = "clock")`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.match, q.Match(member))
+		})
+	}
+}
+
+func TestQuery_ParseErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`service`,
+		`service =`,
+		`service = "clock`,
+		`foo = "bar"`,
+		`metadata. = "bar"`,
+		`service == "clock"`,
+		`service = "clock" and`,
+		`(service = "clock"`,
+		`service = "clock")`,
+		`service ! "clock"`,
+		`service = "clock" liveness = up`,
+	}
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			_, err := ParseQuery(query)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestQuery_NilMatchesAll(t *testing.T) {
+	var q *Query
+	assert.True(t, q.Match(remoteMember("foo", 100)))
+}
+
+func TestRegistry_MembersWithQuery(t *testing.T) {
+	reg := NewRegistry("local")
+
+	clock := remoteMember("clock-1", 100)
+	clock.State.Service = "clock"
+	reg.RemoteUpdate(clock)
+
+	other := remoteMember("other-1", 100)
+	other.State.Service = "other"
+	reg.RemoteUpdate(other)
+
+	q, err := ParseQuery(`service = "clock"`)
+	require.NoError(t, err)
+
+	members := reg.Members(WithQuery(q))
+	assert.Equal(t, 1, len(members))
+	assert.Equal(t, "clock-1", members[0].State.Id)
+
+	assert.Equal(t, 2, len(reg.Members()))
+}
+
+func TestFilter_Query(t *testing.T) {
+	q, err := ParseQuery(`metadata.version >= 2`)
+	require.NoError(t, err)
+
+	f := &Filter{
+		Service: []string{"clock"},
+		Query:   q,
+	}
+
+	b, err := f.Encode()
+	require.NoError(t, err)
+	parsed, err := ParseFilter(b)
+	require.NoError(t, err)
+	assert.Equal(t, q.String(), parsed.Query.String())
+
+	m := remoteMember("clock-1", 100)
+	m.State.Service = "clock"
+	m.State.Metadata = map[string]string{"version": "2"}
+	assert.True(t, parsed.Match(m))
+
+	m.State.Metadata = map[string]string{"version": "1"}
+	assert.False(t, parsed.Match(m))
+}
@@ -1,17 +1,20 @@
 package registry
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"sync"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
+	"github.com/fuddle-io/fuddle/pkg/registry/storage"
 	"go.uber.org/zap"
 )
 
-type subHandle struct {
-	onUpdate  func(update *rpc.Member2)
-	ownerOnly bool
-}
+// ErrReadOnly is returned when attempting to register a member with a
+// read-only registry.
+var ErrReadOnly = errors.New("registry is read-only")
 
 type Registry struct {
 	// localID is the node ID of this local node.
@@ -36,15 +39,27 @@ type Registry struct {
 	// subs contains a set of subscriptions.
 	subs map[*subHandle]interface{}
 
-	// lastVersion is the last version used by this node. This is used to
-	// increment the version counter when there are multiple versions in the
-	// same millisecond.
-	lastVersion *rpc.Version2
+	// clock is the hybrid logical clock used to version updates to members
+	// owned by this node. It advances past any timestamp received from other
+	// nodes so local updates are always ordered after updates we've seen.
+	clock hybridClock
 
 	// leftNodes contains a map of nodes that still own members in the registry
 	// but are not part of the registry.
 	leftNodes map[string]int64
 
+	// indexes contains secondary indexes on the members, to avoid scanning
+	// every member on lookups.
+	indexes *memberIndexes
+
+	// feed is a bounded log of the updates applied to the registry, used to
+	// resume subscriptions.
+	feed *changeFeed
+
+	// tree is a Merkle tree summarising the member versions, used by replica
+	// repair to find members that differ between nodes.
+	tree *merkleTree
+
 	// priorityMembers contains the member IDs that are known to be out of date
 	// so must be included as a priority in the next digest.
 	priorityMembers map[string]interface{}
@@ -56,6 +71,23 @@ type Registry struct {
 	reconnectTimeout int64
 	tombstoneTimeout int64
 
+	// maxClockDrift is the maximum time in milliseconds a remote timestamp
+	// may be ahead of the local clock before clockDriftPolicy is applied.
+	// Zero disables the check.
+	maxClockDrift    int64
+	clockDriftPolicy ClockDriftPolicy
+
+	// storage persists member updates so the registry can be recovered after
+	// a restart. May be nil if persistence is disabled.
+	storage *storage.Storage
+
+	// readOnly indicates the registry never owns members, other than the
+	// local member.
+	readOnly bool
+
+	// wallClock is used to read the time 'now' when not given by WithNowTime.
+	wallClock clock.Clock
+
 	logger  *zap.Logger
 	metrics *Metrics
 }
@@ -65,6 +97,9 @@ func NewRegistry(localID string, opts ...Option) *Registry {
 	for _, o := range opts {
 		o.apply(options)
 	}
+	if !options.nowSet {
+		options.now = options.clock.Now().UnixMilli()
+	}
 
 	metrics := NewMetrics()
 	if options.collector != nil {
@@ -77,10 +112,18 @@ func NewRegistry(localID string, opts ...Option) *Registry {
 		lastSeen:         make(map[string]int64),
 		subs:             make(map[*subHandle]interface{}),
 		leftNodes:        make(map[string]int64),
+		indexes:          newMemberIndexes(),
+		feed:             newChangeFeed(options.feedLimit),
+		tree:             newMerkleTree(),
 		priorityMembers:  make(map[string]interface{}),
 		heartbeatTimeout: options.heartbeatTimeout,
 		reconnectTimeout: options.reconnectTimeout,
 		tombstoneTimeout: options.tombstoneTimeout,
+		maxClockDrift:    options.maxClockDrift,
+		clockDriftPolicy: options.clockDriftPolicy,
+		storage:          options.storage,
+		readOnly:         options.readOnly,
+		wallClock:        options.clock,
 		metrics:          metrics,
 		logger:           options.logger,
 	}
@@ -91,7 +134,7 @@ func NewRegistry(localID string, opts ...Option) *Registry {
 			Liveness: rpc.Liveness_UP,
 			Version:  reg.nextVersionLocked(options.now),
 		}
-		reg.setMemberLocked(member)
+		reg.setMemberLocked(member, options.now)
 
 		reg.logger.Info(
 			"added local member",
@@ -102,6 +145,19 @@ func NewRegistry(localID string, opts ...Option) *Registry {
 	return reg
 }
 
+// options returns the options for a registry operation, where the time 'now'
+// defaults to the registry clock.
+func (r *Registry) options(opts []Option) *options {
+	options := defaultOptions()
+	for _, o := range opts {
+		o.apply(options)
+	}
+	if !options.nowSet {
+		options.now = r.wallClock.Now().UnixMilli()
+	}
+	return options
+}
+
 func (r *Registry) LocalID() string {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -143,13 +199,31 @@ func (r *Registry) Member(id string) (*rpc.Member2, bool) {
 	return m, ok
 }
 
-func (r *Registry) Members() []*rpc.Member2 {
+// Members returns the members in the registry. If a query is given using
+// WithQuery, only members matching the query are returned. If a namespace is
+// given using WithNamespace, only members in that namespace are returned.
+func (r *Registry) Members(opts ...Option) []*rpc.Member2 {
+	options := r.options(opts)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if scopedNamespace(options.namespace) {
+		var members []*rpc.Member2
+		for id := range r.indexes.namespace[options.namespace] {
+			m := r.members[id]
+			if options.query.Match(m) {
+				members = append(members, m)
+			}
+		}
+		return members
+	}
+
 	members := make([]*rpc.Member2, 0, len(r.members))
 	for _, m := range r.members {
-		members = append(members, m)
+		if options.query.Match(m) {
+			members = append(members, m)
+		}
 	}
 	return members
 }
@@ -158,54 +232,97 @@ func (r *Registry) OwnedMembers() []*rpc.Member2 {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	members := make([]*rpc.Member2, 0, len(r.members))
-	for _, m := range r.members {
-		if m.Version.OwnerId == r.localID {
-			members = append(members, m)
-		}
-	}
-	return members
+	return r.indexedMembersLocked(r.indexes.owner[r.localID])
 }
 
 func (r *Registry) UpMembers() []*rpc.Member2 {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	members := make([]*rpc.Member2, 0, len(r.members))
-	for _, m := range r.members {
-		if m.Liveness == rpc.Liveness_UP {
-			members = append(members, m)
-		}
-	}
-	return members
+	return r.indexedMembersLocked(r.indexes.liveness[rpc.Liveness_UP.String()])
 }
 
 func (r *Registry) Metrics() *Metrics {
 	return r.metrics
 }
 
+// SubscribeLocal subscribes to updates to members owned by this node.
+//
+// Updates are delivered synchronously while holding the registry mutex, so
+// onUpdate must not block.
 func (r *Registry) SubscribeLocal(onUpdate func(update *rpc.Member2)) func() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	handle := &subHandle{
-		onUpdate:  onUpdate,
-		ownerOnly: true,
-	}
+	handle := newSubHandle(func(update *rpc.Member2, _ uint64) {
+		onUpdate(update)
+	}, true, defaultOptions())
 	r.subs[handle] = struct{}{}
 
 	return func() {
 		r.mu.Lock()
-		defer r.mu.Unlock()
+		r.unsubscribeLocked(handle)
+		r.mu.Unlock()
 
-		delete(r.subs, handle)
+		// Wait for the delivery goroutine to exit without holding the mutex,
+		// since it may be waiting for the mutex to resync.
+		if handle.stopped != nil {
+			<-handle.stopped
+		}
 	}
 }
 
 // Subscribe to member updates.
+//
+// If a filter is given with WithFilter, the subscriber only receives updates
+// to members matching the filter. When a member moves out of the filter the
+// subscriber receives an update with liveness left so it can remove the
+// member.
+//
+// By default updates are delivered synchronously while holding the registry
+// mutex, so onUpdate must not block. If a queue limit is given with
+// WithSubscriberQueueLimit, updates are instead queued and delivered by a
+// separate goroutine, so onUpdate may block. If the queue is full, the
+// subscriber is handled using the overflow policy given with
+// WithOverflowPolicy.
+//
+// The returned unsubscribe function waits for any update being delivered, so
+// onUpdate is never called once it returns. It must not be called from
+// onUpdate.
 func (r *Registry) Subscribe(req *rpc.SubscribeRequest, onUpdate func(update *rpc.Member2), opts ...Option) func() {
+	return r.SubscribeFeed(req, nil, func(update *rpc.Member2, _ uint64) {
+		onUpdate(update)
+	}, opts...)
+}
+
+// SubscribeFeed subscribes to member updates the same as Subscribe, except
+// each update is delivered with its sequence number in the registry change
+// feed (see changeFeed).
+//
+// If since is given and the registry change feed still contains the updates
+// after that position, the subscriber is only sent the updates it missed from
+// the feed. Otherwise the subscriber falls back to being sent the updates
+// it's missing given the known members in the request.
+//
+// If WithOnSubscribed is given, the callback is called with the feed
+// position the subscriber will have reached once it receives the initial
+// updates, and whether the subscriber resumed from the feed, before any
+// updates are delivered.
+//
+// If a namespace is given using WithNamespace, the subscriber only receives
+// updates to members in that namespace.
+//
+// Only updates from the feed have a sequence number. When falling back to a
+// diff of the known members, or when a subscriber is resynced, only the last
+// update has a sequence number (the feed head), otherwise the sequence number
+// is 0.
+func (r *Registry) SubscribeFeed(req *rpc.SubscribeRequest, since *FeedPosition, onUpdate func(update *rpc.Member2, seq uint64), opts ...Option) func() {
+	options := r.options(opts)
+	if scopedNamespace(options.namespace) {
+		options.filter = options.filter.withNamespace(options.namespace)
+	}
+
 	r.mu.Lock()
-	defer r.mu.Unlock()
 
 	if req == nil {
 		req = &rpc.SubscribeRequest{
@@ -213,29 +330,82 @@ func (r *Registry) Subscribe(req *rpc.SubscribeRequest, onUpdate func(update *rp
 		}
 	}
 
-	handle := &subHandle{
-		onUpdate:  onUpdate,
-		ownerOnly: req.OwnerOnly,
-	}
+	handle := newSubHandle(onUpdate, req.OwnerOnly, options)
 	r.subs[handle] = struct{}{}
 
-	for _, update := range r.updatesLocked(req) {
-		onUpdate(update)
+	updates, resumed := r.feedUpdatesLocked(handle, since)
+	if resumed {
+		r.metrics.FeedSubscriptions.Inc(map[string]string{
+			"result": "resumed",
+		})
+	} else {
+		if since != nil {
+			r.metrics.FeedSubscriptions.Inc(map[string]string{
+				"result": "fallback",
+			})
+		}
+		updates = r.withHeadSequenceLocked(r.updatesLocked(req, options.filter))
+	}
+
+	head := r.feed.Head()
+
+	if handle.queue == nil {
+		if options.onSubscribed != nil {
+			options.onSubscribed(head, resumed)
+		}
+		for _, update := range updates {
+			onUpdate(update.member, update.seq)
+		}
+		r.mu.Unlock()
+	} else {
+		if handle.known != nil {
+			for id := range req.KnownMembers {
+				handle.known[id] = struct{}{}
+			}
+			for _, update := range updates {
+				handle.trackLocked(update.member)
+			}
+		}
+		r.mu.Unlock()
+
+		// Since updates are queued until delivery starts, onSubscribed is
+		// called without holding the mutex, as it may block, such as when
+		// sending stream headers to a slow client.
+		if options.onSubscribed != nil {
+			options.onSubscribed(head, resumed)
+		}
+		go r.deliver(handle, updates)
 	}
 
 	return func() {
 		r.mu.Lock()
-		defer r.mu.Unlock()
+		r.unsubscribeLocked(handle)
+		r.mu.Unlock()
 
-		delete(r.subs, handle)
+		// Wait for the delivery goroutine to exit without holding the mutex,
+		// since it may be waiting for the mutex to resync.
+		if handle.stopped != nil {
+			<-handle.stopped
+		}
 	}
 }
 
-func (r *Registry) Updates(req *rpc.SubscribeRequest) []*rpc.Member2 {
+// FeedHead returns the position of the last update in the registry change
+// feed.
+func (r *Registry) FeedHead() FeedPosition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.feed.Head()
+}
+
+func (r *Registry) Updates(req *rpc.SubscribeRequest, opts ...Option) []*rpc.Member2 {
+	options := r.options(opts)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	return r.updatesLocked(req)
+	return r.updatesLocked(req, options.filter)
 }
 
 func (r *Registry) OnNodeJoin(id string) {
@@ -248,10 +418,7 @@ func (r *Registry) OnNodeJoin(id string) {
 }
 
 func (r *Registry) OnNodeLeave(id string, opts ...Option) {
-	options := defaultOptions()
-	for _, o := range opts {
-		o.apply(options)
-	}
+	options := r.options(opts)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -279,11 +446,45 @@ func (r *Registry) OnNodeLeave(id string, opts ...Option) {
 //
 // The member is re-added whenever we receive a heartbeat for the member, which
 // will update the members status to UP if it was down.
-func (r *Registry) AddMember(member *rpc.MemberState, opts ...Option) {
+//
+// If the member is already registered and UP, its status must follow the
+// member lifecycle (see StatusStarting), otherwise an error wrapping
+// ErrInvalidTransition is returned and the member isn't updated. The
+// lifecycle isn't checked for new registrations (see WithNewRegistration).
+func (r *Registry) AddMember(member *rpc.MemberState, opts ...Option) error {
+	options := r.options(opts)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.readOnly {
+		return fmt.Errorf("add member: %w", ErrReadOnly)
+	}
+	if existing, ok := r.members[member.Id]; ok && IsFederated(existing.State) {
+		return fmt.Errorf("add member: %w", ErrFederatedMember)
+	}
+
+	// Members that are down or have left are treated as new, such as if the
+	// member restarted with the same ID.
+	from := ""
+	if existing, ok := r.members[member.Id]; ok && existing.Liveness == rpc.Liveness_UP && !options.newRegistration {
+		from = existing.State.Status
+	}
+	if err := ValidateTransition(from, member.Status); err != nil {
+		r.metrics.LifecycleTransitionsRejected.Inc(map[string]string{
+			"from": from,
+			"to":   lifecycleLabel(member.Status),
+		})
+		r.logger.Warn(
+			"add member; invalid lifecycle transition",
+			zap.Object("member", newMemberStateLogger(member)),
+			zap.Error(err),
+		)
+		return fmt.Errorf("add member: %w", err)
+	}
+
 	r.updateMemberLocked(member, rpc.Liveness_UP, 0, opts...)
+	return nil
 }
 
 // MemberHeartbeat updates the last seen timestamp for the member.
@@ -292,10 +493,7 @@ func (r *Registry) AddMember(member *rpc.MemberState, opts ...Option) {
 // so another node took ownership, but the client is still connected to this
 // node), then update the member version and status to take back ownership.
 func (r *Registry) MemberHeartbeat(member *rpc.MemberState, opts ...Option) {
-	options := defaultOptions()
-	for _, o := range opts {
-		o.apply(options)
-	}
+	options := r.options(opts)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -318,10 +516,7 @@ func (r *Registry) MemberHeartbeat(member *rpc.MemberState, opts ...Option) {
 // used as a tombstone to ensure the update is propagated before nodes actually
 // remove the node.
 func (r *Registry) RemoveMember(id string, opts ...Option) {
-	options := defaultOptions()
-	for _, o := range opts {
-		o.apply(options)
-	}
+	options := r.options(opts)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -341,10 +536,20 @@ func (r *Registry) RemoveMember(id string, opts ...Option) {
 }
 
 // RemoteUpdate applies an updates received from another node.
-func (r *Registry) RemoteUpdate(update *rpc.Member2) {
+//
+// The local clock is advanced past the update version, unless the version is
+// ahead of the local clock by more than the max clock drift and the drift
+// policy is to reject, in which case the update is discarded.
+func (r *Registry) RemoteUpdate(update *rpc.Member2, opts ...Option) {
+	options := r.options(opts)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.remoteUpdateLocked(update, options)
+}
+
+func (r *Registry) remoteUpdateLocked(update *rpc.Member2, options *options) {
 	if update.State.Id == r.localID {
 		r.logger.Error(
 			"remote update: discarding update; attempted to update local member",
@@ -361,6 +566,17 @@ func (r *Registry) RemoteUpdate(update *rpc.Member2) {
 		return
 	}
 
+	if !r.observeLocked(
+		update.Version.Timestamp, options.now, zap.String("owner", update.Version.OwnerId),
+	) {
+		r.logger.Error(
+			"discarding remote member update; clock drift exceeded",
+			zap.Object("update", newMemberLogger(update)),
+			zap.Object("update-version", newVersionLogger(update.Version)),
+		)
+		return
+	}
+
 	ownershipChange := false
 
 	existing, ok := r.members[update.State.Id]
@@ -380,23 +596,33 @@ func (r *Registry) RemoteUpdate(update *rpc.Member2) {
 		}
 	}
 
-	r.setMemberLocked(update)
+	r.setMemberLocked(update, options.now)
+
+	// Record the time the update took to reach this node. Since versions
+	// are generated by a hybrid logical clock the timestamp may be ahead of
+	// the local time if clocks are skewed, in which case the lag is zero.
+	lag := options.now - update.Version.Timestamp.Timestamp
+	if lag < 0 {
+		lag = 0
+	}
+	r.metrics.ReplicationLag.Observe(float64(lag)/1000, map[string]string{
+		"owner": update.Version.OwnerId,
+	})
 
 	r.logger.Info(
 		"updated member; remote",
 		zap.Object("update", newMemberLogger(update)),
 	)
 
-	r.notifySubscribersLocked(update, ownershipChange)
+	r.notifySubscribersLocked(update, existing, ownershipChange)
 }
 
 func (r *Registry) updateMemberLocked(member *rpc.MemberState, liveness rpc.Liveness, expiry int64, opts ...Option) {
-	// TODO copy state
+	// Copy the state so the caller can't modify the registry state after the
+	// update.
+	member = copyMemberState(member)
 
-	options := defaultOptions()
-	for _, o := range opts {
-		o.apply(options)
-	}
+	options := r.options(opts)
 
 	// Don't allow updating the local member.
 	if member.Id == r.localID {
@@ -407,26 +633,32 @@ func (r *Registry) updateMemberLocked(member *rpc.MemberState, liveness rpc.Live
 		return
 	}
 
-	version := r.nextVersionLocked(options.now)
+	// A read-only registry never takes ownership of members.
+	if r.readOnly {
+		r.logger.Error(
+			"attempted to update member in read-only registry",
+			zap.Object("member", newMemberStateLogger(member)),
+		)
+		return
+	}
 
-	// If the version is out of date we must ignore the update. This should
-	// never happen as it means there is clock skew between nodes or a non-
-	// monotonic clock.
-	//
-	// If it does happen, the owner will get regular heartbeats where it keeps
-	// re-adding the member, so will eventually win ownership.
+	// Federated members are only updated by their origin cluster.
 	existing, exists := r.members[member.Id]
+	if exists && IsFederated(existing.State) {
+		r.logger.Error(
+			"attempted to update federated member",
+			zap.Object("member", newMemberStateLogger(member)),
+		)
+		return
+	}
+
+	// Advance the clock past the existing version so the update always
+	// supersedes it, even if the existing version was created by a node whose
+	// clock is ahead of ours, or our own wall clock has gone backwards.
 	if exists {
-		if compareVersions(existing.Version, version) <= 0 {
-			r.logger.Error(
-				"discarding local member update; outdated version",
-				zap.Object("member", newMemberStateLogger(member)),
-				zap.Object("update-version", newVersionLogger(version)),
-				zap.Object("existing-version", newVersionLogger(existing.Version)),
-			)
-			return
-		}
+		r.clock.Observe(existing.Version.Timestamp)
 	}
+	version := r.nextVersionLocked(options.now)
 
 	versionedMember := &rpc.Member2{
 		State:    member,
@@ -434,7 +666,7 @@ func (r *Registry) updateMemberLocked(member *rpc.MemberState, liveness rpc.Live
 		Version:  version,
 		Expiry:   expiry,
 	}
-	r.setMemberLocked(versionedMember)
+	r.setMemberLocked(versionedMember, options.now)
 
 	r.logger.Info(
 		"updated member; owner",
@@ -442,82 +674,171 @@ func (r *Registry) updateMemberLocked(member *rpc.MemberState, liveness rpc.Live
 		zap.Object("member", newMemberLogger(versionedMember)),
 	)
 
-	r.notifySubscribersLocked(versionedMember, true)
+	r.notifySubscribersLocked(versionedMember, existing, true)
 }
 
-func (r *Registry) notifySubscribersLocked(update *rpc.Member2, owner bool) {
+// notifySubscribersLocked notifies subscribers about the update, where
+// previous is the members state before the update, or nil if the member is
+// new.
+//
+// The update is also added to the change feed.
+func (r *Registry) notifySubscribersLocked(update *rpc.Member2, previous *rpc.Member2, owner bool) {
+	seq := r.feed.Append(update, previous, owner)
+
 	for s := range r.subs {
-		if s.ownerOnly && owner {
-			s.onUpdate(update)
-		} else if !s.ownerOnly {
-			s.onUpdate(update)
+		if u, ok := subscriberUpdate(s, update, previous, owner); ok {
+			r.notifySubscriberLocked(s, sequencedUpdate{member: u, seq: seq})
 		}
 	}
 }
 
-func (r *Registry) nextVersionLocked(now int64) *rpc.Version2 {
-	v := &rpc.Version2{
-		OwnerId: r.localID,
-		Timestamp: &rpc.MonotonicTimestamp{
-			Timestamp: now,
-			Counter:   0,
-		},
+// feedUpdatesLocked returns the updates from the change feed the subscriber
+// missed since the given position, or false if the position can't be resumed.
+func (r *Registry) feedUpdatesLocked(h *subHandle, since *FeedPosition) ([]sequencedUpdate, bool) {
+	if since == nil {
+		return nil, false
+	}
+	entries, ok := r.feed.Since(*since)
+	if !ok {
+		return nil, false
 	}
-	// If the version has the same count as the previous version, increment
-	// the counter.
-	if r.lastVersion != nil && r.lastVersion.Timestamp.Timestamp == v.Timestamp.Timestamp {
-		v.Timestamp.Counter = r.lastVersion.Timestamp.Counter + 1
+
+	var updates []sequencedUpdate
+	for _, e := range entries {
+		if u, ok := subscriberUpdate(h, e.update, e.previous, e.owner); ok {
+			updates = append(updates, sequencedUpdate{member: u, seq: e.seq})
+		}
 	}
-	r.lastVersion = v
-	return v
+	return updates, true
 }
 
-func (r *Registry) membersForOwnerLocked(id string) int {
-	count := 0
-	for _, m := range r.members {
-		if m.Version.OwnerId == id {
-			count++
+func (r *Registry) nextVersionLocked(now int64) *rpc.Version2 {
+	return &rpc.Version2{
+		OwnerId:   r.localID,
+		Timestamp: r.clock.Now(now),
+	}
+}
+
+// observeLocked advances the local clock past the given timestamp received
+// from another node.
+//
+// If the timestamp is ahead of the local time by more than the max clock
+// drift, the drift is logged and recorded, and if the drift policy is to
+// reject, the clock isn't advanced and false is returned.
+func (r *Registry) observeLocked(ts *rpc.MonotonicTimestamp, now int64, source zap.Field) bool {
+	if r.maxClockDrift > 0 && ts.Timestamp-now > r.maxClockDrift {
+		r.logger.Warn(
+			"remote timestamp exceeds max clock drift",
+			source,
+			zap.Int64("timestamp", ts.Timestamp),
+			zap.Int64("now", now),
+			zap.Int64("drift", ts.Timestamp-now),
+			zap.String("policy", r.clockDriftPolicy.String()),
+		)
+		r.metrics.ClockDriftExceeded.Inc(map[string]string{
+			"policy": r.clockDriftPolicy.String(),
+		})
+
+		if r.clockDriftPolicy == ClockDriftPolicyReject {
+			return false
 		}
 	}
-	return count
+
+	r.clock.Observe(ts)
+	return true
+}
+
+func (r *Registry) membersForOwnerLocked(id string) int {
+	return len(r.indexes.owner[id])
 }
 
-func (r *Registry) updatesLocked(req *rpc.SubscribeRequest) []*rpc.Member2 {
+func (r *Registry) updatesLocked(req *rpc.SubscribeRequest, filter *Filter) []*rpc.Member2 {
 	if req.KnownMembers == nil {
 		req.KnownMembers = make(map[string]*rpc.Version2)
 	}
 
+	var updates []*rpc.Member2
 	if req.OwnerOnly {
-		return r.ownerOnlyUpdatesLocked(req.KnownMembers)
+		updates = r.ownerOnlyUpdatesLocked(req.KnownMembers)
+	} else if candidates, ok := r.filterCandidatesLocked(filter); ok {
+		updates = r.candidateUpdatesLocked(req.KnownMembers, candidates)
+	} else {
+		updates = r.allUpdatesLocked(req.KnownMembers)
+	}
+
+	if filter == nil {
+		return updates
 	}
-	return r.allUpdatesLocked(req.KnownMembers)
+	return r.filterUpdatesLocked(updates, req.KnownMembers, filter)
+}
+
+// filterUpdatesLocked filters the updates to those matching the filter. Any
+// members the subscriber knows about that don't match the filter are sent with
+// liveness left so the subscriber removes them.
+func (r *Registry) filterUpdatesLocked(updates []*rpc.Member2, knownMembers map[string]*rpc.Version2, filter *Filter) []*rpc.Member2 {
+	var filtered []*rpc.Member2
+	updated := make(map[string]interface{})
+	for _, u := range updates {
+		updated[u.State.Id] = struct{}{}
+
+		// Members that are no longer in the registry are always sent as the
+		// subscriber already knows about the member.
+		if _, ok := r.members[u.State.Id]; !ok {
+			filtered = append(filtered, u)
+			continue
+		}
+
+		if filter.Match(u) {
+			filtered = append(filtered, u)
+		} else if _, ok := knownMembers[u.State.Id]; ok {
+			filtered = append(filtered, filteredOutUpdate(u))
+		}
+	}
+
+	// The subscriber may already have the latest version of members that
+	// don't match the filter, such as if the subscriber changed its filter,
+	// so remove those members.
+	for id, knownVersion := range knownMembers {
+		if _, ok := updated[id]; ok {
+			continue
+		}
+		m, ok := r.members[id]
+		if !ok || filter.Match(m) {
+			continue
+		}
+		filtered = append(filtered, knownMemberLeftUpdate(id, knownVersion))
+	}
+
+	return filtered
 }
 
 func (r *Registry) ownerOnlyUpdatesLocked(knownMembers map[string]*rpc.Version2) []*rpc.Member2 {
 	var updates []*rpc.Member2
-	for id, m := range r.members {
+	for id := range r.indexes.owner[r.localID] {
+		m := r.members[id]
 		knownVersion, ok := knownMembers[id]
 		if ok {
-			// If either we own the member, or the subscriber thinks we do,
-			// and we have a more recent version, send an update.
-			if m.Version.OwnerId == r.localID || knownVersion.OwnerId == r.localID {
-				if compareVersions(knownVersion, m.Version) > 0 {
-					updates = append(updates, m)
-				}
+			// If we own the member and have a more recent version, send an
+			// update.
+			if compareVersions(knownVersion, m.Version) > 0 {
+				updates = append(updates, m)
 			}
 		} else {
 			// If the subscriber doesn't know abou tthe member, send an update.
-			if m.Version.OwnerId == r.localID {
-				updates = append(updates, m)
-			}
+			updates = append(updates, m)
 		}
 	}
 
 	for id, knownVersion := range knownMembers {
-		if _, ok := r.members[id]; ok {
+		if knownVersion.OwnerId != r.localID {
 			continue
 		}
-		if knownVersion.OwnerId != r.localID {
+		if m, ok := r.members[id]; ok {
+			// If the subscriber thinks we own a member that we no longer
+			// own, and we have a more recent version, send an update.
+			if m.Version.OwnerId != r.localID && compareVersions(knownVersion, m.Version) > 0 {
+				updates = append(updates, m)
+			}
 			continue
 		}
 
@@ -529,23 +850,44 @@ func (r *Registry) ownerOnlyUpdatesLocked(knownMembers map[string]*rpc.Version2)
 			zap.Object("known-version", newVersionLogger(knownVersion)),
 		)
 
-		// So the subscriber knows the member has left, send the smallest
-		// version that will remove the member, but won't conflict with
-		// a more recent version from another owner, by keeping the same
-		// timestamp but incrementing the counter.
-		updates = append(updates, &rpc.Member2{
-			State: &rpc.MemberState{
-				Id: id,
-			},
-			Liveness: rpc.Liveness_LEFT,
-			Version: &rpc.Version2{
-				OwnerId: knownVersion.OwnerId,
-				Timestamp: &rpc.MonotonicTimestamp{
-					Timestamp: knownVersion.Timestamp.Timestamp,
-					Counter:   knownVersion.Timestamp.Counter + 1,
-				},
-			},
-		})
+		updates = append(updates, knownMemberLeftUpdate(id, knownVersion))
+	}
+
+	return updates
+}
+
+// candidateUpdatesLocked is the same as allUpdatesLocked, except only
+// considers the given candidate members and the members the subscriber already
+// knows, since any other members will be filtered out.
+func (r *Registry) candidateUpdatesLocked(knownMembers map[string]*rpc.Version2, candidates map[string]interface{}) []*rpc.Member2 {
+	var updates []*rpc.Member2
+	for id := range candidates {
+		m := r.members[id]
+		knownVersion, ok := knownMembers[id]
+		if !ok || compareVersions(knownVersion, m.Version) > 0 {
+			updates = append(updates, m)
+		}
+	}
+
+	for id, knownVersion := range knownMembers {
+		if _, ok := candidates[id]; ok {
+			continue
+		}
+
+		m, ok := r.members[id]
+		if ok {
+			if compareVersions(knownVersion, m.Version) > 0 {
+				updates = append(updates, m)
+			}
+			continue
+		}
+
+		r.logger.Error(
+			"subscriber knows about a member that is not in the cluster",
+			zap.Object("known-version", newVersionLogger(knownVersion)),
+		)
+
+		updates = append(updates, knownMemberLeftUpdate(id, knownVersion))
 	}
 
 	return updates
@@ -580,56 +922,80 @@ func (r *Registry) allUpdatesLocked(knownMembers map[string]*rpc.Version2) []*rp
 			zap.Object("known-version", newVersionLogger(knownVersion)),
 		)
 
-		// So the subscriber knows the member has left, send the smallest
-		// version that will remove the member, but won't conflict with
-		// a more recent version from another owner, by keeping the same
-		// timestamp but incrementing the counter.
-		updates = append(updates, &rpc.Member2{
-			State: &rpc.MemberState{
-				Id: id,
-			},
-			Liveness: rpc.Liveness_LEFT,
-			Version: &rpc.Version2{
-				OwnerId: knownVersion.OwnerId,
-				Timestamp: &rpc.MonotonicTimestamp{
-					Timestamp: knownVersion.Timestamp.Timestamp,
-					Counter:   knownVersion.Timestamp.Counter + 1,
-				},
-			},
-		})
+		updates = append(updates, knownMemberLeftUpdate(id, knownVersion))
 	}
 
 	return updates
 }
 
-func (r *Registry) setMemberLocked(m *rpc.Member2) {
+// knownMemberLeftUpdate returns an update that removes a member the subscriber
+// knows about with the given version.
+//
+// So the subscriber knows the member has left, send the smallest version that
+// will remove the member, but won't conflict with a more recent version from
+// another owner, by keeping the same timestamp but incrementing the counter.
+func knownMemberLeftUpdate(id string, knownVersion *rpc.Version2) *rpc.Member2 {
+	return &rpc.Member2{
+		State: &rpc.MemberState{
+			Id: id,
+		},
+		Liveness: rpc.Liveness_LEFT,
+		Version: &rpc.Version2{
+			OwnerId: knownVersion.OwnerId,
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: knownVersion.Timestamp.Timestamp,
+				Counter:   knownVersion.Timestamp.Counter + 1,
+			},
+		},
+	}
+}
+
+// setMemberLocked sets the member in the registry. If the member is owned by
+// this node, it is last seen at the given local time.
+func (r *Registry) setMemberLocked(m *rpc.Member2, now int64) {
 	if existing, ok := r.members[m.State.Id]; ok {
+		r.tree.Remove(existing)
+		r.indexes.remove(existing)
+		r.decLifecycleCount(existing)
+
 		r.metrics.MembersCount.Dec(map[string]string{
-			"status": strings.ToLower(existing.Liveness.String()),
-			"owner":  existing.Version.OwnerId,
+			"namespace": MemberNamespace(existing.State),
+			"status":    strings.ToLower(existing.Liveness.String()),
+			"owner":     existing.Version.OwnerId,
 		})
 		if existing.Version.OwnerId == r.localID {
 			r.metrics.MembersOwned.Dec(map[string]string{
-				"status": strings.ToLower(existing.Liveness.String()),
+				"namespace": MemberNamespace(existing.State),
+				"status":    strings.ToLower(existing.Liveness.String()),
 			})
 		}
 	}
 
 	r.members[m.State.Id] = m
+	r.tree.Add(m)
+	r.indexes.add(m)
+	r.persistUpsertLocked(m)
+
+	r.incLifecycleCount(m)
 
 	r.metrics.MembersCount.Inc(map[string]string{
-		"status": strings.ToLower(m.Liveness.String()),
-		"owner":  m.Version.OwnerId,
+		"namespace": MemberNamespace(m.State),
+		"status":    strings.ToLower(m.Liveness.String()),
+		"owner":     m.Version.OwnerId,
 	})
 	if m.Version.OwnerId == r.localID {
 		r.metrics.MembersOwned.Inc(map[string]string{
-			"status": strings.ToLower(m.Liveness.String()),
+			"namespace": MemberNamespace(m.State),
+			"status":    strings.ToLower(m.Liveness.String()),
 		})
 
 	}
 
 	if m.Version.OwnerId == r.localID {
-		r.lastSeen[m.State.Id] = m.Version.Timestamp.Timestamp
+		// Use the local time rather than the version timestamp, which may be
+		// ahead of the local clock, so the failure detector compares times
+		// from the same clock.
+		r.lastSeen[m.State.Id] = now
 	} else {
 		delete(r.lastSeen, m.State.Id)
 	}
@@ -637,59 +1003,57 @@ func (r *Registry) setMemberLocked(m *rpc.Member2) {
 
 func (r *Registry) deleteMemberLocked(id string) {
 	if existing, ok := r.members[id]; ok {
+		r.tree.Remove(existing)
+		r.indexes.remove(existing)
+		r.decLifecycleCount(existing)
+
 		r.metrics.MembersCount.Dec(map[string]string{
-			"status": strings.ToLower(existing.Liveness.String()),
-			"owner":  existing.Version.OwnerId,
+			"namespace": MemberNamespace(existing.State),
+			"status":    strings.ToLower(existing.Liveness.String()),
+			"owner":     existing.Version.OwnerId,
 		})
 
 		if existing.Version.OwnerId == r.localID {
 			r.metrics.MembersOwned.Dec(map[string]string{
-				"status": strings.ToLower(existing.Liveness.String()),
+				"namespace": MemberNamespace(existing.State),
+				"status":    strings.ToLower(existing.Liveness.String()),
 			})
 		}
 	}
 
 	delete(r.members, id)
 	delete(r.lastSeen, id)
+	r.persistDeleteLocked(id)
 }
 
 // compareVersions compares lhs and rhs.
 //
-// If the owners don't match but the timestamps do, lhs is considered greater.
+// Since versions are generated by a hybrid logical clock, timestamps are
+// comparable across owners. If the owners don't match but the timestamps do,
+// lhs is considered greater.
 func compareVersions(lhs *rpc.Version2, rhs *rpc.Version2) int {
+	if c := compareTimestamps(lhs.Timestamp, rhs.Timestamp); c != 0 {
+		return c
+	}
 	if lhs.OwnerId != rhs.OwnerId {
-		// Ignore the counter when owners don't match, as the counter only
-		// applies locally.
-		if lhs.Timestamp.Timestamp < rhs.Timestamp.Timestamp {
-			return 1
-		}
-		if lhs.Timestamp.Timestamp > rhs.Timestamp.Timestamp {
-			return -1
-		}
 		// If the owners don't match, but the timestamps do, favor lhs.
 		return -1
 	}
-
-	if lhs.Timestamp.Timestamp < rhs.Timestamp.Timestamp {
-		return 1
-	}
-	if lhs.Timestamp.Timestamp > rhs.Timestamp.Timestamp {
-		return -1
-	}
-	if lhs.Timestamp.Counter < rhs.Timestamp.Counter {
-		return 1
-	}
-	if lhs.Timestamp.Counter > rhs.Timestamp.Counter {
-		return -1
-	}
 	return 0
 }
 
+// CompareVersions compares member versions lhs and rhs. Returns 1 if rhs is
+// newer than lhs, -1 if lhs is newer, or 0 if they are equal.
+func CompareVersions(lhs *rpc.Version2, rhs *rpc.Version2) int {
+	return compareVersions(lhs, rhs)
+}
+
 func copyMember(m *rpc.Member2) *rpc.Member2 {
 	return &rpc.Member2{
 		State:    copyMemberState(m.State),
 		Liveness: m.Liveness,
 		Version:  copyVersion(m.Version),
+		Expiry:   m.Expiry,
 	}
 }
 
@@ -698,11 +1062,18 @@ func copyMemberState(m *rpc.MemberState) *rpc.MemberState {
 	for k, v := range m.Metadata {
 		metadata[k] = v
 	}
+	var locality *rpc.Locality
+	if m.Locality != nil {
+		locality = &rpc.Locality{
+			Region:           m.Locality.Region,
+			AvailabilityZone: m.Locality.AvailabilityZone,
+		}
+	}
 	return &rpc.MemberState{
 		Id:       m.Id,
 		Status:   m.Status,
 		Service:  m.Service,
-		Locality: m.Locality,
+		Locality: locality,
 		Started:  m.Started,
 		Revision: m.Revision,
 		Metadata: metadata,
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/testutils"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -24,11 +25,13 @@ func TestRegistry_AddLocalMember(t *testing.T) {
 	assert.True(t, proto.Equal(localMember, m))
 
 	assert.Equal(t, 1.0, reg.Metrics().MembersCount.Value(map[string]string{
-		"status": "up",
-		"owner":  "local",
+		"namespace": "default",
+		"status":    "up",
+		"owner":     "local",
 	}))
 	assert.Equal(t, 1.0, reg.Metrics().MembersOwned.Value(map[string]string{
-		"status": "up",
+		"namespace": "default",
+		"status":    "up",
 	}))
 }
 
@@ -64,28 +67,76 @@ func TestRegistry_AddMember(t *testing.T) {
 	assert.True(t, proto.Equal(addedMember, m))
 
 	assert.Equal(t, 1.0, reg.Metrics().MembersCount.Value(map[string]string{
-		"status": "up",
-		"owner":  "local",
+		"namespace": "default",
+		"status":    "up",
+		"owner":     "local",
 	}))
 	assert.Equal(t, 1.0, reg.Metrics().MembersOwned.Value(map[string]string{
-		"status": "up",
+		"namespace": "default",
+		"status":    "up",
 	}))
 }
 
-func TestRegistry_AddMemberDiscardOutdated(t *testing.T) {
+func TestRegistry_ReadOnlyAddMemberRejected(t *testing.T) {
 	reg := NewRegistry(
 		"local",
+		WithLocalMember(randomMember("local")),
+		WithReadOnly(),
 		WithLogger(testutils.Logger()),
 	)
 
+	err := reg.AddMember(randomMember("my-member"))
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	_, ok := reg.Member("my-member")
+	assert.False(t, ok)
+
+	// The local member should still be added.
+	_, ok = reg.Member("local")
+	assert.True(t, ok)
+}
+
+// Tests if the wall clock goes backwards, a later update still supersedes the
+// existing member as the hybrid logical clock never goes backwards.
+func TestRegistry_AddMemberClockGoesBackwards(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.AddMember(randomMember("my-member"), WithNowTime(100))
+
 	addedMember := randomMember("my-member")
-	reg.AddMember(addedMember, WithNowTime(100))
+	reg.AddMember(addedMember, WithNowTime(50))
 
-	reg.AddMember(randomMember("my-member"), WithNowTime(50))
+	m, ok := reg.Member("my-member")
+	assert.True(t, ok)
+	assert.True(t, proto.Equal(addedMember, m.State))
+	assert.Equal(t, int64(100), m.Version.Timestamp.Timestamp)
+	assert.Equal(t, uint64(1), m.Version.Timestamp.Counter)
+}
 
-	m, ok := reg.MemberState("my-member")
+func TestRegistry_AddMemberWithClock(t *testing.T) {
+	c := clock.NewManualClock(time.UnixMilli(1000))
+	reg := NewRegistry(
+		"local",
+		WithClock(c),
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.AddMember(randomMember("my-member"))
+
+	m, ok := reg.Member("my-member")
 	assert.True(t, ok)
-	assert.True(t, proto.Equal(addedMember, m))
+	assert.Equal(t, int64(1000), m.Version.Timestamp.Timestamp)
+
+	c.Advance(time.Second)
+	reg.RemoveMember("my-member")
+
+	m, ok = reg.Member("my-member")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2000), m.Version.Timestamp.Timestamp)
+	assert.Equal(t, 2000+reg.tombstoneTimeout, m.Expiry)
 }
 
 func TestRegistry_SubscribeToAddMember(t *testing.T) {
@@ -131,28 +182,31 @@ func TestRegistry_RemoveMember(t *testing.T) {
 	assert.Equal(t, rpc.Liveness_LEFT, m.Liveness)
 
 	assert.Equal(t, 1.0, reg.Metrics().MembersCount.Value(map[string]string{
-		"status": "left",
-		"owner":  "local",
+		"namespace": "default",
+		"status":    "left",
+		"owner":     "local",
 	}))
 	assert.Equal(t, 1.0, reg.Metrics().MembersOwned.Value(map[string]string{
-		"status": "left",
+		"namespace": "default",
+		"status":    "left",
 	}))
 }
 
-func TestRegistry_RemoveMemberDiscardOutdated(t *testing.T) {
+func TestRegistry_RemoveMemberClockGoesBackwards(t *testing.T) {
 	reg := NewRegistry(
 		"local",
 		WithLogger(testutils.Logger()),
 	)
 
-	addedMember := randomMember("my-member")
-	reg.AddMember(addedMember, WithNowTime(100))
+	reg.AddMember(randomMember("my-member"), WithNowTime(100))
 
 	reg.RemoveMember("my-member", WithNowTime(50))
 
-	m, ok := reg.MemberState("my-member")
+	m, ok := reg.Member("my-member")
 	assert.True(t, ok)
-	assert.True(t, proto.Equal(addedMember, m))
+	assert.Equal(t, rpc.Liveness_LEFT, m.Liveness)
+	assert.Equal(t, int64(100), m.Version.Timestamp.Timestamp)
+	assert.Equal(t, uint64(1), m.Version.Timestamp.Counter)
 }
 
 func TestRegistry_SubscribeToRemoveMember(t *testing.T) {
@@ -191,6 +245,7 @@ func TestRegistry_RemoteUpdateTakeOwnership(t *testing.T) {
 	reg := NewRegistry(
 		"local",
 		WithLocalMember(localMember),
+		WithNowTime(0),
 		WithLogger(testutils.Logger()),
 	)
 
@@ -198,11 +253,13 @@ func TestRegistry_RemoteUpdateTakeOwnership(t *testing.T) {
 	reg.AddMember(addedMember, WithNowTime(100))
 
 	assert.Equal(t, 2.0, reg.Metrics().MembersCount.Value(map[string]string{
-		"status": "up",
-		"owner":  "local",
+		"namespace": "default",
+		"status":    "up",
+		"owner":     "local",
 	}))
 	assert.Equal(t, 2.0, reg.Metrics().MembersOwned.Value(map[string]string{
-		"status": "up",
+		"namespace": "default",
+		"status":    "up",
 	}))
 
 	updatedMember := randomMember("my-member")
@@ -223,18 +280,54 @@ func TestRegistry_RemoteUpdateTakeOwnership(t *testing.T) {
 	assert.True(t, proto.Equal(updatedMember, m))
 
 	assert.Equal(t, 1.0, reg.Metrics().MembersCount.Value(map[string]string{
-		"status": "up",
-		"owner":  "local",
+		"namespace": "default",
+		"status":    "up",
+		"owner":     "local",
 	}))
 	assert.Equal(t, 1.0, reg.Metrics().MembersCount.Value(map[string]string{
-		"status": "up",
-		"owner":  "remote",
+		"namespace": "default",
+		"status":    "up",
+		"owner":     "remote",
 	}))
 	assert.Equal(t, 1.0, reg.Metrics().MembersOwned.Value(map[string]string{
-		"status": "up",
+		"namespace": "default",
+		"status":    "up",
 	}))
 }
 
+func TestRegistry_RemoteUpdateReplicationLag(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	reg.RemoteUpdate(&rpc.Member2{
+		State: randomMember("member-1"),
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 1000,
+			},
+		},
+	}, WithNowTime(1250))
+	// An update ahead of the local time should have no lag.
+	reg.RemoteUpdate(&rpc.Member2{
+		State: randomMember("member-2"),
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 2000,
+			},
+		},
+	}, WithNowTime(1500))
+
+	labels := map[string]string{
+		"owner": "remote",
+	}
+	assert.Equal(t, uint64(2), reg.Metrics().ReplicationLag.Count(labels))
+	assert.Equal(t, 0.25, reg.Metrics().ReplicationLag.Sum(labels))
+}
+
 func TestRegistry_RemoteUpdateWithOutdatedVersionIgnored(t *testing.T) {
 	localMember := randomMember("local")
 	reg := NewRegistry(
@@ -384,6 +477,7 @@ func TestRegistry_SubscribeOwnerOnlyReceivesOwnershipChangesUpdates(t *testing.T
 	reg := NewRegistry(
 		"local",
 		WithLocalMember(localMember),
+		WithNowTime(0),
 		WithLogger(testutils.Logger()),
 	)
 
@@ -4,6 +4,7 @@ import (
 	"math/rand"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"go.uber.org/zap"
 )
 
 // Digest returns the timestamps of the known nodes in the registry upto the
@@ -60,7 +61,12 @@ func (r *Registry) Digest(limit int) map[string]*rpc.MonotonicTimestamp {
 //
 // It also tracks which known members are out of date, or unknown, to request
 // in the next digest.
-func (r *Registry) Delta(digest map[string]*rpc.MonotonicTimestamp) []*rpc.Member2 {
+//
+// The local clock is advanced past the timestamps in the digest, subject to
+// the max clock drift.
+func (r *Registry) Delta(digest map[string]*rpc.MonotonicTimestamp, opts ...Option) []*rpc.Member2 {
+	options := r.options(opts)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -76,6 +82,8 @@ func (r *Registry) Delta(digest map[string]*rpc.MonotonicTimestamp) []*rpc.Membe
 
 	var members []*rpc.Member2
 	for id, timestamp := range digest {
+		r.observeLocked(timestamp, options.now, zap.String("member-id", id))
+
 		if m, ok := r.members[id]; ok {
 			if compareTimestamps(timestamp, m.Version.Timestamp) > 0 {
 				members = append(members, copyMember(m))
@@ -0,0 +1,297 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+// OverflowPolicy defines how to handle a subscriber whose delivery queue is
+// full, such as a client that isn't reading updates fast enough.
+type OverflowPolicy int
+
+const (
+	// OverflowPolicyDisconnect unsubscribes the subscriber, so it must
+	// reconnect and resubscribe with its known members.
+	OverflowPolicyDisconnect OverflowPolicy = iota
+	// OverflowPolicyResync discards the queued updates, then once the
+	// subscriber has caught up, sends the latest state of every member in the
+	// registry so the subscriber can recover any missed updates.
+	OverflowPolicyResync
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowPolicyDisconnect:
+		return "disconnect"
+	case OverflowPolicyResync:
+		return "resync"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseOverflowPolicy returns the overflow policy with the given name.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch strings.ToLower(s) {
+	case "disconnect":
+		return OverflowPolicyDisconnect, nil
+	case "resync":
+		return OverflowPolicyResync, nil
+	default:
+		return 0, fmt.Errorf("unknown overflow policy: %s", s)
+	}
+}
+
+// sequencedUpdate is an update with its sequence number in the change feed.
+// The sequence number is 0 if the update isn't from the feed.
+type sequencedUpdate struct {
+	member *rpc.Member2
+	seq    uint64
+}
+
+type subHandle struct {
+	onUpdate  func(update *rpc.Member2, seq uint64)
+	ownerOnly bool
+	filter    *Filter
+
+	// queue contains updates waiting to be delivered to the subscriber. If
+	// nil updates are delivered synchronously while holding the registry
+	// mutex.
+	queue          chan sequencedUpdate
+	overflowPolicy OverflowPolicy
+	onDisconnect   func()
+
+	// resyncPending is set when the queue overflowed and the subscriber is
+	// waiting for a resync. While pending, no further updates are queued.
+	// Protected by the registry mutex.
+	resyncPending bool
+	resync        chan interface{}
+
+	// known contains the IDs of the members matching the filter that have
+	// been queued for a filtered subscriber since it was last resynced, so
+	// a resync only removes members the subscriber may know about. Nil if
+	// the subscriber isn't filtered or isn't queued. Protected by the
+	// registry mutex.
+	known map[string]struct{}
+
+	lagging *atomic.Bool
+
+	done chan interface{}
+	// stopped is closed once the delivery goroutine exits.
+	stopped chan interface{}
+}
+
+func newSubHandle(onUpdate func(update *rpc.Member2, seq uint64), ownerOnly bool, options *options) *subHandle {
+	h := &subHandle{
+		onUpdate:       onUpdate,
+		ownerOnly:      ownerOnly,
+		filter:         options.filter,
+		overflowPolicy: options.overflowPolicy,
+		onDisconnect:   options.onDisconnect,
+		lagging:        atomic.NewBool(false),
+		done:           make(chan interface{}),
+	}
+	if options.subscriberQueueLimit > 0 {
+		h.queue = make(chan sequencedUpdate, options.subscriberQueueLimit)
+		h.resync = make(chan interface{}, 1)
+		h.stopped = make(chan interface{})
+		if h.filter != nil {
+			h.known = make(map[string]struct{})
+		}
+	}
+	return h
+}
+
+// trackLocked records the subscriber may know about the member in the given
+// update. Members that move out of the filter are kept until the next resync,
+// since the update removing them may be discarded by the resync.
+func (h *subHandle) trackLocked(update *rpc.Member2) {
+	if h.known != nil && h.filter.Match(update) {
+		h.known[update.State.Id] = struct{}{}
+	}
+}
+
+// subscriberUpdate returns the update to send to the subscriber, or false if
+// the update should not be sent, given the members previous state and whether
+// the update is to a member owned by this node.
+func subscriberUpdate(h *subHandle, update *rpc.Member2, previous *rpc.Member2, owner bool) (*rpc.Member2, bool) {
+	if h.ownerOnly && !owner {
+		return nil, false
+	}
+	if h.filter == nil {
+		return update, true
+	}
+	return filterUpdate(h.filter, update, previous)
+}
+
+// notifySubscriberLocked sends the update to the subscriber, either by calling
+// onUpdate directly or adding it to the subscribers queue.
+func (r *Registry) notifySubscriberLocked(h *subHandle, update sequencedUpdate) {
+	if h.queue == nil {
+		h.onUpdate(update.member, update.seq)
+		return
+	}
+
+	if h.resyncPending {
+		r.metrics.SubscriberUpdatesDropped.Inc(map[string]string{
+			"policy": h.overflowPolicy.String(),
+		})
+		return
+	}
+
+	select {
+	case h.queue <- update:
+		h.trackLocked(update.member)
+		if len(h.queue) >= cap(h.queue)/2 && h.lagging.CompareAndSwap(false, true) {
+			r.metrics.SubscribersLagging.Inc(map[string]string{})
+		}
+		return
+	default:
+	}
+
+	r.metrics.SubscriberUpdatesDropped.Inc(map[string]string{
+		"policy": h.overflowPolicy.String(),
+	})
+	r.metrics.SubscriberOverflows.Inc(map[string]string{
+		"policy": h.overflowPolicy.String(),
+	})
+
+	switch h.overflowPolicy {
+	case OverflowPolicyResync:
+		r.logger.Warn(
+			"subscriber queue overflow; resyncing",
+			zap.Int("queue-limit", cap(h.queue)),
+		)
+
+		h.resyncPending = true
+		h.resync <- struct{}{}
+	default:
+		r.logger.Warn(
+			"subscriber queue overflow; disconnecting",
+			zap.Int("queue-limit", cap(h.queue)),
+		)
+
+		r.unsubscribeLocked(h)
+		if h.onDisconnect != nil {
+			h.onDisconnect()
+		}
+	}
+}
+
+// deliver delivers the initial updates then the queued updates to the
+// subscriber until the subscriber is unsubscribed.
+func (r *Registry) deliver(h *subHandle, initial []sequencedUpdate) {
+	defer close(h.stopped)
+
+	for _, u := range initial {
+		select {
+		case <-h.done:
+			return
+		default:
+		}
+		h.onUpdate(u.member, u.seq)
+	}
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case u := <-h.queue:
+			if len(h.queue) < cap(h.queue)/2 && h.lagging.CompareAndSwap(true, false) {
+				r.metrics.SubscribersLagging.Dec(map[string]string{})
+			}
+			h.onUpdate(u.member, u.seq)
+		case <-h.resync:
+			for _, u := range r.resyncSubscriber(h) {
+				select {
+				case <-h.done:
+					return
+				default:
+				}
+				h.onUpdate(u.member, u.seq)
+			}
+		}
+	}
+}
+
+// resyncSubscriber discards the subscribers queued updates and returns the
+// latest state of every member.
+//
+// Members that don't match the subscribers filter, that the subscriber may know
+// about, are sent with liveness left so the subscriber removes them.
+func (r *Registry) resyncSubscriber(h *subHandle) []sequencedUpdate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Since no updates are queued while the resync is pending, the queue only
+	// contains updates before the overflow, which are superseded by the
+	// resync.
+	for len(h.queue) > 0 {
+		<-h.queue
+	}
+	if h.lagging.CompareAndSwap(true, false) {
+		r.metrics.SubscribersLagging.Dec(map[string]string{})
+	}
+
+	var updates []*rpc.Member2
+	for _, m := range r.members {
+		if h.ownerOnly && m.Version.OwnerId != r.localID {
+			continue
+		}
+		if h.filter.Match(m) {
+			updates = append(updates, m)
+			continue
+		}
+		if _, ok := h.known[m.State.Id]; ok {
+			updates = append(updates, filteredOutUpdate(m))
+		}
+	}
+
+	// Reset the known members to those sent in the resync.
+	if h.known != nil {
+		h.known = make(map[string]struct{})
+		for _, u := range updates {
+			h.trackLocked(u)
+		}
+	}
+
+	// Once unlocked new updates will be queued after the resync updates.
+	h.resyncPending = false
+
+	r.logger.Info("resync subscriber", zap.Int("updates", len(updates)))
+
+	return r.withHeadSequenceLocked(updates)
+}
+
+func (r *Registry) unsubscribeLocked(h *subHandle) {
+	if _, ok := r.subs[h]; !ok {
+		return
+	}
+
+	delete(r.subs, h)
+	close(h.done)
+
+	if h.lagging.CompareAndSwap(true, false) {
+		r.metrics.SubscribersLagging.Dec(map[string]string{})
+	}
+}
+
+// withHeadSequenceLocked returns the updates with the sequence number of the
+// last update set to the head of the change feed, so once the subscriber has
+// received all updates it is up to date with the feed. The other updates don't
+// have a sequence number, since if the subscriber disconnects before receiving
+// all updates it can't resume from the feed.
+func (r *Registry) withHeadSequenceLocked(updates []*rpc.Member2) []sequencedUpdate {
+	sequenced := make([]sequencedUpdate, 0, len(updates))
+	for _, u := range updates {
+		sequenced = append(sequenced, sequencedUpdate{member: u})
+	}
+	if len(sequenced) > 0 {
+		sequenced[len(sequenced)-1].seq = r.feed.Head().Seq
+	}
+	return sequenced
+}
@@ -0,0 +1,224 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests a subscriber that blocks doesn't block updates to the registry.
+func TestSubscriber_QueuedSubscriberDoesNotBlock(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	block := make(chan interface{})
+	updates := make(chan *rpc.Member2, 10)
+	unsubscribe := reg.Subscribe(nil, func(u *rpc.Member2) {
+		<-block
+		updates <- u
+	}, WithSubscriberQueueLimit(10))
+	defer unsubscribe()
+
+	for i := 0; i != 5; i++ {
+		reg.AddMember(testutils.RandomMemberState("", ""))
+	}
+
+	close(block)
+	for i := 0; i != 5; i++ {
+		select {
+		case <-updates:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for update")
+		}
+	}
+}
+
+func TestSubscriber_OverflowDisconnect(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	block := make(chan interface{})
+	defer close(block)
+	disconnected := make(chan interface{})
+	reg.Subscribe(nil, func(u *rpc.Member2) {
+		<-block
+	},
+		WithSubscriberQueueLimit(2),
+		WithOverflowPolicy(OverflowPolicyDisconnect),
+		WithOnDisconnect(func() {
+			close(disconnected)
+		}),
+	)
+
+	// The first update will be taken from the queue and block the subscriber,
+	// then two more will fill the queue, so the fourth overflows.
+	for i := 0; i != 4; i++ {
+		reg.AddMember(testutils.RandomMemberState("", ""))
+		// Wait for the subscriber to take the first update.
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for disconnect")
+	}
+
+	assert.Equal(t, 1.0, reg.Metrics().SubscriberOverflows.Value(map[string]string{
+		"policy": "disconnect",
+	}))
+	assert.Equal(t, 0.0, reg.Metrics().SubscribersLagging.Value(map[string]string{}))
+}
+
+func TestSubscriber_OverflowResync(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	block := make(chan interface{})
+	received := make(map[string]*rpc.Member2)
+	updates := make(chan *rpc.Member2, 100)
+	unsubscribe := reg.Subscribe(nil, func(u *rpc.Member2) {
+		<-block
+		updates <- u
+	},
+		WithSubscriberQueueLimit(2),
+		WithOverflowPolicy(OverflowPolicyResync),
+	)
+	defer unsubscribe()
+
+	for i := 0; i != 10; i++ {
+		reg.AddMember(testutils.RandomMemberState("", ""))
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	assert.Equal(t, 1.0, reg.Metrics().SubscriberOverflows.Value(map[string]string{
+		"policy": "resync",
+	}))
+
+	close(block)
+
+	// Once resynced the subscriber should have received every member.
+	deadline := time.After(time.Second)
+	for len(received) != 10 {
+		select {
+		case u := <-updates:
+			received[u.State.Id] = u
+		case <-deadline:
+			require.Fail(t, "timed out waiting for resync")
+		}
+	}
+	for _, m := range reg.Members() {
+		assert.Equal(t, m, received[m.State.Id])
+	}
+}
+
+// Tests unsubscribing waits for an in progress delivery, so onUpdate is never
+// called once unsubscribe returns.
+func TestSubscriber_UnsubscribeWaitsForDelivery(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	delivering := make(chan interface{})
+	block := make(chan interface{})
+	unsubscribe := reg.Subscribe(nil, func(u *rpc.Member2) {
+		close(delivering)
+		<-block
+	}, WithSubscriberQueueLimit(10))
+
+	reg.AddMember(testutils.RandomMemberState("", ""))
+	<-delivering
+
+	unsubscribed := make(chan interface{})
+	go func() {
+		unsubscribe()
+		close(unsubscribed)
+	}()
+
+	select {
+	case <-unsubscribed:
+		t.Fatal("unsubscribe returned while delivering update")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(block)
+
+	select {
+	case <-unsubscribed:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for unsubscribe")
+	}
+}
+
+// Tests resyncing a filtered subscriber only removes members outside the
+// filter that the subscriber may know about.
+func TestSubscriber_OverflowResyncWithFilter(t *testing.T) {
+	reg := NewRegistry(
+		"local",
+		WithLogger(testutils.Logger()),
+	)
+
+	for i := 0; i != 10; i++ {
+		reg.AddMember(testutils.RandomMemberState(fmt.Sprintf("bar-%d", i), "bar"))
+	}
+
+	block := make(chan interface{})
+	updates := make(chan *rpc.Member2, 100)
+	unsubscribe := reg.Subscribe(nil, func(u *rpc.Member2) {
+		<-block
+		updates <- u
+	},
+		WithFilter(&Filter{
+			Service: []string{"foo"},
+		}),
+		WithSubscriberQueueLimit(2),
+		WithOverflowPolicy(OverflowPolicyResync),
+	)
+	defer unsubscribe()
+
+	// The first update blocks the subscriber, then two more fill the queue,
+	// so the fourth overflows.
+	for i := 0; i != 4; i++ {
+		reg.AddMember(testutils.RandomMemberState(fmt.Sprintf("foo-%d", i), "foo"))
+		time.Sleep(time.Millisecond * 10)
+	}
+	// Move a member the subscriber knows about out of the filter while the
+	// resync is pending.
+	reg.AddMember(testutils.RandomMemberState("foo-0", "bar"))
+
+	assert.Equal(t, 1.0, reg.Metrics().SubscriberOverflows.Value(map[string]string{
+		"policy": "resync",
+	}))
+
+	close(block)
+
+	received := make(map[string]*rpc.Member2)
+	for {
+		select {
+		case u := <-updates:
+			assert.NotContains(t, u.State.Id, "bar-")
+			received[u.State.Id] = u
+			continue
+		case <-time.After(time.Millisecond * 200):
+		}
+		break
+	}
+
+	assert.Equal(t, 4, len(received))
+	assert.Equal(t, rpc.Liveness_LEFT, received["foo-0"].Liveness)
+	for i := 1; i != 4; i++ {
+		assert.Equal(t, rpc.Liveness_UP, received[fmt.Sprintf("foo-%d", i)].Liveness)
+	}
+}
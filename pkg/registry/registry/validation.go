@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
+// ValidationReason identifies why a member state was rejected.
+type ValidationReason string
+
+const (
+	ValidationReasonMissingMember   ValidationReason = "missing_member"
+	ValidationReasonMissingID       ValidationReason = "missing_id"
+	ValidationReasonIDTooLong       ValidationReason = "id_too_long"
+	ValidationReasonIDCharset       ValidationReason = "id_charset"
+	ValidationReasonMissingService  ValidationReason = "missing_service"
+	ValidationReasonMetadataEntries ValidationReason = "metadata_entries"
+	ValidationReasonMetadataBytes   ValidationReason = "metadata_bytes"
+	ValidationReasonNamespace       ValidationReason = "namespace"
+	ValidationReasonCluster         ValidationReason = "cluster"
+)
+
+// ValidationError is returned when a member state doesn't satisfy the
+// MemberLimits.
+type ValidationError struct {
+	Reason  ValidationReason
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// MemberLimits defines the constraints on the member state clients may
+// register.
+type MemberLimits struct {
+	// MaxIDLength is the maximum length of a member ID in bytes. Zero means
+	// there is no limit.
+	MaxIDLength int
+
+	// IDCharset is a regular expression character class (without the
+	// brackets) containing the characters allowed in a member ID, such as
+	// 'a-zA-Z0-9'. If empty any characters are allowed.
+	IDCharset string
+
+	// MaxMetadataEntries is the maximum number of metadata entries, excluding
+	// the namespace key. Zero means there is no limit.
+	MaxMetadataEntries int
+
+	// MaxMetadataBytes is the maximum total size of the metadata keys and
+	// values in bytes, excluding the namespace key. Zero means there is no
+	// limit.
+	MaxMetadataBytes int
+
+	// RequireService rejects members without a service.
+	RequireService bool
+}
+
+// DefaultMemberLimits returns the default limits, which don't restrict the
+// member state, so existing clients aren't rejected unless limits are
+// configured.
+func DefaultMemberLimits() *MemberLimits {
+	return &MemberLimits{
+		MaxIDLength:        0,
+		IDCharset:          "",
+		MaxMetadataEntries: 0,
+		MaxMetadataBytes:   0,
+		RequireService:     false,
+	}
+}
+
+// MemberValidator validates member states against the configured limits.
+type MemberValidator struct {
+	limits    MemberLimits
+	idPattern *regexp.Regexp
+}
+
+func NewMemberValidator(limits *MemberLimits) (*MemberValidator, error) {
+	v := &MemberValidator{
+		limits: *limits,
+	}
+	if limits.IDCharset != "" {
+		pattern, err := regexp.Compile("^[" + limits.IDCharset + "]*$")
+		if err != nil {
+			return nil, fmt.Errorf("member validator: invalid id charset: %w", err)
+		}
+		v.idPattern = pattern
+	}
+	return v, nil
+}
+
+// Validate returns a *ValidationError if the member doesn't satisfy the
+// limits.
+func (v *MemberValidator) Validate(m *rpc.MemberState) error {
+	if m == nil {
+		return &ValidationError{
+			Reason:  ValidationReasonMissingMember,
+			Message: "missing member",
+		}
+	}
+
+	if m.Id == "" {
+		return &ValidationError{
+			Reason:  ValidationReasonMissingID,
+			Message: "missing member id",
+		}
+	}
+	if v.limits.MaxIDLength != 0 && len(m.Id) > v.limits.MaxIDLength {
+		return &ValidationError{
+			Reason: ValidationReasonIDTooLong,
+			Message: fmt.Sprintf(
+				"member id exceeds max length: %d > %d",
+				len(m.Id), v.limits.MaxIDLength,
+			),
+		}
+	}
+	if v.idPattern != nil && !v.idPattern.MatchString(m.Id) {
+		return &ValidationError{
+			Reason: ValidationReasonIDCharset,
+			Message: fmt.Sprintf(
+				"member id contains invalid characters (allowed [%s]): %q",
+				v.limits.IDCharset, m.Id,
+			),
+		}
+	}
+
+	if err := ValidateNamespace(MemberNamespace(m)); err != nil {
+		return &ValidationError{
+			Reason:  ValidationReasonNamespace,
+			Message: fmt.Sprintf("member %s", err),
+		}
+	}
+
+	// Only members received from a remote cluster are marked with their
+	// origin cluster.
+	if _, ok := m.Metadata[ClusterMetadataKey]; ok {
+		return &ValidationError{
+			Reason:  ValidationReasonCluster,
+			Message: fmt.Sprintf("member metadata key %q is reserved", ClusterMetadataKey),
+		}
+	}
+
+	if v.limits.RequireService && m.Service == "" {
+		return &ValidationError{
+			Reason:  ValidationReasonMissingService,
+			Message: "missing member service",
+		}
+	}
+
+	// The namespace key is added by the server when registering into a
+	// namespace, so doesn't count towards the metadata limits.
+	entries := 0
+	size := 0
+	for key, value := range m.Metadata {
+		if key == NamespaceMetadataKey {
+			continue
+		}
+		entries++
+		size += len(key) + len(value)
+	}
+	if v.limits.MaxMetadataEntries != 0 && entries > v.limits.MaxMetadataEntries {
+		return &ValidationError{
+			Reason: ValidationReasonMetadataEntries,
+			Message: fmt.Sprintf(
+				"member metadata exceeds max entries: %d > %d",
+				entries, v.limits.MaxMetadataEntries,
+			),
+		}
+	}
+	if v.limits.MaxMetadataBytes != 0 && size > v.limits.MaxMetadataBytes {
+		return &ValidationError{
+			Reason: ValidationReasonMetadataBytes,
+			Message: fmt.Sprintf(
+				"member metadata exceeds max size: %d > %d bytes",
+				size, v.limits.MaxMetadataBytes,
+			),
+		}
+	}
+
+	return nil
+}
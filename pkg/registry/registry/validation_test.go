@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemberValidator_Validate(t *testing.T) {
+	largeMetadata := make(map[string]string)
+	for i := 0; i != 65; i++ {
+		largeMetadata[strings.Repeat("k", i+1)] = "v"
+	}
+
+	tests := []struct {
+		name   string
+		member *rpc.MemberState
+		reason ValidationReason
+	}{
+		{"missing member", nil, ValidationReasonMissingMember},
+		{"missing id", &rpc.MemberState{Service: "foo"}, ValidationReasonMissingID},
+		{
+			"id too long",
+			&rpc.MemberState{Id: strings.Repeat("a", 129), Service: "foo"},
+			ValidationReasonIDTooLong,
+		},
+		{
+			"id charset",
+			&rpc.MemberState{Id: "foo/bar", Service: "foo"},
+			ValidationReasonIDCharset,
+		},
+		{
+			"missing service",
+			&rpc.MemberState{Id: "foo"},
+			ValidationReasonMissingService,
+		},
+		{
+			"metadata entries",
+			&rpc.MemberState{Id: "foo", Service: "foo", Metadata: largeMetadata},
+			ValidationReasonMetadataEntries,
+		},
+		{
+			"metadata bytes",
+			&rpc.MemberState{
+				Id:       "foo",
+				Service:  "foo",
+				Metadata: map[string]string{"foo": strings.Repeat("a", 16*1024)},
+			},
+			ValidationReasonMetadataBytes,
+		},
+		{
+			"cluster",
+			&rpc.MemberState{
+				Id:       "foo",
+				Service:  "foo",
+				Metadata: map[string]string{ClusterMetadataKey: "us-east"},
+			},
+			ValidationReasonCluster,
+		},
+	}
+
+	v, err := NewMemberValidator(&MemberLimits{
+		MaxIDLength:        128,
+		IDCharset:          "a-zA-Z0-9._:-",
+		MaxMetadataEntries: 64,
+		MaxMetadataBytes:   16 * 1024,
+		RequireService:     true,
+	})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(tt.member)
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, tt.reason, validationErr.Reason)
+		})
+	}
+
+	assert.NoError(t, v.Validate(testutils.RandomMemberState("", "")))
+}
+
+// Tests the default limits don't restrict the member state.
+func TestMemberValidator_DefaultLimits(t *testing.T) {
+	v, err := NewMemberValidator(DefaultMemberLimits())
+	require.NoError(t, err)
+
+	assert.NoError(t, v.Validate(&rpc.MemberState{
+		Id: strings.Repeat("/", 1000),
+	}))
+}
+
+// Tests a member exactly at the metadata limits is accepted when registered
+// into a namespace, since the namespace key doesn't count towards the limits.
+func TestMemberValidator_NamespaceExcludedFromLimits(t *testing.T) {
+	v, err := NewMemberValidator(&MemberLimits{
+		MaxMetadataEntries: 2,
+		MaxMetadataBytes:   8,
+	})
+	require.NoError(t, err)
+
+	member := WithMemberNamespace(&rpc.MemberState{
+		Id: "foo",
+		Metadata: map[string]string{
+			"a": "bcd",
+			"e": "fgh",
+		},
+	}, "staging")
+	assert.NoError(t, v.Validate(member))
+
+	member.Metadata["i"] = ""
+	var validationErr *ValidationError
+	require.True(t, errors.As(v.Validate(member), &validationErr))
+	assert.Equal(t, ValidationReasonMetadataEntries, validationErr.Reason)
+
+	delete(member.Metadata, "i")
+	member.Metadata["e"] = "fghi"
+	require.True(t, errors.As(v.Validate(member), &validationErr))
+	assert.Equal(t, ValidationReasonMetadataBytes, validationErr.Reason)
+}
+
+func TestMemberValidator_InvalidCharset(t *testing.T) {
+	_, err := NewMemberValidator(&MemberLimits{IDCharset: "z-a"})
+	assert.Error(t, err)
+}
+
+// Tests updating the member state passed to AddMember doesn't modify the
+// registry.
+func TestRegistry_AddMemberCopiesState(t *testing.T) {
+	reg := NewRegistry("local")
+
+	member := randomMember("member-1")
+	reg.AddMember(member)
+
+	member.Status = "modified"
+	member.Metadata["foo"] = "bar"
+
+	m, ok := reg.MemberState("member-1")
+	require.True(t, ok)
+	assert.NotEqual(t, "modified", m.Status)
+	assert.NotContains(t, m.Metadata, "foo")
+}
@@ -2,11 +2,39 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	"github.com/fuddle-io/fuddle/pkg/metrics"
 	"github.com/fuddle-io/fuddle/pkg/registry/registry"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// FilterMetadataKey is the gRPC metadata key clients use to send a JSON
+	// encoded registry.Filter when subscribing to updates.
+	FilterMetadataKey = "fuddle-filter"
+
+	// QueryMetadataKey is the gRPC metadata key clients use to send a query
+	// expression (see registry.Query) when listing members or subscribing to
+	// updates.
+	QueryMetadataKey = "fuddle-query"
+
+	// NamespaceMetadataKey is the gRPC metadata key clients use to send the
+	// namespace to register members in, list members from or subscribe to.
+	// If not given, clients use registry.DefaultNamespace. Readers may use
+	// registry.AllNamespaces to include members in any namespace.
+	NamespaceMetadataKey = "fuddle-namespace"
+
+	// IncludeRemoteMetadataKey is the gRPC metadata key clients set to "true"
+	// to include members federated from remote clusters when listing members
+	// or subscribing to updates. By default only members registered with the
+	// local cluster are included.
+	IncludeRemoteMetadataKey = "fuddle-include-remote"
 )
 
 // ClientReadServer serves updates to the registry to the external
@@ -14,6 +42,11 @@ import (
 type ClientReadServer struct {
 	registry *registry.Registry
 
+	subscriberQueueLimit int
+	overflowPolicy       registry.OverflowPolicy
+
+	drainer *Drainer
+
 	outboundUpdates *metrics.Counter
 	logger          *zap.Logger
 
@@ -37,44 +70,153 @@ func NewClientReadServer(reg *registry.Registry, opts ...Option) *ClientReadServ
 	}
 
 	return &ClientReadServer{
-		registry:        reg,
-		outboundUpdates: outboundUpdates,
-		logger:          options.logger,
+		registry:             reg,
+		subscriberQueueLimit: options.subscriberQueueLimit,
+		overflowPolicy:       options.overflowPolicy,
+		drainer:              options.drainer,
+		outboundUpdates:      outboundUpdates,
+		logger:               options.logger,
 	}
 }
 
 // Updates streams updates to the local registry. This includes sending any
 // updates the client missed given their known members in the subscribe request.
+//
+// Clients may include a filter or query in the stream metadata to only
+// receive updates for the members they are interested in. Updates are scoped
+// to the namespace in the stream metadata, and only include members federated
+// from remote clusters if the client opts in with IncludeRemoteMetadataKey or
+// the filter.
+//
+// Clients may include the change feed position of the last update they
+// received in the stream metadata to only receive the updates they missed
+// since that position, if the position is still in the registry change feed.
+//
+// Updates are queued for each client so a slow client doesn't block the
+// registry. If the client falls too far behind, it is either disconnected or
+// resynced depending on the overflow policy.
+//
+// When the node is draining, the stream is closed with an Unavailable status
+// and the address of another node to reconnect to in the
+// ReconnectMetadataKey trailer.
 func (s *ClientReadServer) Updates(req *rpc.SubscribeRequest, stream rpc.ClientReadRegistry_UpdatesServer) error {
 	logger := s.logger.With(zap.String("rpc", "ClientReadServer.Updates"))
 	logger.Debug("updates stream")
 
-	unsubscribe := s.registry.Subscribe(req, func(update *rpc.Member2) {
-		logger.Debug(
-			"send update",
-			zap.String("id", update.State.Id),
-		)
+	filter, err := filterFromContext(stream.Context())
+	if err != nil {
+		logger.Debug("invalid filter", zap.Error(err))
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	namespace, err := readNamespaceFromContext(stream.Context())
+	if err != nil {
+		logger.Debug("invalid namespace", zap.Error(err))
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Always use a filter so federated members are excluded unless
+	// requested.
+	if filter == nil {
+		filter = &registry.Filter{}
+	}
+	if includeRemoteFromContext(stream.Context()) {
+		filter.IncludeRemote = true
+	}
+
+	since, err := resumePositionFromContext(stream.Context())
+	if err != nil {
+		logger.Debug("invalid resume position", zap.Error(err))
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	drain := s.drainer.track()
+	defer s.drainer.untrack(drain)
+
+	disconnected := make(chan interface{})
+	unsubscribe := s.registry.SubscribeFeed(
+		req,
+		since,
+		func(update *rpc.Member2, seq uint64) {
+			logger.Debug(
+				"send update",
+				zap.String("id", update.State.Id),
+				zap.Uint64("seq", seq),
+			)
 
-		s.outboundUpdates.Inc(map[string]string{})
+			s.outboundUpdates.Inc(map[string]string{})
 
-		// Ignore return error, if the client closes the stream the context
-		// will be cancelled.
-		// nolint
-		stream.Send(update)
-	})
-	defer unsubscribe()
+			if seq != 0 {
+				update = WithUpdateSequence(update, seq)
+			}
 
-	<-stream.Context().Done()
-	logger.Debug("subscribe stream closed")
+			// Ignore return error, if the client closes the stream the
+			// context will be cancelled.
+			// nolint
+			stream.Send(update)
+		},
+		registry.WithOnSubscribed(func(head registry.FeedPosition, resumed bool) {
+			logger.Debug(
+				"subscribed",
+				zap.String("head", head.String()),
+				zap.Bool("resumed", resumed),
+			)
 
-	return nil
+			// Ignore return error, if the client closes the stream the
+			// context will be cancelled.
+			// nolint
+			stream.SendHeader(metadata.Pairs(
+				FeedPositionMetadataKey, head.String(),
+				ResumedMetadataKey, strconv.FormatBool(resumed),
+			))
+		}),
+		registry.WithFilter(filter),
+		registry.WithNamespace(namespace),
+		registry.WithSubscriberQueueLimit(s.subscriberQueueLimit),
+		registry.WithOverflowPolicy(s.overflowPolicy),
+		registry.WithOnDisconnect(func() {
+			close(disconnected)
+		}),
+	)
+	// Updates are sent from the registry's delivery goroutine, so the
+	// subscriber must be unsubscribed (which waits for any in progress send)
+	// before returning, as the stream must not be used once the handler
+	// returns.
+	select {
+	case <-stream.Context().Done():
+		unsubscribe()
+		logger.Debug("subscribe stream closed")
+		return nil
+	case <-disconnected:
+		unsubscribe()
+		logger.Warn("subscriber queue overflow; disconnecting")
+		return status.Error(codes.ResourceExhausted, "subscriber queue overflow")
+	case addr := <-drain.drained():
+		unsubscribe()
+		logger.Debug("node draining; closing stream", zap.String("reconnect", addr))
+		return drainedError(stream, addr)
+	}
 }
 
-// Member looks up the requested member.
+// Member looks up the requested member. Like Members, the member is only
+// returned if it is in the requested namespace, and members federated from
+// remote clusters are only returned if the client includes remote members.
 func (s *ClientReadServer) Member(ctx context.Context, req *rpc.MemberRequest) (*rpc.MemberResponse, error) {
 	logger := s.logger.With(zap.String("rpc", "ClientReadServer.Member"))
 
+	namespace, err := readNamespaceFromContext(ctx)
+	if err != nil {
+		logger.Debug("invalid namespace", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	m, ok := s.registry.Member(req.Id)
+	if ok && namespace != registry.AllNamespaces && registry.MemberNamespace(m.State) != namespace {
+		ok = false
+	}
+	if ok && registry.IsFederated(m.State) && !includeRemoteFromContext(ctx) {
+		ok = false
+	}
 	if !ok {
 		logger.Debug("member request; not found", zap.String("id", req.Id))
 		return &rpc.MemberResponse{}, nil
@@ -88,13 +230,145 @@ func (s *ClientReadServer) Member(ctx context.Context, req *rpc.MemberRequest) (
 }
 
 // Members lists the members in the registry.
-func (s *ClientReadServer) Members(context.Context, *rpc.MembersRequest) (*rpc.MembersResponse, error) {
+//
+// Clients may include a query in the request metadata to only list the
+// matching members. Members are scoped to the namespace in the request
+// metadata, and only include members federated from remote clusters if the
+// client opts in with IncludeRemoteMetadataKey.
+func (s *ClientReadServer) Members(ctx context.Context, _ *rpc.MembersRequest) (*rpc.MembersResponse, error) {
 	logger := s.logger.With(zap.String("rpc", "ClientReadServer.Members"))
 
-	members := s.registry.Members()
+	query, err := queryFromContext(ctx)
+	if err != nil {
+		logger.Debug("invalid query", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	namespace, err := readNamespaceFromContext(ctx)
+	if err != nil {
+		logger.Debug("invalid namespace", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	members := s.registry.Members(
+		registry.WithQuery(query),
+		registry.WithNamespace(namespace),
+	)
+	if !includeRemoteFromContext(ctx) {
+		local := members[:0]
+		for _, m := range members {
+			if !registry.IsFederated(m.State) {
+				local = append(local, m)
+			}
+		}
+		members = local
+	}
 	logger.Debug("members request", zap.Int("num-members", len(members)))
 
 	return &rpc.MembersResponse{
 		Members: members,
 	}, nil
 }
+
+// filterFromContext returns the filter in the incoming metadata, or nil if no
+// filter is given. If a query is given it is added to the filter.
+func filterFromContext(ctx context.Context) (*registry.Filter, error) {
+	query, err := queryFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	values := md.Get(FilterMetadataKey)
+	if len(values) == 0 {
+		if query == nil {
+			return nil, nil
+		}
+		return &registry.Filter{Query: query}, nil
+	}
+
+	filter, err := registry.ParseFilter([]byte(values[0]))
+	if err != nil {
+		return nil, err
+	}
+	if query != nil {
+		if filter.Query != nil {
+			return nil, fmt.Errorf("query given in both filter and metadata")
+		}
+		filter.Query = query
+	}
+	return filter, nil
+}
+
+// queryFromContext returns the query in the incoming metadata, or nil if no
+// query is given.
+func queryFromContext(ctx context.Context) (*registry.Query, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	values := md.Get(QueryMetadataKey)
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return registry.ParseQuery(values[0])
+}
+
+// includeRemoteFromContext returns whether the client requested members
+// federated from remote clusters.
+func includeRemoteFromContext(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	value, _ := firstMetadataValue(md, IncludeRemoteMetadataKey)
+	return value == "true"
+}
+
+// resumePositionFromContext returns the change feed position the client is
+// resuming from, or nil if no position is given.
+func resumePositionFromContext(ctx context.Context) (*registry.FeedPosition, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	value, ok := firstMetadataValue(md, ResumeMetadataKey)
+	if !ok {
+		return nil, nil
+	}
+	pos, err := registry.ParseFeedPosition(value)
+	if err != nil {
+		return nil, err
+	}
+	return &pos, nil
+}
+
+// namespaceFromContext returns the namespace in the incoming metadata, or
+// false if no namespace is given.
+func namespaceFromContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return firstMetadataValue(md, NamespaceMetadataKey)
+}
+
+// readNamespaceFromContext returns the namespace to read members from, which
+// is either a namespace, registry.AllNamespaces or registry.DefaultNamespace
+// if no namespace is given.
+func readNamespaceFromContext(ctx context.Context) (string, error) {
+	namespace, ok := namespaceFromContext(ctx)
+	if !ok {
+		return registry.DefaultNamespace, nil
+	}
+	if namespace == registry.AllNamespaces {
+		return namespace, nil
+	}
+	if err := registry.ValidateNamespace(namespace); err != nil {
+		return "", err
+	}
+	return namespace, nil
+}
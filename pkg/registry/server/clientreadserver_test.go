@@ -0,0 +1,98 @@
+package server_test
+
+import (
+	"context"
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientReadServer_MemberScopedByNamespace(t *testing.T) {
+	reg := registry.NewRegistry("local")
+	readServer := server.NewClientReadServer(reg)
+
+	require.NoError(t, reg.AddMember(registry.WithMemberNamespace(
+		testutils.RandomMemberState("staging-member", "foo"), "staging",
+	)))
+	require.NoError(t, reg.AddMember(
+		testutils.RandomMemberState("default-member", "foo"),
+	))
+
+	tests := []struct {
+		name      string
+		namespace string
+		id        string
+		found     bool
+	}{
+		{"default namespace", "", "default-member", true},
+		{"other namespace", "", "staging-member", false},
+		{"requested namespace", "staging", "staging-member", true},
+		{"outside requested namespace", "staging", "default-member", false},
+		{"all namespaces", registry.AllNamespaces, "staging-member", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.namespace != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(
+					server.NamespaceMetadataKey, tt.namespace,
+				))
+			}
+			resp, err := readServer.Member(ctx, &rpc.MemberRequest{Id: tt.id})
+			require.NoError(t, err)
+			if tt.found {
+				require.NotNil(t, resp.Member)
+				assert.Equal(t, tt.id, resp.Member.State.Id)
+			} else {
+				assert.Nil(t, resp.Member)
+			}
+		})
+	}
+
+	_, err := readServer.Member(
+		metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			server.NamespaceMetadataKey, "invalid namespace!",
+		)),
+		&rpc.MemberRequest{Id: "default-member"},
+	)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestClientReadServer_MemberExcludesRemote(t *testing.T) {
+	reg := registry.NewRegistry("local")
+	readServer := server.NewClientReadServer(reg)
+
+	remote := &rpc.Member2{
+		State:    registry.WithMemberCluster(testutils.RandomMemberState("remote-member", "foo"), "remote"),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote-node",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 10,
+			},
+		},
+	}
+	reg.RemoteUpdate(remote)
+
+	resp, err := readServer.Member(context.Background(), &rpc.MemberRequest{Id: "remote-member"})
+	require.NoError(t, err)
+	assert.Nil(t, resp.Member)
+
+	resp, err = readServer.Member(
+		metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			server.IncludeRemoteMetadataKey, "true",
+		)),
+		&rpc.MemberRequest{Id: "remote-member"},
+	)
+	require.NoError(t, err)
+	require.NotNil(t, resp.Member)
+	assert.Equal(t, "remote-member", resp.Member.State.Id)
+}
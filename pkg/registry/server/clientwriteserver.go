@@ -1,18 +1,54 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	"github.com/fuddle-io/fuddle/pkg/metrics"
 	"github.com/fuddle-io/fuddle/pkg/registry/registry"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+type ClientWriteServerMetrics struct {
+	InboundUpdates        *metrics.Counter
+	RegistrationsRejected *metrics.Counter
+}
+
+func NewClientWriteServerMetrics() *ClientWriteServerMetrics {
+	return &ClientWriteServerMetrics{
+		InboundUpdates: metrics.NewCounter(
+			"registry",
+			"updates.client.inbound",
+			[]string{"updatetype"},
+			"Number of inbound updates from the client",
+		),
+
+		RegistrationsRejected: metrics.NewCounter(
+			"registry",
+			"registrations.rejected",
+			[]string{"reason"},
+			"Number of client registrations rejected due to invalid member state",
+		),
+	}
+}
+
+func (m *ClientWriteServerMetrics) Register(collector metrics.Collector) {
+	collector.AddCounter(m.InboundUpdates)
+	collector.AddCounter(m.RegistrationsRejected)
+}
+
 // ClientWriteServer receives updates from external clients.
 type ClientWriteServer struct {
-	registry *registry.Registry
+	registry  *registry.Registry
+	validator *registry.MemberValidator
+	drainer   *Drainer
 
-	inboundUpdates *metrics.Counter
-	logger         *zap.Logger
+	metrics *ClientWriteServerMetrics
+	logger  *zap.Logger
 
 	rpc.UnimplementedClientWriteRegistryServer
 }
@@ -23,27 +59,107 @@ func NewClientWriteServer(reg *registry.Registry, opts ...Option) *ClientWriteSe
 		o.apply(options)
 	}
 
-	inboundUpdates := metrics.NewCounter(
-		"registry",
-		"updates.client.inbound",
-		[]string{"updatetype"},
-		"Number of inbound updates from the client",
-	)
+	metrics := NewClientWriteServerMetrics()
 	if options.collector != nil {
-		options.collector.AddCounter(inboundUpdates)
+		metrics.Register(options.collector)
+	}
+
+	validator := options.memberValidator
+	if validator == nil {
+		// Ignore the error as the default limits are always valid.
+		validator, _ = registry.NewMemberValidator(registry.DefaultMemberLimits())
 	}
 
 	return &ClientWriteServer{
-		registry:       reg,
-		inboundUpdates: inboundUpdates,
-		logger:         options.logger,
+		registry:  reg,
+		validator: validator,
+		drainer:   options.drainer,
+		metrics:   metrics,
+		logger:    options.logger,
 	}
 }
 
+func (s *ClientWriteServer) Metrics() *ClientWriteServerMetrics {
+	return s.metrics
+}
+
+// Register receives updates to the members registered by the client.
+//
+// Members are registered into the namespace in the stream metadata, or the
+// namespace in the members metadata if not given.
+//
+// Registered members are validated against the servers member limits. If
+// the member is invalid the stream is closed with an InvalidArgument status.
+// If an update doesn't follow the member lifecycle (such as a terminating
+// member becoming active) the stream is closed with a FailedPrecondition
+// status.
+//
+// When the node is draining, the stream is closed with an Unavailable status
+// and the address of another node to reconnect to in the
+// ReconnectMetadataKey trailer.
 func (s *ClientWriteServer) Register(stream rpc.ClientWriteRegistry_RegisterServer) error {
 	logger := s.logger.With(zap.String("rpc", "ClientWriteServer.Register"))
 	logger.Debug("register stream")
 
+	drain := s.drainer.track()
+	defer s.drainer.untrack(drain)
+
+	// Receive updates in the background so the stream can be closed while
+	// waiting for the next update.
+	guard := &registerGuard{}
+	registerErr := make(chan error, 1)
+	go func() {
+		registerErr <- s.register(stream, guard, logger)
+	}()
+
+	select {
+	case err := <-registerErr:
+		return err
+	case addr := <-drain.drained():
+		// The register goroutine may be blocked receiving from the stream,
+		// which only returns once the handler returns, so rather than wait
+		// for it to exit, stop it updating the registry.
+		guard.stop()
+
+		logger.Debug("node draining; closing stream", zap.String("reconnect", addr))
+		return drainedError(stream, addr)
+	}
+}
+
+// registerGuard stops the register goroutine updating the registry once the
+// Register handler has returned.
+type registerGuard struct {
+	stopped bool
+
+	// mu is a mutex protecting the fields above, and held while updating the
+	// registry so stop waits for any in progress update.
+	mu sync.Mutex
+}
+
+// do calls f unless the guard is stopped, returning whether f was called.
+func (g *registerGuard) do(f func()) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stopped {
+		return false
+	}
+	f()
+	return true
+}
+
+func (g *registerGuard) stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stopped = true
+}
+
+// register receives updates from the stream until the member unregisters,
+// the stream closes or the guard is stopped.
+func (s *ClientWriteServer) register(stream rpc.ClientWriteRegistry_RegisterServer, guard *registerGuard, logger *zap.Logger) error {
+	namespace, _ := namespaceFromContext(stream.Context())
+
 	m, err := stream.Recv()
 	if err != nil {
 		return nil
@@ -53,12 +169,23 @@ func (s *ClientWriteServer) Register(stream rpc.ClientWriteRegistry_RegisterServ
 		return nil
 	}
 
-	s.inboundUpdates.Inc(map[string]string{
+	s.metrics.InboundUpdates.Inc(map[string]string{
 		"updatetype": clientUpdateTypeToString(m.UpdateType),
 	})
 
-	member := m.Member
-	s.registry.AddMember(member)
+	member, err := s.validate(m.Member, namespace, logger)
+	if err != nil {
+		return err
+	}
+	// The first registration on the stream may be a member that restarted
+	// with the same ID, so its status doesn't have to follow the previous
+	// registration's lifecycle.
+	if !guard.do(func() { err = s.addMember(member, logger, registry.WithNewRegistration()) }) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
 	for {
 		m, err := stream.Recv()
@@ -66,22 +193,116 @@ func (s *ClientWriteServer) Register(stream rpc.ClientWriteRegistry_RegisterServ
 			return nil
 		}
 
-		s.inboundUpdates.Inc(map[string]string{
+		s.metrics.InboundUpdates.Inc(map[string]string{
 			"updatetype": clientUpdateTypeToString(m.UpdateType),
 		})
 
 		if m.UpdateType == rpc.ClientUpdateType_CLIENT_REGISTER {
-			member = m.Member
-			s.registry.AddMember(member)
+			member, err = s.validate(m.Member, namespace, logger)
+			if err != nil {
+				return err
+			}
+			if !guard.do(func() { err = s.addMember(member, logger) }) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
 		}
 
 		if m.UpdateType == rpc.ClientUpdateType_CLIENT_HEARTBEAT {
-			s.registry.MemberHeartbeat(member)
+			if !guard.do(func() { s.registry.MemberHeartbeat(member) }) {
+				return nil
+			}
 		}
 
 		if m.UpdateType == rpc.ClientUpdateType_CLIENT_UNREGISTER {
-			s.registry.RemoveMember(member.Id)
+			guard.do(func() { s.registry.RemoveMember(member.Id) })
 			return nil
 		}
 	}
 }
+
+// validate returns the member to register in the given namespace, or a gRPC
+// status error if the member is invalid.
+func (s *ClientWriteServer) validate(member *rpc.MemberState, namespace string, logger *zap.Logger) (*rpc.MemberState, error) {
+	err := s.validateNamespace(member, namespace)
+	if err == nil {
+		if namespace != "" {
+			member = registry.WithMemberNamespace(member, namespace)
+		}
+		err = s.validator.Validate(member)
+	}
+	if err == nil {
+		return member, nil
+	}
+
+	var validationErr *registry.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	s.metrics.RegistrationsRejected.Inc(map[string]string{
+		"reason": string(validationErr.Reason),
+	})
+	logger.Warn(
+		"rejected registration; invalid member",
+		zap.String("reason", string(validationErr.Reason)),
+		zap.Error(err),
+	)
+
+	return nil, status.Error(codes.InvalidArgument, err.Error())
+}
+
+// addMember adds the member to the registry, or returns a gRPC status error
+// if the update doesn't follow the member lifecycle or the member is owned by
+// a remote cluster.
+func (s *ClientWriteServer) addMember(member *rpc.MemberState, logger *zap.Logger, opts ...registry.Option) error {
+	err := s.registry.AddMember(member, opts...)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, registry.ErrFederatedMember) {
+		s.metrics.RegistrationsRejected.Inc(map[string]string{
+			"reason": "federated_member",
+		})
+		logger.Warn(
+			"rejected registration; member owned by remote cluster",
+			zap.Error(err),
+		)
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	if !errors.Is(err, registry.ErrInvalidTransition) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	s.metrics.RegistrationsRejected.Inc(map[string]string{
+		"reason": "invalid_transition",
+	})
+	logger.Warn(
+		"rejected registration; invalid lifecycle transition",
+		zap.Error(err),
+	)
+
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+// validateNamespace checks the namespace in the stream metadata doesn't
+// conflict with the namespace in the members metadata.
+func (s *ClientWriteServer) validateNamespace(member *rpc.MemberState, namespace string) error {
+	if member == nil || namespace == "" {
+		return nil
+	}
+	if ns, ok := member.Metadata[registry.NamespaceMetadataKey]; ok && ns != namespace {
+		return &registry.ValidationError{
+			Reason: registry.ValidationReasonNamespace,
+			Message: fmt.Sprintf(
+				"member namespace %q conflicts with stream namespace %q",
+				ns, namespace,
+			),
+		}
+	}
+	return nil
+}
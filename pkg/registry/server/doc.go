@@ -7,7 +7,8 @@
 // * Read/Write: The read server is used to stream updates to the registry in
 // the local node, and the write server is used to send updates to the registry
 //
-// The read servers and write servers are split since in the future can run the
-// read server on a read-only cache node as its just forwarding updates, and the
-// write server on a Fuddle node as it maintains updates.
+// The read servers and write servers are split so read-only cache nodes
+// (started with --mode=cache) only run the read server, as they are just
+// forwarding updates, whereas full nodes also run the write server as they
+// maintain updates.
 package server
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ReconnectMetadataKey is the gRPC trailer key containing the address of
+// another Fuddle node clients should reconnect to when their stream is closed
+// because the node is draining.
+const ReconnectMetadataKey = "fuddle-reconnect-addr"
+
+// drainBatches is the number of batches client streams are closed in when
+// draining.
+const drainBatches = 10
+
+// Drainer closes client streams gradually when the node is shutting down.
+//
+// If every stream were closed at once, all clients would reconnect to the
+// other nodes at the same time. Instead streams are closed in batches spread
+// over the drain window, and each closed stream is given the address of
+// another node to reconnect to so the clients are spread across the cluster.
+//
+// A nil Drainer never drains streams.
+type Drainer struct {
+	streams  map[*drainStream]struct{}
+	draining bool
+	hint     func() string
+
+	// mu protects the fields above.
+	mu sync.Mutex
+}
+
+func NewDrainer() *Drainer {
+	return &Drainer{
+		streams: make(map[*drainStream]struct{}),
+	}
+}
+
+// Drain closes the tracked client streams in batches spread over window,
+// returning once every stream has been closed. hint returns the address of
+// the node each closed stream should reconnect to, or an empty string if
+// there is no other node.
+//
+// If the context is cancelled, any remaining streams are closed immediately.
+// Streams that start after Drain is called are closed immediately.
+func (d *Drainer) Drain(ctx context.Context, window time.Duration, hint func() string) {
+	d.mu.Lock()
+	d.draining = true
+	d.hint = hint
+	var streams []*drainStream
+	for s := range d.streams {
+		streams = append(streams, s)
+	}
+	d.streams = make(map[*drainStream]struct{})
+	d.mu.Unlock()
+
+	batches := drainBatches
+	if len(streams) < batches {
+		batches = len(streams)
+	}
+	if batches == 0 {
+		return
+	}
+	interval := window / time.Duration(batches)
+
+	for i := 0; i != batches; i++ {
+		start := i * len(streams) / batches
+		end := (i + 1) * len(streams) / batches
+		for _, s := range streams[start:end] {
+			s.close(hint())
+		}
+
+		if i == batches-1 {
+			break
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			for _, s := range streams[end:] {
+				s.close(hint())
+			}
+			return
+		}
+	}
+}
+
+// track adds a client stream to be drained. The stream must be untracked
+// when it closes.
+func (d *Drainer) track() *drainStream {
+	s := &drainStream{
+		ch: make(chan string, 1),
+	}
+	if d == nil {
+		return s
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		s.close(d.hint())
+		return s
+	}
+	d.streams[s] = struct{}{}
+	return s
+}
+
+func (d *Drainer) untrack(s *drainStream) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.streams, s)
+}
+
+type drainStream struct {
+	// ch receives the address to reconnect to when the stream should be
+	// closed.
+	ch chan string
+}
+
+// drained returns a channel that receives the address the client should
+// reconnect to when the stream should be closed.
+func (s *drainStream) drained() <-chan string {
+	return s.ch
+}
+
+func (s *drainStream) close(addr string) {
+	s.ch <- addr
+}
+
+// drainedError sets the reconnect address in the stream trailer and returns
+// the status to close the stream with.
+func drainedError(stream grpc.ServerStream, addr string) error {
+	if addr != "" {
+		stream.SetTrailer(metadata.Pairs(ReconnectMetadataKey, addr))
+	}
+	return status.Error(codes.Unavailable, "node draining")
+}
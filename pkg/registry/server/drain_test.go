@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainer_DrainInBatches(t *testing.T) {
+	d := NewDrainer()
+
+	var streams []*drainStream
+	for i := 0; i != 20; i++ {
+		streams = append(streams, d.track())
+	}
+
+	start := time.Now()
+	d.Drain(context.Background(), time.Millisecond*200, func() string {
+		return "10.26.104.52:8110"
+	})
+	// The last batch is closed at the start of the final interval.
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*180)
+
+	for _, s := range streams {
+		select {
+		case addr := <-s.drained():
+			assert.Equal(t, "10.26.104.52:8110", addr)
+		default:
+			t.Error("stream not drained")
+		}
+	}
+}
+
+func TestDrainer_DrainCancelled(t *testing.T) {
+	d := NewDrainer()
+
+	var streams []*drainStream
+	for i := 0; i != 20; i++ {
+		streams = append(streams, d.track())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Once cancelled the remaining streams should be closed immediately.
+	start := time.Now()
+	d.Drain(ctx, time.Minute, func() string {
+		return ""
+	})
+	assert.Less(t, time.Since(start), time.Second)
+
+	for _, s := range streams {
+		select {
+		case <-s.drained():
+		default:
+			t.Error("stream not drained")
+		}
+	}
+}
+
+func TestDrainer_TrackWhileDraining(t *testing.T) {
+	d := NewDrainer()
+	d.Drain(context.Background(), time.Second, func() string {
+		return "10.26.104.52:8110"
+	})
+
+	s := d.track()
+	select {
+	case addr := <-s.drained():
+		assert.Equal(t, "10.26.104.52:8110", addr)
+	default:
+		t.Error("stream not drained")
+	}
+}
+
+func TestDrainer_Untrack(t *testing.T) {
+	d := NewDrainer()
+
+	s := d.track()
+	d.untrack(s)
+
+	d.Drain(context.Background(), time.Second, func() string {
+		return ""
+	})
+
+	select {
+	case <-s.drained():
+		t.Error("untracked stream drained")
+	default:
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Subscribers can resume from the registry change feed (see
+// registry.SubscribeFeed) rather than diffing their known members with the
+// whole registry when they reconnect. Since the SubscribeRequest and Member2
+// messages don't include sequence numbers:
+//
+//   - The server sends the feed position the subscriber will have reached once
+//     it receives the initial updates in the FeedPositionMetadataKey header,
+//     and whether it resumed from the feed in the ResumedMetadataKey header.
+//   - Each update includes its sequence number in the feed as an unknown
+//     field (SequenceFieldNumber), which clients that don't support resuming
+//     ignore. Updates without a sequence number don't advance the subscribers
+//     position.
+//   - When reconnecting, the client sends the position of the last update it
+//     received in ResumeMetadataKey. If the server can't resume from that
+//     position, such as the feed has been truncated or the server restarted,
+//     it falls back to sending the updates the client is missing given the
+//     known members in the request.
+const (
+	ResumeMetadataKey       = "fuddle-resume"
+	FeedPositionMetadataKey = "fuddle-feed-position"
+	ResumedMetadataKey      = "fuddle-resumed"
+
+	// SequenceFieldNumber is the field number of the feed sequence number in
+	// Member2 updates. This must not conflict with the fields in Member2.
+	SequenceFieldNumber protowire.Number = 1000
+)
+
+// WithUpdateSequence returns a copy of the update with the given feed sequence
+// number. The member state isn't copied so must not be modified.
+func WithUpdateSequence(update *rpc.Member2, seq uint64) *rpc.Member2 {
+	sequenced := &rpc.Member2{
+		State:    update.State,
+		Liveness: update.Liveness,
+		Version:  update.Version,
+		Expiry:   update.Expiry,
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, SequenceFieldNumber, protowire.VarintType)
+	b = protowire.AppendVarint(b, seq)
+	sequenced.ProtoReflect().SetUnknown(b)
+	return sequenced
+}
+
+// UpdateSequence returns the feed sequence number of the update, or false if
+// the update doesn't have a sequence number.
+func UpdateSequence(update *rpc.Member2) (uint64, bool) {
+	b := update.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return 0, false
+		}
+		b = b[n:]
+
+		if num == SequenceFieldNumber && typ == protowire.VarintType {
+			seq, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return 0, false
+			}
+			return seq, true
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return 0, false
+		}
+		b = b[n:]
+	}
+	return 0, false
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// Tests the update sequence number is preserved when the update is encoded,
+// and ignored by clients that don't read it.
+func TestFeed_UpdateSequence(t *testing.T) {
+	update := &rpc.Member2{
+		State: &rpc.MemberState{
+			Id: "member-1",
+		},
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "local",
+		},
+	}
+
+	_, ok := UpdateSequence(update)
+	assert.False(t, ok)
+
+	b, err := proto.Marshal(WithUpdateSequence(update, 1234))
+	require.NoError(t, err)
+
+	var decoded rpc.Member2
+	require.NoError(t, proto.Unmarshal(b, &decoded))
+
+	seq, ok := UpdateSequence(&decoded)
+	require.True(t, ok)
+	assert.Equal(t, uint64(1234), seq)
+	assert.Equal(t, "member-1", decoded.State.Id)
+	assert.Equal(t, rpc.Liveness_UP, decoded.Liveness)
+
+	// The original update must not be modified.
+	_, ok = UpdateSequence(update)
+	assert.False(t, ok)
+}
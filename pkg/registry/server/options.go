@@ -2,18 +2,27 @@ package server
 
 import (
 	"github.com/fuddle-io/fuddle/pkg/metrics"
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
 	"go.uber.org/zap"
 )
 
 type options struct {
-	collector metrics.Collector
-	logger    *zap.Logger
+	subscriberQueueLimit int
+	overflowPolicy       registry.OverflowPolicy
+	memberValidator      *registry.MemberValidator
+	drainer              *Drainer
+	collector            metrics.Collector
+	logger               *zap.Logger
 }
 
 func defaultOptions() *options {
 	return &options{
-		collector: nil,
-		logger:    zap.NewNop(),
+		subscriberQueueLimit: 1024,
+		overflowPolicy:       registry.OverflowPolicyDisconnect,
+		memberValidator:      nil,
+		drainer:              nil,
+		collector:            nil,
+		logger:               zap.NewNop(),
 	}
 }
 
@@ -21,6 +30,61 @@ type Option interface {
 	apply(*options)
 }
 
+type subscriberQueueLimitOption struct {
+	limit int
+}
+
+func (o subscriberQueueLimitOption) apply(opts *options) {
+	opts.subscriberQueueLimit = o.limit
+}
+
+// WithSubscriberQueueLimit sets the maximum number of updates queued for each
+// client subscriber before the overflow policy is applied.
+func WithSubscriberQueueLimit(limit int) Option {
+	return subscriberQueueLimitOption{limit: limit}
+}
+
+type overflowPolicyOption struct {
+	policy registry.OverflowPolicy
+}
+
+func (o overflowPolicyOption) apply(opts *options) {
+	opts.overflowPolicy = o.policy
+}
+
+// WithOverflowPolicy sets how to handle client subscribers whose queue is full.
+func WithOverflowPolicy(policy registry.OverflowPolicy) Option {
+	return overflowPolicyOption{policy: policy}
+}
+
+type memberValidatorOption struct {
+	validator *registry.MemberValidator
+}
+
+func (o memberValidatorOption) apply(opts *options) {
+	opts.memberValidator = o.validator
+}
+
+// WithMemberValidator sets the validator used to reject invalid client
+// registrations. Defaults to validating with registry.DefaultMemberLimits.
+func WithMemberValidator(v *registry.MemberValidator) Option {
+	return memberValidatorOption{validator: v}
+}
+
+type drainerOption struct {
+	drainer *Drainer
+}
+
+func (o drainerOption) apply(opts *options) {
+	opts.drainer = o.drainer
+}
+
+// WithDrainer sets the drainer used to close client streams when the node
+// shuts down. If not set client streams aren't drained.
+func WithDrainer(d *Drainer) Option {
+	return drainerOption{drainer: d}
+}
+
 type collectorOption struct {
 	collector metrics.Collector
 }
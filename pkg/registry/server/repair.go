@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Replica repair compares the Merkle trees of two nodes before exchanging
+// member versions. Since the ReplicaSyncRequest and ReplicaSyncResponse
+// messages only contain member versions, the tree is exchanged using gRPC
+// metadata on the Sync RPC:
+//
+//   - To request the tree hashes at a level, the client sends the level in
+//     RepairLevelMetadataKey and the parent nodes to expand in
+//     RepairParentsMetadataKey. The server responds with the hashes of the
+//     children of those parents in the RepairHashesMetadataKey header.
+//   - Once the client has found the mismatched buckets, it sends the versions
+//     of its members in those buckets as the request digest, with the bucket
+//     indexes in RepairBucketsMetadataKey. The server responds with the
+//     members in those buckets the client is missing or are out of date.
+//
+// Servers that don't support tree repair ignore the metadata, so the client
+// falls back to a digest sync if the server doesn't respond with hashes.
+const (
+	RepairLevelMetadataKey   = "fuddle-repair-level"
+	RepairParentsMetadataKey = "fuddle-repair-parents"
+	RepairHashesMetadataKey  = "fuddle-repair-hashes-bin"
+	RepairBucketsMetadataKey = "fuddle-repair-buckets"
+)
+
+// EncodeTreeHashes encodes the hashes as a binary metadata value.
+func EncodeTreeHashes(hashes []uint64) string {
+	b := make([]byte, 8*len(hashes))
+	for i, h := range hashes {
+		binary.BigEndian.PutUint64(b[i*8:], h)
+	}
+	return string(b)
+}
+
+// DecodeTreeHashes decodes hashes encoded with EncodeTreeHashes.
+func DecodeTreeHashes(s string) ([]uint64, error) {
+	if len(s)%8 != 0 {
+		return nil, fmt.Errorf("decode tree hashes: invalid length: %d", len(s))
+	}
+	b := []byte(s)
+	hashes := make([]uint64, len(b)/8)
+	for i := range hashes {
+		hashes[i] = binary.BigEndian.Uint64(b[i*8:])
+	}
+	return hashes, nil
+}
+
+// EncodeTreeIndexes encodes the tree node indexes as a metadata value.
+func EncodeTreeIndexes(indexes []int) string {
+	s := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		s = append(s, strconv.Itoa(index))
+	}
+	return strings.Join(s, ",")
+}
+
+// DecodeTreeIndexes decodes indexes encoded with EncodeTreeIndexes.
+func DecodeTreeIndexes(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var indexes []int
+	for _, v := range strings.Split(s, ",") {
+		index, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("decode tree indexes: %w", err)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// MetadataSize returns the approximate number of bytes used to encode the
+// metadata.
+func MetadataSize(md metadata.MD) int {
+	size := 0
+	for k, values := range md {
+		for _, v := range values {
+			size += len(k) + len(v)
+		}
+	}
+	return size
+}
+
+func firstMetadataValue(md metadata.MD, key string) (string, bool) {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
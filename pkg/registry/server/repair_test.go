@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepair_EncodeTreeHashes(t *testing.T) {
+	hashes := []uint64{0, 1, 0xffffffffffffffff, 1234567890}
+
+	decoded, err := DecodeTreeHashes(EncodeTreeHashes(hashes))
+	require.NoError(t, err)
+	assert.Equal(t, hashes, decoded)
+
+	_, err = DecodeTreeHashes("abc")
+	assert.Error(t, err)
+}
+
+func TestRepair_EncodeTreeIndexes(t *testing.T) {
+	indexes := []int{0, 12, 4095}
+
+	decoded, err := DecodeTreeIndexes(EncodeTreeIndexes(indexes))
+	require.NoError(t, err)
+	assert.Equal(t, indexes, decoded)
+
+	decoded, err = DecodeTreeIndexes("")
+	require.NoError(t, err)
+	assert.Empty(t, decoded)
+
+	_, err = DecodeTreeIndexes("1,a")
+	assert.Error(t, err)
+}
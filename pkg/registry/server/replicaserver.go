@@ -2,16 +2,26 @@ package server
 
 import (
 	"context"
+	"strconv"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	"github.com/fuddle-io/fuddle/pkg/metrics"
 	"github.com/fuddle-io/fuddle/pkg/registry/registry"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type ReplicaServerMetrics struct {
 	ReplicaUpdatesInbound *metrics.Counter
 	RepairUpdatesOutbound *metrics.Counter
+	RepairBytesOutbound   *metrics.Counter
+
+	ReplicaBatchesInbound *metrics.Counter
+	ReplicaBytesInbound   *metrics.Counter
 }
 
 func NewReplicaServerMetrics() *ReplicaServerMetrics {
@@ -29,12 +39,35 @@ func NewReplicaServerMetrics() *ReplicaServerMetrics {
 			[]string{"target"},
 			"Number of outbound updates from replica repair",
 		),
+
+		RepairBytesOutbound: metrics.NewCounter(
+			"registry",
+			"repair.bytes.outbound",
+			[]string{"target"},
+			"Number of bytes sent in response to replica repair",
+		),
+
+		ReplicaBatchesInbound: metrics.NewCounter(
+			"registry",
+			"replica.batches.inbound",
+			[]string{"source"},
+			"Number of inbound batches of updates received on replica streams",
+		),
+		ReplicaBytesInbound: metrics.NewCounter(
+			"registry",
+			"replica.bytes.inbound",
+			[]string{"source"},
+			"Number of bytes of updates received on replica streams",
+		),
 	}
 }
 
 func (m *ReplicaServerMetrics) Register(collector metrics.Collector) {
 	collector.AddCounter(m.ReplicaUpdatesInbound)
 	collector.AddCounter(m.RepairUpdatesOutbound)
+	collector.AddCounter(m.RepairBytesOutbound)
+	collector.AddCounter(m.ReplicaBatchesInbound)
+	collector.AddCounter(m.ReplicaBytesInbound)
 }
 
 type ReplicaServer struct {
@@ -77,14 +110,66 @@ func (s *ReplicaServer) Update(ctx context.Context, req *rpc.UpdateRequest) (*rp
 	return &rpc.UpdateResponse{}, nil
 }
 
+// Sync handles replica repair requests from other nodes. See repair.go for
+// how the Merkle tree is exchanged.
 func (s *ReplicaServer) Sync(ctx context.Context, req *rpc.ReplicaSyncRequest) (*rpc.ReplicaSyncResponse, error) {
-	delta := s.registry.Delta(req.Digest)
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if level, ok := firstMetadataValue(md, RepairLevelMetadataKey); ok {
+		return s.syncTree(ctx, req, level, md)
+	}
+
+	var delta []*rpc.Member2
+	if v, ok := firstMetadataValue(md, RepairBucketsMetadataKey); ok {
+		buckets, err := DecodeTreeIndexes(v)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		delta = s.registry.BucketDelta(buckets, req.Digest)
+	} else {
+		delta = s.registry.Delta(req.Digest)
+	}
 
 	s.metrics.RepairUpdatesOutbound.Add(len(delta), map[string]string{
 		"target": req.SourceNodeId,
 	})
 
-	return &rpc.ReplicaSyncResponse{
+	resp := &rpc.ReplicaSyncResponse{
 		Members: delta,
-	}, nil
+	}
+	s.metrics.RepairBytesOutbound.Add(proto.Size(resp), map[string]string{
+		"target": req.SourceNodeId,
+	})
+	return resp, nil
+}
+
+// syncTree responds with the hashes of the Merkle tree nodes at the requested
+// level in the response header.
+func (s *ReplicaServer) syncTree(ctx context.Context, req *rpc.ReplicaSyncRequest, levelValue string, md metadata.MD) (*rpc.ReplicaSyncResponse, error) {
+	level, err := strconv.Atoi(levelValue)
+	if err != nil || level < 0 || level >= registry.TreeLevels {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid tree level: %s", levelValue)
+	}
+
+	var parents []int
+	if v, ok := firstMetadataValue(md, RepairParentsMetadataKey); ok {
+		parents, err = DecodeTreeIndexes(v)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	header := metadata.Pairs(
+		RepairHashesMetadataKey,
+		EncodeTreeHashes(s.registry.TreeHashes(level, parents)),
+	)
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		return nil, status.Errorf(codes.Internal, "set header: %s", err)
+	}
+
+	s.metrics.RepairBytesOutbound.Add(MetadataSize(header), map[string]string{
+		"target": req.SourceNodeId,
+	})
+
+	return &rpc.ReplicaSyncResponse{}, nil
 }
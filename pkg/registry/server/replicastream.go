@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"io"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Replicas forward updates over a long-lived bidirectional stream, which
+// batches updates rather than sending an Update RPC per member. Since the rpc
+// package doesn't define a streaming replica RPC, the stream is registered as
+// its own service using the existing message types:
+//
+//   - The client sends batches of member updates as rpc.ReplicaSyncResponse
+//     messages, with the source node ID in ReplicaSourceMetadataKey.
+//   - The server acknowledges each batch once it has been applied with an
+//     rpc.ClientAck, where SeqId is the number of batches received on the
+//     stream. Since the stream is ordered, an ack also acknowledges all earlier
+//     batches.
+//
+// Nodes that don't register the stream respond with Unimplemented, so the
+// client falls back to the unary Update RPC.
+//
+// A node shutting down gracefully also uses the stream to hand off ownership
+// of its members, setting ReplicaHandoffMetadataKey so the updates are applied
+// with registry.AcceptHandoff rather than registry.RemoteUpdate.
+const (
+	ReplicaStreamServiceName  = "registry.ReplicaStream"
+	ReplicaStreamMethod       = "/registry.ReplicaStream/Replicate"
+	ReplicaSourceMetadataKey  = "fuddle-replica-source"
+	ReplicaHandoffMetadataKey = "fuddle-replica-handoff"
+)
+
+// ReplicaStreamServer is the server API for the replica stream service.
+type ReplicaStreamServer interface {
+	Replicate(stream grpc.ServerStream) error
+}
+
+// ReplicaStreamDesc describes the replica stream for clients opening the
+// stream with grpc.ClientConn.NewStream.
+var ReplicaStreamDesc = grpc.StreamDesc{
+	StreamName:    "Replicate",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+var replicaStreamServiceDesc = grpc.ServiceDesc{
+	ServiceName: ReplicaStreamServiceName,
+	HandlerType: (*ReplicaStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    ReplicaStreamDesc.StreamName,
+			Handler:       replicateHandler,
+			ServerStreams: ReplicaStreamDesc.ServerStreams,
+			ClientStreams: ReplicaStreamDesc.ClientStreams,
+		},
+	},
+}
+
+// RegisterReplicaStreamServer registers the replica stream service with the
+// gRPC server.
+func RegisterReplicaStreamServer(s grpc.ServiceRegistrar, srv ReplicaStreamServer) {
+	s.RegisterService(&replicaStreamServiceDesc, srv)
+}
+
+func replicateHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ReplicaStreamServer).Replicate(stream)
+}
+
+// Replicate receives batches of member updates from another node and
+// acknowledges each batch once it has been applied to the registry.
+func (s *ReplicaServer) Replicate(stream grpc.ServerStream) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	source, _ := firstMetadataValue(md, ReplicaSourceMetadataKey)
+	_, handoff := firstMetadataValue(md, ReplicaHandoffMetadataKey)
+
+	labels := map[string]string{
+		"source": source,
+	}
+
+	var seq uint64
+	for {
+		batch := &rpc.ReplicaSyncResponse{}
+		if err := stream.RecvMsg(batch); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		seq++
+
+		s.metrics.ReplicaUpdatesInbound.Add(len(batch.Members), labels)
+		s.metrics.ReplicaBatchesInbound.Inc(labels)
+		s.metrics.ReplicaBytesInbound.Add(proto.Size(batch), labels)
+
+		for _, m := range batch.Members {
+			if handoff {
+				s.registry.AcceptHandoff(m)
+			} else {
+				s.registry.RemoteUpdate(m)
+			}
+		}
+
+		if err := stream.SendMsg(&rpc.ClientAck{SeqId: seq}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,504 @@
+// Package storage persists the registry state to disk so a restarted node can
+// recover its registry without waiting for replica repair.
+//
+// The storage contains a snapshot file with the full registry state at the
+// time of the last compaction, and a write-ahead log (WAL) of every update
+// applied since that snapshot. To recover, the snapshot is loaded then the WAL
+// is replayed on top.
+//
+// While a snapshot is being written, the WAL from before the snapshot is kept
+// in a separate file until the snapshot is complete, so updates can continue
+// to be written to a new WAL without waiting for the snapshot.
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	snapshotFileName = "snapshot"
+	walFileName      = "wal"
+	// walOldFileName is the WAL from before an in progress snapshot.
+	walOldFileName = "wal.old"
+
+	// recordHeaderSize is the size of the record header, containing the
+	// payload length and CRC.
+	recordHeaderSize = 8
+
+	// maxRecordSize is the maximum size of a record body. Members are much
+	// smaller than this, so a larger length means the header is corrupt.
+	maxRecordSize = 16 << 20
+)
+
+type recordType byte
+
+const (
+	recordTypeUpsert recordType = 1
+	recordTypeDelete recordType = 2
+)
+
+var (
+	errCorruptRecord = errors.New("corrupt record")
+)
+
+// Storage persists registry updates to a data directory.
+//
+// Updates are written to the WAL without an fsync, so a crashed host (rather
+// than a crashed process) may lose the most recent updates, which will be
+// recovered from other replicas by replica repair. The WAL is only synced on
+// RotateWAL and Close.
+type Storage struct {
+	dir string
+
+	wal       *os.File
+	walWriter *bufio.Writer
+	// walEntries is the number of entries written to the WAL since the last
+	// snapshot.
+	walEntries int
+
+	// snapshotting is true between RotateWAL and Snapshot.
+	snapshotting bool
+
+	closed bool
+
+	// mu is a mutex protecting the fields above.
+	mu sync.Mutex
+
+	logger *zap.Logger
+}
+
+// Open opens the storage in the given data directory, creating the directory
+// if it doesn't exist.
+func Open(dir string, opts ...Option) (*Storage, error) {
+	options := defaultOptions()
+	for _, o := range opts {
+		o.apply(options)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("storage: open: %w", err)
+	}
+
+	wal, err := os.OpenFile(
+		filepath.Join(dir, walFileName),
+		os.O_CREATE|os.O_RDWR|os.O_APPEND,
+		0o644,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("storage: open: %w", err)
+	}
+
+	return &Storage{
+		dir:       dir,
+		wal:       wal,
+		walWriter: bufio.NewWriter(wal),
+		logger:    options.logger,
+	}, nil
+}
+
+// Load reads the persisted members, by loading the last snapshot and replaying
+// the WAL on top.
+//
+// If the WAL ends with a partially written record (such as the process
+// crashed mid-write), the WAL is truncated to the last complete record.
+func (s *Storage) Load() ([]*rpc.Member2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := make(map[string]*rpc.Member2)
+
+	snapshot, err := os.Open(filepath.Join(s.dir, snapshotFileName))
+	if err == nil {
+		_, _, err = readRecords(snapshot, members)
+		snapshot.Close()
+		if err != nil {
+			return nil, fmt.Errorf("storage: load: snapshot: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("storage: load: snapshot: %w", err)
+	}
+
+	snapshotMembers := len(members)
+
+	// If the node stopped while writing a snapshot, the old WAL contains the
+	// updates from before the snapshot that aren't in the last complete
+	// snapshot. Its records were synced before the snapshot started, so there
+	// is no partially written record to truncate.
+	walOld, err := os.Open(filepath.Join(s.dir, walOldFileName))
+	if err == nil {
+		_, _, err = readRecords(walOld, members)
+		walOld.Close()
+		if err != nil {
+			return nil, fmt.Errorf("storage: load: old wal: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("storage: load: old wal: %w", err)
+	}
+
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("storage: load: wal: %w", err)
+	}
+	n, offset, err := readRecords(s.wal, members)
+	if err != nil {
+		if !errors.Is(err, errCorruptRecord) {
+			return nil, fmt.Errorf("storage: load: wal: %w", err)
+		}
+
+		s.logger.Warn(
+			"wal contains corrupt record; truncating",
+			zap.Int64("offset", offset),
+		)
+
+		if err := s.wal.Truncate(offset); err != nil {
+			return nil, fmt.Errorf("storage: load: wal: %w", err)
+		}
+	}
+	s.walEntries = n
+
+	s.logger.Info(
+		"loaded registry state",
+		zap.Int("snapshot-members", snapshotMembers),
+		zap.Int("wal-entries", n),
+		zap.Int("members", len(members)),
+	)
+
+	loaded := make([]*rpc.Member2, 0, len(members))
+	for _, m := range members {
+		loaded = append(loaded, m)
+	}
+	return loaded, nil
+}
+
+// Upsert appends an update for the given member to the WAL.
+func (s *Storage) Upsert(m *rpc.Member2) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("storage: upsert: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.appendLocked(recordTypeUpsert, b); err != nil {
+		return fmt.Errorf("storage: upsert: %w", err)
+	}
+	return nil
+}
+
+// Delete appends a removal of the member with the given ID to the WAL.
+func (s *Storage) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.appendLocked(recordTypeDelete, []byte(id)); err != nil {
+		return fmt.Errorf("storage: delete: %w", err)
+	}
+	return nil
+}
+
+// WALEntries returns the number of entries in the WAL since the last snapshot.
+func (s *Storage) WALEntries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.walEntries
+}
+
+// RotateWAL starts compacting the storage by moving the WAL aside, so updates
+// written after RotateWAL go to a new WAL. The caller must then call Snapshot
+// with the members at the time of the rotation, which discards the old WAL.
+//
+// The caller must prevent concurrent updates while rotating the WAL and
+// reading the members to snapshot, though not while writing the snapshot.
+func (s *Storage) RotateWAL() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("storage: rotate wal: closed")
+	}
+	if s.snapshotting {
+		return fmt.Errorf("storage: rotate wal: snapshot in progress")
+	}
+
+	// Sync the WAL first so the old WAL is complete if we crash before the
+	// snapshot is written.
+	if err := s.syncLocked(); err != nil {
+		return fmt.Errorf("storage: rotate wal: %w", err)
+	}
+
+	walPath := filepath.Join(s.dir, walFileName)
+	walOldPath := filepath.Join(s.dir, walOldFileName)
+
+	// If a previous snapshot failed the old WAL still contains updates that
+	// aren't in the last snapshot, so rather than replace it, append the
+	// current WAL to it.
+	if _, err := os.Stat(walOldPath); err == nil {
+		if err := s.appendToOldWALLocked(walOldPath); err != nil {
+			return fmt.Errorf("storage: rotate wal: %w", err)
+		}
+		s.walEntries = 0
+		s.snapshotting = true
+		return nil
+	}
+
+	if err := os.Rename(walPath, walOldPath); err != nil {
+		return fmt.Errorf("storage: rotate wal: %w", err)
+	}
+	wal, err := os.OpenFile(walPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		// Restore the WAL so updates continue to be appended to it.
+		if renameErr := os.Rename(walOldPath, walPath); renameErr != nil {
+			s.logger.Error("failed to restore wal", zap.Error(renameErr))
+		}
+		return fmt.Errorf("storage: rotate wal: %w", err)
+	}
+	s.wal.Close()
+
+	s.wal = wal
+	s.walWriter.Reset(wal)
+	s.walEntries = 0
+	s.snapshotting = true
+
+	return nil
+}
+
+// Snapshot writes the given members as the new snapshot and discards the WAL
+// from before the last RotateWAL.
+//
+// The members must contain the full registry state at the time RotateWAL was
+// called, including every update written to the WAL before it.
+func (s *Storage) Snapshot(members []*rpc.Member2) error {
+	s.mu.Lock()
+	if !s.snapshotting {
+		s.mu.Unlock()
+		return fmt.Errorf("storage: snapshot: wal not rotated")
+	}
+	s.mu.Unlock()
+
+	// Whether or not the snapshot succeeds the next snapshot must start by
+	// rotating the WAL again. If the snapshot fails the old WAL is kept.
+	defer func() {
+		s.mu.Lock()
+		s.snapshotting = false
+		s.mu.Unlock()
+	}()
+
+	tmpPath := filepath.Join(s.dir, snapshotFileName+".tmp")
+	if err := writeSnapshot(tmpPath, members); err != nil {
+		return fmt.Errorf("storage: snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("storage: snapshot: %w", err)
+	}
+
+	// If we crash before removing the old WAL, replaying it on top of the new
+	// snapshot gives the same state.
+	if err := os.Remove(filepath.Join(s.dir, walOldFileName)); err != nil {
+		return fmt.Errorf("storage: snapshot: remove old wal: %w", err)
+	}
+
+	s.logger.Debug("snapshot", zap.Int("members", len(members)))
+
+	return nil
+}
+
+// Close flushes any buffered WAL entries and closes the storage.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	if err := s.syncLocked(); err != nil {
+		s.wal.Close()
+		return fmt.Errorf("storage: close: %w", err)
+	}
+	if err := s.wal.Close(); err != nil {
+		return fmt.Errorf("storage: close: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) appendLocked(t recordType, payload []byte) error {
+	if s.closed {
+		return fmt.Errorf("closed")
+	}
+
+	if err := writeRecord(s.walWriter, t, payload); err != nil {
+		return err
+	}
+	// Flush to the OS on every write so updates are not lost if the process
+	// crashes.
+	if err := s.walWriter.Flush(); err != nil {
+		return err
+	}
+	s.walEntries++
+	return nil
+}
+
+// appendToOldWALLocked appends the records in the WAL to the old WAL at the
+// given path, then truncates the WAL.
+func (s *Storage) appendToOldWALLocked(path string) error {
+	walOld, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer walOld.Close()
+
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(walOld, s.wal); err != nil {
+		return err
+	}
+	if err := walOld.Sync(); err != nil {
+		return err
+	}
+	return s.wal.Truncate(0)
+}
+
+func (s *Storage) syncLocked() error {
+	if err := s.walWriter.Flush(); err != nil {
+		return err
+	}
+	return s.wal.Sync()
+}
+
+func writeSnapshot(path string, members []*rpc.Member2) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, m := range members {
+		b, err := proto.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err := writeRecord(w, recordTypeUpsert, b); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// writeRecord writes a record with format:
+//
+//	| length (4 bytes) | crc (4 bytes) | type (1 byte) | payload |
+//
+// Where the length and CRC cover both the type and the payload.
+func writeRecord(w io.Writer, t recordType, payload []byte) error {
+	body := make([]byte, 1+len(payload))
+	body[0] = byte(t)
+	copy(body[1:], payload)
+
+	header := make([]byte, recordHeaderSize)
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(body))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readRecord reads the next record, returning io.EOF if there are no more
+// records or errCorruptRecord if the record is incomplete, exceeds the
+// maximum record size or fails the CRC check.
+func readRecord(r io.Reader) (recordType, []byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, errCorruptRecord
+		}
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	crc := binary.BigEndian.Uint32(header[4:8])
+	if length == 0 || length > maxRecordSize {
+		return 0, nil, errCorruptRecord
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, nil, errCorruptRecord
+		}
+		return 0, nil, err
+	}
+	if crc32.ChecksumIEEE(body) != crc {
+		return 0, nil, errCorruptRecord
+	}
+
+	return recordType(body[0]), body[1:], nil
+}
+
+// applyRecord applies the record to the given members.
+func applyRecord(t recordType, payload []byte, members map[string]*rpc.Member2) error {
+	switch t {
+	case recordTypeUpsert:
+		var m rpc.Member2
+		if err := proto.Unmarshal(payload, &m); err != nil {
+			return errCorruptRecord
+		}
+		if m.State == nil || m.Version == nil || m.Version.Timestamp == nil {
+			return errCorruptRecord
+		}
+		members[m.State.Id] = &m
+	case recordTypeDelete:
+		delete(members, string(payload))
+	default:
+		return errCorruptRecord
+	}
+	return nil
+}
+
+// readRecords applies all records in r to the given members. It returns the
+// number of records read and the offset of the end of the last valid record.
+func readRecords(r io.Reader, members map[string]*rpc.Member2) (int, int64, error) {
+	br := bufio.NewReader(r)
+	n := 0
+	var offset int64
+	for {
+		t, payload, err := readRecord(br)
+		if err == io.EOF {
+			return n, offset, nil
+		}
+		if err != nil {
+			return n, offset, err
+		}
+		if err := applyRecord(t, payload, members); err != nil {
+			return n, offset, err
+		}
+		n++
+		offset += int64(recordHeaderSize + 1 + len(payload))
+	}
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStorage_LoadEmpty(t *testing.T) {
+	s, err := Open(t.TempDir())
+	require.NoError(t, err)
+	defer s.Close()
+
+	members, err := s.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(members))
+}
+
+func TestStorage_ReplayWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	require.NoError(t, err)
+
+	m1 := randomMember("member-1", 1)
+	m2 := randomMember("member-2", 2)
+	m3 := randomMember("member-3", 3)
+	updatedM1 := randomMember("member-1", 4)
+	require.NoError(t, s.Upsert(m1))
+	require.NoError(t, s.Upsert(m2))
+	require.NoError(t, s.Upsert(m3))
+	require.NoError(t, s.Upsert(updatedM1))
+	require.NoError(t, s.Delete("member-2"))
+	require.NoError(t, s.Close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	members, err := s.Load()
+	require.NoError(t, err)
+	assertMembersEqual(t, []*rpc.Member2{updatedM1, m3}, members)
+	assert.Equal(t, 5, s.WALEntries())
+}
+
+func TestStorage_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	require.NoError(t, err)
+
+	m1 := randomMember("member-1", 1)
+	m2 := randomMember("member-2", 2)
+	require.NoError(t, s.Upsert(m1))
+	require.NoError(t, s.Upsert(m2))
+	require.NoError(t, s.RotateWAL())
+	assert.Equal(t, 0, s.WALEntries())
+
+	// Updates while the snapshot is written go to the new WAL.
+	m3 := randomMember("member-3", 3)
+	require.NoError(t, s.Upsert(m3))
+	require.NoError(t, s.Snapshot([]*rpc.Member2{m1, m2}))
+	assert.Equal(t, 1, s.WALEntries())
+
+	_, err = os.Stat(filepath.Join(dir, walOldFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	// Updates after the snapshot are replayed on top of the snapshot.
+	require.NoError(t, s.Delete("member-1"))
+	require.NoError(t, s.Close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	members, err := s.Load()
+	require.NoError(t, err)
+	assertMembersEqual(t, []*rpc.Member2{m2, m3}, members)
+	assert.Equal(t, 2, s.WALEntries())
+}
+
+// Tests if the node stops after rotating the WAL but before the snapshot is
+// written, no updates are lost.
+func TestStorage_SnapshotIncomplete(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	require.NoError(t, err)
+
+	m1 := randomMember("member-1", 1)
+	m2 := randomMember("member-2", 2)
+	require.NoError(t, s.Upsert(m1))
+	require.NoError(t, s.RotateWAL())
+	require.NoError(t, s.Upsert(m2))
+	require.NoError(t, s.Close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+
+	members, err := s.Load()
+	require.NoError(t, err)
+	assertMembersEqual(t, []*rpc.Member2{m1, m2}, members)
+
+	// Rotating again keeps the updates in the existing old WAL.
+	m3 := randomMember("member-3", 3)
+	require.NoError(t, s.Upsert(m3))
+	require.NoError(t, s.RotateWAL())
+	require.NoError(t, s.Close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+
+	members, err = s.Load()
+	require.NoError(t, err)
+	assertMembersEqual(t, []*rpc.Member2{m1, m2, m3}, members)
+
+	require.NoError(t, s.RotateWAL())
+	require.NoError(t, s.Snapshot(members))
+	require.NoError(t, s.Close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	members, err = s.Load()
+	require.NoError(t, err)
+	assertMembersEqual(t, []*rpc.Member2{m1, m2, m3}, members)
+	assert.Equal(t, 0, s.WALEntries())
+}
+
+// Tests a partially written record at the end of the WAL is discarded and
+// the WAL truncated so new records can be appended.
+func TestStorage_TruncateCorruptWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	require.NoError(t, err)
+
+	m1 := randomMember("member-1", 1)
+	require.NoError(t, s.Upsert(m1))
+	require.NoError(t, s.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 50, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+
+	members, err := s.Load()
+	require.NoError(t, err)
+	assertMembersEqual(t, []*rpc.Member2{m1}, members)
+
+	m2 := randomMember("member-2", 2)
+	require.NoError(t, s.Upsert(m2))
+	require.NoError(t, s.Close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	members, err = s.Load()
+	require.NoError(t, err)
+	assertMembersEqual(t, []*rpc.Member2{m1, m2}, members)
+}
+
+// Tests a record header with a length larger than the maximum record size is
+// treated as corrupt rather than allocating the length.
+func TestStorage_TruncateOversizedRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	require.NoError(t, err)
+
+	m1 := randomMember("member-1", 1)
+	require.NoError(t, s.Upsert(m1))
+	require.NoError(t, s.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+	defer s.Close()
+
+	members, err := s.Load()
+	require.NoError(t, err)
+	assertMembersEqual(t, []*rpc.Member2{m1}, members)
+}
+
+func assertMembersEqual(t *testing.T, expected []*rpc.Member2, actual []*rpc.Member2) {
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].State.Id < expected[j].State.Id
+	})
+	sort.Slice(actual, func(i, j int) bool {
+		return actual[i].State.Id < actual[j].State.Id
+	})
+
+	assert.Equal(t, len(expected), len(actual))
+	for i := 0; i != len(expected) && i != len(actual); i++ {
+		assert.True(t, proto.Equal(expected[i], actual[i]))
+	}
+}
+
+func randomMember(id string, timestamp int64) *rpc.Member2 {
+	return &rpc.Member2{
+		State:    testutils.RandomMemberState(id, ""),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "owner",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: timestamp,
+			},
+		},
+	}
+}
@@ -13,16 +13,16 @@ type Metrics struct {
 func NewMetrics() *Metrics {
 	return &Metrics{
 		ReplicaUpdatesOutbound: metrics.NewCounter(
-			"registry",
+			"registryv2",
 			"replica.updates.outbound",
-			[]string{"target"},
+			[]string{"target", "status"},
 			"Number of outbound updates sent to replicas",
 		),
 
 		RepairUpdatesInbound: metrics.NewCounter(
-			"registry",
+			"registryv2",
 			"repair.updates.inbound",
-			[]string{"source"},
+			[]string{"source", "status"},
 			"Number of inbound updates from replica repair",
 		),
 	}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type options struct {
+	pendingUpdatesLimit int
+	updateTimeout       time.Duration
+	logger              *zap.Logger
+}
+
+func defaultOptions() *options {
+	return &options{
+		pendingUpdatesLimit: 128,
+		updateTimeout:       time.Second * 20,
+		logger:              zap.NewNop(),
+	}
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type pendingUpdatesLimitOption struct {
+	limit int
+}
+
+func (o pendingUpdatesLimitOption) apply(opts *options) {
+	opts.pendingUpdatesLimit = o.limit
+}
+
+// WithPendingUpdatesLimit sets the maximum number of updates waiting to be
+// sent to the replica before the oldest updates are dropped.
+func WithPendingUpdatesLimit(limit int) Option {
+	return pendingUpdatesLimitOption{limit: limit}
+}
+
+type updateTimeoutOption struct {
+	timeout time.Duration
+}
+
+func (o updateTimeoutOption) apply(opts *options) {
+	opts.updateTimeout = o.timeout
+}
+
+// WithUpdateTimeout sets the time to keep retrying an update before it is
+// dropped.
+func WithUpdateTimeout(timeout time.Duration) Option {
+	return updateTimeoutOption{timeout: timeout}
+}
+
+type loggerOption struct {
+	log *zap.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.logger = o.log
+}
+
+func WithLogger(log *zap.Logger) Option {
+	return loggerOption{log: log}
+}
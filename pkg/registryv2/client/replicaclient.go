@@ -3,9 +3,15 @@ package client
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	"github.com/fuddle-io/fuddle/pkg/registryv2/registry"
+	"github.com/fuddle-io/fuddle/pkg/registryv2/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 const (
@@ -14,30 +20,232 @@ const (
 	maxDigestSize = 10000
 )
 
+// ReplicaClient forwards updates to, and repairs the local registry from,
+// another Fuddle node in the cluster.
+//
+// If the connection to the replica drops, the client will keep trying to
+// reconnect until it is closed.
 type ReplicaClient struct {
+	targetID string
 	registry *registry.Registry
 
-	client rpc.ReplicaRegistry2Client
+	pending *pendingUpdates
+
+	updateTimeout time.Duration
+
+	conn *grpc.ClientConn
+
+	ctx    context.Context
+	cancel func()
+
+	wg sync.WaitGroup
+
+	metrics *Metrics
+	logger  *zap.Logger
 }
 
-func ConnectReplica(addr string) *ReplicaClient {
-	return &ReplicaClient{}
+func ConnectReplica(addr string, targetID string, registry *registry.Registry, metrics *Metrics, opts ...Option) (*ReplicaClient, error) {
+	options := defaultOptions()
+	for _, o := range opts {
+		o.apply(options)
+	}
+
+	var retryPolicy = `{
+		"methodConfig": [{
+			"name": [{"service": "` + server.ReplicaServiceName + `", "method": "Update"}],
+			"waitForReady": true,
+
+			"retryPolicy": {
+				"MaxAttempts": 5,
+				"InitialBackoff": ".2s",
+				"MaxBackoff": "10s",
+				"BackoffMultiplier": 2.0,
+				"RetryableStatusCodes": [ "UNAVAILABLE" ]
+			}
+		}]
+	}`
+	// Dial won't connect yet so should never fail.
+	conn, err := grpc.Dial(
+		addr,
+		grpc.WithDefaultServiceConfig(retryPolicy),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("replica client: connect: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &ReplicaClient{
+		targetID:      targetID,
+		registry:      registry,
+		pending:       newPendingUpdates(options.pendingUpdatesLimit),
+		updateTimeout: options.updateTimeout,
+		conn:          conn,
+		ctx:           ctx,
+		cancel:        cancel,
+		metrics:       metrics,
+		logger:        options.logger,
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.sendLoop()
+	}()
+
+	return c, nil
 }
 
-func (c *ReplicaClient) Update(ctx context.Context, member *rpc.Member2) error {
-	// TODO(AD) don't block
-	return nil
+// Update forwards the given member update to the connected replica.
+//
+// This sends the update in the background to avoid blocking. If the number of
+// pending updates exceeds the pending updates limit, the older updates are
+// dropped and must be repaired by replica repair.
+func (c *ReplicaClient) Update(member *rpc.Member2) {
+	c.pending.Push(member)
 }
 
+// Sync sends a digest of the local registry to the replica and applies any
+// members the replica has a more recent version of.
 func (c *ReplicaClient) Sync(ctx context.Context) error {
-	resp, err := c.client.Sync(ctx, &rpc.ReplicaSyncRequest{
-		Digest: c.registry.MembersDigest(maxDigestSize),
-	})
-	if err != nil {
+	resp := &rpc.ReplicaSyncResponse{}
+	if err := c.conn.Invoke(ctx, replicaMethod("Sync"), &rpc.ReplicaSyncRequest{
+		Digest:       c.registry.MembersDigest(maxDigestSize),
+		SourceNodeId: c.registry.LocalID(),
+	}, resp); err != nil {
+		c.metrics.RepairUpdatesInbound.Inc(map[string]string{
+			"source": c.targetID,
+			"status": "fail",
+		})
 		return fmt.Errorf("replica client: sync: %w", err)
 	}
+
+	c.metrics.RepairUpdatesInbound.Add(len(resp.Members), map[string]string{
+		"source": c.targetID,
+		"status": "ok",
+	})
+
 	for _, m := range resp.Members {
 		c.registry.RemoteUpsertMember(m)
 	}
 	return nil
 }
+
+func (c *ReplicaClient) Close() {
+	c.cancel()
+	c.pending.Close()
+	c.wg.Wait()
+	c.conn.Close()
+}
+
+func (c *ReplicaClient) sendLoop() {
+	for {
+		m, ok := c.pending.Take()
+		if !ok {
+			// Client closed.
+			return
+		}
+
+		if err := c.update(m); err != nil {
+			c.logger.Warn(
+				"failed to forward update",
+				zap.String("member-id", m.State.Id),
+				zap.String("target", c.targetID),
+				zap.Error(err),
+			)
+
+			c.metrics.ReplicaUpdatesOutbound.Inc(map[string]string{
+				"target": c.targetID,
+				"status": "fail",
+			})
+		} else {
+			c.metrics.ReplicaUpdatesOutbound.Inc(map[string]string{
+				"target": c.targetID,
+				"status": "ok",
+			})
+		}
+	}
+}
+
+// update sends the update to the replica. The update will keep retrying until
+// the update timeout. If it still does not succeed, the update is dropped and
+// the replica will get the update via replica repair.
+func (c *ReplicaClient) update(m *rpc.Member2) error {
+	ctx, cancel := context.WithTimeout(c.ctx, c.updateTimeout)
+	defer cancel()
+
+	return c.conn.Invoke(ctx, replicaMethod("Update"), &rpc.UpdateRequest{
+		Member:       m,
+		SourceNodeId: c.registry.LocalID(),
+	}, &rpc.UpdateResponse{})
+}
+
+func replicaMethod(method string) string {
+	return "/" + server.ReplicaServiceName + "/" + method
+}
+
+type pendingUpdates struct {
+	limit int
+
+	pending []*rpc.Member2
+	closed  bool
+
+	cv *sync.Cond
+
+	// mu protects the fields above.
+	mu *sync.Mutex
+}
+
+func newPendingUpdates(limit int) *pendingUpdates {
+	mu := &sync.Mutex{}
+	return &pendingUpdates{
+		limit: limit,
+		cv:    sync.NewCond(mu),
+		mu:    mu,
+	}
+}
+
+func (p *pendingUpdates) Push(m *rpc.Member2) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	// If the number of pending updates exceeds the limit, drop the oldest
+	// update, which will be repaired by replica repair.
+	if len(p.pending) >= p.limit {
+		p.pending = p.pending[1:]
+	}
+
+	p.pending = append(p.pending, m)
+	p.cv.Signal()
+}
+
+// Take returns the next pending update and removes it, or false if the client
+// is closed.
+func (p *pendingUpdates) Take() (*rpc.Member2, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.pending) == 0 && !p.closed {
+		p.cv.Wait()
+	}
+
+	if p.closed {
+		return nil, false
+	}
+
+	m := p.pending[0]
+	p.pending = p.pending[1:]
+	return m, true
+}
+
+func (p *pendingUpdates) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.cv.Signal()
+}
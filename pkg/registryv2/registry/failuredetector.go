@@ -1,19 +1,91 @@
 package registry
 
+import (
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+)
+
 // FailureDetector detects when members are no longer responding and marks them
 // as down.
 type FailureDetector struct {
+	registry *Registry
 }
 
 func NewFailureDetector(registry *Registry) *FailureDetector {
-	return &FailureDetector{}
+	return &FailureDetector{
+		registry: registry,
+	}
 }
 
-func (fd *FailureDetector) Check() {
-	// mark any members missing heartbeats as 'down' with an expiry of
-	// now + reconnect timeout
+// Check updates the liveness of the members in the registry at the given
+// timestamp:
+//   - Members owned by the local node that missed their heartbeats are marked
+//     as down, with an expiry of the reconnect timeout
+//   - Members owned by a node that left the cluster over the heartbeat timeout
+//     ago are taken over by the local node and marked as down. Multiple nodes
+//     may try to take ownership, which is resolved by the member version
+//   - Down members owned by the local node that exceed their expiry are marked
+//     as left, with an expiry of the tombstone timeout
+//   - Left members that exceed their expiry are removed
+func (fd *FailureDetector) Check(timestamp int64) {
+	r := fd.registry
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, m := range r.members {
+		// The local member is never down.
+		if id == r.localID {
+			continue
+		}
+
+		if m.Liveness == rpc.Liveness_LEFT {
+			if m.Expiry != 0 && m.Expiry <= timestamp {
+				r.removeMemberLocked(id)
+			}
+			continue
+		}
+
+		if m.Version.OwnerId != r.localID {
+			left, ok := r.leftNodes[m.Version.OwnerId]
+			if !ok || timestamp-left < r.heartbeatTimeout {
+				continue
+			}
+
+			expiry := m.Expiry
+			if m.Liveness != rpc.Liveness_DOWN {
+				expiry = timestamp + r.reconnectTimeout
+			}
+			r.setMemberLocked(&rpc.Member2{
+				State:    m.State,
+				Liveness: rpc.Liveness_DOWN,
+				Version:  r.nextVersionLocked(timestamp),
+				Expiry:   expiry,
+			})
+			continue
+		}
 
-	// mark any members registered to a missing node, where the node has been
-	// down for the heartbeat timeout, as 'down' with same expiry as above
-	// we'll try to take ownership (and may lose which is fine)
+		switch m.Liveness {
+		case rpc.Liveness_UP:
+			if timestamp-r.lastContact[id] < r.heartbeatTimeout {
+				continue
+			}
+			r.setMemberLocked(&rpc.Member2{
+				State:    m.State,
+				Liveness: rpc.Liveness_DOWN,
+				Version:  r.nextVersionLocked(timestamp),
+				Expiry:   timestamp + r.reconnectTimeout,
+			})
+		case rpc.Liveness_DOWN:
+			if m.Expiry > timestamp {
+				continue
+			}
+			r.setMemberLocked(&rpc.Member2{
+				State:    m.State,
+				Liveness: rpc.Liveness_LEFT,
+				Version:  r.nextVersionLocked(timestamp),
+				Expiry:   timestamp + r.tombstoneTimeout,
+			})
+			delete(r.lastContact, id)
+		}
+	}
 }
@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"testing"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureDetector_MissedHeartbeat(t *testing.T) {
+	r := NewRegistry(
+		"local",
+		0,
+		WithHeartbeatTimeout(1000),
+		WithReconnectTimeout(2000),
+	)
+	fd := NewFailureDetector(r)
+
+	member := randomMember("", "")
+	r.OwnedMemberUpsert(member, 1000)
+
+	assert.NoError(t, r.OwnedMemberHeartbeat(member.Id, 1500))
+
+	// Check the member is still up before the heartbeat timeout.
+	fd.Check(2400)
+	_, ok := r.Member(member.Id)
+	assert.True(t, ok)
+
+	fd.Check(2600)
+	m := ownedMember(r, member.Id)
+	assert.Equal(t, rpc.Liveness_DOWN, m.Liveness)
+	assert.Equal(t, int64(4600), m.Expiry)
+
+	// Down members must join again rather than heartbeat.
+	assert.ErrorIs(t, r.OwnedMemberHeartbeat(member.Id, 2700), ErrNotOwned)
+}
+
+func TestFailureDetector_ExpireDownMember(t *testing.T) {
+	r := NewRegistry(
+		"local",
+		0,
+		WithHeartbeatTimeout(1000),
+		WithReconnectTimeout(2000),
+		WithTombstoneTimeout(5000),
+	)
+	fd := NewFailureDetector(r)
+
+	member := randomMember("", "")
+	r.OwnedMemberUpsert(member, 1000)
+
+	// Mark the member down.
+	fd.Check(2000)
+	assert.Equal(t, rpc.Liveness_DOWN, ownedMember(r, member.Id).Liveness)
+
+	// Mark the member left after the reconnect timeout.
+	fd.Check(4000)
+	m := ownedMember(r, member.Id)
+	assert.Equal(t, rpc.Liveness_LEFT, m.Liveness)
+	assert.Equal(t, int64(9000), m.Expiry)
+
+	// Remove the member after the tombstone timeout.
+	fd.Check(9000)
+	assert.Nil(t, ownedMember(r, member.Id))
+}
+
+func TestFailureDetector_TakeOverLeftNodeMembers(t *testing.T) {
+	r := NewRegistry(
+		"local",
+		0,
+		WithHeartbeatTimeout(1000),
+		WithReconnectTimeout(2000),
+	)
+	fd := NewFailureDetector(r)
+
+	member := randomMember("", "")
+	r.RemoteUpsertMember(&rpc.Member2{
+		State:    member,
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 1000,
+			},
+		},
+	})
+
+	r.OnNodeLeave("remote", 2000)
+
+	// Check the member isn't taken over before the heartbeat timeout.
+	fd.Check(2500)
+	assert.Nil(t, ownedMember(r, member.Id))
+
+	fd.Check(3000)
+	m := ownedMember(r, member.Id)
+	assert.Equal(t, rpc.Liveness_DOWN, m.Liveness)
+	assert.Equal(t, int64(5000), m.Expiry)
+}
+
+func TestFailureDetector_NodeRejoined(t *testing.T) {
+	r := NewRegistry("local", 0, WithHeartbeatTimeout(1000))
+	fd := NewFailureDetector(r)
+
+	member := randomMember("", "")
+	r.RemoteUpsertMember(&rpc.Member2{
+		State:    member,
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: 1000,
+			},
+		},
+	})
+
+	r.OnNodeLeave("remote", 2000)
+	r.OnNodeJoin("remote")
+
+	fd.Check(5000)
+	assert.Nil(t, ownedMember(r, member.Id))
+	_, ok := r.Member(member.Id)
+	assert.True(t, ok)
+}
+
+func TestFailureDetector_LocalMemberNeverDown(t *testing.T) {
+	r := NewRegistry(
+		"local",
+		0,
+		WithLocalMember(randomMember("local", "fuddle")),
+		WithHeartbeatTimeout(1000),
+	)
+	fd := NewFailureDetector(r)
+
+	fd.Check(5000)
+
+	_, ok := r.Member("local")
+	assert.True(t, ok)
+}
+
+// ownedMember returns the member with the given ID owned by the local node,
+// or nil if not found.
+func ownedMember(r *Registry, id string) *rpc.Member2 {
+	for _, m := range r.OwnedMembers() {
+		if m.State.Id == id {
+			return m
+		}
+	}
+	return nil
+}
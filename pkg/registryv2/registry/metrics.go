@@ -12,13 +12,13 @@ type Metrics struct {
 func NewMetrics() *Metrics {
 	return &Metrics{
 		MembersCount: metrics.NewGauge(
-			"registry",
+			"registryv2",
 			"members.count",
 			[]string{"liveness", "service", "owner"},
 			"Number of members in the registry",
 		),
 		MembersOwned: metrics.NewGauge(
-			"registry",
+			"registryv2",
 			"members.owned",
 			[]string{"liveness", "service"},
 			"Number of members owned by the node",
@@ -8,6 +8,8 @@ import (
 type options struct {
 	localMember *rpc.MemberState
 
+	heartbeatTimeout int64
+	reconnectTimeout int64
 	tombstoneTimeout int64
 
 	collector metrics.Collector
@@ -16,6 +18,8 @@ type options struct {
 func defaultOptions() *options {
 	return &options{
 		localMember:      nil,
+		heartbeatTimeout: 20 * 1000,
+		reconnectTimeout: 5 * 60 * 1000,
 		tombstoneTimeout: 30 * 60 * 1000,
 		collector:        nil,
 	}
@@ -37,6 +41,37 @@ func WithLocalMember(m *rpc.MemberState) Option {
 	return localMemberOption{member: m}
 }
 
+type heartbeatTimeoutOption struct {
+	timeout int64
+}
+
+func (o heartbeatTimeoutOption) apply(opts *options) {
+	opts.heartbeatTimeout = o.timeout
+}
+
+// WithHeartbeatTimeout sets the time in milliseconds a member has to send a
+// heartbeat before it is considered down.
+//
+// This is also the time a Fuddle node has to rejoin the cluster before its
+// members are taken over by another node.
+func WithHeartbeatTimeout(timeout int64) Option {
+	return heartbeatTimeoutOption{timeout: timeout}
+}
+
+type reconnectTimeoutOption struct {
+	timeout int64
+}
+
+func (o reconnectTimeoutOption) apply(opts *options) {
+	opts.reconnectTimeout = o.timeout
+}
+
+// WithReconnectTimeout sets the time in milliseconds a down member has to
+// join again before it is considered left.
+func WithReconnectTimeout(timeout int64) Option {
+	return reconnectTimeoutOption{timeout: timeout}
+}
+
 type tombstoneTimeoutOption struct {
 	timeout int64
 }
@@ -1,18 +1,34 @@
 package registry
 
 import (
+	"errors"
 	"math/rand"
 	"sync"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 )
 
+// ErrNotOwned is returned when a member heartbeat is received for a member
+// that isn't owned by the local node, so the member must join again.
+var ErrNotOwned = errors.New("member not owned by local node")
+
 // Registry manages the set of registered members in the cluster.
 type Registry struct {
 	localID string
 
 	members map[string]*rpc.Member2
 
+	// lastContact contains the time of the last heartbeat received from each
+	// member owned by the local node.
+	lastContact map[string]int64
+
+	// leftNodes contains the time each Fuddle node left the cluster. Members
+	// owned by left nodes are taken over by the failure detector.
+	leftNodes map[string]int64
+
+	localSubscribers  map[*localSubscriber]interface{}
+	digestSubscribers map[*digestSubscriber]interface{}
+
 	// priorityMembers contains the member IDs that are known to be out of date
 	// so must be included as a priority in the next digest.
 	priorityMembers map[string]interface{}
@@ -25,11 +41,22 @@ type Registry struct {
 	// mu is a mutex protecting the fields above.
 	mu sync.Mutex
 
+	heartbeatTimeout int64
+	reconnectTimeout int64
 	tombstoneTimeout int64
 
 	metrics *Metrics
 }
 
+type localSubscriber struct {
+	onUpdate func(member *rpc.Member2)
+}
+
+type digestSubscriber struct {
+	filter   *rpc.ClientFilter
+	onUpdate func(member *rpc.Member2)
+}
+
 func NewRegistry(localID string, timestamp int64, opts ...Option) *Registry {
 	options := defaultOptions()
 	for _, o := range opts {
@@ -42,11 +69,17 @@ func NewRegistry(localID string, timestamp int64, opts ...Option) *Registry {
 	}
 
 	r := &Registry{
-		localID:          localID,
-		members:          make(map[string]*rpc.Member2),
-		priorityMembers:  make(map[string]interface{}),
-		tombstoneTimeout: options.tombstoneTimeout,
-		metrics:          metrics,
+		localID:           localID,
+		members:           make(map[string]*rpc.Member2),
+		lastContact:       make(map[string]int64),
+		leftNodes:         make(map[string]int64),
+		localSubscribers:  make(map[*localSubscriber]interface{}),
+		digestSubscribers: make(map[*digestSubscriber]interface{}),
+		priorityMembers:   make(map[string]interface{}),
+		heartbeatTimeout:  options.heartbeatTimeout,
+		reconnectTimeout:  options.reconnectTimeout,
+		tombstoneTimeout:  options.tombstoneTimeout,
+		metrics:           metrics,
 	}
 
 	if options.localMember != nil {
@@ -82,14 +115,87 @@ func (r *Registry) Metrics() *Metrics {
 	return r.metrics
 }
 
-func (r *Registry) SubscribeLocal(onUpdate func(member *rpc.Member2)) {
-	// register local subscriber (onUpdate must not block)
+// LocalID returns the ID of the local node.
+func (r *Registry) LocalID() string {
+	return r.localID
 }
 
-func (r *Registry) SubscribeFromDigest(digest map[string]*rpc.MonotonicTimestamp, filter *rpc.ClientFilter, onUpdate func(member *rpc.Member2)) {
-	// register subscriber (onUpdate must not block)
+// OwnedMembers returns the members owned by the local node, including the
+// local member.
+func (r *Registry) OwnedMembers() []*rpc.Member2 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	// get a delta similar to MembersDelta and send to onUpdate
+	var members []*rpc.Member2
+	for _, m := range r.members {
+		if m.Version.OwnerId == r.localID {
+			members = append(members, copyMember(m))
+		}
+	}
+	return members
+}
+
+// SubscribeLocal subscribes to updates to members owned by the local node,
+// including updates where the local node lost ownership of a member. This is
+// used to forward local updates to the other nodes in the cluster.
+//
+// onUpdate is called with the registry mutex held so must not block.
+//
+// Returns a function to unsubscribe.
+func (r *Registry) SubscribeLocal(onUpdate func(member *rpc.Member2)) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub := &localSubscriber{
+		onUpdate: onUpdate,
+	}
+	r.localSubscribers[sub] = struct{}{}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.localSubscribers, sub)
+	}
+}
+
+// SubscribeFromDigest subscribes to updates to members matching the filter.
+//
+// The digest contains the versions of the members already known by the
+// subscriber, so onUpdate is first called with any members matching the
+// filter that the subscriber is missing or has an out of date version of,
+// then with all subsequent updates.
+//
+// onUpdate is called with the registry mutex held so must not block.
+//
+// Returns a function to unsubscribe.
+func (r *Registry) SubscribeFromDigest(digest map[string]*rpc.MonotonicTimestamp, filter *rpc.ClientFilter, onUpdate func(member *rpc.Member2)) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, m := range r.members {
+		if !matchesFilter(m, filter) {
+			continue
+		}
+		timestamp, ok := digest[id]
+		if ok && compareTimestamps(timestamp, m.Version.Timestamp) <= 0 {
+			continue
+		}
+		onUpdate(copyMember(m))
+	}
+
+	sub := &digestSubscriber{
+		filter:   filter,
+		onUpdate: onUpdate,
+	}
+	r.digestSubscribers[sub] = struct{}{}
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.digestSubscribers, sub)
+	}
 }
 
 // OwnedMemberUpsert takes ownership of the given member and adds or updates the
@@ -116,18 +222,14 @@ func (r *Registry) OwnedMemberUpsert(memberState *rpc.MemberState, timestamp int
 		if compareVersions(existing.Version, version) <= 0 {
 			return
 		}
-
-		r.decMembersCount(existing)
 	}
 
-	member := &rpc.Member2{
+	r.setMemberLocked(&rpc.Member2{
 		State:    copyMemberState(memberState),
 		Liveness: rpc.Liveness_UP,
 		Version:  version,
-	}
-	r.members[memberState.Id] = member
-
-	r.incMembersCount(member)
+	})
+	r.lastContact[memberState.Id] = timestamp
 }
 
 // OwnedMemberLeave takes ownership of the member with the given ID and marks
@@ -141,42 +243,55 @@ func (r *Registry) OwnedMemberLeave(id string, timestamp int64) {
 		return
 	}
 
-	version := r.nextVersionLocked(timestamp)
-
 	existing, ok := r.members[id]
-	if ok {
-		// If the local update is before the existing member version, this
-		// likely means there is clock skew between nodes, so this should never
-		// happen.
-		//
-		// If it does happen, it means we arn't the owner, so we have to just
-		// discard the leave update and the current owner will mark the member
-		// as down.
-		if compareVersions(existing.Version, version) <= 0 {
-			return
-		}
+	if !ok {
+		// Discard leave updates for unknown members, as there is no member
+		// state to keep as a tombstone.
+		return
+	}
 
-		r.decMembersCount(existing)
+	version := r.nextVersionLocked(timestamp)
+
+	// If the local update is before the existing member version, this
+	// likely means there is clock skew between nodes, so this should never
+	// happen.
+	//
+	// If it does happen, it means we arn't the owner, so we have to just
+	// discard the leave update and the current owner will mark the member
+	// as down.
+	if compareVersions(existing.Version, version) <= 0 {
+		return
 	}
 
 	// Mark the member as left with an expiry to be removed after the tombstone
 	// timeout.
-	member := &rpc.Member2{
+	r.setMemberLocked(&rpc.Member2{
 		State:    existing.State,
 		Liveness: rpc.Liveness_LEFT,
 		Version:  version,
 		Expiry:   timestamp + r.tombstoneTimeout,
-	}
-	r.members[id] = member
-
-	r.incMembersCount(member)
+	})
+	delete(r.lastContact, id)
 }
 
-func (r *Registry) OwnedMemberHeartbeat(id string, timestamp int64) {
-	// if not owned by the local node, return an error so the client
-	// re-registers
+// OwnedMemberHeartbeat records a heartbeat from the member with the given ID.
+//
+// If the member is not an up member owned by the local node, such as if the
+// member was taken over by another node, returns ErrNotOwned so the member
+// can join again.
+func (r *Registry) OwnedMemberHeartbeat(id string, timestamp int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.members[id]
+	if !ok || m.Version.OwnerId != r.localID || m.Liveness != rpc.Liveness_UP {
+		return ErrNotOwned
+	}
 
-	// update last contact
+	if timestamp > r.lastContact[id] {
+		r.lastContact[id] = timestamp
+	}
+	return nil
 }
 
 func (r *Registry) RemoteUpsertMember(member *rpc.Member2) {
@@ -189,17 +304,15 @@ func (r *Registry) RemoteUpsertMember(member *rpc.Member2) {
 		if compareVersions(existing.Version, member.Version) <= 0 {
 			return
 		}
-
-		r.decMembersCount(existing)
 	}
 
-	r.members[member.State.Id] = copyMember(member)
-
-	r.incMembersCount(member)
+	// If another node took ownership of a member, the local node no longer
+	// tracks its heartbeats.
+	if member.Version.OwnerId != r.localID {
+		delete(r.lastContact, member.State.Id)
+	}
 
-	// notify SubscribeFromDigest subscribers
-	// if we are owner or lost ownership
-	//    notify SubscribeLocal subscribers
+	r.setMemberLocked(copyMember(member))
 }
 
 func (r *Registry) MembersDigest(maxMembers int) map[string]*rpc.MonotonicTimestamp {
@@ -276,12 +389,62 @@ func (r *Registry) MembersDelta(digest map[string]*rpc.MonotonicTimestamp) []*rp
 	return members
 }
 
+// OnNodeJoin marks the Fuddle node with the given ID as joined, so its members
+// are no longer taken over by the failure detector.
 func (r *Registry) OnNodeJoin(id string) {
-	// if the node was considered down, mark it alive again
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.leftNodes, id)
 }
 
-func (r *Registry) OnNodeLeave(id string) {
-	// if the node was considered up, mark it as down
+// OnNodeLeave marks the Fuddle node with the given ID as left. If the node
+// doesn't rejoin within the heartbeat timeout, the failure detector takes
+// ownership of its members.
+func (r *Registry) OnNodeLeave(id string, timestamp int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.leftNodes[id]; ok {
+		return
+	}
+	r.leftNodes[id] = timestamp
+}
+
+// setMemberLocked adds or replaces the member and notifies subscribers.
+func (r *Registry) setMemberLocked(member *rpc.Member2) {
+	existing, ok := r.members[member.State.Id]
+	if ok {
+		r.decMembersCount(existing)
+	}
+
+	r.members[member.State.Id] = member
+	r.incMembersCount(member)
+
+	// Notify local subscribers if the local node owns the member or just lost
+	// ownership.
+	if member.Version.OwnerId == r.localID || (ok && existing.Version.OwnerId == r.localID) {
+		for sub := range r.localSubscribers {
+			sub.onUpdate(copyMember(member))
+		}
+	}
+	for sub := range r.digestSubscribers {
+		if matchesFilter(member, sub.filter) {
+			sub.onUpdate(copyMember(member))
+		}
+	}
+}
+
+// removeMemberLocked removes the member from the registry without notifying
+// subscribers, since each node removes expired members itself.
+func (r *Registry) removeMemberLocked(id string) {
+	existing, ok := r.members[id]
+	if !ok {
+		return
+	}
+	r.decMembersCount(existing)
+	delete(r.members, id)
+	delete(r.lastContact, id)
 }
 
 func (r *Registry) nextVersionLocked(now int64) *rpc.Version2 {
@@ -334,6 +497,7 @@ func copyMember(m *rpc.Member2) *rpc.Member2 {
 		State:    copyMemberState(m.State),
 		Liveness: m.Liveness,
 		Version:  copyVersion(m.Version),
+		Expiry:   m.Expiry,
 	}
 }
 
@@ -363,6 +527,60 @@ func copyVersion(m *rpc.Version2) *rpc.Version2 {
 	}
 }
 
+// matchesFilter returns whether the member matches the client filter. A nil
+// filter matches all members.
+func matchesFilter(m *rpc.Member2, filter *rpc.ClientFilter) bool {
+	if filter == nil {
+		return true
+	}
+
+	if len(filter.Service) > 0 {
+		match := false
+		for _, service := range filter.Service {
+			if m.State.Service == service {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+
+	if len(filter.Locality) > 0 {
+		match := false
+		for _, locality := range filter.Locality {
+			if matchesLocality(m.State.Locality, locality) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesLocality returns whether the locality matches the filter locality,
+// where empty filter fields match any value.
+func matchesLocality(locality *rpc.Locality, filter *rpc.Locality) bool {
+	if filter == nil {
+		return true
+	}
+	if locality == nil {
+		locality = &rpc.Locality{}
+	}
+	if filter.Region != "" && filter.Region != locality.Region {
+		return false
+	}
+	if filter.AvailabilityZone != "" && filter.AvailabilityZone != locality.AvailabilityZone {
+		return false
+	}
+	return true
+}
+
 func livenessToString(liveness rpc.Liveness) string {
 	switch liveness {
 	case rpc.Liveness_UP:
@@ -141,6 +141,157 @@ func TestRegistry_LeaveLocalMemberDiscarded(t *testing.T) {
 	assert.True(t, proto.Equal(localMember, m))
 }
 
+func TestRegistry_SubscribeLocal(t *testing.T) {
+	r := NewRegistry("local", time.Now().UnixMilli())
+
+	var updates []*rpc.Member2
+	unsubscribe := r.SubscribeLocal(func(m *rpc.Member2) {
+		updates = append(updates, m)
+	})
+
+	ownedMember := randomMember("", "")
+	r.OwnedMemberUpsert(ownedMember, time.Now().UnixMilli())
+
+	// Remote members not owned by the local node are not included.
+	r.RemoteUpsertMember(&rpc.Member2{
+		State:    randomMember("", ""),
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: time.Now().UnixMilli(),
+			},
+		},
+	})
+
+	assert.Equal(t, 1, len(updates))
+	assert.True(t, proto.Equal(ownedMember, updates[0].State))
+	assert.Equal(t, "local", updates[0].Version.OwnerId)
+
+	// Updates where the local node loses ownership are included.
+	r.RemoteUpsertMember(&rpc.Member2{
+		State:    ownedMember,
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: time.Now().UnixMilli() + 1000,
+			},
+		},
+	})
+	assert.Equal(t, 2, len(updates))
+	assert.Equal(t, "remote", updates[1].Version.OwnerId)
+
+	unsubscribe()
+
+	r.OwnedMemberUpsert(randomMember("", ""), time.Now().UnixMilli())
+	assert.Equal(t, 2, len(updates))
+}
+
+func TestRegistry_SubscribeFromDigest(t *testing.T) {
+	r := NewRegistry("local", time.Now().UnixMilli())
+
+	knownMember := randomMember("", "foo")
+	r.OwnedMemberUpsert(knownMember, time.Now().UnixMilli())
+	missingMember := randomMember("", "foo")
+	r.OwnedMemberUpsert(missingMember, time.Now().UnixMilli())
+	// Doesn't match the filter.
+	r.OwnedMemberUpsert(randomMember("", "bar"), time.Now().UnixMilli())
+
+	digest := make(map[string]*rpc.MonotonicTimestamp)
+	for _, m := range r.OwnedMembers() {
+		if m.State.Id == knownMember.Id {
+			digest[m.State.Id] = m.Version.Timestamp
+		}
+	}
+
+	var updates []*rpc.Member2
+	unsubscribe := r.SubscribeFromDigest(digest, &rpc.ClientFilter{
+		Service: []string{"foo"},
+	}, func(m *rpc.Member2) {
+		updates = append(updates, m)
+	})
+
+	// Only the member missing from the digest is sent.
+	assert.Equal(t, 1, len(updates))
+	assert.True(t, proto.Equal(missingMember, updates[0].State))
+
+	r.OwnedMemberLeave(knownMember.Id, time.Now().UnixMilli())
+	r.OwnedMemberUpsert(randomMember("", "bar"), time.Now().UnixMilli())
+
+	assert.Equal(t, 2, len(updates))
+	assert.Equal(t, knownMember.Id, updates[1].State.Id)
+	assert.Equal(t, rpc.Liveness_LEFT, updates[1].Liveness)
+
+	unsubscribe()
+
+	r.OwnedMemberUpsert(randomMember("", "foo"), time.Now().UnixMilli())
+	assert.Equal(t, 2, len(updates))
+}
+
+func TestRegistry_SubscribeFromDigestFilterLocality(t *testing.T) {
+	r := NewRegistry("local", time.Now().UnixMilli())
+
+	member := randomMember("", "")
+	r.OwnedMemberUpsert(member, time.Now().UnixMilli())
+	r.OwnedMemberUpsert(randomMember("", ""), time.Now().UnixMilli())
+
+	var updates []*rpc.Member2
+	r.SubscribeFromDigest(nil, &rpc.ClientFilter{
+		Locality: []*rpc.Locality{
+			{Region: member.Locality.Region},
+		},
+	}, func(m *rpc.Member2) {
+		updates = append(updates, m)
+	})
+
+	assert.Equal(t, 1, len(updates))
+	assert.True(t, proto.Equal(member, updates[0].State))
+}
+
+func TestRegistry_OwnedMemberHeartbeat(t *testing.T) {
+	r := NewRegistry("local", time.Now().UnixMilli())
+
+	member := randomMember("", "")
+	r.OwnedMemberUpsert(member, time.Now().UnixMilli())
+
+	assert.NoError(t, r.OwnedMemberHeartbeat(member.Id, time.Now().UnixMilli()))
+}
+
+func TestRegistry_OwnedMemberHeartbeatNotOwned(t *testing.T) {
+	r := NewRegistry("local", time.Now().UnixMilli())
+
+	// Unknown members aren't owned.
+	assert.ErrorIs(t, r.OwnedMemberHeartbeat("unknown", time.Now().UnixMilli()), ErrNotOwned)
+
+	member := randomMember("", "")
+	r.RemoteUpsertMember(&rpc.Member2{
+		State:    member,
+		Liveness: rpc.Liveness_UP,
+		Version: &rpc.Version2{
+			OwnerId: "remote",
+			Timestamp: &rpc.MonotonicTimestamp{
+				Timestamp: time.Now().UnixMilli(),
+			},
+		},
+	})
+	assert.ErrorIs(t, r.OwnedMemberHeartbeat(member.Id, time.Now().UnixMilli()), ErrNotOwned)
+
+	// Left members aren't owned.
+	leftMember := randomMember("", "")
+	r.OwnedMemberUpsert(leftMember, time.Now().UnixMilli())
+	r.OwnedMemberLeave(leftMember.Id, time.Now().UnixMilli())
+	assert.ErrorIs(t, r.OwnedMemberHeartbeat(leftMember.Id, time.Now().UnixMilli()), ErrNotOwned)
+}
+
+func TestRegistry_LeaveUnknownMemberDiscarded(t *testing.T) {
+	r := NewRegistry("local", time.Now().UnixMilli())
+
+	r.OwnedMemberLeave("unknown", time.Now().UnixMilli())
+
+	assert.Equal(t, 0, len(r.OwnedMembers()))
+}
+
 func randomMember(id string, service string) *rpc.MemberState {
 	if id == "" {
 		id = uuid.New().String()
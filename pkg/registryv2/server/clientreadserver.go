@@ -1,23 +1,168 @@
 package server
 
 import (
+	"errors"
+	"sync"
+
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	"github.com/fuddle-io/fuddle/pkg/registryv2/registry"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+var errSyncQueueFull = errors.New("sync queue full")
+
 type ClientReadServer struct {
 	registry *registry.Registry
 
+	subscriberQueueLimit int
+
+	metrics *Metrics
+	logger  *zap.Logger
+
 	rpc.UnimplementedClientReadRegistry2Server
 }
 
-func NewClientReadServer() *ClientReadServer {
-	return &ClientReadServer{}
+func NewClientReadServer(reg *registry.Registry, metrics *Metrics, opts ...Option) *ClientReadServer {
+	options := defaultOptions()
+	for _, o := range opts {
+		o.apply(options)
+	}
+
+	return &ClientReadServer{
+		registry:             reg,
+		subscriberQueueLimit: options.subscriberQueueLimit,
+		metrics:              metrics,
+		logger:               options.logger,
+	}
 }
 
+// Sync streams the members matching the request filter that the client is
+// missing or has an out of date version of according to its digest, followed
+// by all subsequent updates to the matching members.
+//
+// If the client can't keep up with the updates, the stream is closed with a
+// ResourceExhausted status, so the client syncs again from its digest.
 func (s *ClientReadServer) Sync(req *rpc.ClientSyncRequest, stream rpc.ClientReadRegistry2_SyncServer) error {
-	s.registry.SubscribeFromDigest(req.Digest, req.Filter, func(member *rpc.Member2) {
-		// TODO(AD) can't block so queue and send in background
+	logger := s.logger.With(zap.String("rpc", "ClientReadServer.Sync"))
+	logger.Debug("sync stream")
+
+	queue := newSyncQueue(s.subscriberQueueLimit)
+
+	// The registry calls onUpdate with its mutex held so updates must be
+	// queued and sent in the background.
+	unsubscribe := s.registry.SubscribeFromDigest(req.Digest, req.Filter, func(member *rpc.Member2) {
+		queue.Push(member)
 	})
-	return nil
+	defer unsubscribe()
+
+	// The initial delta may exceed the queue limit, so only enforce the limit
+	// once subscribed.
+	queue.Limit()
+
+	go func() {
+		<-stream.Context().Done()
+		queue.Close()
+	}()
+
+	for {
+		member, err := queue.Pop()
+		if err != nil {
+			logger.Warn("sync stream closed; queue full")
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if member == nil {
+			// Stream closed.
+			return nil
+		}
+
+		if err := stream.Send(&rpc.ClientSyncUpdate{Member: member}); err != nil {
+			logger.Debug("sync stream closed", zap.Error(err))
+			return nil
+		}
+
+		s.metrics.ClientUpdatesOutbound.Inc(map[string]string{})
+	}
+}
+
+// syncQueue queues updates to send to a sync stream.
+type syncQueue struct {
+	limit   int
+	limited bool
+
+	updates  []*rpc.Member2
+	overflow bool
+	closed   bool
+
+	cv *sync.Cond
+
+	// mu protects the fields above.
+	mu *sync.Mutex
+}
+
+func newSyncQueue(limit int) *syncQueue {
+	mu := &sync.Mutex{}
+	return &syncQueue{
+		limit: limit,
+		cv:    sync.NewCond(mu),
+		mu:    mu,
+	}
+}
+
+// Push adds the update to the queue. If the queue limit is exceeded the queue
+// overflows and Pop returns an error.
+func (q *syncQueue) Push(m *rpc.Member2) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed || q.overflow {
+		return
+	}
+	if q.limited && len(q.updates) >= q.limit {
+		q.overflow = true
+		q.cv.Signal()
+		return
+	}
+
+	q.updates = append(q.updates, m)
+	q.cv.Signal()
+}
+
+// Limit enforces the queue limit on subsequent pushes.
+func (q *syncQueue) Limit() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.limited = true
+}
+
+// Pop returns the next update, blocking until an update is queued. Returns
+// nil if the queue is closed, or an error if the queue overflowed.
+func (q *syncQueue) Pop() (*rpc.Member2, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.updates) == 0 && !q.closed && !q.overflow {
+		q.cv.Wait()
+	}
+
+	if q.overflow {
+		return nil, errSyncQueueFull
+	}
+	if q.closed {
+		return nil, nil
+	}
+
+	m := q.updates[0]
+	q.updates = q.updates[1:]
+	return m, nil
+}
+
+func (q *syncQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.cv.Signal()
 }
@@ -2,33 +2,92 @@ package server
 
 import (
 	"context"
-	"time"
+	"errors"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
 	"github.com/fuddle-io/fuddle/pkg/registryv2/registry"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type ClientWriteServer struct {
 	registry *registry.Registry
 
+	clock clock.Clock
+
+	metrics *Metrics
+	logger  *zap.Logger
+
 	rpc.UnimplementedClientWriteRegistry2Server
 }
 
-func NewClientWriteServer() *ClientWriteServer {
-	return &ClientWriteServer{}
+func NewClientWriteServer(reg *registry.Registry, metrics *Metrics, opts ...Option) *ClientWriteServer {
+	options := defaultOptions()
+	for _, o := range opts {
+		o.apply(options)
+	}
+
+	return &ClientWriteServer{
+		registry: reg,
+		clock:    options.clock,
+		metrics:  metrics,
+		logger:   options.logger,
+	}
 }
 
+// MemberJoin adds or updates the member, owned by the local node.
 func (s *ClientWriteServer) MemberJoin(ctx context.Context, req *rpc.ClientMemberJoinRequest) (*rpc.ClientMemberJoinResponse, error) {
-	s.registry.OwnedMemberUpsert(req.Member, time.Now().UnixMilli())
+	s.metrics.ClientUpdatesInbound.Inc(map[string]string{
+		"type": "join",
+	})
+
+	if req.Member == nil || req.Member.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing member")
+	}
+
+	s.logger.Debug(
+		"member join",
+		zap.String("rpc", "ClientWriteServer.MemberJoin"),
+		zap.String("member-id", req.Member.Id),
+	)
+
+	s.registry.OwnedMemberUpsert(req.Member, s.clock.Now().UnixMilli())
 	return &rpc.ClientMemberJoinResponse{}, nil
 }
 
+// MemberLeave marks the member as left.
 func (s *ClientWriteServer) MemberLeave(ctx context.Context, req *rpc.ClientMemberLeaveRequest) (*rpc.ClientMemberLeaveResponse, error) {
-	s.registry.OwnedMemberLeave(req.MemberId, time.Now().UnixMilli())
+	s.metrics.ClientUpdatesInbound.Inc(map[string]string{
+		"type": "leave",
+	})
+
+	s.logger.Debug(
+		"member leave",
+		zap.String("rpc", "ClientWriteServer.MemberLeave"),
+		zap.String("member-id", req.MemberId),
+	)
+
+	s.registry.OwnedMemberLeave(req.MemberId, s.clock.Now().UnixMilli())
 	return &rpc.ClientMemberLeaveResponse{}, nil
 }
 
+// MemberHeartbeat records a heartbeat from the member.
+//
+// If the member isn't owned by this node, such as if it was marked down and
+// taken over by another node, returns a NotFound status so the client joins
+// again.
 func (s *ClientWriteServer) MemberHeartbeat(ctx context.Context, req *rpc.ClientMemberHeartbeatRequest) (*rpc.ClientMemberHeartbeatResponse, error) {
-	s.registry.OwnedMemberHeartbeat(req.MemberId, time.Now().UnixMilli())
-	return nil, nil
+	s.metrics.ClientUpdatesInbound.Inc(map[string]string{
+		"type": "heartbeat",
+	})
+
+	if err := s.registry.OwnedMemberHeartbeat(req.MemberId, s.clock.Now().UnixMilli()); err != nil {
+		if errors.Is(err, registry.ErrNotOwned) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &rpc.ClientMemberHeartbeatResponse{}, nil
 }
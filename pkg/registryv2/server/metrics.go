@@ -16,27 +16,27 @@ type Metrics struct {
 func NewMetrics() *Metrics {
 	return &Metrics{
 		ClientUpdatesInbound: metrics.NewCounter(
-			"registry",
+			"registryv2",
 			"client.updates.inbound",
-			[]string{},
+			[]string{"type"},
 			"Number of inbound updates received from a client",
 		),
 		ClientUpdatesOutbound: metrics.NewCounter(
-			"registry",
+			"registryv2",
 			"client.updates.outbound",
 			[]string{},
 			"Number of outbound updates sent to a client",
 		),
 
 		ReplicaUpdatesInbound: metrics.NewCounter(
-			"registry",
+			"registryv2",
 			"replica.updates.inbound",
 			[]string{"source"},
 			"Number of inbound updates received from replicas",
 		),
 
 		RepairUpdatesOutbound: metrics.NewCounter(
-			"registry",
+			"registryv2",
 			"repair.updates.outbound",
 			[]string{"target"},
 			"Number of outbound updates from replica repair",
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/fuddle-io/fuddle/pkg/clock"
+	"go.uber.org/zap"
+)
+
+type options struct {
+	subscriberQueueLimit int
+	clock                clock.Clock
+	logger               *zap.Logger
+}
+
+func defaultOptions() *options {
+	return &options{
+		subscriberQueueLimit: 1024,
+		clock:                clock.NewRealClock(),
+		logger:               zap.NewNop(),
+	}
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type subscriberQueueLimitOption struct {
+	limit int
+}
+
+func (o subscriberQueueLimitOption) apply(opts *options) {
+	opts.subscriberQueueLimit = o.limit
+}
+
+// WithSubscriberQueueLimit sets the maximum number of updates queued for each
+// client sync stream. If the queue is full the stream is closed, so the client
+// syncs again from its digest.
+func WithSubscriberQueueLimit(limit int) Option {
+	return subscriberQueueLimitOption{limit: limit}
+}
+
+type clockOption struct {
+	clock clock.Clock
+}
+
+func (o clockOption) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock used to timestamp member updates. Defaults to the
+// system clock.
+func WithClock(c clock.Clock) Option {
+	return clockOption{clock: c}
+}
+
+type loggerOption struct {
+	Log *zap.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.logger = o.Log
+}
+
+func WithLogger(log *zap.Logger) Option {
+	return loggerOption{Log: log}
+}
@@ -5,25 +5,79 @@ import (
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	"github.com/fuddle-io/fuddle/pkg/registryv2/registry"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
+// ReplicaServiceName is the gRPC service name of the v2 replica server.
+//
+// The v2 registry uses the same messages as the ReplicaRegistry2 service,
+// though the ReplicaRegistry2 service name is used by the v1 registry, so the
+// v2 registry serves the service under a different name so both registries
+// can run on the same server.
+const ReplicaServiceName = "registryv2.ReplicaRegistry2"
+
+// ReplicaServiceDesc is the gRPC service descriptor of the v2 replica server.
+var ReplicaServiceDesc = replicaServiceDesc()
+
+// RegisterReplicaServer registers the v2 replica server with the gRPC server.
+func RegisterReplicaServer(s grpc.ServiceRegistrar, srv *ReplicaServer) {
+	s.RegisterService(&ReplicaServiceDesc, srv)
+}
+
 type ReplicaServer struct {
 	registry *registry.Registry
 
+	metrics *Metrics
+	logger  *zap.Logger
+
 	rpc.UnimplementedReplicaRegistry2Server
 }
 
-func NewReplicaServer() *ReplicaServer {
-	return &ReplicaServer{}
+func NewReplicaServer(reg *registry.Registry, metrics *Metrics, opts ...Option) *ReplicaServer {
+	options := defaultOptions()
+	for _, o := range opts {
+		o.apply(options)
+	}
+
+	return &ReplicaServer{
+		registry: reg,
+		metrics:  metrics,
+		logger:   options.logger,
+	}
 }
 
 func (s *ReplicaServer) Update(ctx context.Context, req *rpc.UpdateRequest) (*rpc.UpdateResponse, error) {
+	s.metrics.ReplicaUpdatesInbound.Inc(map[string]string{
+		"source": req.SourceNodeId,
+	})
+
+	if req.Member == nil || req.Member.State == nil || req.Member.Version == nil {
+		s.logger.Warn(
+			"discarding invalid replica update",
+			zap.String("source", req.SourceNodeId),
+		)
+		return &rpc.UpdateResponse{}, nil
+	}
+
 	s.registry.RemoteUpsertMember(req.Member)
 	return &rpc.UpdateResponse{}, nil
 }
 
 func (s *ReplicaServer) Sync(ctx context.Context, req *rpc.ReplicaSyncRequest) (*rpc.ReplicaSyncResponse, error) {
+	members := s.registry.MembersDelta(req.Digest)
+
+	s.metrics.RepairUpdatesOutbound.Add(len(members), map[string]string{
+		"target": req.SourceNodeId,
+	})
+
 	return &rpc.ReplicaSyncResponse{
-		Members: s.registry.MembersDelta(req.Digest),
+		Members: members,
 	}, nil
 }
+
+func replicaServiceDesc() grpc.ServiceDesc {
+	desc := rpc.ReplicaRegistry2_ServiceDesc
+	desc.ServiceName = ReplicaServiceName
+	return desc
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReadyRegistrar returns a registrar for services that should only accept
+// RPCs once the node is ready, such as once it has bootstrapped its registry.
+//
+// Since gRPC doesn't support registering services once the server is serving,
+// the services are registered immediately though reject RPCs with an
+// Unavailable status until the server is set ready. Clients will then retry
+// with another node.
+func (s *Server) ReadyRegistrar() grpc.ServiceRegistrar {
+	return &readyRegistrar{server: s}
+}
+
+// SetReady sets whether the server is ready. Services registered with
+// ReadyRegistrar only accept RPCs while the server is ready, such as once the
+// node has bootstrapped and until the node starts draining.
+func (s *Server) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// Ready returns whether the server is ready.
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+func (s *Server) checkReady() error {
+	if !s.Ready() {
+		return status.Error(codes.Unavailable, "node not ready")
+	}
+	return nil
+}
+
+type readyRegistrar struct {
+	server *Server
+}
+
+// RegisterService registers the service with the gRPC server, wrapping each
+// method and stream handler to check the server is ready.
+func (r *readyRegistrar) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	gated := *desc
+
+	gated.Methods = make([]grpc.MethodDesc, 0, len(desc.Methods))
+	for _, m := range desc.Methods {
+		handler := m.Handler
+		gated.Methods = append(gated.Methods, grpc.MethodDesc{
+			MethodName: m.MethodName,
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				if err := r.server.checkReady(); err != nil {
+					return nil, err
+				}
+				return handler(srv, ctx, dec, interceptor)
+			},
+		})
+	}
+
+	gated.Streams = make([]grpc.StreamDesc, 0, len(desc.Streams))
+	for _, st := range desc.Streams {
+		handler := st.Handler
+		gated.Streams = append(gated.Streams, grpc.StreamDesc{
+			StreamName: st.StreamName,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				if err := r.server.checkReady(); err != nil {
+					return err
+				}
+				return handler(srv, stream)
+			},
+			ServerStreams: st.ServerStreams,
+			ClientStreams: st.ClientStreams,
+		})
+	}
+
+	r.server.grpcServer.RegisterService(&gated, impl)
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/fuddle-io/fuddle/pkg/config"
@@ -15,7 +16,12 @@ type Server struct {
 	conf       *config.Config
 	ln         *net.TCPListener
 	grpcServer *grpc.Server
-	logger     *zap.Logger
+
+	// ready is set once the node is ready to accept RPCs to services
+	// registered with ReadyRegistrar.
+	ready atomic.Bool
+
+	logger *zap.Logger
 }
 
 func NewServer(conf *config.Config, opts ...Option) *Server {
@@ -0,0 +1,14 @@
+// Package version describes the version of the running Fuddle node.
+package version
+
+// Version is the Fuddle build version, which is set when building a release
+// with:
+//
+//	go build -ldflags "-X github.com/fuddle-io/fuddle/pkg/version.Version=v0.1.0"
+var Version = "dev"
+
+// ProtocolVersion is the version of the protocol Fuddle nodes use to
+// communicate with one another, such as the replication protocol. It is
+// incremented whenever the protocol changes in a way that isn't compatible
+// with older nodes.
+const ProtocolVersion = 1
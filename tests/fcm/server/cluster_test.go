@@ -60,6 +60,8 @@ func TestFCMCluster_AddAndRemoveNodes(t *testing.T) {
 	require.NoError(t, err)
 	defer server.Shutdown()
 
+	// Add the nodes without changing their clocks.
+	var nodeClock client.NodeClock
 	client := client.NewClient(ln.Addr().String())
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
@@ -70,7 +72,7 @@ func TestFCMCluster_AddAndRemoveNodes(t *testing.T) {
 	assert.Equal(t, 3, len(clusterInfo.FuddleNodes))
 	assert.Equal(t, 10, len(clusterInfo.ClientNodes))
 
-	nodesInfo, err := client.AddNodes(ctx, clusterInfo.ID, 2, 5)
+	nodesInfo, err := client.AddNodes(ctx, clusterInfo.ID, 2, 5, nodeClock)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(nodesInfo.FuddleNodes))
 	assert.Equal(t, 5, len(nodesInfo.ClientNodes))
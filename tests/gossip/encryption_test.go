@@ -0,0 +1,100 @@
+//go:build all || integration
+
+package gossip
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	admin "github.com/fuddle-io/fuddle/pkg/admin/client"
+	"github.com/fuddle-io/fuddle/pkg/fcm/cluster"
+	"github.com/fuddle-io/fuddle/pkg/gossip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Creates a 3 node cluster with gossip encryption, then rotates the
+// encryption key across the cluster and checks the nodes stay healthy.
+func TestGossip_RotateEncryptionKey(t *testing.T) {
+	oldKey, err := gossip.GenerateKey()
+	require.NoError(t, err)
+	newKey, err := gossip.GenerateKey()
+	require.NoError(t, err)
+
+	c, err := cluster.NewCluster(
+		cluster.WithFuddleNodes(3),
+		cluster.WithGossipEncryptionKey(oldKey),
+	)
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, c.WaitForHealthy(ctx))
+
+	adminClient, err := admin.Connect(c.FuddleNodes()[0].Fuddle.Config.RPC.JoinAdvAddr())
+	require.NoError(t, err)
+	defer adminClient.Close()
+
+	assertKeys := func(primary string, keys ...string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		nodes, err := adminClient.ListKeys(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, len(nodes))
+		for id, k := range nodes {
+			assert.Equal(t, primary, k.Primary, id)
+			assert.ElementsMatch(t, keys, k.Keys, id)
+		}
+	}
+
+	assertKeys(oldKey, oldKey)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	require.NoError(t, adminClient.InstallKey(ctx, newKey))
+	assertKeys(oldKey, oldKey, newKey)
+
+	require.NoError(t, adminClient.UseKey(ctx, newKey))
+	assertKeys(newKey, oldKey, newKey)
+
+	require.NoError(t, adminClient.RemoveKey(ctx, oldKey))
+	assertKeys(newKey, newKey)
+
+	// The primary key can't be removed.
+	err = adminClient.RemoveKey(ctx, newKey)
+	assert.Equal(t, codes.InvalidArgument, status.Code(errors.Unwrap(err)))
+
+	// The nodes should still accept each others gossip with the new key.
+	require.NoError(t, c.WaitForHealthy(ctx))
+}
+
+// Tests managing the keyring of a cluster without gossip encryption fails.
+func TestGossip_EncryptionDisabled(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(3))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, c.WaitForHealthy(ctx))
+
+	adminClient, err := admin.Connect(c.FuddleNodes()[0].Fuddle.Config.RPC.JoinAdvAddr())
+	require.NoError(t, err)
+	defer adminClient.Close()
+
+	key, err := gossip.GenerateKey()
+	require.NoError(t, err)
+
+	err = adminClient.InstallKey(ctx, key)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(errors.Unwrap(err)))
+
+	_, err = adminClient.ListKeys(ctx)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(errors.Unwrap(err)))
+}
@@ -0,0 +1,171 @@
+//go:build all || integration
+
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/fuddle-io/fuddle/pkg/gossip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts a node whose seed hasn't started yet, then starts the seed and waits
+// for the first node to join it.
+func TestGossip_JoinRetry(t *testing.T) {
+	seedConf, seedLn := gossipConfig(t)
+	// Close the seeds listener until the seed starts, so connections to the
+	// seed are refused.
+	seedLn.Close()
+
+	conf, ln := gossipConfig(t)
+	conf.Gossip.Seeds = []string{gossipAddr(seedConf)}
+	conf.Gossip.JoinBackoff = time.Millisecond * 100
+	conf.Gossip.JoinBackoffMax = time.Millisecond * 100
+
+	// Starting the node should succeed even though the seed is unreachable.
+	g := startGossip(t, conf, ln)
+	defer g.Shutdown()
+
+	// Wait for the node to retry at least once.
+	time.Sleep(time.Millisecond * 200)
+
+	seed := startGossip(t, seedConf, nil)
+	defer seed.Shutdown()
+
+	waitForNodes(t, 2, g, seed)
+}
+
+// Starts two nodes with a seed file, then updates the file to add a third
+// node and waits for the nodes to join it.
+func TestGossip_JoinSeedFile(t *testing.T) {
+	seedFile := filepath.Join(t.TempDir(), "seeds")
+
+	var nodes []*gossip.Gossip
+	for i := 0; i != 2; i++ {
+		conf, ln := gossipConfig(t)
+		conf.Gossip.SeedFile = seedFile
+
+		if i == 0 {
+			require.NoError(t, os.WriteFile(seedFile, []byte(gossipAddr(conf)+"\n"), 0o644))
+		}
+
+		g := startGossip(t, conf, ln)
+		defer g.Shutdown()
+		nodes = append(nodes, g)
+	}
+	waitForNodes(t, 2, nodes...)
+
+	// Start a node that doesn't join the other nodes, then add it to the
+	// seed file.
+	conf, ln := gossipConfig(t)
+	g := startGossip(t, conf, ln)
+	defer g.Shutdown()
+	nodes = append(nodes, g)
+
+	require.NoError(t, os.WriteFile(seedFile, []byte(gossipAddr(conf)+"\n"), 0o644))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(seedFile, future, future))
+
+	waitForNodes(t, 3, nodes...)
+}
+
+// Starts two nodes where one persists its peers, then restarts that node
+// without any seeds and waits for it to rejoin the persisted peer.
+func TestGossip_RejoinPersistedPeers(t *testing.T) {
+	peersFile := filepath.Join(t.TempDir(), "peers")
+
+	seedConf, seedLn := gossipConfig(t)
+	seed := startGossip(t, seedConf, seedLn)
+	defer seed.Shutdown()
+
+	conf, ln := gossipConfig(t)
+	conf.Gossip.Seeds = []string{gossipAddr(seedConf)}
+	conf.Gossip.PeersFile = peersFile
+
+	g := startGossip(t, conf, ln)
+	waitForNodes(t, 2, g, seed)
+	g.Shutdown()
+
+	restartConf, restartLn := gossipConfig(t)
+	restartConf.Gossip.PeersFile = peersFile
+
+	g = startGossip(t, restartConf, restartLn)
+	defer g.Shutdown()
+
+	waitForNodes(t, 2, g, seed)
+}
+
+func gossipConfig(t *testing.T) (*config.Config, *net.TCPListener) {
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+
+	conf := config.DefaultConfig()
+	conf.Gossip.BindAddr = "127.0.0.1"
+	conf.Gossip.AdvAddr = "127.0.0.1"
+	conf.Gossip.BindPort = ln.Addr().(*net.TCPAddr).Port
+	conf.Gossip.AdvPort = ln.Addr().(*net.TCPAddr).Port
+	return conf, ln
+}
+
+func gossipAddr(conf *config.Config) string {
+	return fmt.Sprintf("%s:%d", conf.Gossip.AdvAddr, conf.Gossip.AdvPort)
+}
+
+// startGossip starts a gossip node with the given TCP listener, or if the
+// listener is nil, listens on the configured port.
+func startGossip(t *testing.T, conf *config.Config, ln *net.TCPListener) *gossip.Gossip {
+	if ln == nil {
+		var err error
+		ln, err = net.ListenTCP("tcp", &net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: conf.Gossip.BindPort,
+		})
+		require.NoError(t, err)
+	}
+
+	udpLn, err := net.ListenUDP("udp", &net.UDPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: conf.Gossip.BindPort,
+	})
+	require.NoError(t, err)
+
+	g, err := gossip.NewGossip(
+		conf,
+		gossip.WithTCPListener(ln),
+		gossip.WithUDPListener(udpLn),
+	)
+	require.NoError(t, err)
+	return g
+}
+
+func waitForNodes(t *testing.T, count int, nodes ...*gossip.Gossip) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for {
+		discovered := true
+		for _, g := range nodes {
+			if len(g.Nodes()) != count {
+				discovered = false
+			}
+		}
+		if discovered {
+			return
+		}
+
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			assert.Fail(t, "nodes not discovered")
+			return
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build all || integration
+
+package gossip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	admin "github.com/fuddle-io/fuddle/pkg/admin/client"
+	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/fuddle-io/fuddle/pkg/fcm/cluster"
+	"github.com/fuddle-io/fuddle/pkg/gossip"
+	"github.com/fuddle-io/fuddle/pkg/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates a cluster with a full and cache node, and checks the node metadata
+// gossiped by each node is listed.
+func TestGossip_ListNodes(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(2))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	_, err = c.AddFuddleNode(cluster.WithNodeMode(config.ModeCache))
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, c.WaitForHealthy(ctx))
+
+	adminClient, err := admin.Connect(c.FuddleNodes()[0].Fuddle.Config.RPC.JoinAdvAddr())
+	require.NoError(t, err)
+	defer adminClient.Close()
+
+	nodes, err := adminClient.Nodes(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, len(nodes))
+	for _, n := range c.FuddleNodes() {
+		conf := n.Fuddle.Config
+		assert.Equal(t, gossip.Node{
+			ID:              conf.NodeID,
+			RPCAddr:         conf.RPC.JoinAdvAddr(),
+			AdminAddr:       conf.Admin.JoinAdvAddr(),
+			Mode:            conf.Mode,
+			Version:         version.Version,
+			ProtocolVersion: version.ProtocolVersion,
+		}, nodes[conf.NodeID])
+	}
+}
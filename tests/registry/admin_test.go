@@ -67,7 +67,7 @@ func TestAdmin_ListMembers(t *testing.T) {
 	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
 	defer cancel()
 
-	members, err := adminClient.Members(ctx)
+	members, err := adminClient.Members(ctx, "", "")
 	assert.NoError(t, err)
 
 	var sdkMembers []fuddle.Member
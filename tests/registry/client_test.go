@@ -4,15 +4,21 @@ package registry
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	rpc "github.com/fuddle-io/fuddle-rpc/go"
 	"github.com/fuddle-io/fuddle/pkg/fcm/cluster"
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestClient_Register(t *testing.T) {
@@ -46,7 +52,8 @@ func TestClient_Register(t *testing.T) {
 	err = stream.Send(&rpc.ClientUpdate{
 		UpdateType: rpc.ClientUpdateType_CLIENT_REGISTER,
 		Member: &rpc.MemberState{
-			Id: "member-1",
+			Id:      "member-1",
+			Service: "foo",
 		},
 		SeqId: 1,
 	})
@@ -63,3 +70,213 @@ func TestClient_Register(t *testing.T) {
 		}
 	}
 }
+
+// Tests registering a member with an invalid state is rejected.
+func TestClient_RegisterInvalidMember(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(1))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, c.WaitForHealthy(ctx))
+
+	node := c.FuddleNodes()[0]
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		node.Fuddle.Config.RPC.JoinAdvAddr(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.Nil(t, err)
+	client := rpc.NewClientWriteRegistryClient(conn)
+
+	stream, err := client.Register(context.Background())
+	require.Nil(t, err)
+
+	err = stream.Send(&rpc.ClientUpdate{
+		UpdateType: rpc.ClientUpdateType_CLIENT_REGISTER,
+		// Only members federated from a remote cluster may have the
+		// cluster metadata key.
+		Member: &rpc.MemberState{
+			Id:      "invalid-member",
+			Service: "foo",
+			Metadata: map[string]string{
+				registry.ClusterMetadataKey: "remote",
+			},
+		},
+		SeqId: 1,
+	})
+	require.Nil(t, err)
+
+	err = stream.RecvMsg(&rpc.ClientAck{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, ok := node.Fuddle.Registry().Member("invalid-member")
+	assert.False(t, ok)
+}
+
+// Tests registering a member into the namespace given in the stream metadata.
+func TestClient_RegisterWithNamespace(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(1))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, c.WaitForHealthy(ctx))
+
+	node := c.FuddleNodes()[0]
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		node.Fuddle.Config.RPC.JoinAdvAddr(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.Nil(t, err)
+	client := rpc.NewClientWriteRegistryClient(conn)
+
+	updatesCh := make(chan *rpc.Member2, 10)
+	node.Fuddle.Registry().Subscribe(nil, func(update *rpc.Member2) {
+		updatesCh <- update
+	}, registry.WithNamespace("staging"))
+
+	stream, err := client.Register(metadata.AppendToOutgoingContext(
+		context.Background(), server.NamespaceMetadataKey, "staging",
+	))
+	require.Nil(t, err)
+
+	err = stream.Send(&rpc.ClientUpdate{
+		UpdateType: rpc.ClientUpdateType_CLIENT_REGISTER,
+		Member: &rpc.MemberState{
+			Id:      "member-1",
+			Service: "foo",
+		},
+		SeqId: 1,
+	})
+	require.Nil(t, err)
+
+	select {
+	case u := <-updatesCh:
+		assert.Equal(t, "member-1", u.State.Id)
+		assert.Equal(t, "staging", registry.MemberNamespace(u.State))
+	case <-time.After(time.Second):
+		t.Error("timeout")
+	}
+}
+
+// Tests a member that restarts with the same ID may register as starting on a
+// new stream while its previous registration is still terminating.
+func TestClient_RegisterRestartedMember(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(1))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, c.WaitForHealthy(ctx))
+
+	node := c.FuddleNodes()[0]
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		node.Fuddle.Config.RPC.JoinAdvAddr(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.Nil(t, err)
+	defer conn.Close()
+	client := rpc.NewClientWriteRegistryClient(conn)
+
+	updatesCh := make(chan *rpc.Member2, 10)
+	node.Fuddle.Registry().Subscribe(nil, func(update *rpc.Member2) {
+		if update.State.Id == "member-1" {
+			updatesCh <- update
+		}
+	})
+
+	for _, status := range []string{registry.StatusTerminating, registry.StatusStarting} {
+		stream, err := client.Register(context.Background())
+		require.Nil(t, err)
+
+		err = stream.Send(&rpc.ClientUpdate{
+			UpdateType: rpc.ClientUpdateType_CLIENT_REGISTER,
+			Member: &rpc.MemberState{
+				Id:      "member-1",
+				Service: "foo",
+				Status:  status,
+			},
+			SeqId: 1,
+		})
+		require.Nil(t, err)
+
+		select {
+		case u := <-updatesCh:
+			assert.Equal(t, status, u.State.Status)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+// Tests when a node shuts down, it closes client streams with the address of
+// another node to reconnect to.
+func TestClient_DrainOnShutdown(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(2))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, c.WaitForHealthy(ctx))
+
+	// Open a stream to each node, since we don't know which node will be
+	// removed.
+	streams := make(map[string]rpc.ClientWriteRegistry_RegisterClient)
+	addrs := make(map[string]string)
+	for i, node := range c.FuddleNodes() {
+		conn, err := grpc.DialContext(
+			context.Background(),
+			node.Fuddle.Config.RPC.JoinAdvAddr(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		require.Nil(t, err)
+		defer conn.Close()
+
+		stream, err := rpc.NewClientWriteRegistryClient(conn).Register(context.Background())
+		require.Nil(t, err)
+		require.Nil(t, stream.Send(&rpc.ClientUpdate{
+			UpdateType: rpc.ClientUpdateType_CLIENT_REGISTER,
+			Member: &rpc.MemberState{
+				Id:      fmt.Sprintf("member-%d", i),
+				Service: "foo",
+			},
+			SeqId: 1,
+		}))
+
+		streams[node.Fuddle.Config.NodeID] = stream
+		addrs[node.Fuddle.Config.NodeID] = node.Fuddle.Config.RPC.JoinAdvAddr()
+	}
+
+	// Wait for the members to be registered.
+	for _, node := range c.FuddleNodes() {
+		assert.Eventually(t, func() bool {
+			_, ok0 := node.Fuddle.Registry().Member("member-0")
+			_, ok1 := node.Fuddle.Registry().Member("member-1")
+			return ok0 && ok1
+		}, time.Second*5, time.Millisecond*10)
+	}
+
+	removed := c.RemoveFuddleNode()
+
+	stream := streams[removed]
+	err = stream.RecvMsg(&rpc.ClientAck{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	var remaining string
+	for id, addr := range addrs {
+		if id != removed {
+			remaining = addr
+		}
+	}
+	assert.Equal(t, []string{remaining}, stream.Trailer().Get(server.ReconnectMetadataKey))
+}
@@ -0,0 +1,95 @@
+//go:build all || integration
+
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/config"
+	"github.com/fuddle-io/fuddle/pkg/fcm/cluster"
+	"github.com/fuddle-io/fuddle/pkg/registry/registry"
+	"github.com/fuddle-io/fuddle/pkg/registry/server"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Tests members registered with a remote cluster are federated to every node
+// in the local cluster through the gateway node, and are only visible to
+// clients that opt in.
+func TestFederation(t *testing.T) {
+	remote, err := cluster.NewCluster(cluster.WithFuddleNodes(2))
+	require.Nil(t, err)
+	defer remote.Shutdown()
+
+	local, err := cluster.NewCluster(cluster.WithFuddleNodes(2))
+	require.Nil(t, err)
+	defer local.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, remote.WaitForHealthy(ctx))
+	assert.NoError(t, local.WaitForHealthy(ctx))
+
+	gateway, err := local.AddFuddleNode(cluster.WithNodeFederation(config.FederatedCluster{
+		Name:  "remote",
+		Addrs: remote.RPCAddrs(),
+	}))
+	require.Nil(t, err)
+	assert.NoError(t, local.WaitForHealthy(ctx))
+
+	remoteNode := remote.FuddleNodes()[0]
+	require.NoError(t, remoteNode.Fuddle.Registry().AddMember(
+		testutils.RandomMemberState("remote-member", "foo"),
+	))
+
+	for _, n := range local.FuddleNodes() {
+		assert.Eventually(t, func() bool {
+			m, ok := n.Fuddle.Registry().Member("remote-member")
+			return ok && registry.MemberCluster(m.State) == "remote"
+		}, time.Second*5, time.Millisecond*10)
+	}
+
+	// The remote clusters own Fuddle node members should also be federated,
+	// but not members federated from the local cluster back again.
+	_, ok := gateway.Fuddle.Registry().Member(remoteNode.Fuddle.Config.NodeID)
+	assert.True(t, ok)
+
+	// The federated member should be read-only in the local cluster.
+	err = gateway.Fuddle.Registry().AddMember(testutils.RandomMemberState("remote-member", "foo"))
+	assert.ErrorIs(t, err, registry.ErrFederatedMember)
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		gateway.Fuddle.Config.RPC.JoinAdvAddr(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.Nil(t, err)
+	defer conn.Close()
+	client := rpc.NewClientReadRegistryClient(conn)
+
+	// By default clients should only see members of the local cluster.
+	resp, err := client.Members(context.Background(), &rpc.MembersRequest{})
+	require.Nil(t, err)
+	for _, m := range resp.Members {
+		assert.False(t, registry.IsFederated(m.State))
+	}
+
+	resp, err = client.Members(metadata.AppendToOutgoingContext(
+		context.Background(), server.IncludeRemoteMetadataKey, "true",
+	), &rpc.MembersRequest{})
+	require.Nil(t, err)
+	found := false
+	for _, m := range resp.Members {
+		if m.State.Id == "remote-member" {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
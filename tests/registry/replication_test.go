@@ -4,12 +4,22 @@ package registry
 
 import (
 	"context"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	rpc "github.com/fuddle-io/fuddle-rpc/go"
+	"github.com/fuddle-io/fuddle/pkg/clock"
+	"github.com/fuddle-io/fuddle/pkg/config"
 	"github.com/fuddle-io/fuddle/pkg/fcm/cluster"
+	"github.com/fuddle-io/fuddle/pkg/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 func TestReplication(t *testing.T) {
@@ -23,3 +33,165 @@ func TestReplication(t *testing.T) {
 	// Waits for registries to discover one another.
 	assert.NoError(t, c.WaitForHealthy(ctx))
 }
+
+// Tests a node whose clock is ahead of the rest of the cluster (within the max
+// clock drift) still replicates its members.
+func TestReplication_NodeClockOffset(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(2))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	skewed, err := c.AddFuddleNode(cluster.WithNodeClock(
+		clock.NewOffsetClock(clock.NewRealClock(), time.Second*30),
+	))
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, c.WaitForHealthy(ctx))
+
+	skewed.Fuddle.Registry().AddMember(testutils.RandomMemberState("member-1", "foo"))
+
+	local, ok := skewed.Fuddle.Registry().Member("member-1")
+	require.True(t, ok)
+	assert.Greater(t, local.Version.Timestamp.Timestamp, time.Now().Add(time.Second*20).UnixMilli())
+
+	for _, n := range c.FuddleNodes() {
+		assert.Eventually(t, func() bool {
+			_, ok := n.Fuddle.Registry().Member("member-1")
+			return ok
+		}, time.Second*5, time.Millisecond*10)
+	}
+}
+
+// Tests a node joining the cluster syncs the registry before it accepts
+// client traffic.
+func TestReplication_BootstrapSync(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(2))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	// Add members owned by a node outside the cluster, so the existing nodes
+	// don't forward them to the new node when it joins.
+	existing := c.FuddleNodes()[0]
+	for i := 0; i != 500; i++ {
+		existing.Fuddle.Registry().RemoteUpdate(&rpc.Member2{
+			State:    testutils.RandomMemberState(fmt.Sprintf("member-%d", i), "foo"),
+			Liveness: rpc.Liveness_UP,
+			Version: &rpc.Version2{
+				OwnerId: "remote",
+				Timestamp: &rpc.MonotonicTimestamp{
+					Timestamp: time.Now().UnixMilli(),
+				},
+			},
+		})
+	}
+
+	node, err := c.AddFuddleNode()
+	require.Nil(t, err)
+
+	// The node should have the full registry as soon as it starts.
+	for i := 0; i != 500; i++ {
+		_, ok := node.Fuddle.Registry().Member(fmt.Sprintf("member-%d", i))
+		assert.True(t, ok)
+	}
+}
+
+// Tests a node shutting down gracefully hands off ownership of its members to
+// the other nodes, without the members being marked down.
+func TestReplication_HandoffOnShutdown(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(3))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, c.WaitForHealthy(ctx))
+
+	// Add members owned by each node.
+	for _, n := range c.FuddleNodes() {
+		for i := 0; i != 10; i++ {
+			n.Fuddle.Registry().AddMember(testutils.RandomMemberState(
+				fmt.Sprintf("%s-member-%d", n.Fuddle.Config.NodeID, i), "foo",
+			))
+		}
+	}
+	for _, n := range c.FuddleNodes() {
+		assert.Eventually(t, func() bool {
+			// Includes the Fuddle node members.
+			return len(n.Fuddle.Registry().Members()) == 33
+		}, time.Second*5, time.Millisecond*10)
+	}
+
+	// Record any updates that change the members liveness.
+	var livenessUpdates int64
+	for _, n := range c.FuddleNodes() {
+		unsubscribe := n.Fuddle.Registry().Subscribe(
+			&rpc.SubscribeRequest{},
+			func(update *rpc.Member2) {
+				if update.Liveness != rpc.Liveness_UP && update.State.Service != "fuddle" {
+					atomic.AddInt64(&livenessUpdates, 1)
+				}
+			},
+		)
+		defer unsubscribe()
+	}
+
+	removed := c.RemoveFuddleNode()
+
+	for _, n := range c.FuddleNodes() {
+		for i := 0; i != 10; i++ {
+			m, ok := n.Fuddle.Registry().Member(fmt.Sprintf("%s-member-%d", removed, i))
+			require.True(t, ok)
+			assert.Equal(t, rpc.Liveness_UP, m.Liveness)
+			assert.NotEqual(t, removed, m.Version.OwnerId)
+		}
+	}
+	assert.Equal(t, int64(0), atomic.LoadInt64(&livenessUpdates))
+}
+
+// Tests a cache node receives the members owned by the full nodes, but never
+// accepts registrations or owns members.
+func TestReplication_CacheNode(t *testing.T) {
+	c, err := cluster.NewCluster(cluster.WithFuddleNodes(2))
+	require.Nil(t, err)
+	defer c.Shutdown()
+
+	cache, err := c.AddFuddleNode(cluster.WithNodeMode(config.ModeCache))
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	assert.NoError(t, c.WaitForHealthy(ctx))
+
+	for _, n := range c.FuddleNodes() {
+		if n == cache {
+			continue
+		}
+		for i := 0; i != 10; i++ {
+			n.Fuddle.Registry().AddMember(testutils.RandomMemberState(
+				fmt.Sprintf("%s-member-%d", n.Fuddle.Config.NodeID, i), "foo",
+			))
+		}
+	}
+	assert.Eventually(t, func() bool {
+		// Includes the Fuddle node members.
+		return len(cache.Fuddle.Registry().Members()) == 23
+	}, time.Second*5, time.Millisecond*10)
+
+	// The cache node should only own its own local member.
+	assert.Equal(t, 1, len(cache.Fuddle.Registry().OwnedMembers()))
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		cache.Fuddle.Config.RPC.JoinAdvAddr(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	stream, err := rpc.NewClientWriteRegistryClient(conn).Register(context.Background())
+	require.Nil(t, err)
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}